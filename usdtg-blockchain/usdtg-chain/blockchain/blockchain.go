@@ -1,13 +1,20 @@
 package blockchain
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
+
+	"usdtg-chain/evm"
 )
 
 // Block represents a single block in the blockchain
@@ -19,6 +26,14 @@ type Block struct {
 	Hash         string        `json:"hash"`
 	Nonce        int           `json:"nonce"`
 	Difficulty   int           `json:"difficulty"`
+	TxRoot       string        `json:"tx_root"`
+	StateRoot    string        `json:"state_root"`
+	Pruned       bool          `json:"pruned,omitempty"`
+
+	// EVM commits to the block's EVM transactions and their outcome.
+	// Blocks mined before EVM transactions were bundled have none.
+	EVM             *evm.Header           `json:"evm,omitempty"`
+	EVMTransactions []*evm.EVMTransaction `json:"evm_transactions,omitempty"`
 }
 
 // Transaction represents a single transaction
@@ -37,48 +52,146 @@ type Blockchain struct {
 	PendingTx    []Transaction `json:"pending_tx"`
 	Difficulty   int           `json:"difficulty"`
 	MiningReward float64       `json:"mining_reward"`
+	pruning      PruningConfig
+	prunedUpTo   int
+	balances     map[string]map[string]float64
+	store        Store
+	dirtyBlocks  []int
+	dirtyState   map[string]struct{}
+	evm          *evm.EVM
+	faucet       bool
+	pendingEVM   []*evm.EVMTransaction
 	mu           sync.RWMutex
 }
 
+// GenesisTimestamp is the fixed timestamp of the genesis block, so that
+// every node starting from scratch derives the same genesis hash
+var GenesisTimestamp = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Config holds the options used to construct a blockchain
+type Config struct {
+	Pruning PruningConfig `json:"pruning"`
+	Storage StorageConfig `json:"storage"`
+	// EVM executes the EVM transactions of blocks and holds the USDTg
+	// balances; a fresh one is created when nil
+	EVM *evm.EVM `json:"-"`
+	// Faucet accepts native transactions from FaucetAddress, which mint
+	// USDTg. It is meant for dev chains only.
+	Faucet bool `json:"-"`
+}
+
+// DefaultConfig returns the configuration used by NewBlockchain
+func DefaultConfig() Config {
+	return Config{
+		Pruning: PruningConfig{Mode: PruningArchive},
+		Storage: StorageConfig{Backend: StorageMemory},
+	}
+}
+
 // NewBlockchain creates a new blockchain
 func NewBlockchain() *Blockchain {
-	bc := &Blockchain{
-		Difficulty:   0, // INSTANT mining - difficulty 0
-		MiningReward: 100.0,
+	bc, _ := NewBlockchainWithConfig(DefaultConfig())
+	return bc
+}
+
+// NewBlockchainWithConfig creates a new blockchain with the given
+// configuration. An existing chain in the configured store is loaded,
+// otherwise a genesis block is created.
+func NewBlockchainWithConfig(cfg Config) (*Blockchain, error) {
+	bc, err := newBlockchain(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded, err := bc.load()
+	if err != nil {
+		bc.store.Close()
+		return nil, err
 	}
 
 	// Create genesis block
-	bc.CreateGenesisBlock()
-	return bc
+	if !loaded {
+		bc.CreateGenesisBlock()
+	}
+
+	bc.prune()
+	if err := bc.persist(); err != nil {
+		bc.store.Close()
+		return nil, err
+	}
+	return bc, nil
+}
+
+// newBlockchain creates an empty blockchain backed by the configured store
+func newBlockchain(cfg Config) (*Blockchain, error) {
+	if err := cfg.Pruning.Validate(); err != nil {
+		return nil, err
+	}
+
+	store, err := OpenStore(cfg.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	machine := cfg.EVM
+	if machine == nil {
+		machine = evm.NewEVM()
+	}
+
+	return &Blockchain{
+		Difficulty:   0, // INSTANT mining - difficulty 0
+		MiningReward: 100.0,
+		pruning:      cfg.Pruning,
+		balances:     make(map[string]map[string]float64),
+		store:        store,
+		dirtyState:   make(map[string]struct{}),
+		evm:          machine,
+		faucet:       cfg.Faucet,
+	}, nil
+}
+
+// Close releases the underlying store
+func (bc *Blockchain) Close() error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.store.Close()
 }
 
 // CreateGenesisBlock creates the first block
 func (bc *Blockchain) CreateGenesisBlock() {
 	genesisBlock := Block{
 		Index:        0,
-		Timestamp:    time.Now(),
+		Timestamp:    GenesisTimestamp,
 		Transactions: []Transaction{},
 		PrevHash:     "0",
 		Difficulty:   bc.Difficulty,
 	}
 
+	genesisBlock.TxRoot = bc.CalculateTxRoot(genesisBlock.Transactions)
+	genesisBlock.StateRoot = bc.stateRoot()
 	genesisBlock.Hash = bc.CalculateHash(genesisBlock)
-	bc.Chain = append(bc.Chain, genesisBlock)
+	bc.appendBlock(genesisBlock)
 }
 
 // GetLatestBlock returns the most recent block
 func (bc *Blockchain) GetLatestBlock() Block {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
+	return bc.latestBlock()
+}
 
+// latestBlock returns the most recent block. The caller must hold the
+// lock.
+func (bc *Blockchain) latestBlock() Block {
 	if len(bc.Chain) == 0 {
 		return Block{}
 	}
 	return bc.Chain[len(bc.Chain)-1]
 }
 
-// AddTransaction adds a new transaction to pending transactions
-func (bc *Blockchain) AddTransaction(from, to string, amount float64, token string) {
+// AddTransaction adds a new transaction to pending transactions. USDTg
+// transactions must be transfers their sender can pay, see NativeToken.
+func (bc *Blockchain) AddTransaction(from, to string, amount float64, token string) (Transaction, error) {
 	tx := Transaction{
 		From:      from,
 		To:        to,
@@ -88,30 +201,124 @@ func (bc *Blockchain) AddTransaction(from, to string, amount float64, token stri
 	}
 
 	tx.Hash = bc.CalculateTransactionHash(tx)
+	if err := bc.checkNativeTransaction(tx); err != nil {
+		return Transaction{}, err
+	}
 
 	bc.mu.Lock()
 	bc.PendingTx = append(bc.PendingTx, tx)
 	bc.mu.Unlock()
+
+	return tx, nil
 }
 
-// MinePendingTransactions mines a new block with pending transactions
-func (bc *Blockchain) MinePendingTransactions(minerAddress string) Block {
-	// Get latest block (no mutex for simplicity)
-	latestBlock := bc.GetLatestBlock()
-	
-	// Simple lock for pending transactions
+// SubmitTransaction adds an already signed-off transaction, such as one
+// received from a peer, to pending transactions. It returns false when the
+// transaction is already pending.
+func (bc *Blockchain) SubmitTransaction(tx Transaction) (bool, error) {
+	if tx.Hash != bc.CalculateTransactionHash(tx) {
+		return false, fmt.Errorf("invalid transaction hash %s", tx.Hash)
+	}
+	if tx.Amount <= 0 || tx.From == "" || tx.To == "" {
+		return false, fmt.Errorf("invalid transaction data")
+	}
+	if err := bc.checkNativeTransaction(tx); err != nil {
+		return false, err
+	}
+
 	bc.mu.Lock()
-	pendingTx := make([]Transaction, len(bc.PendingTx))
-	copy(pendingTx, bc.PendingTx)
-	bc.PendingTx = []Transaction{} // Clear immediately
-	bc.mu.Unlock()
+	defer bc.mu.Unlock()
+
+	for _, pending := range bc.PendingTx {
+		if pending.Hash == tx.Hash {
+			return false, nil
+		}
+	}
+	bc.PendingTx = append(bc.PendingTx, tx)
+	return true, nil
+}
+
+// SubmitEVMTransaction adds an EVM transaction to the mempool once the EVM
+// accepts it, see evm.EVM.CheckTransaction. Pending EVM transactions are
+// executed in submission order when the next block is mined. It returns
+// false when the transaction is already pending.
+func (bc *Blockchain) SubmitEVMTransaction(tx *evm.EVMTransaction) (bool, error) {
+	if err := bc.evm.CheckTransaction(tx); err != nil {
+		return false, err
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	for _, pending := range bc.pendingEVM {
+		if pending.Hash == tx.Hash {
+			return false, nil
+		}
+	}
+	bc.pendingEVM = append(bc.pendingEVM, tx)
+	return true, nil
+}
+
+// PendingEVMTransactions returns the EVM transactions waiting for a block
+func (bc *Blockchain) PendingEVMTransactions() []*evm.EVMTransaction {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return append([]*evm.EVMTransaction(nil), bc.pendingEVM...)
+}
+
+// PendingNonce returns the next nonce of an EVM account, counting its
+// pending transactions
+func (bc *Blockchain) PendingNonce(address evm.Address) uint64 {
+	nonce := bc.evm.GetNonce(address)
+
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	for _, tx := range bc.pendingEVM {
+		if tx.From == address && tx.Nonce >= nonce {
+			nonce = tx.Nonce + 1
+		}
+	}
+	return nonce
+}
+
+// GenesisHash returns the hash of the genesis block
+func (bc *Blockchain) GenesisHash() string {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.Chain[0].Hash
+}
+
+// Height returns the index of the latest block
+func (bc *Blockchain) Height() int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return len(bc.Chain) - 1
+}
+
+// MinePendingTransactions mines a new block with pending transactions.
+// USDTg transactions the sender cannot pay are dropped. Pending EVM
+// transactions are executed in order; those that cannot run yet stay
+// pending, see evm.EVM.BuildBlock. The reward is paid in USDTg, so the
+// miner address must be an EVM address.
+func (bc *Blockchain) MinePendingTransactions(minerAddress string) (Block, error) {
+	if _, err := evm.ParseAddress(minerAddress); err != nil {
+		return Block{}, fmt.Errorf("miner address: %w", err)
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	latestBlock := bc.Chain[len(bc.Chain)-1]
+	pendingTx := bc.PendingTx
+	bc.PendingTx = []Transaction{}
 
 	// Create mining reward transaction
 	rewardTx := Transaction{
-		From:      "system",
+		From:      rewardSender,
 		To:        minerAddress,
 		Amount:    bc.MiningReward,
-		Token:     "USDTg",
+		Token:     NativeToken,
 		Timestamp: time.Now(),
 	}
 	rewardTx.Hash = bc.CalculateTransactionHash(rewardTx)
@@ -120,35 +327,226 @@ func (bc *Blockchain) MinePendingTransactions(minerAddress string) Block {
 	newBlock := Block{
 		Index:        latestBlock.Index + 1,
 		Timestamp:    time.Now(),
-		Transactions: append(pendingTx, rewardTx),
+		Transactions: []Transaction{},
 		PrevHash:     latestBlock.Hash,
 		Difficulty:   0, // PoS - mining yok
 		Nonce:        0, // PoS - nonce yok
 	}
 
+	// USDTg transactions move EVM balances ahead of the EVM transactions
+	candidates := append(pendingTx, rewardTx)
+	var transfers []evm.Transfer
+	var transferTxs []int
+	dropped := make(map[int]bool)
+	for i, tx := range candidates {
+		if tx.Token != NativeToken {
+			continue
+		}
+		transfer, err := bc.nativeTransfer(tx, i == len(candidates)-1)
+		if err != nil {
+			dropped[i] = true
+			continue
+		}
+		transfers = append(transfers, transfer)
+		transferTxs = append(transferTxs, i)
+	}
+
+	rejected, included, stale, header := bc.evm.BuildBlock(uint64(newBlock.Index), uint64(newBlock.Timestamp.Unix()), transfers, bc.pendingEVM)
+	for _, i := range rejected {
+		dropped[transferTxs[i]] = true
+	}
+	for i, tx := range candidates {
+		if dropped[i] {
+			log.Printf("blockchain: dropping transaction %s from %s: cannot be paid", tx.Hash, tx.From)
+			continue
+		}
+		newBlock.Transactions = append(newBlock.Transactions, tx)
+	}
+	newBlock.TxRoot = bc.CalculateTxRoot(newBlock.Transactions)
+	newBlock.EVM = header
+	newBlock.EVMTransactions = included
+	bc.removePendingEVM(append(included, stale...))
+
+	bc.applyTransactions(newBlock.Transactions)
+	newBlock.StateRoot = bc.stateRoot()
+
 	// INSTANT block creation - NO MINING
 	newBlock.Hash = bc.CalculateHash(newBlock)
+	bc.appendBlock(newBlock)
+	bc.prune()
+	if err := bc.persist(); err != nil {
+		log.Printf("blockchain: persisting block %d: %v", newBlock.Index, err)
+	}
 
-	// Add to chain (with mutex)
-	bc.mu.Lock()
-	bc.Chain = append(bc.Chain, newBlock)
-	bc.mu.Unlock()
-
-	return newBlock
+	return newBlock, nil
 }
 
 // MineBlock - PoS için kullanılmıyor
 func (bc *Blockchain) MineBlock(block Block) Block {
 	// PoS - mining yok, sadece hash hesapla
+	block.TxRoot = bc.CalculateTxRoot(block.Transactions)
 	block.Hash = bc.CalculateHash(block)
 	return block
 }
 
-// CalculateHash calculates the hash of a block
+// AddBlock validates a block against the current head and appends it
+func (bc *Blockchain) AddBlock(block Block) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if err := bc.applyBlock(block); err != nil {
+		return err
+	}
+	bc.prune()
+	return bc.persist()
+}
+
+// applyBlock validates a full block on top of the current head, applies its
+// transactions and appends it. The caller must hold the write lock.
+func (bc *Blockchain) applyBlock(block Block) error {
+	head := bc.Chain[len(bc.Chain)-1]
+	if block.Index != head.Index+1 {
+		return fmt.Errorf("block %d: expected index %d", block.Index, head.Index+1)
+	}
+	if block.PrevHash != head.Hash {
+		return fmt.Errorf("block %d: prev_hash does not match head", block.Index)
+	}
+	if err := bc.validateBody(block); err != nil {
+		return err
+	}
+
+	balances := bc.balances
+	bc.balances = copyBalances(balances)
+	bc.applyTransactions(block.Transactions)
+	if root := bc.stateRoot(); root != block.StateRoot {
+		bc.balances = balances
+		return fmt.Errorf("block %d: state root mismatch", block.Index)
+	}
+	if err := bc.applyEVM(block); err != nil {
+		bc.balances = balances
+		return err
+	}
+
+	bc.appendBlock(block)
+	bc.removePending(block.Transactions)
+	bc.removePendingEVM(block.EVMTransactions)
+	return nil
+}
+
+// applyEVM executes the USDTg transfers and EVM transactions of a block
+// and checks them against its EVM header. The caller must hold the write
+// lock.
+func (bc *Blockchain) applyEVM(block Block) error {
+	transfers, err := bc.blockTransfers(block)
+	if err != nil {
+		return err
+	}
+	if block.EVM == nil {
+		if len(block.EVMTransactions) > 0 || len(transfers) > 0 {
+			return fmt.Errorf("block %d: %s or EVM transactions without an EVM header", block.Index, NativeToken)
+		}
+		bc.evm.SetBlockNumber(uint64(block.Index))
+		return nil
+	}
+	if err := bc.evm.ApplyBlock(uint64(block.Index), uint64(block.Timestamp.Unix()), transfers, block.EVMTransactions, block.EVM); err != nil {
+		return fmt.Errorf("block %d: EVM: %w", block.Index, err)
+	}
+	return nil
+}
+
+// removePending drops pending transactions included in a block. The caller
+// must hold the write lock.
+func (bc *Blockchain) removePending(included []Transaction) {
+	if len(bc.PendingTx) == 0 {
+		return
+	}
+
+	hashes := make(map[string]struct{}, len(included))
+	for _, tx := range included {
+		hashes[tx.Hash] = struct{}{}
+	}
+
+	pending := bc.PendingTx[:0]
+	for _, tx := range bc.PendingTx {
+		if _, ok := hashes[tx.Hash]; !ok {
+			pending = append(pending, tx)
+		}
+	}
+	bc.PendingTx = pending
+}
+
+// removePendingEVM drops pending EVM transactions that were included in a
+// block or can no longer be. The caller must hold the write lock.
+func (bc *Blockchain) removePendingEVM(done []*evm.EVMTransaction) {
+	if len(bc.pendingEVM) == 0 || len(done) == 0 {
+		return
+	}
+
+	hashes := make(map[evm.Hash]struct{}, len(done))
+	for _, tx := range done {
+		hashes[tx.Hash] = struct{}{}
+	}
+
+	var pending []*evm.EVMTransaction
+	for _, tx := range bc.pendingEVM {
+		if _, ok := hashes[tx.Hash]; !ok {
+			pending = append(pending, tx)
+		}
+	}
+	bc.pendingEVM = pending
+}
+
+// appendBlock appends a block and marks it for persistence. The caller must
+// hold the write lock.
+func (bc *Blockchain) appendBlock(block Block) {
+	bc.Chain = append(bc.Chain, block)
+	bc.dirtyBlocks = append(bc.dirtyBlocks, block.Index)
+	bc.evm.SetBlockHash(uint64(block.Index), evmBlockHash(block))
+}
+
+// evmBlockHash returns the hash of a block as the EVM sees it through
+// BLOCKHASH and PREVRANDAO
+func evmBlockHash(block Block) evm.Hash {
+	hash, _ := hex.DecodeString(block.Hash)
+	return evm.BytesToHash(hash)
+}
+
+// validateBody checks the header hash and that the transactions match it
+func (bc *Blockchain) validateBody(block Block) error {
+	if block.Pruned {
+		return fmt.Errorf("block %d: %w", block.Index, ErrBlockPruned)
+	}
+	if block.Hash != bc.CalculateHash(block) {
+		return fmt.Errorf("block %d: invalid hash", block.Index)
+	}
+	if block.TxRoot != bc.CalculateTxRoot(block.Transactions) {
+		return fmt.Errorf("block %d: transactions do not match tx_root", block.Index)
+	}
+	if block.EVM != nil && block.EVM.TxRoot != evm.TransactionsRoot(block.EVMTransactions) {
+		return fmt.Errorf("block %d: EVM transactions do not match the EVM transactions root", block.Index)
+	}
+	for _, tx := range block.Transactions {
+		if tx.Hash != bc.CalculateTransactionHash(tx) {
+			return fmt.Errorf("block %d: invalid transaction hash %s", block.Index, tx.Hash)
+		}
+	}
+	return nil
+}
+
+// CalculateHash calculates the hash of a block header. Transactions are
+// committed through TxRoot so the hash stays verifiable after pruning. The
+// EVM header is only part of blocks that have one, so older blocks keep
+// their hashes.
 func (bc *Blockchain) CalculateHash(block Block) string {
-	record := strconv.Itoa(block.Index) + block.Timestamp.String() +
-		bc.TransactionsToString(block.Transactions) + block.PrevHash +
-		strconv.Itoa(block.Nonce) + strconv.Itoa(block.Difficulty)
+	record := strconv.Itoa(block.Index) + hashTimestamp(block.Timestamp) +
+		block.TxRoot + block.PrevHash +
+		strconv.Itoa(block.Nonce) + strconv.Itoa(block.Difficulty) +
+		block.StateRoot
+	if header := block.EVM; header != nil {
+		record += header.Coinbase.Hex() + strconv.FormatUint(header.GasUsed, 10) +
+			header.TxRoot.Hex() + header.ReceiptRoot.Hex() + header.StateRoot.Hex() +
+			hex.EncodeToString(header.LogsBloom[:])
+	}
 
 	h := sha256.New()
 	h.Write([]byte(record))
@@ -159,7 +557,7 @@ func (bc *Blockchain) CalculateHash(block Block) string {
 // CalculateTransactionHash calculates the hash of a transaction
 func (bc *Blockchain) CalculateTransactionHash(tx Transaction) string {
 	record := tx.From + tx.To + fmt.Sprintf("%f", tx.Amount) +
-		tx.Token + tx.Timestamp.String()
+		tx.Token + hashTimestamp(tx.Timestamp)
 
 	h := sha256.New()
 	h.Write([]byte(record))
@@ -167,6 +565,20 @@ func (bc *Blockchain) CalculateTransactionHash(tx Transaction) string {
 	return hex.EncodeToString(hashed)
 }
 
+// hashTimestamp formats a timestamp for hashing. It is independent of the
+// local time zone and of the monotonic clock reading, so hashes survive a
+// round trip through JSON and through other nodes.
+func hashTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// CalculateTxRoot calculates the hash committing to a block's transactions
+func (bc *Blockchain) CalculateTxRoot(transactions []Transaction) string {
+	h := sha256.New()
+	h.Write([]byte(bc.TransactionsToString(transactions)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 // TransactionsToString converts transactions to string for hashing
 func (bc *Blockchain) TransactionsToString(transactions []Transaction) string {
 	var result string
@@ -180,7 +592,12 @@ func (bc *Blockchain) TransactionsToString(transactions []Transaction) string {
 func (bc *Blockchain) IsChainValid() bool {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
+	return bc.isChainValid()
+}
 
+// isChainValid validates the entire blockchain. The caller must hold the
+// lock.
+func (bc *Blockchain) isChainValid() bool {
 	for i := 1; i < len(bc.Chain); i++ {
 		currentBlock := bc.Chain[i]
 		previousBlock := bc.Chain[i-1]
@@ -190,6 +607,11 @@ func (bc *Blockchain) IsChainValid() bool {
 			return false
 		}
 
+		// Pruned blocks keep only their header, so the body check is skipped
+		if !currentBlock.Pruned && currentBlock.TxRoot != bc.CalculateTxRoot(currentBlock.Transactions) {
+			return false
+		}
+
 		// Check if previous block hash is correct
 		if currentBlock.PrevHash != previousBlock.Hash {
 			return false
@@ -199,27 +621,87 @@ func (bc *Blockchain) IsChainValid() bool {
 	return true
 }
 
-// GetBalance returns the balance of an address
+// GetBalance returns the balance of an address. The USDTg balance of an
+// EVM address is its EVM balance in native units.
 func (bc *Blockchain) GetBalance(address string) map[string]float64 {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
 	balance := make(map[string]float64)
-
-	for _, block := range bc.Chain {
-		for _, tx := range block.Transactions {
-			if tx.From == address {
-				balance[tx.Token] -= tx.Amount
-			}
-			if tx.To == address {
-				balance[tx.Token] += tx.Amount
-			}
+	for token, amount := range bc.balances[address] {
+		balance[token] = amount
+	}
+	if evmAddress, err := evm.ParseAddress(address); err == nil {
+		if wei := bc.evm.GetBalance(evmAddress); wei.Sign() > 0 {
+			balance[NativeToken] = FromWei(wei)
 		}
 	}
 
 	return balance
 }
 
+// applyTransactions applies transactions to the balance state of tokens
+// other than USDTg, which applyEVM moves. The caller must hold the write
+// lock.
+func (bc *Blockchain) applyTransactions(transactions []Transaction) {
+	for _, tx := range transactions {
+		if tx.Token == NativeToken {
+			continue
+		}
+		bc.credit(tx.From, tx.Token, -tx.Amount)
+		bc.credit(tx.To, tx.Token, tx.Amount)
+	}
+}
+
+// credit adds amount to the token balance of an address
+func (bc *Blockchain) credit(address, token string, amount float64) {
+	if bc.balances[address] == nil {
+		bc.balances[address] = make(map[string]float64)
+	}
+	bc.balances[address][token] += amount
+	bc.dirtyState[address] = struct{}{}
+}
+
+// copyBalances returns a deep copy of a balance state
+func copyBalances(balances map[string]map[string]float64) map[string]map[string]float64 {
+	cp := make(map[string]map[string]float64, len(balances))
+	for address, tokens := range balances {
+		cp[address] = make(map[string]float64, len(tokens))
+		for token, amount := range tokens {
+			cp[address][token] = amount
+		}
+	}
+	return cp
+}
+
+// stateRoot calculates the hash committing to the current balance state
+func (bc *Blockchain) stateRoot() string {
+	return stateRootOf(bc.balances)
+}
+
+// stateRootOf calculates the hash committing to a balance state
+func stateRootOf(balances map[string]map[string]float64) string {
+	addresses := make([]string, 0, len(balances))
+	for address := range balances {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	h := sha256.New()
+	for _, address := range addresses {
+		tokens := make([]string, 0, len(balances[address]))
+		for token := range balances[address] {
+			tokens = append(tokens, token)
+		}
+		sort.Strings(tokens)
+
+		for _, token := range tokens {
+			fmt.Fprintf(h, "%s:%s:%f;", address, token, balances[address][token])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 // GetBlockByIndex returns a block by its index
 func (bc *Blockchain) GetBlockByIndex(index int) (Block, error) {
 	bc.mu.RLock()
@@ -229,24 +711,63 @@ func (bc *Blockchain) GetBlockByIndex(index int) (Block, error) {
 		return Block{}, fmt.Errorf("block index out of range")
 	}
 
+	if bc.Chain[index].Pruned {
+		return Block{}, fmt.Errorf("block %d: %w", index, ErrBlockPruned)
+	}
+
 	return bc.Chain[index], nil
 }
 
+// GetBlockByHash returns a block by its hash
+func (bc *Blockchain) GetBlockByHash(hash string) (Block, error) {
+	block, err := bc.store.GetBlockByHash(hash)
+	if errors.Is(err, ErrNotFound) {
+		return Block{}, fmt.Errorf("block %s not found", hash)
+	}
+	if err != nil {
+		return Block{}, err
+	}
+	if block.Pruned {
+		return Block{}, fmt.Errorf("block %d: %w", block.Index, ErrBlockPruned)
+	}
+	return block, nil
+}
+
+// GetBlockHeader returns a block by its index without its transactions.
+// Unlike GetBlockByIndex it also succeeds for pruned blocks.
+func (bc *Blockchain) GetBlockHeader(index int) (Block, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if index < 0 || index >= len(bc.Chain) {
+		return Block{}, fmt.Errorf("block index out of range")
+	}
+
+	header := bc.Chain[index]
+	header.Transactions = nil
+	header.EVMTransactions = nil
+	return header, nil
+}
+
 // GetBlockchainInfo returns information about the blockchain
 func (bc *Blockchain) GetBlockchainInfo() map[string]interface{} {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
-	latestBlock := bc.GetLatestBlock()
+	latestBlock := bc.latestBlock()
 
 	info := map[string]interface{}{
 		"total_blocks":      len(bc.Chain),
 		"latest_block":      latestBlock.Index,
 		"pending_tx":        len(bc.PendingTx),
+		"pending_evm_tx":    len(bc.pendingEVM),
 		"difficulty":        bc.Difficulty,
 		"mining_reward":     bc.MiningReward,
-		"is_valid":          bc.IsChainValid(),
+		"is_valid":          bc.isChainValid(),
 		"latest_block_hash": latestBlock.Hash,
+		"state_root":        latestBlock.StateRoot,
+		"pruning_mode":      bc.pruning.Mode,
+		"pruned_blocks":     bc.prunedCount(),
 	}
 
 	return info
@@ -254,8 +775,66 @@ func (bc *Blockchain) GetBlockchainInfo() map[string]interface{} {
 
 // ToJSON converts the blockchain to JSON
 func (bc *Blockchain) ToJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := bc.WriteJSON(&buf, 0, LatestHeight); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// WriteJSON streams the blockchain as JSON to w, one block at a time. The
+// read lock is only held while copying each block, so writers are not
+// blocked for the duration of the dump. The output has the same shape as
+// marshalling the Blockchain, limited to blocks in the from-to range.
+func (bc *Blockchain) WriteJSON(w io.Writer, from, to int) error {
 	bc.mu.RLock()
-	defer bc.mu.RUnlock()
+	head := len(bc.Chain) - 1
+	bc.mu.RUnlock()
+
+	from, to, err := resolveRange(from, to, head)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, `{"chain":[`); err != nil {
+		return err
+	}
+	for i := from; i <= to; i++ {
+		bc.mu.RLock()
+		block := bc.Chain[i]
+		bc.mu.RUnlock()
+
+		data, err := json.Marshal(block)
+		if err != nil {
+			return err
+		}
+		if i > from {
+			data = append([]byte{','}, data...)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
 
-	return json.MarshalIndent(bc, "", "  ")
+	bc.mu.RLock()
+	pendingTx := make([]Transaction, len(bc.PendingTx))
+	copy(pendingTx, bc.PendingTx)
+	difficulty := bc.Difficulty
+	miningReward := bc.MiningReward
+	bc.mu.RUnlock()
+
+	if _, err := io.WriteString(w, `],"pending_tx":`); err != nil {
+		return err
+	}
+	if err := json.NewEncoder(w).Encode(pendingTx); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, `,"difficulty":%d,"mining_reward":%s}`, difficulty,
+		strconv.FormatFloat(miningReward, 'g', -1, 64))
+	return err
 }
@@ -0,0 +1,264 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"usdtg-chain/evm"
+)
+
+const testMiner = "0x00000000000000000000000000000000000000aa"
+
+func TestMinePendingTransactionsPaysReward(t *testing.T) {
+	bc := NewBlockchain()
+	defer bc.Close()
+
+	block, err := bc.MinePendingTransactions(testMiner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Index != 1 || len(block.Transactions) != 1 {
+		t.Fatalf("got block %d with %d transactions, want block 1 with the reward", block.Index, len(block.Transactions))
+	}
+	if got := bc.GetBalance(testMiner)[NativeToken]; got != bc.MiningReward {
+		t.Fatalf("miner balance %v, want %v", got, bc.MiningReward)
+	}
+	if got := bc.evm.BlockNumber(); got != 1 {
+		t.Fatalf("EVM at block %d, want 1", got)
+	}
+}
+
+func TestMinePendingTransactionsRejectsNonEVMMiner(t *testing.T) {
+	bc := NewBlockchain()
+	defer bc.Close()
+
+	if _, err := bc.MinePendingTransactions("alice"); err == nil {
+		t.Fatal("mining to a non-EVM address succeeded")
+	}
+	if h := bc.Height(); h != 0 {
+		t.Fatalf("height %d after a rejected mine, want 0", h)
+	}
+	if got := bc.evm.BlockNumber(); got != 0 {
+		t.Fatalf("EVM moved to block %d", got)
+	}
+}
+
+// TestAddBlockRejectedLeavesEVM checks that a block whose EVM part does
+// not match its header leaves the EVM where it was
+func TestAddBlockRejectedLeavesEVM(t *testing.T) {
+	miner := NewBlockchain()
+	defer miner.Close()
+	block, err := miner.MinePendingTransactions(testMiner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	follower := NewBlockchain()
+	defer follower.Close()
+	bad := block
+	header := *block.EVM
+	header.StateRoot = evm.Hash{1}
+	bad.EVM = &header
+	bad.Hash = follower.CalculateHash(bad)
+	if err := follower.AddBlock(bad); err == nil {
+		t.Fatal("block with a wrong EVM state root was accepted")
+	}
+	if got := follower.evm.BlockNumber(); got != 0 {
+		t.Fatalf("EVM moved to block %d by a rejected block", got)
+	}
+
+	if err := follower.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if got := follower.evm.BlockNumber(); got != 1 {
+		t.Fatalf("EVM at block %d, want 1", got)
+	}
+}
+
+// newDevChain returns an in-memory chain whose EVM accepts unsigned
+// transactions
+func newDevChain(t *testing.T) *Blockchain {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.EVM = evm.NewEVM()
+	cfg.EVM.AllowUnsigned = true
+	bc, err := NewBlockchainWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc
+}
+
+func TestBlockHashAndPrevRandao(t *testing.T) {
+	bc := newDevChain(t)
+	defer bc.Close()
+
+	// Init code storing BLOCKHASH(NUMBER-1) in slot 0 and PREVRANDAO in
+	// slot 1
+	code := []byte{
+		byte(evm.PUSH1), 1, byte(evm.NUMBER), byte(evm.SUB), byte(evm.BLOCKHASH),
+		byte(evm.PUSH1), 0, byte(evm.SSTORE),
+		byte(evm.PREVRANDAO), byte(evm.PUSH1), 1, byte(evm.SSTORE),
+		byte(evm.STOP),
+	}
+	tx := &evm.EVMTransaction{Value: new(big.Int), Data: code, Gas: 100_000, GasPrice: new(big.Int)}
+	if _, err := bc.SubmitEVMTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	block, err := bc.MinePendingTransactions(testMiner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.EVMTransactions) != 1 {
+		t.Fatal("transaction was not included")
+	}
+
+	contract := *bc.evm.GetTransactionResult(tx.Hash).ContractAddress
+	genesis := evmBlockHash(bc.Chain[0])
+	if got := bc.evm.GetStorage(contract, evm.Hash{}); got != genesis {
+		t.Fatalf("BLOCKHASH(0) = %s, want genesis hash %s", got, genesis)
+	}
+	if got := bc.evm.GetStorage(contract, evm.BytesToHash([]byte{1})); got != genesis {
+		t.Fatalf("PREVRANDAO = %s, want parent hash %s", got, genesis)
+	}
+
+	follower := newDevChain(t)
+	defer follower.Close()
+	if err := follower.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestReopenLoadsEVMState restarts a disk node whose chain holds unsigned
+// transactions without dev mode, which only works if the EVM state is
+// loaded rather than replayed
+func TestReopenLoadsEVMState(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Storage = StorageConfig{Backend: StorageDisk, Path: t.TempDir()}
+	cfg.EVM = evm.NewEVM()
+	cfg.EVM.AllowUnsigned = true
+	bc, err := NewBlockchainWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Init code storing 42 in slot 7
+	code := []byte{byte(evm.PUSH1), 42, byte(evm.PUSH1), 7, byte(evm.SSTORE), byte(evm.STOP)}
+	tx := &evm.EVMTransaction{Value: new(big.Int), Data: code, Gas: 100_000, GasPrice: new(big.Int)}
+	if _, err := bc.SubmitEVMTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := bc.MinePendingTransactions(testMiner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	contract := *bc.evm.GetTransactionResult(tx.Hash).ContractAddress
+	root := bc.evm.StateRoot()
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.EVM = evm.NewEVM()
+	reopened, err := NewBlockchainWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	if got := reopened.evm.StateRoot(); got != root {
+		t.Fatalf("state root %s after reopening, want %s", got, root)
+	}
+	if got := reopened.evm.GetStorage(contract, evm.BytesToHash([]byte{7})); got != evm.BytesToHash([]byte{42}) {
+		t.Fatalf("slot 7 = %s, want 42", got)
+	}
+	if got := reopened.evm.BlockNumber(); got != 2 {
+		t.Fatalf("EVM at block %d, want 2", got)
+	}
+	result := reopened.evm.GetTransactionResult(tx.Hash)
+	if result == nil || !result.Success || *result.ContractAddress != contract {
+		t.Fatalf("receipt of the deployment not restored: %+v", result)
+	}
+
+	// The chain goes on from the loaded state
+	if _, err := reopened.MinePendingTransactions(testMiner); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	bc := NewBlockchain()
+	defer bc.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := bc.MinePendingTransactions(testMiner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := bc.AddTransaction(testMiner, "0x00000000000000000000000000000000000000bb", 1, NativeToken); err != nil {
+		t.Fatal(err)
+	}
+
+	dump := func(from, to int) (*Blockchain, []byte) {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := bc.WriteJSON(&buf, from, to); err != nil {
+			t.Fatalf("%d-%d: %v", from, to, err)
+		}
+		var got Blockchain
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("%d-%d: %v in %s", from, to, err, buf.Bytes())
+		}
+		return &got, buf.Bytes()
+	}
+
+	ranges := []struct {
+		from, to  int
+		wantFirst int
+		wantLast  int
+	}{
+		{0, LatestHeight, 0, 3},
+		{1, 2, 1, 2},
+		{3, 3, 3, 3},
+		// Heights past the head stop at it
+		{2, 100, 2, 3},
+	}
+	for _, r := range ranges {
+		got, _ := dump(r.from, r.to)
+		if len(got.Chain) != r.wantLast-r.wantFirst+1 {
+			t.Fatalf("%d-%d: %d blocks", r.from, r.to, len(got.Chain))
+		}
+		for i, block := range got.Chain {
+			want, err := bc.GetBlockByIndex(r.wantFirst + i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if block.Index != want.Index || block.Hash != want.Hash || len(block.Transactions) != len(want.Transactions) {
+				t.Fatalf("%d-%d: block %d is %+v", r.from, r.to, i, block)
+			}
+		}
+		if len(got.PendingTx) != 1 || got.Difficulty != bc.Difficulty || got.MiningReward != bc.MiningReward {
+			t.Fatalf("%d-%d: %d pending, difficulty %d, reward %v", r.from, r.to, len(got.PendingTx), got.Difficulty, got.MiningReward)
+		}
+	}
+
+	// An invalid range fails before anything is written
+	for _, r := range [][2]int{{-1, 2}, {3, 1}, {4, LatestHeight}} {
+		var buf bytes.Buffer
+		if err := bc.WriteJSON(&buf, r[0], r[1]); err == nil || buf.Len() != 0 {
+			t.Fatalf("%d-%d: wrote %q, %v", r[0], r[1], buf.Bytes(), err)
+		}
+	}
+
+	// ToJSON is the indented full dump
+	_, full := dump(0, LatestHeight)
+	var want bytes.Buffer
+	if err := json.Indent(&want, full, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	got, err := bc.ToJSON()
+	if err != nil || !bytes.Equal(got, want.Bytes()) {
+		t.Fatalf("ToJSON returned %s, %v", got, err)
+	}
+}
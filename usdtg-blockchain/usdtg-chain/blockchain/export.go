@@ -0,0 +1,428 @@
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"usdtg-chain/evm"
+)
+
+const (
+	// ExportFormat identifies USDTg chain export files
+	ExportFormat = "usdtg-chain-export"
+	// ExportVersion is the current export file version
+	ExportVersion = 1
+	// LatestHeight selects the current head in height ranges
+	LatestHeight = -1
+)
+
+// ExportOptions selects what Export writes
+type ExportOptions struct {
+	From         int  `json:"from"`
+	To           int  `json:"to"`
+	IncludeState bool `json:"include_state"`
+}
+
+// exportRecord is a single NDJSON line of an export file. The first line is
+// a header, followed by one line per block, optional state lines for the
+// native balances, EVM accounts and EVM receipts, and a closing end line.
+type exportRecord struct {
+	Type          string             `json:"type"`
+	Format        string             `json:"format,omitempty"`
+	Version       int                `json:"version,omitempty"`
+	From          int                `json:"from,omitempty"`
+	To            int                `json:"to,omitempty"`
+	IncludesState bool               `json:"includes_state,omitempty"`
+	GenesisHash   string             `json:"genesis_hash,omitempty"`
+	ExportedAt    *time.Time         `json:"exported_at,omitempty"`
+	Block         *Block             `json:"block,omitempty"`
+	Address       string             `json:"address,omitempty"`
+	Balances      map[string]float64 `json:"balances,omitempty"`
+	EVMAccount    *evm.Account       `json:"evm_account,omitempty"`
+	Receipts      json.RawMessage    `json:"receipts,omitempty"`
+	Blocks        int                `json:"blocks,omitempty"`
+	Accounts      int                `json:"accounts,omitempty"`
+	EVMAccounts   int                `json:"evm_accounts,omitempty"`
+	EVMReceipts   int                `json:"evm_receipts,omitempty"`
+}
+
+const (
+	recordHeader = "header"
+	recordBlock  = "block"
+	recordState  = "state"
+	recordEnd    = "end"
+
+	recordEVMAccount  = "evm_account"
+	recordEVMReceipts = "evm_receipts"
+)
+
+// Export streams blocks in the requested height range, and optionally the
+// state at the head, to w as versioned NDJSON. Blocks are read one at a time
+// so writers are not blocked for the duration of the export.
+func (bc *Blockchain) Export(w io.Writer, opts ExportOptions) error {
+	bc.mu.RLock()
+	head := len(bc.Chain) - 1
+	genesisHash := bc.Chain[0].Hash
+	var state map[string]map[string]float64
+	var evmState evm.Changes
+	if opts.IncludeState {
+		state = copyBalances(bc.balances)
+		var err error
+		if evmState, err = bc.evm.Dump(); err != nil {
+			bc.mu.RUnlock()
+			return fmt.Errorf("export: %w", err)
+		}
+	}
+	bc.mu.RUnlock()
+
+	from, to, err := resolveRange(opts.From, opts.To, head)
+	if err != nil {
+		return err
+	}
+	if opts.IncludeState && to != head {
+		return fmt.Errorf("export: state can only be included when exporting up to the head (%d)", head)
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	now := time.Now().UTC()
+	if err := enc.Encode(exportRecord{
+		Type:          recordHeader,
+		Format:        ExportFormat,
+		Version:       ExportVersion,
+		From:          from,
+		To:            to,
+		IncludesState: opts.IncludeState,
+		GenesisHash:   genesisHash,
+		ExportedAt:    &now,
+	}); err != nil {
+		return err
+	}
+
+	for i := from; i <= to; i++ {
+		bc.mu.RLock()
+		block := bc.Chain[i]
+		bc.mu.RUnlock()
+
+		if err := enc.Encode(exportRecord{Type: recordBlock, Block: &block}); err != nil {
+			return err
+		}
+	}
+
+	addresses := make([]string, 0, len(state))
+	for address := range state {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	for _, address := range addresses {
+		if err := enc.Encode(exportRecord{Type: recordState, Address: address, Balances: state[address]}); err != nil {
+			return err
+		}
+	}
+
+	evmAddresses := make([]evm.Address, 0, len(evmState.Accounts))
+	for addr := range evmState.Accounts {
+		evmAddresses = append(evmAddresses, addr)
+	}
+	sort.Slice(evmAddresses, func(i, j int) bool {
+		return bytes.Compare(evmAddresses[i][:], evmAddresses[j][:]) < 0
+	})
+	for _, addr := range evmAddresses {
+		if err := enc.Encode(exportRecord{Type: recordEVMAccount, EVMAccount: evmState.Accounts[addr]}); err != nil {
+			return err
+		}
+	}
+
+	numbers := make([]uint64, 0, len(evmState.Receipts))
+	for number := range evmState.Receipts {
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	for _, number := range numbers {
+		if err := enc.Encode(exportRecord{Type: recordEVMReceipts, Receipts: evmState.Receipts[number]}); err != nil {
+			return err
+		}
+	}
+
+	if err := enc.Encode(exportRecord{
+		Type:        recordEnd,
+		Blocks:      to - from + 1,
+		Accounts:    len(addresses),
+		EVMAccounts: len(evmAddresses),
+		EVMReceipts: len(numbers),
+	}); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ImportChain builds a fresh blockchain from an export file. Every block is
+// validated: full blocks are replayed against the state and must reproduce
+// their state roots, while pruned blocks are checked for hash linkage only
+// and then require the state section to match the head's state roots,
+// native and EVM. When every block is replayed, the EVM accounts and
+// receipts in the state section must match the replayed ones. The
+// configured store must be empty; it receives the chain once the whole file
+// has been validated.
+func ImportChain(r io.Reader, cfg Config) (*Blockchain, error) {
+	bc, err := newBlockchain(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bc.importFrom(r); err != nil {
+		bc.store.Close()
+		return nil, err
+	}
+	return bc, nil
+}
+
+// importFrom reads an export file into an empty blockchain and persists it
+func (bc *Blockchain) importFrom(r io.Reader) error {
+	stored, err := bc.hasStoredChain()
+	if err != nil {
+		return err
+	}
+	if stored {
+		return fmt.Errorf("import: store already contains a chain")
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	var header exportRecord
+	if err := dec.Decode(&header); err != nil {
+		return fmt.Errorf("import: reading header: %w", err)
+	}
+	if header.Type != recordHeader || header.Format != ExportFormat {
+		return fmt.Errorf("import: not a %s file", ExportFormat)
+	}
+	if header.Version != ExportVersion {
+		return fmt.Errorf("import: unsupported version %d", header.Version)
+	}
+	if header.From != 0 {
+		return fmt.Errorf("import: file starts at height %d, a full chain from genesis is required", header.From)
+	}
+
+	headersOnly := false
+	var state map[string]map[string]float64
+	var evmAccounts []*evm.Account
+	var evmReceipts [][]byte
+	var end *exportRecord
+
+	for end == nil {
+		var rec exportRecord
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("import: truncated file, missing end record")
+			}
+			return fmt.Errorf("import: %w", err)
+		}
+
+		switch rec.Type {
+		case recordBlock:
+			if rec.Block == nil {
+				return fmt.Errorf("import: block record without block")
+			}
+			if state != nil || evmAccounts != nil || evmReceipts != nil {
+				return fmt.Errorf("import: block %d after state records", rec.Block.Index)
+			}
+			if rec.Block.Pruned {
+				headersOnly = true
+			}
+			if err := bc.importBlock(*rec.Block, headersOnly); err != nil {
+				return fmt.Errorf("import: %w", err)
+			}
+		case recordState:
+			if state == nil {
+				state = make(map[string]map[string]float64)
+			}
+			state[rec.Address] = rec.Balances
+		case recordEVMAccount:
+			if rec.EVMAccount == nil {
+				return fmt.Errorf("import: EVM account record without account")
+			}
+			evmAccounts = append(evmAccounts, rec.EVMAccount)
+		case recordEVMReceipts:
+			evmReceipts = append(evmReceipts, rec.Receipts)
+		case recordEnd:
+			end = &rec
+		default:
+			return fmt.Errorf("import: unknown record type %q", rec.Type)
+		}
+	}
+
+	if len(bc.Chain) == 0 {
+		return fmt.Errorf("import: file contains no blocks")
+	}
+	if end.Blocks != len(bc.Chain) || end.Accounts != len(state) ||
+		end.EVMAccounts != len(evmAccounts) || end.EVMReceipts != len(evmReceipts) {
+		return fmt.Errorf("import: end record does not match file contents")
+	}
+	if header.To != bc.Chain[len(bc.Chain)-1].Index {
+		return fmt.Errorf("import: header declares height %d, file ends at %d", header.To, len(bc.Chain)-1)
+	}
+	if bc.Chain[0].Hash != header.GenesisHash {
+		return fmt.Errorf("import: genesis hash does not match header")
+	}
+
+	// All balances may be USDTg, which live in the EVM
+	if state == nil && header.IncludesState {
+		state = make(map[string]map[string]float64)
+	}
+	if headersOnly {
+		if state == nil {
+			return fmt.Errorf("import: file contains pruned blocks but no state")
+		}
+		bc.balances = state
+		head := uint64(len(bc.Chain) - 1)
+		if err := bc.evm.Restore(head, evmAccounts, evmReceipts); err != nil {
+			return fmt.Errorf("import: %w", err)
+		}
+		if err := bc.checkEVMState(); err != nil {
+			return fmt.Errorf("import: %w", err)
+		}
+	}
+	// A replayed chain has its own EVM state, which the file's records
+	// must describe exactly
+	if !headersOnly && header.IncludesState {
+		if err := bc.checkEVMRecords(evmAccounts, evmReceipts); err != nil {
+			return fmt.Errorf("import: %w", err)
+		}
+	}
+	if state != nil {
+		if root := stateRootOf(state); root != bc.Chain[len(bc.Chain)-1].StateRoot {
+			return fmt.Errorf("import: state does not match head state root")
+		}
+	}
+
+	for address := range bc.balances {
+		bc.dirtyState[address] = struct{}{}
+	}
+	bc.prune()
+	return bc.persist()
+}
+
+// checkEVMRecords compares the EVM accounts and receipts of an export
+// file with the state and receipts the import replayed
+func (bc *Blockchain) checkEVMRecords(accounts []*evm.Account, receipts [][]byte) error {
+	replayed, err := bc.evm.Dump()
+	if err != nil {
+		return err
+	}
+
+	if len(accounts) != len(replayed.Accounts) {
+		return fmt.Errorf("file has %d EVM accounts, replaying the blocks gives %d", len(accounts), len(replayed.Accounts))
+	}
+	for _, account := range accounts {
+		if !sameEVMAccount(account, replayed.Accounts[account.Address]) {
+			return fmt.Errorf("EVM account %s does not match the replayed state", account.Address)
+		}
+	}
+
+	numbers := make([]uint64, 0, len(replayed.Receipts))
+	for number := range replayed.Receipts {
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	if len(receipts) != len(numbers) {
+		return fmt.Errorf("file has EVM receipts of %d blocks, replaying the blocks gives %d", len(receipts), len(numbers))
+	}
+	for i, number := range numbers {
+		var have, want bytes.Buffer
+		if json.Compact(&have, receipts[i]) != nil || json.Compact(&want, replayed.Receipts[number]) != nil ||
+			!bytes.Equal(have.Bytes(), want.Bytes()) {
+			return fmt.Errorf("EVM receipts of block %d do not match the replayed ones", number)
+		}
+	}
+	return nil
+}
+
+// sameEVMAccount reports whether two accounts hold the same state; a nil
+// account matches nothing
+func sameEVMAccount(a, b *evm.Account) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	if a.Address != b.Address || a.Nonce != b.Nonce || a.CodeHash != b.CodeHash ||
+		!bytes.Equal(a.Code, b.Code) || len(a.Storage) != len(b.Storage) {
+		return false
+	}
+	if (a.Balance == nil) != (b.Balance == nil) || (a.Balance != nil && a.Balance.Cmp(b.Balance) != 0) {
+		return false
+	}
+	for key, value := range a.Storage {
+		if b.Storage[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// importBlock appends an imported block. In headers-only mode the state can
+// no longer be replayed, so only the header hash and linkage are checked and
+// the state records at the end of the file stand in for execution.
+func (bc *Blockchain) importBlock(block Block, headersOnly bool) error {
+	if len(bc.Chain) == 0 {
+		return bc.importGenesis(block)
+	}
+	if !headersOnly {
+		return bc.applyBlock(block)
+	}
+
+	head := bc.Chain[len(bc.Chain)-1]
+	if block.Index != head.Index+1 {
+		return fmt.Errorf("block %d: expected index %d", block.Index, head.Index+1)
+	}
+	if block.PrevHash != head.Hash {
+		return fmt.Errorf("block %d: prev_hash does not match head", block.Index)
+	}
+	if block.Hash != bc.CalculateHash(block) {
+		return fmt.Errorf("block %d: invalid hash", block.Index)
+	}
+	if block.Pruned {
+		block.Transactions = nil
+		block.EVMTransactions = nil
+		bc.prunedUpTo = block.Index
+	} else if err := bc.validateBody(block); err != nil {
+		return err
+	}
+	bc.appendBlock(block)
+	return nil
+}
+
+// importGenesis validates and installs the genesis block of an import
+func (bc *Blockchain) importGenesis(block Block) error {
+	if block.Index != 0 {
+		return fmt.Errorf("block %d: expected genesis block", block.Index)
+	}
+	if err := bc.validateBody(block); err != nil {
+		return err
+	}
+
+	bc.applyTransactions(block.Transactions)
+	if bc.stateRoot() != block.StateRoot {
+		return fmt.Errorf("block 0: state root mismatch")
+	}
+
+	bc.appendBlock(block)
+	return nil
+}
+
+// resolveRange validates a height range against the head, resolving
+// LatestHeight
+func resolveRange(from, to, head int) (int, int, error) {
+	if to == LatestHeight || to > head {
+		to = head
+	}
+	if from < 0 || from > to {
+		return 0, 0, fmt.Errorf("invalid height range %d-%d (head %d)", from, to, head)
+	}
+	return from, to, nil
+}
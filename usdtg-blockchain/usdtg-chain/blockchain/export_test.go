@@ -0,0 +1,170 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"usdtg-chain/evm"
+)
+
+// TestExportImportPruned round-trips a pruned chain: the pruned blocks
+// have lost their transactions, so the EVM state comes from the export's
+// state records
+func TestExportImportPruned(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Pruning = PruningConfig{Mode: PruningRecent, KeepRecent: 1}
+	cfg.EVM = evm.NewEVM()
+	cfg.EVM.AllowUnsigned = true
+	bc, err := NewBlockchainWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	// Init code storing 42 in slot 7
+	code := []byte{byte(evm.PUSH1), 42, byte(evm.PUSH1), 7, byte(evm.SSTORE), byte(evm.STOP)}
+	tx := &evm.EVMTransaction{Value: new(big.Int), Data: code, Gas: 100_000, GasPrice: new(big.Int)}
+	if _, err := bc.SubmitEVMTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := bc.MinePendingTransactions(testMiner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bc.IsPruned(1) {
+		t.Fatal("block 1 was not pruned")
+	}
+	if block := bc.Chain[1]; block.Transactions != nil || block.EVMTransactions != nil {
+		t.Fatal("pruned block 1 kept its transactions")
+	}
+	contract := *bc.evm.GetTransactionResult(tx.Hash).ContractAddress
+
+	var buf bytes.Buffer
+	if err := bc.Export(&buf, ExportOptions{To: LatestHeight, IncludeState: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.EVM = evm.NewEVM()
+	imported, err := ImportChain(&buf, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer imported.Close()
+
+	if got, want := imported.GetLatestBlock().Hash, bc.GetLatestBlock().Hash; got != want {
+		t.Fatalf("imported head %s, want %s", got, want)
+	}
+	miner, _ := evm.ParseAddress(testMiner)
+	if got, want := imported.evm.GetBalance(miner), bc.evm.GetBalance(miner); got.Cmp(want) != 0 || got.Sign() == 0 {
+		t.Fatalf("imported miner balance %s, want %s", got, want)
+	}
+	if got := imported.evm.GetStorage(contract, evm.BytesToHash([]byte{7})); got != evm.BytesToHash([]byte{42}) {
+		t.Fatalf("slot 7 = %s, want 42", got)
+	}
+	if result := imported.evm.GetTransactionResult(tx.Hash); result == nil || !result.Success {
+		t.Fatalf("receipt of the pruned deployment not imported: %+v", result)
+	}
+
+	// The chain goes on from the imported state
+	if _, err := imported.MinePendingTransactions(testMiner); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestExportImportFull round-trips an unpruned chain with its state. The
+// import replays every block, and the state records in the file must
+// describe the state it arrives at.
+func TestExportImportFull(t *testing.T) {
+	bc := newDevChain(t)
+	defer bc.Close()
+
+	// Init code storing 42 in slot 7 and logging it
+	code := []byte{
+		byte(evm.PUSH1), 42, byte(evm.PUSH1), 7, byte(evm.SSTORE),
+		byte(evm.PUSH1), 7, byte(evm.PUSH1), 0, byte(evm.PUSH1), 0, byte(evm.LOG0 + 1), byte(evm.STOP),
+	}
+	tx := &evm.EVMTransaction{Value: new(big.Int), Data: code, Gas: 100_000, GasPrice: new(big.Int)}
+	if _, err := bc.SubmitEVMTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := bc.MinePendingTransactions(testMiner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	contract := *bc.evm.GetTransactionResult(tx.Hash).ContractAddress
+
+	var buf bytes.Buffer
+	if err := bc.Export(&buf, ExportOptions{To: LatestHeight, IncludeState: true}); err != nil {
+		t.Fatal(err)
+	}
+	export := buf.String()
+
+	importFile := func(file string) (*Blockchain, error) {
+		cfg := DefaultConfig()
+		cfg.EVM = evm.NewEVM()
+		cfg.EVM.AllowUnsigned = true
+		return ImportChain(strings.NewReader(file), cfg)
+	}
+	imported, err := importFile(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer imported.Close()
+	if got, want := imported.evm.StateRoot(), bc.evm.StateRoot(); got != want {
+		t.Fatalf("imported EVM state root %s, want %s", got, want)
+	}
+	if got := imported.evm.GetStorage(contract, evm.BytesToHash([]byte{7})); got != evm.BytesToHash([]byte{42}) {
+		t.Fatalf("slot 7 = %s, want 42", got)
+	}
+	if receipt := imported.evm.GetReceipt(tx.Hash); receipt == nil || len(receipt.Logs) != 1 {
+		t.Fatalf("receipt of the deployment %+v", receipt)
+	}
+
+	// Records that do not describe the replayed state are rejected
+	tamper := func(recordType string, change func(rec *exportRecord)) string {
+		lines := strings.Split(strings.TrimSuffix(export, "\n"), "\n")
+		for i, line := range lines {
+			var rec exportRecord
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Type == recordType && (rec.EVMAccount == nil || rec.EVMAccount.Address == contract) {
+				change(&rec)
+				data, err := json.Marshal(rec)
+				if err != nil {
+					t.Fatal(err)
+				}
+				lines[i] = string(data)
+				return strings.Join(lines, "\n") + "\n"
+			}
+		}
+		t.Fatalf("no %s record", recordType)
+		return ""
+	}
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"storage", tamper(recordEVMAccount, func(rec *exportRecord) {
+			rec.EVMAccount.Storage[evm.BytesToHash([]byte{7})] = evm.BytesToHash([]byte{43})
+		})},
+		{"nonce", tamper(recordEVMAccount, func(rec *exportRecord) { rec.EVMAccount.Nonce++ })},
+		{"receipts", tamper(recordEVMReceipts, func(rec *exportRecord) {
+			rec.Receipts = bytes.Replace(rec.Receipts, []byte(`"status":1`), []byte(`"status":0`), 1)
+		})},
+	}
+	for _, tt := range tests {
+		if tt.file == export {
+			t.Fatalf("%s: tampering changed nothing", tt.name)
+		}
+		if imported, err := importFile(tt.file); err == nil {
+			imported.Close()
+			t.Fatalf("%s: import accepted records that do not match the replayed state", tt.name)
+		}
+	}
+}
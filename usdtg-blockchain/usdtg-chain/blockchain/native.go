@@ -0,0 +1,139 @@
+package blockchain
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"usdtg-chain/evm"
+)
+
+// NativeToken is the chain's native currency. Its balances live in the
+// EVM state, where it is the value-bearing currency: native transactions
+// in it and block rewards become EVM transfers, and EVM transactions move
+// and pay fees in it.
+const NativeToken = "USDTg"
+
+// NativeDecimals is the precision of native USDTg amounts. One USDTg is
+// 10^18 wei in the EVM, so the smallest native amount is 10^12 wei.
+const NativeDecimals = 6
+
+// FaucetAddress sends native transactions that mint USDTg. Only chains
+// configured with a faucet accept them, see Config.Faucet.
+const FaucetAddress = "faucet"
+
+// rewardSender sends the mining reward, the last transaction of a block
+const rewardSender = "system"
+
+// weiPerUnit is the wei value of the smallest native amount
+var weiPerUnit = new(big.Int).Exp(big.NewInt(10), big.NewInt(18-NativeDecimals), nil)
+
+// ToWei converts a native USDTg amount to wei. The amount must be
+// non-negative and have at most NativeDecimals decimals, so the
+// conversion is exact and every node gets the same result.
+func ToWei(amount float64) (*big.Int, error) {
+	if math.IsNaN(amount) || math.IsInf(amount, 0) || amount < 0 {
+		return nil, fmt.Errorf("invalid amount %v", amount)
+	}
+	s := strconv.FormatFloat(amount, 'f', NativeDecimals, 64)
+	if back, _ := strconv.ParseFloat(s, 64); back != amount {
+		return nil, fmt.Errorf("amount %v has more than %d decimals", amount, NativeDecimals)
+	}
+	units, ok := new(big.Int).SetString(strings.Replace(s, ".", "", 1), 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %v", amount)
+	}
+	return units.Mul(units, weiPerUnit), nil
+}
+
+// FromWei converts wei to a native USDTg amount, dropping what is below
+// the smallest native amount. Amounts up to 2^53 units, well above the
+// maximum supply, convert exactly.
+func FromWei(wei *big.Int) float64 {
+	units := new(big.Int).Quo(wei, weiPerUnit)
+	sign := ""
+	if units.Sign() < 0 {
+		sign = "-"
+		units.Neg(units)
+	}
+	digits := fmt.Sprintf("%0*s", NativeDecimals+1, units.String())
+	point := len(digits) - NativeDecimals
+	amount, _ := strconv.ParseFloat(sign+digits[:point]+"."+digits[point:], 64)
+	return amount
+}
+
+// WeiMultiple reports whether a wei value converts to a native amount
+// without loss
+func WeiMultiple(wei *big.Int) bool {
+	return new(big.Int).Rem(wei, weiPerUnit).Sign() == 0
+}
+
+// nativeTransfer converts a native USDTg transaction into the EVM transfer
+// that moves its value. Addresses are EVM addresses. Only the block
+// reward, the last transaction of a block, and faucet transactions on
+// chains with a faucet mint.
+func (bc *Blockchain) nativeTransfer(tx Transaction, last bool) (evm.Transfer, error) {
+	value, err := ToWei(tx.Amount)
+	if err != nil {
+		return evm.Transfer{}, err
+	}
+	to, err := evm.ParseAddress(tx.To)
+	if err != nil {
+		return evm.Transfer{}, fmt.Errorf("recipient: %w", err)
+	}
+
+	transfer := evm.Transfer{To: to, Value: value}
+	switch tx.From {
+	case rewardSender:
+		if !last || tx.Amount != bc.MiningReward {
+			return evm.Transfer{}, fmt.Errorf("%s can only send the mining reward of %v %s", rewardSender, bc.MiningReward, NativeToken)
+		}
+	case FaucetAddress:
+		if !bc.faucet {
+			return evm.Transfer{}, fmt.Errorf("%s transactions are only accepted on chains with a faucet", FaucetAddress)
+		}
+	default:
+		from, err := evm.ParseAddress(tx.From)
+		if err != nil {
+			return evm.Transfer{}, fmt.Errorf("sender: %w", err)
+		}
+		transfer.From = &from
+	}
+	return transfer, nil
+}
+
+// blockTransfers returns the EVM transfers of a block's native USDTg
+// transactions, in order
+func (bc *Blockchain) blockTransfers(block Block) ([]evm.Transfer, error) {
+	var transfers []evm.Transfer
+	for i, tx := range block.Transactions {
+		if tx.Token != NativeToken {
+			continue
+		}
+		transfer, err := bc.nativeTransfer(tx, i == len(block.Transactions)-1)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: transaction %s: %w", block.Index, tx.Hash, err)
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, nil
+}
+
+// checkNativeTransaction checks a native USDTg transaction before it
+// becomes pending: it must be a valid transfer that its sender can
+// currently pay
+func (bc *Blockchain) checkNativeTransaction(tx Transaction) error {
+	if tx.Token != NativeToken {
+		return nil
+	}
+	transfer, err := bc.nativeTransfer(tx, false)
+	if err != nil {
+		return err
+	}
+	if transfer.From != nil && bc.evm.GetBalance(*transfer.From).Cmp(transfer.Value) < 0 {
+		return fmt.Errorf("%w: %s has %v %s", evm.ErrInsufficientBalance, tx.From, FromWei(bc.evm.GetBalance(*transfer.From)), NativeToken)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"usdtg-chain/evm"
+)
+
+// persist writes blocks, accounts and EVM state changed since the last
+// call to the store in a single atomic batch. The caller must hold the
+// write lock.
+func (bc *Blockchain) persist() error {
+	if len(bc.dirtyBlocks) == 0 && len(bc.dirtyState) == 0 {
+		return nil
+	}
+
+	batch := bc.store.NewBatch()
+	for _, index := range bc.dirtyBlocks {
+		if err := batch.PutBlock(bc.Chain[index]); err != nil {
+			return err
+		}
+	}
+	for address := range bc.dirtyState {
+		data, err := json.Marshal(bc.balances[address])
+		if err != nil {
+			return err
+		}
+		batch.Put(stateKey(address), data)
+	}
+
+	changes, err := bc.evm.Changes()
+	if err != nil {
+		return err
+	}
+	for addr, account := range changes.Accounts {
+		if account == nil {
+			batch.Delete(evmAccountKey(addr))
+			if err := bc.deleteEVMStorage(batch, addr); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := json.Marshal(account)
+		if err != nil {
+			return err
+		}
+		batch.Put(evmAccountKey(addr), data)
+	}
+	// Slots are stored under their own keys, so a block writes only those
+	// it changed rather than the whole storage of each account it touched
+	for addr, slots := range changes.Storage {
+		if changes.Accounts[addr] == nil {
+			continue
+		}
+		for key, value := range slots {
+			if value == (evm.Hash{}) {
+				batch.Delete(evmStorageKey(addr, key))
+			} else {
+				batch.Put(evmStorageKey(addr, key), value[:])
+			}
+		}
+	}
+	for number, data := range changes.Receipts {
+		batch.Put(evmReceiptsKey(number), data)
+	}
+
+	batch.Put(keyHead, encodeHeight(len(bc.Chain)-1))
+	batch.Put(keyPrunedUpTo, encodeHeight(bc.prunedUpTo))
+	batch.Put(keyEVMHead, encodeHeight(len(bc.Chain)-1))
+
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+
+	bc.dirtyBlocks = nil
+	bc.dirtyState = make(map[string]struct{})
+	bc.evm.ClearChanges()
+	return nil
+}
+
+// deleteEVMStorage deletes the stored storage slots of an account that no
+// longer exists
+func (bc *Blockchain) deleteEVMStorage(batch Batch, addr evm.Address) error {
+	it := bc.store.NewIterator(evmStoragePrefix(addr))
+	defer it.Release()
+	for it.Next() {
+		batch.Delete(append([]byte{}, it.Key()...))
+	}
+	return it.Error()
+}
+
+// hasStoredChain reports whether the store already holds a chain
+func (bc *Blockchain) hasStoredChain() (bool, error) {
+	_, err := bc.store.Get(keyHead)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// load reads the chain and state from the store. It returns false when the
+// store is empty.
+func (bc *Blockchain) load() (bool, error) {
+	data, err := bc.store.Get(keyHead)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	head, err := decodeHeight(data)
+	if err != nil {
+		return false, err
+	}
+
+	if data, err := bc.store.Get(keyPrunedUpTo); err == nil {
+		if bc.prunedUpTo, err = decodeHeight(data); err != nil {
+			return false, err
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		return false, err
+	}
+
+	bc.Chain = make([]Block, 0, head+1)
+	for i := 0; i <= head; i++ {
+		block, err := bc.store.GetBlockByHeight(i)
+		if err != nil {
+			return false, fmt.Errorf("store: loading block %d: %w", i, err)
+		}
+		bc.Chain = append(bc.Chain, block)
+	}
+
+	it := bc.store.NewIterator(prefixState)
+	defer it.Release()
+	for it.Next() {
+		address := string(it.Key()[len(prefixState):])
+		var tokens map[string]float64
+		if err := json.Unmarshal(it.Value(), &tokens); err != nil {
+			return false, fmt.Errorf("store: decoding state of %s: %w", address, err)
+		}
+		bc.balances[address] = tokens
+	}
+	if err := it.Error(); err != nil {
+		return false, err
+	}
+
+	if bc.stateRoot() != bc.Chain[head].StateRoot {
+		return false, fmt.Errorf("store: state does not match head state root")
+	}
+
+	stored, err := bc.loadEVM(head)
+	if err != nil {
+		return false, err
+	}
+	for i, block := range bc.Chain {
+		// Stores written before the EVM state was persisted have it
+		// rebuilt by replaying the USDTg and EVM transactions, once
+		if !stored && i > 0 {
+			if err := bc.applyEVM(block); err != nil {
+				return false, fmt.Errorf("store: replaying %w", err)
+			}
+		}
+		bc.evm.SetBlockHash(uint64(block.Index), evmBlockHash(block))
+	}
+	return true, nil
+}
+
+// loadEVM restores the EVM accounts and receipts written by persist and
+// checks them against the latest EVM header. It returns false for stores
+// without them.
+func (bc *Blockchain) loadEVM(head int) (bool, error) {
+	data, err := bc.store.Get(keyEVMHead)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	height, err := decodeHeight(data)
+	if err != nil {
+		return false, err
+	}
+	if height != head {
+		return false, fmt.Errorf("store: EVM state is at block %d, the chain at %d", height, head)
+	}
+
+	var accounts []*evm.Account
+	byAddress := make(map[evm.Address]*evm.Account)
+	inline := false
+	it := bc.store.NewIterator(prefixEVMAccount)
+	defer it.Release()
+	for it.Next() {
+		var account evm.Account
+		if err := json.Unmarshal(it.Value(), &account); err != nil {
+			return false, fmt.Errorf("store: decoding EVM account %x: %w", it.Key()[len(prefixEVMAccount):], err)
+		}
+		if account.Storage == nil {
+			account.Storage = make(map[evm.Hash]evm.Hash)
+		}
+		inline = inline || len(account.Storage) > 0
+		accounts = append(accounts, &account)
+		byAddress[account.Address] = &account
+	}
+	if err := it.Error(); err != nil {
+		return false, err
+	}
+
+	// Each slot is stored under the account's address followed by the slot
+	sit := bc.store.NewIterator(prefixEVMStorage)
+	defer sit.Release()
+	for sit.Next() {
+		key := sit.Key()[len(prefixEVMStorage):]
+		if len(key) != evm.AddressLength+evm.HashLength || len(sit.Value()) != evm.HashLength {
+			return false, fmt.Errorf("store: malformed EVM storage slot %x", key)
+		}
+		account := byAddress[evm.BytesToAddress(key[:evm.AddressLength])]
+		if account == nil {
+			return false, fmt.Errorf("store: storage slot of unknown EVM account %x", key[:evm.AddressLength])
+		}
+		account.Storage[evm.BytesToHash(key[evm.AddressLength:])] = evm.BytesToHash(sit.Value())
+	}
+	if err := sit.Error(); err != nil {
+		return false, err
+	}
+
+	var receipts [][]byte
+	rit := bc.store.NewIterator(prefixEVMReceipts)
+	defer rit.Release()
+	for rit.Next() {
+		receipts = append(receipts, rit.Value())
+	}
+	if err := rit.Error(); err != nil {
+		return false, err
+	}
+
+	if err := bc.evm.Restore(uint64(head), accounts, receipts); err != nil {
+		return false, fmt.Errorf("store: %w", err)
+	}
+	// Stores written before slots had keys of their own keep the storage
+	// in the account records; it all stays changed so that the next
+	// persist moves it out
+	if !inline {
+		bc.evm.ClearChanges()
+	}
+	if err := bc.checkEVMState(); err != nil {
+		return false, fmt.Errorf("store: %w", err)
+	}
+	return true, nil
+}
+
+// checkEVMState checks the EVM state against the latest EVM header; blocks
+// without one leave the state as it was. The caller must hold the write
+// lock.
+func (bc *Blockchain) checkEVMState() error {
+	for i := len(bc.Chain) - 1; i > 0; i-- {
+		if header := bc.Chain[i].EVM; header != nil {
+			if bc.evm.StateRoot() != header.StateRoot {
+				return fmt.Errorf("EVM state does not match the state root of block %d", i)
+			}
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PruningMode selects how much block data the node retains
+type PruningMode string
+
+const (
+	// PruningArchive keeps every block body forever
+	PruningArchive PruningMode = "archive"
+	// PruningRecent keeps full blocks only for the most recent heights and
+	// headers plus state roots for everything older
+	PruningRecent PruningMode = "pruned"
+)
+
+// ErrBlockPruned is returned when a block body has been dropped by pruning
+var ErrBlockPruned = errors.New("block body has been pruned")
+
+// PruningConfig controls block body retention
+type PruningConfig struct {
+	Mode       PruningMode `json:"mode"`
+	KeepRecent int         `json:"keep_recent"`
+}
+
+// Validate checks the pruning configuration
+func (c PruningConfig) Validate() error {
+	switch c.Mode {
+	case PruningArchive, "":
+		return nil
+	case PruningRecent:
+		if c.KeepRecent < 1 {
+			return fmt.Errorf("pruning: keep_recent must be at least 1, got %d", c.KeepRecent)
+		}
+		return nil
+	default:
+		return fmt.Errorf("pruning: unknown mode %q", c.Mode)
+	}
+}
+
+// Pruning returns the active pruning configuration
+func (bc *Blockchain) Pruning() PruningConfig {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.pruning
+}
+
+// IsPruned reports whether the body of the block at index has been dropped
+func (bc *Blockchain) IsPruned(index int) bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return index > 0 && index <= bc.prunedUpTo
+}
+
+// prune drops the bodies of blocks that fell out of the retention window,
+// including their EVM transactions; the EVM state and receipts are stored
+// separately. The genesis block is never pruned. The caller must hold the
+// write lock.
+func (bc *Blockchain) prune() {
+	if bc.pruning.Mode != PruningRecent {
+		return
+	}
+
+	target := len(bc.Chain) - 1 - bc.pruning.KeepRecent
+	for i := bc.prunedUpTo + 1; i <= target; i++ {
+		bc.Chain[i].Transactions = nil
+		bc.Chain[i].EVMTransactions = nil
+		bc.Chain[i].Pruned = true
+		bc.prunedUpTo = i
+		bc.dirtyBlocks = append(bc.dirtyBlocks, i)
+	}
+}
+
+// prunedCount returns the number of blocks whose bodies were dropped
+func (bc *Blockchain) prunedCount() int {
+	return bc.prunedUpTo
+}
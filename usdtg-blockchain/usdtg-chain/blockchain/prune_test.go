@@ -0,0 +1,132 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPruningConfigValidate(t *testing.T) {
+	tests := []struct {
+		cfg   PruningConfig
+		valid bool
+	}{
+		{PruningConfig{}, true},
+		{PruningConfig{Mode: PruningArchive}, true},
+		{PruningConfig{Mode: PruningRecent, KeepRecent: 1}, true},
+		{PruningConfig{Mode: PruningRecent}, false},
+		{PruningConfig{Mode: "light", KeepRecent: 1}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%+v: got %v", tt.cfg, err)
+		}
+	}
+}
+
+func TestPruneKeepsRecentBlocks(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Storage = StorageConfig{Backend: StorageDisk, Path: t.TempDir()}
+	cfg.Pruning = PruningConfig{Mode: PruningRecent, KeepRecent: 2}
+	bc, err := NewBlockchainWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hashes []string
+	for i := 0; i < 4; i++ {
+		block, err := bc.MinePendingTransactions(testMiner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, block.Hash)
+	}
+	balance := bc.GetBalance(testMiner)[NativeToken]
+
+	// Blocks 1 and 2 are pruned, the two most recent and the genesis
+	// block are kept
+	check := func(bc *Blockchain) {
+		t.Helper()
+		for i := 0; i <= 4; i++ {
+			pruned := i == 1 || i == 2
+			if bc.IsPruned(i) != pruned {
+				t.Fatalf("block %d pruned: %v, want %v", i, bc.IsPruned(i), pruned)
+			}
+			block, err := bc.GetBlockByIndex(i)
+			if pruned != errors.Is(err, ErrBlockPruned) {
+				t.Fatalf("block %d: %v", i, err)
+			}
+			if !pruned && (err != nil || (i > 0 && len(block.Transactions) == 0)) {
+				t.Fatalf("block %d: %d transactions, %v", i, len(block.Transactions), err)
+			}
+			header, err := bc.GetBlockHeader(i)
+			if err != nil || header.Index != i || (i > 0 && header.Hash != hashes[i-1]) {
+				t.Fatalf("header %d: %+v, %v", i, header, err)
+			}
+		}
+		if _, err := bc.GetBlockByHash(hashes[0]); !errors.Is(err, ErrBlockPruned) {
+			t.Fatalf("pruned block by hash: %v", err)
+		}
+		if !bc.IsChainValid() {
+			t.Fatal("a pruned chain is not valid")
+		}
+		if got := bc.GetBlockchainInfo()["pruned_blocks"]; got != 2 {
+			t.Fatalf("pruned_blocks %v, want 2", got)
+		}
+		if got := bc.GetBalance(testMiner)[NativeToken]; got != balance {
+			t.Fatalf("miner balance %v, want %v", got, balance)
+		}
+	}
+	check(bc)
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewBlockchainWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(reopened)
+
+	// The window moves with the chain
+	if _, err := reopened.MinePendingTransactions(testMiner); err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.IsPruned(3) || reopened.IsPruned(4) {
+		t.Fatal("the window did not move")
+	}
+	if err := reopened.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPruneArchiveOnReopen(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Storage = StorageConfig{Backend: StorageDisk, Path: t.TempDir()}
+	bc, err := NewBlockchainWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := bc.MinePendingTransactions(testMiner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if bc.IsPruned(1) {
+		t.Fatal("an archive node pruned")
+	}
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Switching an archive node to pruning drops the old bodies at once
+	cfg.Pruning = PruningConfig{Mode: PruningRecent, KeepRecent: 1}
+	pruned, err := NewBlockchainWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pruned.Close()
+	for i, want := range []bool{false, true, true, true, false} {
+		if pruned.IsPruned(i) != want {
+			t.Fatalf("block %d pruned: %v, want %v", i, pruned.IsPruned(i), want)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"usdtg-chain/evm"
+)
+
+// ErrNotFound is returned by a Store when a key or block does not exist
+var ErrNotFound = errors.New("not found")
+
+// Store persists blocks and state. Blocks are addressable by height and by
+// hash; state is an ordered key/value space written through atomic batches.
+type Store interface {
+	GetBlockByHeight(height int) (Block, error)
+	GetBlockByHash(hash string) (Block, error)
+	Get(key []byte) ([]byte, error)
+	NewBatch() Batch
+	NewIterator(prefix []byte) Iterator
+	Close() error
+}
+
+// Batch collects writes that are committed atomically
+type Batch interface {
+	PutBlock(block Block) error
+	Put(key, value []byte)
+	Delete(key []byte)
+	Commit() error
+}
+
+// Iterator walks keys under a prefix in ascending order. It iterates over a
+// snapshot of the keys taken when it was created.
+type Iterator interface {
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Error() error
+	Release()
+}
+
+// Storage backends
+const (
+	StorageMemory = "memory"
+	StorageDisk   = "disk"
+)
+
+// StorageConfig selects the storage backend
+type StorageConfig struct {
+	Backend string `json:"backend"`
+	Path    string `json:"path,omitempty"`
+}
+
+// Validate checks the storage configuration
+func (c StorageConfig) Validate() error {
+	switch c.Backend {
+	case StorageMemory, "":
+		return nil
+	case StorageDisk:
+		if c.Path == "" {
+			return fmt.Errorf("storage: path is required for the disk backend")
+		}
+		return nil
+	default:
+		return fmt.Errorf("storage: unknown backend %q", c.Backend)
+	}
+}
+
+// OpenStore opens the store selected by the configuration
+func OpenStore(cfg StorageConfig) (Store, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Backend == StorageDisk {
+		return OpenDiskStore(cfg.Path)
+	}
+	return NewMemoryStore(), nil
+}
+
+// Key layout shared by all backends
+var (
+	prefixBlockByHeight = []byte("b/n/")
+	prefixBlockByHash   = []byte("b/h/")
+	prefixState         = []byte("s/")
+	prefixEVMAccount    = []byte("e/a/")
+	prefixEVMStorage    = []byte("e/s/")
+	prefixEVMReceipts   = []byte("e/r/")
+	keyHead             = []byte("m/head")
+	keyPrunedUpTo       = []byte("m/pruned")
+	keyEVMHead          = []byte("m/evm")
+)
+
+func blockHeightKey(height int) []byte {
+	key := make([]byte, len(prefixBlockByHeight)+8)
+	copy(key, prefixBlockByHeight)
+	binary.BigEndian.PutUint64(key[len(prefixBlockByHeight):], uint64(height))
+	return key
+}
+
+func blockHashKey(hash string) []byte {
+	return append(append([]byte{}, prefixBlockByHash...), hash...)
+}
+
+func stateKey(address string) []byte {
+	return append(append([]byte{}, prefixState...), address...)
+}
+
+func evmAccountKey(addr evm.Address) []byte {
+	return append(append([]byte{}, prefixEVMAccount...), addr[:]...)
+}
+
+// evmStoragePrefix is the prefix of the storage slots of an account
+func evmStoragePrefix(addr evm.Address) []byte {
+	return append(append([]byte{}, prefixEVMStorage...), addr[:]...)
+}
+
+func evmStorageKey(addr evm.Address, slot evm.Hash) []byte {
+	return append(evmStoragePrefix(addr), slot[:]...)
+}
+
+func evmReceiptsKey(number uint64) []byte {
+	key := make([]byte, len(prefixEVMReceipts)+8)
+	copy(key, prefixEVMReceipts)
+	binary.BigEndian.PutUint64(key[len(prefixEVMReceipts):], number)
+	return key
+}
+
+func encodeHeight(height int) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(height))
+	return buf
+}
+
+func decodeHeight(buf []byte) (int, error) {
+	if len(buf) != 8 {
+		return 0, fmt.Errorf("store: corrupt height value")
+	}
+	return int(binary.BigEndian.Uint64(buf)), nil
+}
+
+// batchOp is a single write in a batch. A nil value deletes the key.
+type batchOp struct {
+	key   string
+	value []byte
+}
+
+// kvBackend is the raw key/value engine behind a kvStore
+type kvBackend interface {
+	get(key string) ([]byte, bool, error)
+	write(ops []batchOp) error
+	keys(prefix string) []string
+	close() error
+}
+
+// kvStore implements Store on top of a key/value backend
+type kvStore struct {
+	kv kvBackend
+}
+
+func (s *kvStore) GetBlockByHeight(height int) (Block, error) {
+	if height < 0 {
+		return Block{}, ErrNotFound
+	}
+	data, err := s.Get(blockHeightKey(height))
+	if err != nil {
+		return Block{}, err
+	}
+
+	var block Block
+	if err := json.Unmarshal(data, &block); err != nil {
+		return Block{}, fmt.Errorf("store: decoding block %d: %w", height, err)
+	}
+	return block, nil
+}
+
+func (s *kvStore) GetBlockByHash(hash string) (Block, error) {
+	data, err := s.Get(blockHashKey(hash))
+	if err != nil {
+		return Block{}, err
+	}
+	height, err := decodeHeight(data)
+	if err != nil {
+		return Block{}, err
+	}
+	return s.GetBlockByHeight(height)
+}
+
+func (s *kvStore) Get(key []byte) ([]byte, error) {
+	value, ok, err := s.kv.get(string(key))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+func (s *kvStore) NewBatch() Batch {
+	return &kvBatch{store: s}
+}
+
+func (s *kvStore) NewIterator(prefix []byte) Iterator {
+	return &kvIterator{store: s, keys: s.kv.keys(string(prefix)), pos: -1}
+}
+
+func (s *kvStore) Close() error {
+	return s.kv.close()
+}
+
+// kvBatch buffers operations until Commit
+type kvBatch struct {
+	store *kvStore
+	ops   []batchOp
+}
+
+func (b *kvBatch) PutBlock(block Block) error {
+	data, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+	b.Put(blockHeightKey(block.Index), data)
+	b.Put(blockHashKey(block.Hash), encodeHeight(block.Index))
+	return nil
+}
+
+func (b *kvBatch) Put(key, value []byte) {
+	if value == nil {
+		value = []byte{}
+	}
+	b.ops = append(b.ops, batchOp{key: string(key), value: append([]byte{}, value...)})
+}
+
+func (b *kvBatch) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp{key: string(key)})
+}
+
+func (b *kvBatch) Commit() error {
+	if len(b.ops) == 0 {
+		return nil
+	}
+	err := b.store.kv.write(b.ops)
+	b.ops = nil
+	return err
+}
+
+// kvIterator iterates over a snapshot of keys, loading values lazily
+type kvIterator struct {
+	store *kvStore
+	keys  []string
+	pos   int
+	value []byte
+	err   error
+}
+
+func (it *kvIterator) Next() bool {
+	for it.err == nil {
+		it.pos++
+		if it.pos >= len(it.keys) {
+			return false
+		}
+
+		value, ok, err := it.store.kv.get(it.keys[it.pos])
+		if err != nil {
+			it.err = err
+			return false
+		}
+		// Skip keys deleted after the snapshot was taken
+		if ok {
+			it.value = value
+			return true
+		}
+	}
+	return false
+}
+
+func (it *kvIterator) Key() []byte {
+	return []byte(it.keys[it.pos])
+}
+
+func (it *kvIterator) Value() []byte {
+	return it.value
+}
+
+func (it *kvIterator) Error() error {
+	return it.err
+}
+
+func (it *kvIterator) Release() {
+	it.keys = nil
+}
+
+// memoryKV keeps everything in a map. It is intended for tests and
+// throwaway nodes.
+type memoryKV struct {
+	data map[string][]byte
+	mu   sync.RWMutex
+}
+
+// NewMemoryStore creates an in-memory store
+func NewMemoryStore() Store {
+	return &kvStore{kv: &memoryKV{data: make(map[string][]byte)}}
+}
+
+func (m *memoryKV) get(key string) ([]byte, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	value, ok := m.data[key]
+	return value, ok, nil
+}
+
+func (m *memoryKV) write(ops []batchOp) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, op := range ops {
+		if op.value == nil {
+			delete(m.data, op.key)
+		} else {
+			m.data[op.key] = op.value
+		}
+	}
+	return nil
+}
+
+func (m *memoryKV) keys(prefix string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return sortedKeys(m.data, prefix)
+}
+
+func (m *memoryKV) close() error {
+	return nil
+}
+
+// sortedKeys returns the keys of m under prefix in ascending order
+func sortedKeys[V any](m map[string]V, prefix string) []string {
+	keys := make([]string, 0)
+	for key := range m {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,331 @@
+package blockchain
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	diskLogName = "chain.log"
+
+	// A batch record is: magic, op count, payload length, payload, CRC-32
+	// of the payload. Each op is: op type, uvarint key length, key and, for
+	// puts, uvarint value length and value.
+	batchMagic = byte('B')
+	opPut      = byte(1)
+	opDelete   = byte(2)
+
+	// The log is compacted once it is larger than compactMinSize and less
+	// than half of it is live data.
+	compactMinSize = 64 << 20
+)
+
+// valueRef locates a value inside the log file
+type valueRef struct {
+	offset int64
+	length int
+}
+
+// diskKV is an append-only log with an in-memory index of key offsets.
+// Every batch is written as one checksummed record and fsynced, so a crash
+// can only lose a trailing partially written batch, which is discarded on
+// the next open. Damage anywhere else fails the open rather than losing
+// the batches after it.
+type diskKV struct {
+	dir       string
+	file      *os.File
+	size      int64
+	liveBytes int64
+	index     map[string]valueRef
+	mu        sync.RWMutex
+}
+
+// OpenDiskStore opens or creates a disk-backed store in dir
+func OpenDiskStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	d := &diskKV{dir: dir, index: make(map[string]valueRef)}
+	if err := d.open(); err != nil {
+		return nil, err
+	}
+	return &kvStore{kv: d}, nil
+}
+
+// open opens the log file and rebuilds the index by replaying it
+func (d *diskKV) open() error {
+	f, err := os.OpenFile(filepath.Join(d.dir, diskLogName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	valid, err := d.replay(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	// Drop a torn batch left behind by a crash
+	if err := f.Truncate(valid); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+
+	d.file = f
+	d.size = valid
+	return nil
+}
+
+// replay reads all complete batches and returns the offset where the valid
+// part of the log ends. Only a torn last batch, cut short or with a bad
+// checksum where it ends at the end of the file, marks that end; any other
+// damage is an error.
+func (d *diskKV) replay(f *os.File) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(f)
+	var offset int64
+
+	for {
+		var header [9]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return offset, nil
+			}
+			return 0, fmt.Errorf("store: reading batch at offset %d: %w", offset, err)
+		}
+		if header[0] != batchMagic {
+			return 0, fmt.Errorf("store: corrupt batch at offset %d: bad magic byte %#x", offset, header[0])
+		}
+		count := binary.BigEndian.Uint32(header[1:5])
+		length := binary.BigEndian.Uint32(header[5:9])
+		end := offset + int64(len(header)) + int64(length) + 4
+
+		payload := make([]byte, length+4)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return offset, nil
+			}
+			return 0, fmt.Errorf("store: reading batch at offset %d: %w", offset, err)
+		}
+		sum := binary.BigEndian.Uint32(payload[length:])
+		payload = payload[:length]
+		if crc32.ChecksumIEEE(payload) != sum {
+			if end == info.Size() {
+				return offset, nil
+			}
+			return 0, fmt.Errorf("store: corrupt batch at offset %d: checksum mismatch", offset)
+		}
+
+		if err := d.indexBatch(payload, count, offset+int64(len(header))); err != nil {
+			return 0, fmt.Errorf("store: corrupt batch at offset %d: %w", offset, err)
+		}
+		offset = end
+	}
+}
+
+// indexBatch applies the ops of a batch payload located at base to the index
+func (d *diskKV) indexBatch(payload []byte, count uint32, base int64) error {
+	pos := 0
+	for i := uint32(0); i < count; i++ {
+		if pos >= len(payload) {
+			return errors.New("payload too short")
+		}
+		op := payload[pos]
+		pos++
+
+		klen, n := binary.Uvarint(payload[pos:])
+		if n <= 0 || pos+n+int(klen) > len(payload) {
+			return errors.New("bad key length")
+		}
+		pos += n
+		key := string(payload[pos : pos+int(klen)])
+		pos += int(klen)
+
+		d.drop(key)
+		switch op {
+		case opPut:
+			vlen, n := binary.Uvarint(payload[pos:])
+			if n <= 0 || pos+n+int(vlen) > len(payload) {
+				return errors.New("bad value length")
+			}
+			pos += n
+			d.index[key] = valueRef{offset: base + int64(pos), length: int(vlen)}
+			d.liveBytes += int64(len(key)) + int64(vlen)
+			pos += int(vlen)
+		case opDelete:
+		default:
+			return fmt.Errorf("unknown op %d", op)
+		}
+	}
+	return nil
+}
+
+// drop removes a key from the index and the live byte count
+func (d *diskKV) drop(key string) {
+	if ref, ok := d.index[key]; ok {
+		d.liveBytes -= int64(len(key)) + int64(ref.length)
+		delete(d.index, key)
+	}
+}
+
+func (d *diskKV) get(key string) ([]byte, bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	ref, ok := d.index[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	value := make([]byte, ref.length)
+	if _, err := d.file.ReadAt(value, ref.offset); err != nil {
+		return nil, false, fmt.Errorf("store: reading %q: %w", key, err)
+	}
+	return value, true, nil
+}
+
+func (d *diskKV) write(ops []batchOp) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.appendBatch(ops); err != nil {
+		return err
+	}
+	if err := d.file.Sync(); err != nil {
+		return err
+	}
+
+	if d.size > compactMinSize && d.liveBytes < d.size/2 {
+		return d.compact()
+	}
+	return nil
+}
+
+// appendBatch writes ops as one batch record at the end of the log and
+// updates the index. The caller must hold the write lock.
+func (d *diskKV) appendBatch(ops []batchOp) error {
+	record := encodeBatch(ops)
+	if _, err := d.file.WriteAt(record, d.size); err != nil {
+		// Leave the torn record to be discarded on the next open
+		return fmt.Errorf("store: writing batch: %w", err)
+	}
+
+	payload := record[9 : len(record)-4]
+	if err := d.indexBatch(payload, uint32(len(ops)), d.size+9); err != nil {
+		return err
+	}
+	d.size += int64(len(record))
+	return nil
+}
+
+// encodeBatch serializes ops into a batch record
+func encodeBatch(ops []batchOp) []byte {
+	var payload []byte
+	for _, op := range ops {
+		if op.value == nil {
+			payload = append(payload, opDelete)
+		} else {
+			payload = append(payload, opPut)
+		}
+		payload = binary.AppendUvarint(payload, uint64(len(op.key)))
+		payload = append(payload, op.key...)
+		if op.value != nil {
+			payload = binary.AppendUvarint(payload, uint64(len(op.value)))
+			payload = append(payload, op.value...)
+		}
+	}
+
+	record := make([]byte, 9, 9+len(payload)+4)
+	record[0] = batchMagic
+	binary.BigEndian.PutUint32(record[1:5], uint32(len(ops)))
+	binary.BigEndian.PutUint32(record[5:9], uint32(len(payload)))
+	record = append(record, payload...)
+	return binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(payload))
+}
+
+// compact rewrites the log with only live keys and atomically replaces the
+// old file. The caller must hold the write lock.
+func (d *diskKV) compact() error {
+	tmpPath := filepath.Join(d.dir, diskLogName+".compact")
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	next := &diskKV{dir: d.dir, file: tmp, index: make(map[string]valueRef)}
+	var ops []batchOp
+	var opsSize int
+	for _, key := range sortedKeys(d.index, "") {
+		ref := d.index[key]
+		value := make([]byte, ref.length)
+		if _, err := d.file.ReadAt(value, ref.offset); err != nil {
+			tmp.Close()
+			return err
+		}
+
+		ops = append(ops, batchOp{key: key, value: value})
+		opsSize += len(key) + len(value)
+		if opsSize >= 4<<20 {
+			if err := next.appendBatch(ops); err != nil {
+				tmp.Close()
+				return err
+			}
+			ops, opsSize = nil, 0
+		}
+	}
+	if len(ops) > 0 {
+		if err := next.appendBatch(ops); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := os.Rename(tmpPath, filepath.Join(d.dir, diskLogName)); err != nil {
+		tmp.Close()
+		return err
+	}
+	d.file.Close()
+	d.file = tmp
+	d.size = next.size
+	d.liveBytes = next.liveBytes
+	d.index = next.index
+	return nil
+}
+
+func (d *diskKV) keys(prefix string) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return sortedKeys(d.index, prefix)
+}
+
+func (d *diskKV) close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file = nil
+	return err
+}
@@ -0,0 +1,370 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"usdtg-chain/evm"
+)
+
+// testStores returns a fresh store of every backend
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	disk, err := OpenDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{StorageMemory: NewMemoryStore(), StorageDisk: disk}
+}
+
+// iterate returns the keys and values under prefix
+func iterate(t *testing.T, s Store, prefix string) (keys, values []string) {
+	t.Helper()
+	it := s.NewIterator([]byte(prefix))
+	defer it.Release()
+	for it.Next() {
+		keys = append(keys, string(it.Key()))
+		values = append(values, string(it.Value()))
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	return keys, values
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			defer s.Close()
+
+			if _, err := s.Get([]byte("s/a")); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("empty store: got %v", err)
+			}
+
+			block := Block{Index: 3, Hash: "h3", PrevHash: "h2", Nonce: 9, Transactions: []Transaction{{From: "a", To: "b", Amount: 1.5, Token: NativeToken, Hash: "t"}}}
+			batch := s.NewBatch()
+			if err := batch.PutBlock(block); err != nil {
+				t.Fatal(err)
+			}
+			batch.Put([]byte("s/b"), []byte("2"))
+			batch.Put([]byte("s/a"), []byte("1"))
+			batch.Put([]byte("s/c"), nil)
+			batch.Put([]byte("t/a"), []byte("other"))
+			// Nothing is visible before Commit
+			if _, err := s.Get([]byte("s/a")); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("uncommitted put visible: %v", err)
+			}
+			if err := batch.Commit(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := s.Get([]byte("s/a")); err != nil || string(got) != "1" {
+				t.Fatalf("s/a = %q, %v", got, err)
+			}
+			if got, err := s.Get([]byte("s/c")); err != nil || len(got) != 0 {
+				t.Fatalf("empty value s/c = %q, %v", got, err)
+			}
+			for _, get := range []func() (Block, error){
+				func() (Block, error) { return s.GetBlockByHeight(3) },
+				func() (Block, error) { return s.GetBlockByHash("h3") },
+			} {
+				got, err := get()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Hash != "h3" || got.PrevHash != "h2" || got.Nonce != 9 || len(got.Transactions) != 1 || got.Transactions[0].Amount != 1.5 {
+					t.Fatalf("block round trip: got %+v", got)
+				}
+			}
+			if _, err := s.GetBlockByHeight(4); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("missing block: got %v", err)
+			}
+			if _, err := s.GetBlockByHeight(-1); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("negative height: got %v", err)
+			}
+
+			keys, values := iterate(t, s, "s/")
+			if want := []string{"s/a", "s/b", "s/c"}; !slices.Equal(keys, want) {
+				t.Fatalf("keys %q, want %q", keys, want)
+			}
+			if want := []string{"1", "2", ""}; !slices.Equal(values, want) {
+				t.Fatalf("values %q, want %q", values, want)
+			}
+
+			// Overwrite and delete in one batch; the iterator skips keys
+			// deleted after it was created
+			it := s.NewIterator([]byte("s/"))
+			defer it.Release()
+			batch = s.NewBatch()
+			batch.Put([]byte("s/a"), []byte("10"))
+			batch.Delete([]byte("s/b"))
+			if err := batch.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			var seen []string
+			for it.Next() {
+				seen = append(seen, string(it.Key())+"="+string(it.Value()))
+			}
+			if want := []string{"s/a=10", "s/c="}; !slices.Equal(seen, want) {
+				t.Fatalf("iterated %q, want %q", seen, want)
+			}
+			if _, err := s.Get([]byte("s/b")); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("deleted key: got %v", err)
+			}
+		})
+	}
+}
+
+func TestDiskStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, value := range []string{"1", "2", "3"} {
+		batch := s.NewBatch()
+		batch.Put([]byte("k"), []byte(value))
+		batch.Put(encodeHeight(i), []byte(value))
+		if err := batch.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	batch := s.NewBatch()
+	batch.Delete(encodeHeight(1))
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A batch torn by a crash is dropped on the next open
+	path := filepath.Join(dir, diskLogName)
+	torn := encodeBatch([]batchOp{{key: "k", value: []byte("4")}})
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(torn[:len(torn)-1]); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	s, err = OpenDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got, err := s.Get([]byte("k")); err != nil || string(got) != "3" {
+		t.Fatalf("k = %q, %v after reopening, want 3", got, err)
+	}
+	if _, err := s.Get(encodeHeight(1)); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("deleted key after reopening: got %v", err)
+	}
+	if got, err := s.Get(encodeHeight(2)); err != nil || string(got) != "3" {
+		t.Fatalf("height key 2 = %q, %v", got, err)
+	}
+
+	// Writes go on after the truncated tail
+	batch = s.NewBatch()
+	batch.Put([]byte("k"), []byte("5"))
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get([]byte("k")); string(got) != "5" {
+		t.Fatalf("k = %q after writing past a torn batch, want 5", got)
+	}
+}
+
+// TestMemoryStoreChainRoundTrip loads a chain from the memory store it was
+// persisted to
+func TestMemoryStoreChainRoundTrip(t *testing.T) {
+	bc := NewBlockchain()
+	for i := 0; i < 3; i++ {
+		if _, err := bc.MinePendingTransactions(testMiner); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loaded, err := newBlockchain(DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.store.Close()
+	loaded.store = bc.store
+	defer bc.Close()
+	if ok, err := loaded.load(); err != nil || !ok {
+		t.Fatalf("load: %v, %v", ok, err)
+	}
+
+	if len(loaded.Chain) != len(bc.Chain) {
+		t.Fatalf("loaded %d blocks, want %d", len(loaded.Chain), len(bc.Chain))
+	}
+	for i := range bc.Chain {
+		if loaded.Chain[i].Hash != bc.Chain[i].Hash {
+			t.Fatalf("block %d hash %s, want %s", i, loaded.Chain[i].Hash, bc.Chain[i].Hash)
+		}
+	}
+	if got, want := loaded.GetBalance(testMiner)[NativeToken], 3*bc.MiningReward; got != want {
+		t.Fatalf("miner balance %v, want %v", got, want)
+	}
+	if loaded.evm.StateRoot() != bc.evm.StateRoot() {
+		t.Fatal("EVM state root differs after loading")
+	}
+}
+
+// TestEVMStoragePersistedPerSlot checks that storage slots are stored
+// under keys of their own, written and deleted one by one, and that
+// accounts stored with their storage inline have it moved out
+func TestEVMStoragePersistedPerSlot(t *testing.T) {
+	bc := newDevChain(t)
+	defer bc.Close()
+
+	// Init code storing 42 in slot 7 and deploying a runtime that stores
+	// the first calldata word in the slot given by the second
+	runtime := []byte{byte(evm.PUSH1), 0, byte(evm.CALLDATALOAD), byte(evm.PUSH1), 32, byte(evm.CALLDATALOAD), byte(evm.SSTORE), byte(evm.STOP)}
+	code := append([]byte{
+		byte(evm.PUSH1), 42, byte(evm.PUSH1), 7, byte(evm.SSTORE),
+		byte(evm.PUSH1), byte(len(runtime)), byte(evm.DUP1), byte(evm.PUSH1), 16, byte(evm.PUSH1), 0, byte(evm.CODECOPY),
+		byte(evm.PUSH1), 0, byte(evm.RETURN),
+	}, runtime...)
+	nonce := uint64(0)
+	send := func(to *evm.Address, data []byte) *evm.EVMTransaction {
+		tx := &evm.EVMTransaction{To: to, Value: new(big.Int), Data: data, Gas: 100_000, GasPrice: new(big.Int), Nonce: nonce}
+		nonce++
+		if _, err := bc.SubmitEVMTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bc.MinePendingTransactions(testMiner); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	tx := send(nil, code)
+	contract := *bc.evm.GetTransactionResult(tx.Hash).ContractAddress
+	slot := func(n byte) evm.Hash { return evm.BytesToHash([]byte{n}) }
+	store := func(key, value byte) {
+		data := make([]byte, 64)
+		data[31], data[63] = value, key
+		if result := bc.evm.GetTransactionResult(send(&contract, data).Hash); !result.Success {
+			t.Fatal(result.Error)
+		}
+	}
+	stored := func() map[evm.Hash]evm.Hash {
+		keys, values := iterate(t, bc.store, string(evmStoragePrefix(contract)))
+		slots := make(map[evm.Hash]evm.Hash)
+		for i, key := range keys {
+			slots[evm.BytesToHash([]byte(key[len(evmStoragePrefix(contract)):]))] = evm.BytesToHash([]byte(values[i]))
+		}
+		return slots
+	}
+
+	store(8, 1)
+	store(7, 0)
+	if got := stored(); len(got) != 1 || got[slot(8)] != slot(1) {
+		t.Fatalf("stored slots %v, want only slot 8 = 1", got)
+	}
+	data, err := bc.store.Get(evmAccountKey(contract))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var account evm.Account
+	if err := json.Unmarshal(data, &account); err != nil {
+		t.Fatal(err)
+	}
+	if account.Storage != nil {
+		t.Fatalf("account record holds storage %v", account.Storage)
+	}
+
+	// Rewrite the account as stores did before slots had their own keys
+	account.Storage = map[evm.Hash]evm.Hash{slot(8): slot(1)}
+	data, err = json.Marshal(&account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := bc.store.NewBatch()
+	batch.Put(evmAccountKey(contract), data)
+	batch.Delete(evmStorageKey(contract, slot(8)))
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.EVM = evm.NewEVM()
+	loaded, err := newBlockchain(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.store.Close()
+	loaded.store = bc.store
+	if ok, err := loaded.load(); err != nil || !ok {
+		t.Fatalf("load: %v, %v", ok, err)
+	}
+	if got := loaded.evm.GetStorage(contract, slot(8)); got != slot(1) {
+		t.Fatalf("slot 8 = %s after loading, want 1", got)
+	}
+	if _, err := loaded.MinePendingTransactions(testMiner); err != nil {
+		t.Fatal(err)
+	}
+	if got := stored(); len(got) != 1 || got[slot(8)] != slot(1) {
+		t.Fatalf("stored slots %v after the next block, want slot 8 = 1", got)
+	}
+}
+
+// TestDiskStoreCorruption checks that only a torn last batch is dropped on
+// open; damage anywhere else is an error
+func TestDiskStoreCorruption(t *testing.T) {
+	records := [][]byte{
+		encodeBatch([]batchOp{{key: "a", value: []byte("1")}}),
+		encodeBatch([]batchOp{{key: "b", value: []byte("2")}}),
+	}
+	log := append(append([]byte{}, records[0]...), records[1]...)
+	last := len(records[0])
+
+	tests := []struct {
+		name    string
+		damage  func(log []byte) []byte
+		keepsB  bool // whether the second batch survives
+		wantErr bool
+	}{
+		{"torn header", func(log []byte) []byte { return append(log, batchMagic, 0, 0) }, true, false},
+		{"torn payload", func(log []byte) []byte { return log[:len(log)-3] }, false, false},
+		{"bad checksum at the end", func(log []byte) []byte { log[len(log)-1] ^= 0xff; return log }, false, false},
+		{"bad checksum in the middle", func(log []byte) []byte { log[last-1] ^= 0xff; return log }, false, true},
+		{"bad magic byte", func(log []byte) []byte { log[last] = 'X'; return log }, false, true},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		damaged := tt.damage(append([]byte{}, log...))
+		if err := os.WriteFile(filepath.Join(dir, diskLogName), damaged, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		s, err := OpenDiskStore(dir)
+		if tt.wantErr {
+			if err == nil {
+				s.Close()
+				t.Fatalf("%s: opened", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got, err := s.Get([]byte("a")); err != nil || string(got) != "1" {
+			t.Fatalf("%s: a = %q, %v", tt.name, got, err)
+		}
+		if tt.keepsB {
+			if got, err := s.Get([]byte("b")); err != nil || string(got) != "2" {
+				t.Fatalf("%s: b = %q, %v", tt.name, got, err)
+			}
+		} else if _, err := s.Get([]byte("b")); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%s: torn batch kept: %v", tt.name, err)
+		}
+		s.Close()
+	}
+}
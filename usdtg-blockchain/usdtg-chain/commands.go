@@ -0,0 +1,230 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"usdtg-chain/blockchain"
+	"usdtg-chain/evm"
+)
+
+// runCommand dispatches CLI subcommands. It returns false when no known
+// subcommand was given so main can fall back to the default server.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	var err error
+	switch args[0] {
+	case "node":
+		err = nodeCommand(args[1:])
+	case "export":
+		err = exportCommand(args[1:])
+	case "import":
+		err = importCommand(args[1:])
+	default:
+		return false
+	}
+
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	return true
+}
+
+// nodeFlags registers the flags shared by commands that start a node
+type nodeFlags struct {
+	configPath *string
+	pruning    *string
+	keepRecent *int
+	storage    *string
+	dataDir    *string
+	p2p        *bool
+	p2pListen  *string
+	peers      *string
+	seeds      *string
+	allowlist  *string
+	adminToken *string
+	feeRecip   *string
+	dev        *bool
+}
+
+func addNodeFlags(fs *flag.FlagSet) nodeFlags {
+	return nodeFlags{
+		configPath: fs.String("config", "", "JSON config file"),
+		pruning:    fs.String("pruning", "", "pruning mode: archive or pruned"),
+		keepRecent: fs.Int("keep-recent", 0, "full blocks to keep in pruned mode"),
+		storage:    fs.String("storage", "", "storage backend: memory or disk"),
+		dataDir:    fs.String("data-dir", "", "data directory for the disk backend"),
+		p2p:        fs.Bool("p2p", false, "enable peer-to-peer networking"),
+		p2pListen:  fs.String("p2p-listen", "", "P2P listen address"),
+		peers:      fs.String("peers", "", "comma separated peer addresses to keep connected"),
+		seeds:      fs.String("seeds", "", "comma separated seed addresses used for peer discovery"),
+		allowlist:  fs.String("allowlist", "", "comma separated node IDs allowed to connect"),
+		adminToken: fs.String("admin-token", "", "bearer token for admin endpoints"),
+		feeRecip:   fs.String("fee-recipient", "", "address credited with EVM transaction fees"),
+		dev:        fs.Bool("dev", false, "dev mode: accept unsigned EVM transactions and run the USDTg faucet"),
+	}
+}
+
+// load reads the config file and applies flag overrides
+func (f nodeFlags) load() (NodeConfig, error) {
+	cfg, err := LoadNodeConfig(*f.configPath)
+	if err != nil {
+		return cfg, err
+	}
+	if *f.pruning != "" {
+		cfg.Chain.Pruning.Mode = blockchain.PruningMode(*f.pruning)
+	}
+	if *f.keepRecent > 0 {
+		cfg.Chain.Pruning.KeepRecent = *f.keepRecent
+	}
+	if *f.storage != "" {
+		cfg.Chain.Storage.Backend = *f.storage
+	}
+	if *f.dataDir != "" {
+		cfg.Chain.Storage.Path = *f.dataDir
+	}
+	if *f.p2p {
+		cfg.P2P.Enabled = true
+	}
+	if *f.p2pListen != "" {
+		cfg.P2P.ListenAddr = *f.p2pListen
+	}
+	if *f.peers != "" {
+		cfg.P2P.Peers = append(cfg.P2P.Peers, strings.Split(*f.peers, ",")...)
+	}
+	if *f.seeds != "" {
+		cfg.P2P.Seeds = append(cfg.P2P.Seeds, strings.Split(*f.seeds, ",")...)
+	}
+	if *f.adminToken != "" {
+		cfg.AdminToken = *f.adminToken
+	}
+	if *f.allowlist != "" {
+		cfg.P2P.Allowlist = append(cfg.P2P.Allowlist, strings.Split(*f.allowlist, ",")...)
+	}
+	if *f.feeRecip != "" {
+		addr, err := evm.ParseAddress(*f.feeRecip)
+		if err != nil {
+			return cfg, fmt.Errorf("fee recipient: %w", err)
+		}
+		cfg.FeeRecipient = addr
+	}
+	if *f.dev {
+		cfg.DevMode = true
+	}
+	return cfg, cfg.Validate()
+}
+
+// nodeCommand starts the full blockchain node
+func nodeCommand(args []string) error {
+	fs := flag.NewFlagSet("node", flag.ContinueOnError)
+	nf := addNodeFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := nf.load()
+	if err != nil {
+		return err
+	}
+	return StartServer(cfg)
+}
+
+// importCommand starts a fresh node from an export file. Every block is
+// validated before the node starts serving.
+func importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	nf := addNodeFlags(fs)
+	in := fs.String("in", "", "export file to import")
+	verifyOnly := fs.Bool("verify-only", false, "validate the file and exit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return fmt.Errorf("import: -in is required")
+	}
+
+	cfg, err := nf.load()
+	if err != nil {
+		return err
+	}
+	cfg.Import = *in
+
+	if *verifyOnly {
+		// Validate in memory so the configured store is left untouched
+		cfg.Chain.Storage = blockchain.StorageConfig{Backend: blockchain.StorageMemory}
+		// Replaying unsigned EVM and faucet transactions needs dev mode, as
+		// when serving
+		cfg.Chain.EVM = evm.NewEVM()
+		cfg.Chain.EVM.AllowUnsigned = cfg.DevMode
+		cfg.Chain.Faucet = cfg.DevMode
+		chain, err := openChain(cfg)
+		if err != nil {
+			return err
+		}
+		defer chain.Close()
+		fmt.Printf("✅ Dosya geçerli, son blok: %d\n", chain.GetLatestBlock().Index)
+		return nil
+	}
+	return StartServer(cfg)
+}
+
+// exportCommand downloads the chain from a running node into a file
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	node := fs.String("node", "http://localhost:8080", "node API address")
+	out := fs.String("out", "", "output file, - for stdout")
+	from := fs.Int("from", 0, "first height to export")
+	to := fs.Int("to", blockchain.LatestHeight, "last height to export, -1 for the head")
+	state := fs.Bool("state", false, "include the state at the head")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return fmt.Errorf("export: -out is required")
+	}
+
+	query := url.Values{}
+	query.Set("from", strconv.Itoa(*from))
+	query.Set("to", strconv.Itoa(*to))
+	query.Set("state", strconv.FormatBool(*state))
+
+	resp, err := http.Get(*node + "/api/blockchain/export?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("export: node returned %s: %s", resp.Status, body)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return err
+	}
+	if *out != "-" {
+		fmt.Printf("✅ %d byte yazıldı: %s\n", n, *out)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"usdtg-chain/blockchain"
+	"usdtg-chain/evm"
+	"usdtg-chain/p2p"
+)
+
+// NodeConfig holds the node configuration
+type NodeConfig struct {
+	ListenAddr string            `json:"listen_addr"`
+	Chain      blockchain.Config `json:"chain"`
+	P2P        p2p.Config        `json:"p2p"`
+	Import     string            `json:"import,omitempty"`
+	AdminToken string            `json:"admin_token,omitempty"`
+	// FeeRecipient receives the priority fee of EVM transactions
+	FeeRecipient evm.Address `json:"fee_recipient"`
+	// DevMode lets the EVM API execute unsigned transactions on behalf of
+	// any address. Never enable it on a shared node.
+	DevMode bool `json:"dev_mode,omitempty"`
+}
+
+// DefaultNodeConfig returns the configuration used when no file is given
+func DefaultNodeConfig() NodeConfig {
+	return NodeConfig{
+		ListenAddr: ":8080",
+		Chain:      blockchain.DefaultConfig(),
+		P2P:        p2p.DefaultConfig(),
+	}
+}
+
+// LoadNodeConfig reads a JSON config file on top of the defaults
+func LoadNodeConfig(path string) (NodeConfig, error) {
+	cfg := DefaultNodeConfig()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("config okunamadı: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("config parse edilemedi: %w", err)
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate checks the node configuration
+func (c NodeConfig) Validate() error {
+	if err := c.Chain.Pruning.Validate(); err != nil {
+		return err
+	}
+	if err := c.Chain.Storage.Validate(); err != nil {
+		return err
+	}
+	if c.P2P.Enabled {
+		return c.P2P.Validate()
+	}
+	return nil
+}
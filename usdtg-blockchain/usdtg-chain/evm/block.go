@@ -0,0 +1,258 @@
+package evm
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Header commits to the EVM part of a block: the transactions it
+// executed, their receipts and the state they left behind
+type Header struct {
+	Coinbase    Address `json:"coinbase"`
+	GasUsed     uint64  `json:"gas_used"`
+	TxRoot      Hash    `json:"transactions_root"`
+	ReceiptRoot Hash    `json:"receipts_root"`
+	StateRoot   Hash    `json:"state_root"`
+	LogsBloom   Bloom   `json:"logs_bloom"`
+}
+
+// Transfer moves native currency outside of EVM transactions, as the
+// native chain's own transactions and block rewards do. A nil From mints
+// the value.
+type Transfer struct {
+	From  *Address
+	To    Address
+	Value *big.Int
+}
+
+// TransactionsRoot returns the root of the trie mapping the RLP encoded
+// index of each transaction to its hash. Unsigned transactions have no
+// network encoding, so the hash stands in for it.
+func TransactionsRoot(txs []*EVMTransaction) Hash {
+	kv := make(map[string][]byte, len(txs))
+	for i, tx := range txs {
+		kv[string(rlpEncodeUint(uint64(i)))] = tx.Hash[:]
+	}
+	return trieRoot(kv)
+}
+
+// receiptsRoot returns the root of the trie mapping the RLP encoded index
+// of each receipt to its consensus encoding, as on Ethereum
+func receiptsRoot(receipts []*Receipt) Hash {
+	kv := make(map[string][]byte, len(receipts))
+	for i, receipt := range receipts {
+		kv[string(rlpEncodeUint(uint64(i)))] = receipt.encode()
+	}
+	return trieRoot(kv)
+}
+
+// CheckTransaction checks a transaction before it enters the mempool. It
+// must be authentic, see ApplyBlock, and able to run once its sender's
+// earlier transactions have: its nonce not used yet, its gas within the
+// block gas limit and its cost covered by the sender's current balance.
+// An unsigned transaction without a hash gets one.
+func (e *EVM) CheckTransaction(tx *EVMTransaction) error {
+	if !tx.Signed() && tx.Hash == (Hash{}) {
+		tx.Hash = tx.hash()
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if err := e.verifyTransaction(tx); err != nil {
+		return err
+	}
+	if e.receipts[tx.Hash] != nil {
+		return fmt.Errorf("%w: transaction %s", ErrAlreadyKnown, tx.Hash)
+	}
+	if nonce := e.StateDB.getNonce(tx.From); tx.Nonce < nonce {
+		return fmt.Errorf("%w: have %d, want at least %d", ErrNonceTooLow, tx.Nonce, nonce)
+	}
+	return e.validateFees(tx, e.blockContext())
+}
+
+// verifyTransaction checks that a transaction is what it claims to be: a
+// signed one must be signed by its sender and have the hash of its
+// encoding, an unsigned one needs AllowUnsigned and must have the hash of
+// its fields
+func (e *EVM) verifyTransaction(tx *EVMTransaction) error {
+	if tx.Value == nil {
+		return fmt.Errorf("transaction %s has no value", tx.Hash)
+	}
+	if !tx.Signed() {
+		if !e.AllowUnsigned {
+			return ErrUnsignedTx
+		}
+		if hash := tx.hash(); tx.Hash != hash {
+			return fmt.Errorf("transaction hash %s does not match its contents, which hash to %s", tx.Hash, hash)
+		}
+		return nil
+	}
+
+	from := tx.From
+	sender, err := Sender(tx, e.ChainID)
+	if err != nil {
+		return err
+	}
+	if from != (Address{}) && from != sender {
+		return fmt.Errorf("transaction %s: from %s is not the signer %s", tx.Hash, from, sender)
+	}
+	if hash := BytesToHash(Keccak256(tx.encode())); tx.Hash != hash {
+		return fmt.Errorf("transaction hash %s does not match its contents, which hash to %s", tx.Hash, hash)
+	}
+	return nil
+}
+
+// BuildBlock executes transactions from the mempool as the block with the
+// given number and time, paying fees to Block.Coinbase, and returns the
+// header of the result. The transfers come first; rejected lists the
+// indices of those whose sender could not pay, which were skipped.
+// Transactions then run in the given order, with another
+// pass over those skipped as long as one runs, so a nonce that arrived
+// early still gets in. Transactions that cannot run yet, because their
+// nonce is ahead, they no longer fit in the block or their sender cannot
+// pay, are left out. Those whose nonce was used meanwhile are returned as
+// stale, for the caller to drop. The state moves to the end of the block.
+func (e *EVM) BuildBlock(number, time uint64, transfers []Transfer, txs []*EVMTransaction) (rejected []int, included, stale []*EVMTransaction, header *Header) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	view := e.blockView(number, time, e.Block.Coinbase)
+	for i, transfer := range transfers {
+		if err := view.StateDB.applyTransfer(transfer); err != nil {
+			rejected = append(rejected, i)
+		}
+	}
+	for progress := true; progress; {
+		progress = false
+		var skipped []*EVMTransaction
+		for _, tx := range txs {
+			if view.StateDB.getNonce(tx.From) > tx.Nonce {
+				stale = append(stale, tx)
+				continue
+			}
+			if tx.Gas > view.gasLeft() {
+				skipped = append(skipped, tx)
+				continue
+			}
+			if _, err := view.applyTransaction(tx); err != nil {
+				skipped = append(skipped, tx)
+				continue
+			}
+			included = append(included, tx)
+			progress = true
+		}
+		txs = skipped
+	}
+
+	header = view.header(included)
+	e.commitView(view)
+	return rejected, included, stale, header
+}
+
+// ApplyBlock executes the transfers and then the transactions of a block,
+// in order, and checks the outcome against the block's header. Every
+// transfer must be covered and every transaction authentic and valid in
+// turn. The state only moves to the end of the block when everything
+// matches; on error it is left as it was.
+func (e *EVM) ApplyBlock(number, time uint64, transfers []Transfer, txs []*EVMTransaction, header *Header) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if number < e.Block.Number {
+		return fmt.Errorf("block %d is behind the current block %d", number, e.Block.Number)
+	}
+	if root := TransactionsRoot(txs); root != header.TxRoot {
+		return fmt.Errorf("transactions root mismatch: have %s, header has %s", root, header.TxRoot)
+	}
+
+	view := e.blockView(number, time, header.Coinbase)
+	for i, transfer := range transfers {
+		if err := view.StateDB.applyTransfer(transfer); err != nil {
+			return fmt.Errorf("transfer %d: %w", i, err)
+		}
+	}
+	for i, tx := range txs {
+		if err := view.verifyTransaction(tx); err != nil {
+			return fmt.Errorf("transaction %d: %w", i, err)
+		}
+		if tx.Gas > view.gasLeft() {
+			return fmt.Errorf("transaction %d: gas limit %d exceeds the %d gas left in the block", i, tx.Gas, view.gasLeft())
+		}
+		if _, err := view.applyTransaction(tx); err != nil {
+			return fmt.Errorf("transaction %d: %w", i, err)
+		}
+	}
+
+	got := view.header(txs)
+	switch {
+	case got.GasUsed != header.GasUsed:
+		return fmt.Errorf("gas used mismatch: have %d, header has %d", got.GasUsed, header.GasUsed)
+	case got.LogsBloom != header.LogsBloom:
+		return fmt.Errorf("logs bloom mismatch")
+	case got.ReceiptRoot != header.ReceiptRoot:
+		return fmt.Errorf("receipts root mismatch: have %s, header has %s", got.ReceiptRoot, header.ReceiptRoot)
+	case got.StateRoot != header.StateRoot:
+		return fmt.Errorf("state root mismatch: have %s, header has %s", got.StateRoot, header.StateRoot)
+	}
+	e.commitView(view)
+	return nil
+}
+
+// blockView returns a view over the current state to execute the given
+// block on. e itself only moves to the block in commitView. The caller
+// holds mu.
+func (e *EVM) blockView(number, time uint64, coinbase Address) *EVM {
+	block := e.Block
+	block.Number = number
+	block.Time = time
+	block.Coinbase = coinbase
+	block.PrevRandao = e.prevRandao(number)
+	return &EVM{
+		StateDB:       e.StateDB.copyOnWrite(),
+		ChainID:       e.ChainID,
+		Block:         block,
+		AllowUnsigned: e.AllowUnsigned,
+		receipts:      make(map[Hash]*Receipt),
+		blocks:        make(map[uint64]*blockReceipts),
+		precompiles:   e.precompiles,
+	}
+}
+
+// gasLeft returns the gas the block being executed has left
+func (e *EVM) gasLeft() uint64 {
+	if block := e.blocks[e.Block.Number]; block != nil {
+		return e.Block.GasLimit - block.gasUsed
+	}
+	return e.Block.GasLimit
+}
+
+// header returns the header of the block executed on e
+func (e *EVM) header(txs []*EVMTransaction) *Header {
+	header := &Header{
+		Coinbase:    e.Block.Coinbase,
+		TxRoot:      TransactionsRoot(txs),
+		ReceiptRoot: emptyRoot,
+		StateRoot:   e.StateDB.root(),
+	}
+	if block := e.blocks[e.Block.Number]; block != nil {
+		header.GasUsed = block.gasUsed
+		header.LogsBloom = block.bloom
+		header.ReceiptRoot = receiptsRoot(block.receipts)
+	}
+	return header
+}
+
+// commitView moves e to the block executed on view and takes over its
+// state changes and receipts; the caller holds mu
+func (e *EVM) commitView(view *EVM) {
+	e.setBlockNumber(view.Block.Number)
+	e.trackChanges(view)
+	e.StateDB.absorb(view.StateDB)
+	for hash, receipt := range view.receipts {
+		e.receipts[hash] = receipt
+	}
+	for number, block := range view.blocks {
+		e.blocks[number] = block
+	}
+}
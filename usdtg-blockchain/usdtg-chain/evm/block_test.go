@@ -0,0 +1,41 @@
+package evm
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestTransactionsRoot(t *testing.T) {
+	raw, _ := hex.DecodeString(eip155Raw)
+	tx, err := DecodeTransaction(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := hexHash(t, "33469b22e9f636356c4160a87eb19df52b7412e8eac32a4a55ffe88ea8350788"); tx.Hash != want {
+		t.Fatalf("transaction hash %s, want %s", tx.Hash, want)
+	}
+
+	// The trie maps index 0 to the transaction hash
+	want := hexHash(t, "0d68825e1a922c3d104d9d7eeb158ebb1c67d419c1c5abe55e17c3d1e37de47e")
+	if got := TransactionsRoot([]*EVMTransaction{tx}); got != want {
+		t.Fatalf("transactions root %s, want %s", got, want)
+	}
+	if got := TransactionsRoot(nil); got != emptyRoot {
+		t.Fatalf("transactions root of no transactions %s, want the empty root", got)
+	}
+}
+
+func TestReceiptsRoot(t *testing.T) {
+	// A legacy receipt with a log and a failed dynamic fee one
+	receipts := []*Receipt{
+		{Type: LegacyTxType, Status: ReceiptStatusSuccessful, CumulativeGasUsed: 21000, Logs: []*Log{testLog}, Bloom: CreateBloom([]*Log{testLog})},
+		{Type: DynamicFeeTxType, Status: ReceiptStatusFailed, CumulativeGasUsed: 42000},
+	}
+	want := hexHash(t, "412b76676cbe326cb58d8299820cfbe88efa17bcec4dbe1064018e5e1d7a6e26")
+	if got := receiptsRoot(receipts); got != want {
+		t.Fatalf("receipts root %s, want %s", got, want)
+	}
+	if got := receiptsRoot(nil); got != emptyRoot {
+		t.Fatalf("receipts root of no receipts %s, want the empty root", got)
+	}
+}
@@ -0,0 +1,80 @@
+package evm
+
+import (
+	"fmt"
+)
+
+// BloomLength is the size of a log bloom filter in bytes
+const BloomLength = 256
+
+// Bloom is a 2048-bit bloom filter over the addresses and topics of a set
+// of logs. A receipt's bloom covers its logs and a block's bloom covers
+// all of its receipts, so a filter can skip blocks and receipts that
+// cannot contain a match.
+type Bloom [BloomLength]byte
+
+// bloomBits returns the three bits Ethereum sets for a value: the low 11
+// bits of the first three byte pairs of its Keccak-256 hash
+func bloomBits(data []byte) [3]uint {
+	hash := Keccak256(data)
+	var bits [3]uint
+	for i := range bits {
+		bits[i] = (uint(hash[2*i])<<8 | uint(hash[2*i+1])) & 2047
+	}
+	return bits
+}
+
+// Add sets the bits of data in the filter
+func (b *Bloom) Add(data []byte) {
+	for _, bit := range bloomBits(data) {
+		b[BloomLength-1-bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// Test reports whether data may have been added to the filter. False
+// positives are possible, false negatives are not.
+func (b *Bloom) Test(data []byte) bool {
+	for _, bit := range bloomBits(data) {
+		if b[BloomLength-1-bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Or merges other into the filter
+func (b *Bloom) Or(other Bloom) {
+	for i := range b {
+		b[i] |= other[i]
+	}
+}
+
+// CreateBloom returns the bloom of the addresses and topics of logs
+func CreateBloom(logs []*Log) Bloom {
+	var b Bloom
+	for _, log := range logs {
+		b.Add(log.Address[:])
+		for _, topic := range log.Topics {
+			b.Add(topic[:])
+		}
+	}
+	return b
+}
+
+// MarshalText encodes the bloom in hex
+func (b Bloom) MarshalText() ([]byte, error) {
+	return Bytes(b[:]).MarshalText()
+}
+
+// UnmarshalText parses a 0x-prefixed bloom of exactly 256 bytes
+func (b *Bloom) UnmarshalText(text []byte) error {
+	var raw Bytes
+	if err := raw.UnmarshalText(text); err != nil {
+		return err
+	}
+	if len(raw) != BloomLength {
+		return fmt.Errorf("invalid bloom: expected %d bytes, got %d", BloomLength, len(raw))
+	}
+	copy(b[:], raw)
+	return nil
+}
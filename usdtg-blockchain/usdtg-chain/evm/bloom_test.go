@@ -0,0 +1,27 @@
+package evm
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testLog is a log with one address and one topic
+var testLog = &Log{
+	Address: BytesToAddress(bytes.Repeat([]byte{0x11}, AddressLength)),
+	Topics:  []Hash{BytesToHash(bytes.Repeat([]byte{0x22}, HashLength))},
+}
+
+func TestCreateBloom(t *testing.T) {
+	// Each of the address and the topic sets three bits
+	var want Bloom
+	for i, b := range map[int]byte{104: 0x20, 127: 0x10, 167: 0x01, 195: 0x02, 215: 0x80, 231: 0x02} {
+		want[i] = b
+	}
+	bloom := CreateBloom([]*Log{testLog})
+	if bloom != want {
+		t.Fatalf("bloom %x, want %x", bloom, want)
+	}
+	if !bloom.Test(testLog.Address[:]) || !bloom.Test(testLog.Topics[0][:]) || bloom.Test(testSender[:]) {
+		t.Fatal("bloom does not test positive for exactly what was added")
+	}
+}
@@ -0,0 +1,814 @@
+package evm
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"math/bits"
+)
+
+// BN254 (alt_bn128), the pairing friendly curve of the 0x06 to 0x08
+// precompiles (EIP-196, EIP-197). G1 is y² = x³ + 3 over Fp. G2 is the
+// order r subgroup of the twist y² = x³ + 3/ξ over Fp2 = Fp[i]/(i² + 1),
+// with ξ = 9 + i. Pairings land in Fp12 = Fp2[w]/(w⁶ - ξ), into which
+// the twist maps by (x, y) → (x·w², y·w³).
+//
+// Field elements are four 64-bit limbs in Montgomery form and points are
+// kept in Jacobian coordinates (x = X/Z², y = Y/Z³), so that no big.Int
+// is allocated and no inversion is needed until a result is encoded. The
+// pairing is the optimal ate pairing, with a Miller loop of length 6u + 2
+// over G2 shared by all pairs of a check.
+
+var (
+	bn256P, _ = new(big.Int).SetString("21888242871839275222246405745257275088696311157297823662689037894645226208583", 10)
+	bn256R, _ = new(big.Int).SetString("21888242871839275222246405745257275088548364400416034343698204186575808495617", 10)
+
+	// bn256U is the parameter the curve is generated from, p and r being
+	// polynomials in it
+	bn256U = new(big.Int).SetUint64(4965661367192848881)
+	// bn256AteLoop is 6u + 2
+	bn256AteLoop = new(big.Int).Add(new(big.Int).Mul(bn256U, big.NewInt(6)), big.NewInt(2))
+
+	// fpModulus is p as limbs and fpNegInv is -1/p mod 2⁶⁴, for Montgomery
+	// reduction
+	fpModulus = fpLimbs(bn256P)
+	fpNegInv  = func() uint64 {
+		// Newton's iteration doubles the correct low bits of 1/p each
+		// step, starting from one
+		inv := uint64(1)
+		for i := 0; i < 6; i++ {
+			inv *= 2 - fpModulus[0]*inv
+		}
+		return -inv
+	}()
+	// fpR2 is 2⁵¹² mod p, by which a number is moved into Montgomery form
+	fpR2 = fpLimbs(new(big.Int).Mod(new(big.Int).Lsh(big.NewInt(1), 512), bn256P))
+
+	fpOne    = fpFromBig(big.NewInt(1))
+	bn256B   = fpFromBig(big.NewInt(3))
+	bn256Xi  = fp2{fpFromBig(big.NewInt(9)), fpOne}
+	bn256B2  = fp2{a: bn256B}.mul(bn256Xi.inverse())
+	fp2One   = fp2{a: fpOne}
+	fp12Unit = fp12{fp2One}
+
+	// bn256Frob1 holds ξ^(k(p - 1)/6) and bn256Frob2 ξ^(k(p² - 1)/6), by
+	// which raising to p and p² scales the coefficient of wᵏ
+	bn256Frob1 = bn256FrobeniusCoefficients(new(big.Int).Set(bn256P))
+	bn256Frob2 = bn256FrobeniusCoefficients(new(big.Int).Mul(bn256P, bn256P))
+)
+
+// Errors of the bn256 precompiles
+var (
+	errBN256Coordinate = errors.New("bn256: coordinate not in field")
+	errBN256NotOnCurve = errors.New("bn256: point not on curve")
+	errBN256NotInGroup = errors.New("bn256: G2 point not in subgroup")
+)
+
+// bn256FrobeniusCoefficients returns ξ^(k(q - 1)/6) for k = 0 to 5
+func bn256FrobeniusCoefficients(q *big.Int) [6]fp2 {
+	e := q.Sub(q, big.NewInt(1))
+	e.Div(e, big.NewInt(6))
+	gamma := bn256Xi.exp(e)
+	var c [6]fp2
+	c[0] = fp2One
+	for k := 1; k < 6; k++ {
+		c[k] = c[k-1].mul(gamma)
+	}
+	return c
+}
+
+// fp is an element of Fp in Montgomery form, a·2²⁵⁶ mod p, least
+// significant limb first. The zero value is zero.
+type fp [4]uint64
+
+// fpLimbs splits v, which must be below 2²⁵⁶, into limbs
+func fpLimbs(v *big.Int) fp {
+	var buf [32]byte
+	v.FillBytes(buf[:])
+	var z fp
+	for i := range z {
+		z[i] = binary.BigEndian.Uint64(buf[24-8*i:])
+	}
+	return z
+}
+
+// fpFromBig returns v mod p in Montgomery form
+func fpFromBig(v *big.Int) fp {
+	return fpLimbs(new(big.Int).Mod(v, bn256P)).mul(fpR2)
+}
+
+// big returns x out of Montgomery form
+func (x fp) big() *big.Int {
+	z := x.mul(fp{1})
+	var buf [32]byte
+	for i := range z {
+		binary.BigEndian.PutUint64(buf[24-8*i:], z[i])
+	}
+	return new(big.Int).SetBytes(buf[:])
+}
+
+func (x fp) isZero() bool {
+	return x == fp{}
+}
+
+// reduce subtracts p from x, which must be below 2p, if x ≥ p
+func (x fp) reduce() fp {
+	var z fp
+	var b uint64
+	z[0], b = bits.Sub64(x[0], fpModulus[0], 0)
+	z[1], b = bits.Sub64(x[1], fpModulus[1], b)
+	z[2], b = bits.Sub64(x[2], fpModulus[2], b)
+	z[3], b = bits.Sub64(x[3], fpModulus[3], b)
+	if b != 0 {
+		return x
+	}
+	return z
+}
+
+// add returns x + y. p is below 2²⁵⁴, so the sum does not overflow.
+func (x fp) add(y fp) fp {
+	var z fp
+	var c uint64
+	z[0], c = bits.Add64(x[0], y[0], 0)
+	z[1], c = bits.Add64(x[1], y[1], c)
+	z[2], c = bits.Add64(x[2], y[2], c)
+	z[3], _ = bits.Add64(x[3], y[3], c)
+	return z.reduce()
+}
+
+func (x fp) double() fp {
+	return x.add(x)
+}
+
+func (x fp) sub(y fp) fp {
+	var z fp
+	var b uint64
+	z[0], b = bits.Sub64(x[0], y[0], 0)
+	z[1], b = bits.Sub64(x[1], y[1], b)
+	z[2], b = bits.Sub64(x[2], y[2], b)
+	z[3], b = bits.Sub64(x[3], y[3], b)
+	if b != 0 {
+		var c uint64
+		z[0], c = bits.Add64(z[0], fpModulus[0], 0)
+		z[1], c = bits.Add64(z[1], fpModulus[1], c)
+		z[2], c = bits.Add64(z[2], fpModulus[2], c)
+		z[3], _ = bits.Add64(z[3], fpModulus[3], c)
+	}
+	return z
+}
+
+func (x fp) neg() fp {
+	return fp{}.sub(x)
+}
+
+// mul returns x·y by interleaved Montgomery multiplication (CIOS). The
+// result is below 2p before the final reduction, as p is below 2²⁵⁴.
+func (x fp) mul(y fp) fp {
+	var t [5]uint64
+	for i := 0; i < 4; i++ {
+		// t += x·y[i]
+		var c uint64
+		for j := 0; j < 4; j++ {
+			hi, lo := bits.Mul64(x[j], y[i])
+			var cc uint64
+			lo, cc = bits.Add64(lo, t[j], 0)
+			hi += cc
+			lo, cc = bits.Add64(lo, c, 0)
+			hi += cc
+			t[j], c = lo, hi
+		}
+		t4, c5 := bits.Add64(t[4], c, 0)
+
+		// t = (t + m·p) / 2⁶⁴, with m chosen to clear the low limb
+		m := t[0] * fpNegInv
+		hi, lo := bits.Mul64(m, fpModulus[0])
+		_, cc := bits.Add64(lo, t[0], 0)
+		c = hi + cc
+		for j := 1; j < 4; j++ {
+			hi, lo = bits.Mul64(m, fpModulus[j])
+			lo, cc = bits.Add64(lo, t[j], 0)
+			hi += cc
+			lo, cc = bits.Add64(lo, c, 0)
+			hi += cc
+			t[j-1], c = lo, hi
+		}
+		t[3], cc = bits.Add64(t4, c, 0)
+		t[4] = c5 + cc
+	}
+	return fp{t[0], t[1], t[2], t[3]}.reduce()
+}
+
+func (x fp) square() fp {
+	return x.mul(x)
+}
+
+// inverse returns 1/x; the inverse of zero is zero
+func (x fp) inverse() fp {
+	inv := new(big.Int).ModInverse(x.big(), bn256P)
+	if inv == nil {
+		return fp{}
+	}
+	return fpFromBig(inv)
+}
+
+// fp2 is a + b·i
+type fp2 struct {
+	a, b fp
+}
+
+func (x fp2) isZero() bool {
+	return x.a.isZero() && x.b.isZero()
+}
+
+func (x fp2) add(y fp2) fp2 {
+	return fp2{x.a.add(y.a), x.b.add(y.b)}
+}
+
+func (x fp2) double() fp2 {
+	return fp2{x.a.double(), x.b.double()}
+}
+
+func (x fp2) sub(y fp2) fp2 {
+	return fp2{x.a.sub(y.a), x.b.sub(y.b)}
+}
+
+func (x fp2) neg() fp2 {
+	return fp2{x.a.neg(), x.b.neg()}
+}
+
+// conjugate returns a - b·i, which is x^p
+func (x fp2) conjugate() fp2 {
+	return fp2{x.a, x.b.neg()}
+}
+
+// mul multiplies with three products of Fp:
+// (a + b·i)(c + d·i) = (ac - bd) + ((a + b)(c + d) - ac - bd)·i
+func (x fp2) mul(y fp2) fp2 {
+	ac := x.a.mul(y.a)
+	bd := x.b.mul(y.b)
+	m := x.a.add(x.b).mul(y.a.add(y.b))
+	return fp2{ac.sub(bd), m.sub(ac).sub(bd)}
+}
+
+// square returns (a + b)(a - b) + 2ab·i
+func (x fp2) square() fp2 {
+	ab := x.a.mul(x.b)
+	return fp2{x.a.add(x.b).mul(x.a.sub(x.b)), ab.double()}
+}
+
+// mulFp multiplies by an element of Fp
+func (x fp2) mulFp(k fp) fp2 {
+	return fp2{x.a.mul(k), x.b.mul(k)}
+}
+
+// mulXi returns x·ξ = (9a - b) + (a + 9b)·i
+func (x fp2) mulXi() fp2 {
+	a9 := x.a.double().double().double().add(x.a)
+	b9 := x.b.double().double().double().add(x.b)
+	return fp2{a9.sub(x.b), x.a.add(b9)}
+}
+
+// inverse returns 1/x as (a - b·i)/(a² + b²); x must not be zero
+func (x fp2) inverse() fp2 {
+	inv := x.a.square().add(x.b.square()).inverse()
+	return fp2{x.a.mul(inv), x.b.mul(inv).neg()}
+}
+
+func (x fp2) exp(e *big.Int) fp2 {
+	z := fp2One
+	for i := e.BitLen() - 1; i >= 0; i-- {
+		z = z.square()
+		if e.Bit(i) == 1 {
+			z = z.mul(x)
+		}
+	}
+	return z
+}
+
+// fp6 is the sum of c[k]·vᵏ in Fp6 = Fp2[v]/(v³ - ξ), where v = w²
+type fp6 [3]fp2
+
+func (x fp6) add(y fp6) fp6 {
+	return fp6{x[0].add(y[0]), x[1].add(y[1]), x[2].add(y[2])}
+}
+
+func (x fp6) sub(y fp6) fp6 {
+	return fp6{x[0].sub(y[0]), x[1].sub(y[1]), x[2].sub(y[2])}
+}
+
+// mulV returns x·v
+func (x fp6) mulV() fp6 {
+	return fp6{x[2].mulXi(), x[0], x[1]}
+}
+
+// mul multiplies with six products of Fp2 (Karatsuba)
+func (x fp6) mul(y fp6) fp6 {
+	v0, v1, v2 := x[0].mul(y[0]), x[1].mul(y[1]), x[2].mul(y[2])
+	c0 := x[1].add(x[2]).mul(y[1].add(y[2])).sub(v1).sub(v2).mulXi().add(v0)
+	c1 := x[0].add(x[1]).mul(y[0].add(y[1])).sub(v0).sub(v1).add(v2.mulXi())
+	c2 := x[0].add(x[2]).mul(y[0].add(y[2])).sub(v0).sub(v2).add(v1)
+	return fp6{c0, c1, c2}
+}
+
+// fp12 is the sum of c[k]·wᵏ
+type fp12 [6]fp2
+
+func (x fp12) isOne() bool {
+	return x == fp12Unit
+}
+
+// halves splits x into a + b·w with a and b in Fp6
+func (x fp12) halves() (fp6, fp6) {
+	return fp6{x[0], x[2], x[4]}, fp6{x[1], x[3], x[5]}
+}
+
+func fp12FromHalves(a, b fp6) fp12 {
+	return fp12{a[0], b[0], a[1], b[1], a[2], b[2]}
+}
+
+// mul multiplies with three products of Fp6 (Karatsuba)
+func (x fp12) mul(y fp12) fp12 {
+	a, b := x.halves()
+	c, d := y.halves()
+	ac, bd := a.mul(c), b.mul(d)
+	e := a.add(b).mul(c.add(d)).sub(ac).sub(bd)
+	return fp12FromHalves(ac.add(bd.mulV()), e)
+}
+
+// square returns (a + b·w)² = (a + b)(a + b·v) - ab - ab·v + 2ab·w
+func (x fp12) square() fp12 {
+	a, b := x.halves()
+	ab := a.mul(b)
+	c := a.add(b).mul(a.add(b.mulV())).sub(ab).sub(ab.mulV())
+	return fp12FromHalves(c, ab.add(ab))
+}
+
+// cyclotomicSquare squares an element of the cyclotomic subgroup, whose
+// order divides p⁴ - p² + 1, as every result of the easy part of the
+// final exponentiation is (Granger and Scott, "Faster squaring in the
+// cyclotomic subgroup of sixth degree extensions"). Over Fp4 = Fp2[s]
+// with s = w³, x is a₀ + a₁·w + a₂·w² and its square is
+// (3a₀² - 2ā₀) + (3s·a₂² + 2ā₁)·w + (3a₁² - 2ā₂)·w², where ā negates s.
+func (x fp12) cyclotomicSquare() fp12 {
+	// (a + b·s)² = (a² + b²·ξ) + 2ab·s
+	square := func(a, b fp2) (fp2, fp2) {
+		return a.square().add(b.square().mulXi()), a.mul(b).double()
+	}
+	three := func(v fp2) fp2 {
+		return v.double().add(v)
+	}
+	t0, t3 := square(x[0], x[3])
+	t1, t4 := square(x[1], x[4])
+	t2, t5 := square(x[2], x[5])
+
+	var z fp12
+	z[0] = three(t0).sub(x[0].double())
+	z[3] = three(t3).add(x[3].double())
+	z[1] = three(t5.mulXi()).add(x[1].double())
+	z[4] = three(t2).sub(x[4].double())
+	z[2] = three(t1).sub(x[2].double())
+	z[5] = three(t4).add(x[5].double())
+	return z
+}
+
+// cyclotomicExp raises an element of the cyclotomic subgroup to e
+func (x fp12) cyclotomicExp(e *big.Int) fp12 {
+	z := fp12Unit
+	for i := e.BitLen() - 1; i >= 0; i-- {
+		z = z.cyclotomicSquare()
+		if e.Bit(i) == 1 {
+			z = z.mul(x)
+		}
+	}
+	return z
+}
+
+// mulLine multiplies by a line l0 + l1·w + l3·w³, as polynomials in w
+// with w⁶ folded back onto ξ
+func (x fp12) mulLine(l bn256Line) fp12 {
+	var t [9]fp2
+	for i := range x {
+		t[i] = t[i].add(x[i].mul(l.l0))
+		t[i+1] = t[i+1].add(x[i].mul(l.l1))
+		t[i+3] = t[i+3].add(x[i].mul(l.l3))
+	}
+	z := fp12(t[:6])
+	for k := 6; k < len(t); k++ {
+		z[k-6] = z[k-6].add(t[k].mulXi())
+	}
+	return z
+}
+
+// conjugate returns x^(p⁶), which negates w
+func (x fp12) conjugate() fp12 {
+	z := x
+	for k := 1; k < 6; k += 2 {
+		z[k] = x[k].neg()
+	}
+	return z
+}
+
+// frobenius returns x^p, conjugating the coefficients and scaling the
+// powers of w
+func (x fp12) frobenius() fp12 {
+	var z fp12
+	for k := range x {
+		z[k] = x[k].conjugate().mul(bn256Frob1[k])
+	}
+	return z
+}
+
+// frobenius2 returns x^(p²); it fixes Fp2 and scales the powers of w
+func (x fp12) frobenius2() fp12 {
+	var z fp12
+	for k := range x {
+		z[k] = x[k].mul(bn256Frob2[k])
+	}
+	return z
+}
+
+// inverse returns 1/x. x·conj(x) has only even powers of w, so it lies in
+// Fp6 = Fp2[v]/(v³ - ξ) with v = w², where it is inverted directly.
+func (x fp12) inverse() fp12 {
+	n := x.mul(x.conjugate())
+	c0, c1, c2 := n[0], n[2], n[4]
+	a := c0.square().sub(c1.mul(c2).mulXi())
+	b := c2.square().mulXi().sub(c0.mul(c1))
+	c := c1.square().sub(c0.mul(c2))
+	f := c0.mul(a).add(c2.mul(b).add(c1.mul(c)).mulXi())
+	finv := f.inverse()
+
+	var inv fp12
+	inv[0], inv[2], inv[4] = a.mul(finv), b.mul(finv), c.mul(finv)
+	return x.conjugate().mul(inv)
+}
+
+// finalExponentiation raises x to (p¹² - 1)/r. The easy part
+// (p⁶ - 1)(p² + 1) takes an inversion and Frobenius maps; the hard part
+// (p⁴ - p² + 1)/r is written in base p with digits that are polynomials
+// in u (Scott et al., "On the final exponentiation for calculating
+// pairings on ordinary elliptic curves"), so that it takes three
+// exponentiations by u, all within the cyclotomic subgroup.
+func (x fp12) finalExponentiation() fp12 {
+	t := x.conjugate().mul(x.inverse()) // x^(p⁶ - 1)
+	t = t.frobenius2().mul(t)           // ^(p² + 1)
+
+	t1 := t.frobenius()
+	t2 := t.frobenius2()
+	t3 := t2.frobenius()
+
+	fu := t.cyclotomicExp(bn256U)
+	fu2 := fu.cyclotomicExp(bn256U)
+	fu3 := fu2.cyclotomicExp(bn256U)
+
+	y0 := t1.mul(t2).mul(t3)
+	y1 := t.conjugate()
+	y2 := fu2.frobenius2()
+	y3 := fu.frobenius().conjugate()
+	y4 := fu.mul(fu2.frobenius()).conjugate()
+	y5 := fu2.conjugate()
+	y6 := fu3.mul(fu3.frobenius()).conjugate()
+
+	t0 := y6.cyclotomicSquare().mul(y4).mul(y5)
+	t1 = y3.mul(y5).mul(t0)
+	t0 = t0.mul(y2)
+	t1 = t1.cyclotomicSquare().mul(t0).cyclotomicSquare()
+	t0 = t1.mul(y1)
+	t1 = t1.mul(y0)
+	return t0.cyclotomicSquare().mul(t1)
+}
+
+// g1Point is a point of G1 in Jacobian coordinates; z is zero for the
+// point at infinity
+type g1Point struct {
+	x, y, z fp
+}
+
+func (p *g1Point) isInf() bool {
+	return p.z.isZero()
+}
+
+// onCurve checks an affine point
+func (p *g1Point) onCurve() bool {
+	if p.isInf() {
+		return true
+	}
+	return p.y.square() == p.x.square().mul(p.x).add(bn256B)
+}
+
+// double returns 2p (dbl-2009-l)
+func (p *g1Point) double() *g1Point {
+	if p.isInf() || p.y.isZero() {
+		return &g1Point{}
+	}
+	a := p.x.square()
+	b := p.y.square()
+	c := b.square()
+	d := p.x.add(b).square().sub(a).sub(c).double()
+	e := a.double().add(a)
+	f := e.square()
+
+	x := f.sub(d.double())
+	y := e.mul(d.sub(x)).sub(c.double().double().double())
+	z := p.y.mul(p.z).double()
+	return &g1Point{x, y, z}
+}
+
+// add returns p + q (add-2007-bl)
+func (p *g1Point) add(q *g1Point) *g1Point {
+	if p.isInf() {
+		return q
+	}
+	if q.isInf() {
+		return p
+	}
+	z1z1 := p.z.square()
+	z2z2 := q.z.square()
+	u1 := p.x.mul(z2z2)
+	u2 := q.x.mul(z1z1)
+	s1 := p.y.mul(q.z).mul(z2z2)
+	s2 := q.y.mul(p.z).mul(z1z1)
+	h := u2.sub(u1)
+	r := s2.sub(s1).double()
+	if h.isZero() {
+		if r.isZero() {
+			return p.double()
+		}
+		return &g1Point{}
+	}
+	i := h.double().square()
+	j := h.mul(i)
+	v := u1.mul(i)
+
+	x := r.square().sub(j).sub(v.double())
+	y := r.mul(v.sub(x)).sub(s1.mul(j).double())
+	z := p.z.add(q.z).square().sub(z1z1).sub(z2z2).mul(h)
+	return &g1Point{x, y, z}
+}
+
+func (p *g1Point) mul(k *big.Int) *g1Point {
+	result := &g1Point{}
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		result = result.double()
+		if k.Bit(i) == 1 {
+			result = result.add(p)
+		}
+	}
+	return result
+}
+
+// affine returns p with z one, or the point at infinity
+func (p *g1Point) affine() *g1Point {
+	if p.isInf() {
+		return &g1Point{}
+	}
+	zinv := p.z.inverse()
+	zinv2 := zinv.square()
+	return &g1Point{p.x.mul(zinv2), p.y.mul(zinv2).mul(zinv), fpOne}
+}
+
+// g2Point is a point of the twist in Jacobian coordinates; z is zero for
+// the point at infinity
+type g2Point struct {
+	x, y, z fp2
+}
+
+func (p *g2Point) isInf() bool {
+	return p.z.isZero()
+}
+
+// onCurve checks an affine point
+func (p *g2Point) onCurve() bool {
+	if p.isInf() {
+		return true
+	}
+	return p.y.square() == p.x.square().mul(p.x).add(bn256B2)
+}
+
+// double returns 2p (dbl-2009-l)
+func (p *g2Point) double() *g2Point {
+	if p.isInf() || p.y.isZero() {
+		return &g2Point{}
+	}
+	a := p.x.square()
+	b := p.y.square()
+	c := b.square()
+	d := p.x.add(b).square().sub(a).sub(c).double()
+	e := a.double().add(a)
+	f := e.square()
+
+	x := f.sub(d.double())
+	y := e.mul(d.sub(x)).sub(c.double().double().double())
+	z := p.y.mul(p.z).double()
+	return &g2Point{x, y, z}
+}
+
+// add returns p + q (add-2007-bl)
+func (p *g2Point) add(q *g2Point) *g2Point {
+	if p.isInf() {
+		return q
+	}
+	if q.isInf() {
+		return p
+	}
+	z1z1 := p.z.square()
+	z2z2 := q.z.square()
+	u1 := p.x.mul(z2z2)
+	u2 := q.x.mul(z1z1)
+	s1 := p.y.mul(q.z).mul(z2z2)
+	s2 := q.y.mul(p.z).mul(z1z1)
+	h := u2.sub(u1)
+	r := s2.sub(s1).double()
+	if h.isZero() {
+		if r.isZero() {
+			return p.double()
+		}
+		return &g2Point{}
+	}
+	i := h.double().square()
+	j := h.mul(i)
+	v := u1.mul(i)
+
+	x := r.square().sub(j).sub(v.double())
+	y := r.mul(v.sub(x)).sub(s1.mul(j).double())
+	z := p.z.add(q.z).square().sub(z1z1).sub(z2z2).mul(h)
+	return &g2Point{x, y, z}
+}
+
+func (p *g2Point) mul(k *big.Int) *g2Point {
+	result := &g2Point{}
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		result = result.double()
+		if k.Bit(i) == 1 {
+			result = result.add(p)
+		}
+	}
+	return result
+}
+
+func (p *g2Point) neg() *g2Point {
+	return &g2Point{p.x, p.y.neg(), p.z}
+}
+
+// psi returns the image of p under the p-power Frobenius of Fp12, mapped
+// back onto the twist: (x̄·ξ^((p - 1)/3), ȳ·ξ^((p - 1)/2)) for affine
+// coordinates
+func (p *g2Point) psi() *g2Point {
+	return &g2Point{p.x.conjugate().mul(bn256Frob1[2]), p.y.conjugate().mul(bn256Frob1[3]), p.z.conjugate()}
+}
+
+// inSubgroup reports whether p is in G2, checking
+// [u + 1]p + ψ([u]p) + ψ²([u]p) = ψ³([2u]p) (El Housni, Guillevic and
+// Piellard, "Co-factor clearing and subgroup membership testing on
+// pairing-friendly curves"), which takes a multiplication by u rather
+// than by r
+func (p *g2Point) inSubgroup() bool {
+	up := p.mul(bn256U)
+	lhs := up.add(p).add(up.psi()).add(up.psi().psi())
+	rhs := up.double().psi().psi().psi()
+	return lhs.add(rhs.neg()).isInf()
+}
+
+// decodeG1 reads a G1 point as 32-byte x and y; (0, 0) is the point at
+// infinity
+func decodeG1(data []byte) (*g1Point, error) {
+	x := new(big.Int).SetBytes(data[:32])
+	y := new(big.Int).SetBytes(data[32:64])
+	if x.Cmp(bn256P) >= 0 || y.Cmp(bn256P) >= 0 {
+		return nil, errBN256Coordinate
+	}
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return &g1Point{}, nil
+	}
+	p := &g1Point{fpFromBig(x), fpFromBig(y), fpOne}
+	if !p.onCurve() {
+		return nil, errBN256NotOnCurve
+	}
+	return p, nil
+}
+
+// encodeG1 writes a G1 point as 32-byte x and y
+func encodeG1(p *g1Point) []byte {
+	out := make([]byte, 64)
+	if a := p.affine(); !a.isInf() {
+		a.x.big().FillBytes(out[:32])
+		a.y.big().FillBytes(out[32:])
+	}
+	return out
+}
+
+// decodeG2 reads a G2 point as x and y, each an element of Fp2 encoded as
+// its imaginary then its real part; all zeros is the point at infinity.
+// The point must be in the order r subgroup.
+func decodeG2(data []byte) (*g2Point, error) {
+	var coords [4]fp
+	zero := true
+	for i := range coords {
+		c := new(big.Int).SetBytes(data[i*32 : i*32+32])
+		if c.Cmp(bn256P) >= 0 {
+			return nil, errBN256Coordinate
+		}
+		zero = zero && c.Sign() == 0
+		coords[i] = fpFromBig(c)
+	}
+	if zero {
+		return &g2Point{}, nil
+	}
+	p := &g2Point{fp2{coords[1], coords[0]}, fp2{coords[3], coords[2]}, fp2One}
+	if !p.onCurve() {
+		return nil, errBN256NotOnCurve
+	}
+	if !p.inSubgroup() {
+		return nil, errBN256NotInGroup
+	}
+	return p, nil
+}
+
+// bn256Line is a line l0 + l1·w + l3·w³ of the Miller loop evaluated at a
+// point of G1. Lines are scaled by factors in Fp2, and vertical lines are
+// left out, as the final exponentiation maps Fp6 to one.
+type bn256Line struct {
+	l0, l1, l3 fp2
+}
+
+// lineDouble returns 2t and the tangent at t evaluated at p, an affine
+// point. With λ = 3x²/2y the tangent is y_p - λ·x_p·w + (λ·x - y)·w³,
+// scaled here by 2YZ³.
+func lineDouble(t *g2Point, p *g1Point) (*g2Point, bn256Line) {
+	x2 := t.x.square()
+	z2 := t.z.square()
+	l := bn256Line{
+		l0: t.y.mul(z2).mul(t.z).double().mulFp(p.y),
+		l1: x2.double().add(x2).mul(z2).mulFp(p.x).neg(),
+		l3: x2.double().add(x2).mul(t.x).sub(t.y.square().double()),
+	}
+	return t.double(), l
+}
+
+// lineAdd returns t + q and the line through them evaluated at p, where q
+// and p are affine. With λ = (y_q - y)/(x_q - x) the line is
+// y_p - λ·x_p·w + (λ·x_q - y_q)·w³, scaled here by Z(x_q·Z² - X).
+func lineAdd(t, q *g2Point, p *g1Point) (*g2Point, bn256Line) {
+	z2 := t.z.square()
+	n := q.y.mul(z2).mul(t.z).sub(t.y)
+	d := q.x.mul(z2).sub(t.x).mul(t.z)
+	l := bn256Line{
+		l0: d.mulFp(p.y),
+		l1: n.mulFp(p.x).neg(),
+		l3: n.mul(q.x).sub(q.y.mul(d)),
+	}
+	return t.add(q), l
+}
+
+// millerLoop returns the product of the optimal ate Miller functions
+// f_{6u+2,Q}(P)·l_{[6u+2]Q,π(Q)}(P)·l_{[6u+2]Q+π(Q),-π²(Q)}(P) of the
+// given pairs, which must be affine and not at infinity, squaring once
+// per step for all of them
+func millerLoop(g1 []*g1Point, g2 []*g2Point) fp12 {
+	t := make([]*g2Point, len(g2))
+	copy(t, g2)
+
+	f := fp12Unit
+	var l bn256Line
+	for i := bn256AteLoop.BitLen() - 2; i >= 0; i-- {
+		f = f.square()
+		for k := range t {
+			t[k], l = lineDouble(t[k], g1[k])
+			f = f.mulLine(l)
+		}
+		if bn256AteLoop.Bit(i) == 1 {
+			for k := range t {
+				t[k], l = lineAdd(t[k], g2[k], g1[k])
+				f = f.mulLine(l)
+			}
+		}
+	}
+
+	for k := range t {
+		q1 := g2[k].psi()
+		q2 := q1.psi().neg()
+		t[k], l = lineAdd(t[k], q1, g1[k])
+		f = f.mulLine(l)
+		_, l = lineAdd(t[k], q2, g1[k])
+		f = f.mulLine(l)
+	}
+	return f
+}
+
+// bn256PairingCheck reports whether the product of the pairings of the
+// given pairs is one
+func bn256PairingCheck(g1 []*g1Point, g2 []*g2Point) bool {
+	var ps []*g1Point
+	var qs []*g2Point
+	for i := range g1 {
+		if g1[i].isInf() || g2[i].isInf() {
+			continue
+		}
+		ps = append(ps, g1[i].affine())
+		qs = append(qs, g2[i])
+	}
+	if len(ps) == 0 {
+		return true
+	}
+	return millerLoop(ps, qs).finalExponentiation().isOne()
+}
@@ -0,0 +1,173 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// Encoded test points: the generators g1 and g2 of G1 and G2, their
+// doubles and negations, and a point of the twist outside G2
+const (
+	bn256TestG1    = "0000000000000000000000000000000000000000000000000000000000000001" + "0000000000000000000000000000000000000000000000000000000000000002"
+	bn256TestG1x2  = "030644e72e131a029b85045b68181585d97816a916871ca8d3c208c16d87cfd3" + "15ed738c0e0a7c92e7845f96b2ae9c0a68a6a449e3538fc7ff3ebf7a5a18a2c4"
+	bn256TestG1Neg = "0000000000000000000000000000000000000000000000000000000000000001" + "30644e72e131a029b85045b68181585d97816a916871ca8d3c208c16d87cfd45"
+	bn256TestInf   = "0000000000000000000000000000000000000000000000000000000000000000" + "0000000000000000000000000000000000000000000000000000000000000000"
+
+	bn256TestG2 = "198e9393920d483a7260bfb731fb5d25f1aa493335a9e71297e485b7aef312c2" + "1800deef121f1e76426a00665e5c4479674322d4f75edadd46debd5cd992f6ed" +
+		"090689d0585ff075ec9e99ad690c3395bc4b313370b38ef355acdadcd122975b" + "12c85ea5db8c6deb4aab71808dcb408fe3d1e7690c43d37b4ce6cc0166fa7daa"
+	bn256TestG2x2 = "203e205db4f19b37b60121b83a7333706db86431c6d835849957ed8c3928ad79" + "27dc7234fd11d3e8c36c59277c3e6f149d5cd3cfa9a62aee49f8130962b4b3b9" +
+		"195e8aa5b7827463722b8c153931579d3505566b4edf48d498e185f0509de152" + "04bb53b8977e5f92a0bc372742c4830944a59b4fe6b1c0466e2a6dad122b5d2e"
+	bn256TestNotG2 = "0000000000000000000000000000000000000000000000000000000000000001" + "0000000000000000000000000000000000000000000000000000000000000002" +
+		"2b76c179599bb92a963dac85546a005a777f7c13f6a7b75d5918b6b5808f5fde" + "101f7278419308b95099eca02dcee0c5381f4d26d1d62313f057167f064101ce"
+)
+
+func bn256Input(t testing.TB, parts ...string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(strings.Join(parts, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestBN256Add(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"double", bn256Input(t, bn256TestG1, bn256TestG1), bn256TestG1x2},
+		{"infinity", bn256Input(t, bn256TestG1, bn256TestInf), bn256TestG1},
+		{"negation", bn256Input(t, bn256TestG1, bn256TestG1Neg), bn256TestInf},
+		{"empty", nil, bn256TestInf},
+	}
+	for _, tt := range tests {
+		out, err := bn256Add{}.Run(nil, tt.input)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := hex.EncodeToString(out); got != tt.want {
+			t.Fatalf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	offCurve := bn256Input(t, bn256TestG1, bn256TestG1x2[:64], bn256TestG1[64:])
+	if _, err := (bn256Add{}).Run(nil, offCurve); !errors.Is(err, errBN256NotOnCurve) {
+		t.Fatalf("point off the curve: got %v", err)
+	}
+	tooLarge := bn256Input(t, bn256TestG1, "30644e72e131a029b85045b68181585d97816a916871ca8d3c208c16d87cfd47", bn256TestG1[64:])
+	if _, err := (bn256Add{}).Run(nil, tooLarge); !errors.Is(err, errBN256Coordinate) {
+		t.Fatalf("coordinate p: got %v", err)
+	}
+}
+
+func TestBN256ScalarMul(t *testing.T) {
+	scalar := func(k *big.Int) string {
+		return hex.EncodeToString(k.FillBytes(make([]byte, 32)))
+	}
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"two", bn256Input(t, bn256TestG1, scalar(big.NewInt(2))), bn256TestG1x2},
+		{"r - 1", bn256Input(t, bn256TestG1, scalar(new(big.Int).Sub(bn256R, big.NewInt(1)))), bn256TestG1Neg},
+		{"r", bn256Input(t, bn256TestG1, scalar(bn256R)), bn256TestInf},
+		{"r + 2", bn256Input(t, bn256TestG1, scalar(new(big.Int).Add(bn256R, big.NewInt(2)))), bn256TestG1x2},
+		{"no scalar", bn256Input(t, bn256TestG1), bn256TestInf},
+	}
+	for _, tt := range tests {
+		out, err := bn256ScalarMul{}.Run(nil, tt.input)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := hex.EncodeToString(out); got != tt.want {
+			t.Fatalf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBN256Pairing(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  byte
+	}{
+		{"empty", nil, 1},
+		{"e(g1, g2)", bn256Input(t, bn256TestG1, bn256TestG2), 0},
+		{"e(g1, g2)·e(-g1, g2)", bn256Input(t, bn256TestG1, bn256TestG2, bn256TestG1Neg, bn256TestG2), 1},
+		{"e(2g1, g2)·e(-g1, 2g2)", bn256Input(t, bn256TestG1x2, bn256TestG2, bn256TestG1Neg, bn256TestG2x2), 1},
+		{"e(2g1, g2)·e(-g1, g2)", bn256Input(t, bn256TestG1x2, bn256TestG2, bn256TestG1Neg, bn256TestG2), 0},
+		{"e(0, g2)", bn256Input(t, bn256TestInf, bn256TestG2), 1},
+	}
+	for _, tt := range tests {
+		out, err := bn256Pairing{}.Run(nil, tt.input)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		want := make([]byte, 32)
+		want[31] = tt.want
+		if !bytes.Equal(out, want) {
+			t.Fatalf("%s: got %x, want %d", tt.name, out, tt.want)
+		}
+	}
+
+	if _, err := (bn256Pairing{}).Run(nil, bn256Input(t, bn256TestG1, bn256TestNotG2)); !errors.Is(err, errBN256NotInGroup) {
+		t.Fatalf("twist point outside G2: got %v", err)
+	}
+	if _, err := (bn256Pairing{}).Run(nil, bn256Input(t, bn256TestG1)); !errors.Is(err, errPrecompileInput) {
+		t.Fatalf("truncated input: got %v", err)
+	}
+}
+
+// TestBN256SubgroupCheck compares the fast G2 membership test with
+// multiplication by r
+func TestBN256SubgroupCheck(t *testing.T) {
+	decode := func(s string) *g2Point {
+		data := bn256Input(t, s)
+		var c [4]fp
+		for i := range c {
+			c[i] = fpFromBig(new(big.Int).SetBytes(data[i*32 : i*32+32]))
+		}
+		return &g2Point{fp2{c[1], c[0]}, fp2{c[3], c[2]}, fp2One}
+	}
+	g2, notG2 := decode(bn256TestG2), decode(bn256TestNotG2)
+	if !g2.onCurve() || !notG2.onCurve() {
+		t.Fatal("test point not on the twist")
+	}
+
+	// The twist has r·(2p - r) points, so the multiples of notG2 by 2p - r
+	// are in G2
+	cofactor := new(big.Int).Sub(new(big.Int).Lsh(bn256P, 1), bn256R)
+	points := []*g2Point{g2, g2.mul(big.NewInt(12345)), notG2, notG2.mul(big.NewInt(3)), notG2.mul(cofactor), g2.add(notG2)}
+	for i, p := range points {
+		if got, want := p.inSubgroup(), p.mul(bn256R).isInf(); got != want {
+			t.Fatalf("point %d: inSubgroup %v, [r]p = 0 %v", i, got, want)
+		}
+	}
+	if points[2].inSubgroup() || !points[4].inSubgroup() {
+		t.Fatal("test points misclassified")
+	}
+}
+
+func BenchmarkBN256ScalarMul(b *testing.B) {
+	input := bn256Input(b, bn256TestG1, "30644e72e131a029b85045b68181585d2833e84879b9709143e1f593f0000000")
+	for i := 0; i < b.N; i++ {
+		if _, err := (bn256ScalarMul{}).Run(nil, input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBN256Pairing(b *testing.B) {
+	input := bn256Input(b, bn256TestG1x2, bn256TestG2, bn256TestG1Neg, bn256TestG2x2)
+	for i := 0; i < b.N; i++ {
+		if _, err := (bn256Pairing{}).Run(nil, input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package evm
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// CallMsg is a message executed by Call. Zero Gas means the block gas
+// limit; a nil GasPrice or Value is zero. A nil To simulates a contract
+// creation.
+type CallMsg struct {
+	From       Address    `json:"from"`
+	To         *Address   `json:"to"`
+	Gas        uint64     `json:"gas"`
+	GasPrice   *big.Int   `json:"gas_price"`
+	Value      *big.Int   `json:"value"`
+	Data       Bytes      `json:"data"`
+	AccessList AccessList `json:"access_list,omitempty"`
+}
+
+// Call executes msg against the state at the end of the given block, or
+// the current state in the next block when number is nil, and returns the output, or the
+// revert data, and the gas used. Changes go to a private copy-on-write
+// layer that is dropped afterwards, so nothing persists and no receipt is
+// recorded. The sender's nonce is not checked and the gas price may be
+// below the base fee.
+func (e *EVM) Call(msg CallMsg, number *uint64) (*TransactionResult, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	block, state, err := e.callState(number)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &EVM{StateDB: state.copyOnWrite(), ChainID: e.ChainID, Block: block, precompiles: e.precompiles}
+	return view.call(msg, block)
+}
+
+// call runs msg on e, which is a throwaway view over real state
+func (e *EVM) call(msg CallMsg, block BlockContext) (*TransactionResult, error) {
+	tx := &EVMTransaction{
+		From:       msg.From,
+		To:         msg.To,
+		Value:      msg.Value,
+		Data:       msg.Data,
+		Gas:        msg.Gas,
+		GasPrice:   msg.GasPrice,
+		AccessList: msg.AccessList,
+		Nonce:      e.StateDB.getNonce(msg.From),
+	}
+	if tx.Value == nil {
+		tx.Value = new(big.Int)
+	}
+	if tx.GasPrice == nil {
+		tx.GasPrice = new(big.Int)
+	}
+	if tx.Gas == 0 {
+		tx.Gas = block.GasLimit
+	}
+
+	if tx.Gas > block.GasLimit {
+		return nil, fmt.Errorf("gas limit %d exceeds block gas limit %d", tx.Gas, block.GasLimit)
+	}
+	if tx.To == nil && len(tx.Data) > MaxInitCodeSize {
+		return nil, fmt.Errorf("%w: code size %d, limit %d", ErrMaxInitCodeSizeExceeded, len(tx.Data), MaxInitCodeSize)
+	}
+	if gas := IntrinsicGas(tx.Data, tx.AccessList, tx.To == nil); tx.Gas < gas {
+		return nil, fmt.Errorf("intrinsic gas too low: have %d, want %d", tx.Gas, gas)
+	}
+	cost := new(big.Int).Mul(tx.GasPrice, new(big.Int).SetUint64(tx.Gas))
+	cost.Add(cost, tx.Value)
+	if balance := e.StateDB.getBalance(tx.From); balance.Cmp(cost) < 0 {
+		return nil, fmt.Errorf("insufficient balance: have %s, want %s", balance, cost)
+	}
+
+	return e.applyMessage(tx, block, tx.GasPrice), nil
+}
@@ -0,0 +1,106 @@
+package evm
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// storeAndLoad is runtime code that stores its first calldata word in slot
+// 0 unless it is zero, then returns slot 0
+var storeAndLoad = []byte{
+	byte(PUSH1), 0, byte(CALLDATALOAD), byte(ISZERO), byte(PUSH1), 13, byte(JUMPI),
+	byte(PUSH1), 0, byte(CALLDATALOAD), byte(PUSH1), 0, byte(SSTORE),
+	byte(JUMPDEST), byte(PUSH1), 0, byte(SLOAD), byte(PUSH1), 0, byte(MSTORE),
+	byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN),
+}
+
+// wordBytes returns n as a 32 byte word
+func wordBytes(n int64) []byte {
+	return big.NewInt(n).FillBytes(make([]byte, 32))
+}
+
+func TestCallDoesNotPersist(t *testing.T) {
+	e := newTestEVM()
+	contract := *execute(t, e, nil, 0, initCode(storeAndLoad)).ContractAddress
+	execute(t, e, &contract, 0, wordBytes(5))
+	root, nonce, number := e.StateRoot(), e.GetNonce(testSender), e.Block.Number
+
+	result, err := e.Call(CallMsg{From: testSender, To: &contract, Data: wordBytes(9)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success || new(big.Int).SetBytes(result.Return).Int64() != 9 {
+		t.Fatalf("call returned %x, %s", result.Return, result.Error)
+	}
+	if result.GasUsed <= IntrinsicGas(wordBytes(9), nil, false) {
+		t.Fatalf("call used %d gas", result.GasUsed)
+	}
+	if got := e.GetStorage(contract, Hash{}); got != BytesToHash(wordBytes(5)) {
+		t.Fatalf("slot 0 is %s after the call", got)
+	}
+	if e.StateRoot() != root || e.GetNonce(testSender) != nonce || e.Block.Number != number {
+		t.Fatal("the call changed the state")
+	}
+	if e.GetReceipt(result.TxHash) != nil {
+		t.Fatal("the call recorded a receipt")
+	}
+
+	// A creation is simulated without deploying anything
+	result, err = e.Call(CallMsg{From: testSender, Data: initCode(storeAndLoad)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success || result.ContractAddress == nil || string(result.Return) != string(storeAndLoad) {
+		t.Fatalf("simulated creation: %+v", result)
+	}
+	if e.GetAccount(*result.ContractAddress) != nil {
+		t.Fatal("the simulated creation deployed a contract")
+	}
+}
+
+func TestCallAtEarlierBlock(t *testing.T) {
+	e := newTestEVM()
+	contract := *execute(t, e, nil, 0, initCode(storeAndLoad)).ContractAddress
+	deployed := e.Block.Number
+	execute(t, e, &contract, 0, wordBytes(5))
+	execute(t, e, &contract, 0, wordBytes(6))
+
+	for _, tt := range []struct {
+		number uint64
+		want   int64
+	}{{deployed, 0}, {deployed + 1, 5}, {deployed + 2, 6}} {
+		number := tt.number
+		result, err := e.Call(CallMsg{From: testSender, To: &contract}, &number)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := new(big.Int).SetBytes(result.Return).Int64(); got != tt.want {
+			t.Fatalf("slot 0 at block %d is %d, want %d", tt.number, got, tt.want)
+		}
+	}
+	future := e.Block.Number + 1
+	if _, err := e.Call(CallMsg{From: testSender, To: &contract}, &future); err == nil {
+		t.Fatal("called at a future block")
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	e := newTestEVM()
+	poor := BytesToAddress([]byte{0x0b})
+	tests := []struct {
+		name string
+		msg  CallMsg
+		want string
+	}{
+		{"over the block gas limit", CallMsg{From: testSender, To: &testBeneficiary, Gas: e.Block.GasLimit + 1}, "exceeds block gas limit"},
+		{"below the intrinsic gas", CallMsg{From: testSender, To: &testBeneficiary, Gas: TxGas - 1}, "intrinsic gas too low"},
+		{"unaffordable value", CallMsg{From: poor, To: &testBeneficiary, Value: big.NewInt(1)}, "insufficient balance"},
+		{"unaffordable gas", CallMsg{From: poor, To: &testBeneficiary, Gas: TxGas, GasPrice: big.NewInt(1)}, "insufficient balance"},
+	}
+	for _, tt := range tests {
+		if _, err := e.Call(tt.msg, nil); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package evm
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// returnSeven is runtime code returning 7
+var returnSeven = append([]byte{byte(PUSH1), 7}, returnTop...)
+
+func TestCreateTransaction(t *testing.T) {
+	e := newTestEVM()
+	code := initCode(returnSeven)
+	result := applyTx(t, e, &EVMTransaction{
+		From: testSender, Value: big.NewInt(100), Data: code, Gas: 200_000, GasPrice: new(big.Int),
+	})
+	if !result.Success {
+		t.Fatal(result.Error)
+	}
+
+	contract := CreateAddress(testSender, 0)
+	if result.ContractAddress == nil || *result.ContractAddress != contract {
+		t.Fatalf("contract address %v, want %s", result.ContractAddress, contract)
+	}
+	account := e.GetAccount(contract)
+	if account == nil || !bytes.Equal(account.Code, returnSeven) || account.Nonce != 1 || account.Balance.Cmp(big.NewInt(100)) != 0 {
+		t.Fatalf("contract account %+v", account)
+	}
+	if e.GetNonce(testSender) != 1 {
+		t.Fatalf("sender nonce %d", e.GetNonce(testSender))
+	}
+	// The init code runs three pushes, DUP1, CODECOPY of one word into
+	// fresh memory and RETURN, then pays the deposit per byte of code
+	initGas := 3 + 3 + 3 + 3 + (3 + CopyGas + MemoryGas) + 3
+	if want := IntrinsicGas(code, nil, true) + initGas + uint64(len(returnSeven))*CreateDataGas; result.GasUsed != want {
+		t.Fatalf("creation used %d gas, want %d", result.GasUsed, want)
+	}
+
+	if got := execute(t, e, &contract, 0, nil).Return; new(big.Int).SetBytes(got).Int64() != 7 {
+		t.Fatalf("contract returned %x", got)
+	}
+}
+
+func TestCreateFailures(t *testing.T) {
+	// Returns 100 bytes of code, which needs a deposit of 20000
+	hundredBytes := []byte{byte(PUSH1), 100, byte(PUSH1), 0, byte(RETURN)}
+	tests := []struct {
+		name    string
+		code    []byte
+		gas     uint64
+		err     error
+		allUsed bool
+	}{
+		{"reverting init code", []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(REVERT)}, 100_000, ErrExecutionReverted, false},
+		{"code starting with 0xEF", initCode([]byte{0xef}), 100_000, ErrInvalidCode, true},
+		{"code over the size limit", []byte{byte(PUSH1) + 1, 0x60, 0x01, byte(PUSH1), 0, byte(RETURN)}, 200_000, ErrMaxCodeSizeExceeded, true},
+		{"deposit out of gas", hundredBytes, IntrinsicGas(hundredBytes, nil, true) + 3 + 3 + 4*MemoryGas + 100*CreateDataGas - 1, ErrCodeStoreOutOfGas, true},
+	}
+	for _, tt := range tests {
+		e := newTestEVM()
+		result := applyTx(t, e, &EVMTransaction{
+			From: testSender, Value: big.NewInt(100), Data: tt.code, Gas: tt.gas, GasPrice: new(big.Int),
+		})
+		if result.Success || !errors.Is(result.Err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, result.Err, tt.err)
+			continue
+		}
+		if got := result.GasUsed == tt.gas; got != tt.allUsed {
+			t.Errorf("%s: used %d of %d gas", tt.name, result.GasUsed, tt.gas)
+		}
+		if result.ContractAddress != nil || e.GetAccount(CreateAddress(testSender, 0)) != nil {
+			t.Errorf("%s: contract created", tt.name)
+		}
+		if e.GetNonce(testSender) != 1 || e.GetBalance(testSender).Cmp(big.NewInt(1_000_000)) != 0 {
+			t.Errorf("%s: sender nonce %d, balance %s", tt.name, e.GetNonce(testSender), e.GetBalance(testSender))
+		}
+	}
+}
+
+// factoryCode returns runtime code that creates a contract from its
+// calldata with op, CREATE2 using salt 42, and returns the address
+func factoryCode(op OpCode) []byte {
+	code := []byte{byte(CALLDATASIZE), byte(PUSH1), 0, byte(PUSH1), 0, byte(CALLDATACOPY)}
+	if op == CREATE2 {
+		code = append(code, byte(PUSH1), 42)
+	}
+	code = append(code, byte(CALLDATASIZE), byte(PUSH1), 0, byte(PUSH1), 0, byte(op))
+	return append(code, returnTop...)
+}
+
+func TestCreateOpcodes(t *testing.T) {
+	e := newTestEVM()
+	code := initCode(returnSeven)
+
+	// CREATE derives the address from the factory's nonce, which starts
+	// at 1 for a contract
+	factory := deploy(t, e, factoryCode(CREATE))
+	for nonce := uint64(1); nonce <= 2; nonce++ {
+		got := BytesToAddress(execute(t, e, &factory, 0, code).Return)
+		if want := CreateAddress(factory, nonce); got != want {
+			t.Fatalf("CREATE with nonce %d deployed to %s, want %s", nonce, got, want)
+		}
+		if !bytes.Equal(e.GetAccount(got).Code, returnSeven) {
+			t.Fatalf("CREATE deployed %x", e.GetAccount(got).Code)
+		}
+	}
+	if e.GetNonce(factory) != 3 {
+		t.Fatalf("factory nonce %d, want 3", e.GetNonce(factory))
+	}
+
+	// CREATE2 derives it from the salt and init code, so the same
+	// deployment again collides and pushes zero
+	factory = deploy(t, e, factoryCode(CREATE2))
+	want := CreateAddress2(factory, BytesToHash([]byte{42}), code)
+	if got := BytesToAddress(execute(t, e, &factory, 0, code).Return); got != want {
+		t.Fatalf("CREATE2 deployed to %s, want %s", got, want)
+	}
+	if !bytes.Equal(e.GetAccount(want).Code, returnSeven) {
+		t.Fatalf("CREATE2 deployed %x", e.GetAccount(want).Code)
+	}
+	if got := BytesToAddress(execute(t, e, &factory, 0, code).Return); got != (Address{}) {
+		t.Fatalf("colliding CREATE2 returned %s", got)
+	}
+	if got := BytesToAddress(execute(t, e, &factory, 0, initCode([]byte{byte(STOP)})).Return); got != CreateAddress2(factory, BytesToHash([]byte{42}), initCode([]byte{byte(STOP)})) {
+		t.Fatalf("CREATE2 of other init code deployed to %s", got)
+	}
+}
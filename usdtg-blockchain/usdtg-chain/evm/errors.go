@@ -0,0 +1,76 @@
+package evm
+
+import "errors"
+
+// Execution errors. Apart from ErrExecutionReverted they all consume the
+// remaining gas of the frame that raised them.
+var (
+	ErrOutOfGas                 = errors.New("out of gas")
+	ErrGasUintOverflow          = errors.New("gas uint64 overflow")
+	ErrStackUnderflow           = errors.New("stack underflow")
+	ErrStackOverflow            = errors.New("stack limit reached 1024")
+	ErrInvalidJump              = errors.New("invalid jump destination")
+	ErrInvalidOpcode            = errors.New("invalid opcode")
+	ErrReturnDataOutOfBounds    = errors.New("return data out of bounds")
+	ErrExecutionReverted        = errors.New("execution reverted")
+	ErrInsufficientBalance      = errors.New("insufficient balance for transfer")
+	ErrDepth                    = errors.New("max call depth exceeded")
+	ErrContractAddressCollision = errors.New("contract address collision")
+	ErrMaxCodeSizeExceeded      = errors.New("max code size exceeded")
+	ErrMaxInitCodeSizeExceeded  = errors.New("max initcode size exceeded")
+	ErrInvalidCode              = errors.New("invalid code: must not begin with 0xef")
+	ErrCodeStoreOutOfGas        = errors.New("contract creation code storage out of gas")
+	ErrWriteProtection          = errors.New("write protection")
+	ErrPrecompileFailed         = errors.New("precompiled contract failed")
+)
+
+// executionErrorCodes are the stable names ErrorCode reports for the
+// execution errors
+var executionErrorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrOutOfGas, "out_of_gas"},
+	{ErrGasUintOverflow, "gas_uint_overflow"},
+	{ErrStackUnderflow, "stack_underflow"},
+	{ErrStackOverflow, "stack_overflow"},
+	{ErrInvalidJump, "invalid_jump"},
+	{ErrInvalidOpcode, "invalid_opcode"},
+	{ErrReturnDataOutOfBounds, "return_data_out_of_bounds"},
+	{ErrExecutionReverted, "execution_reverted"},
+	{ErrInsufficientBalance, "insufficient_balance"},
+	{ErrDepth, "max_call_depth"},
+	{ErrContractAddressCollision, "contract_address_collision"},
+	{ErrMaxCodeSizeExceeded, "max_code_size_exceeded"},
+	{ErrMaxInitCodeSizeExceeded, "max_initcode_size_exceeded"},
+	{ErrInvalidCode, "invalid_code"},
+	{ErrCodeStoreOutOfGas, "code_store_out_of_gas"},
+	{ErrWriteProtection, "write_protection"},
+	{ErrPrecompileFailed, "precompile_failed"},
+}
+
+// ErrorCode names the kind of an execution error for API clients, such as
+// "out_of_gas" or "execution_reverted". It is empty for a nil error and
+// "execution_error" for errors that are not execution errors.
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, c := range executionErrorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return "execution_error"
+}
+
+// Transaction decoding, signature and admission errors
+var (
+	ErrInvalidSignature   = errors.New("invalid signature")
+	ErrInvalidChainID     = errors.New("invalid chain id")
+	ErrUnprotectedTx      = errors.New("only replay-protected (EIP-155) transactions allowed")
+	ErrTxTypeNotSupported = errors.New("transaction type not supported")
+	ErrUnsignedTx         = errors.New("unsigned transactions are only accepted in dev mode")
+	ErrAlreadyKnown       = errors.New("already known")
+	ErrNonceTooLow        = errors.New("nonce too low")
+)
@@ -0,0 +1,77 @@
+package evm
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// EstimateGas returns the lowest gas limit with which msg executes
+// successfully against the state at the end of the given block, or the
+// current state in the next block when number is nil. msg.Gas, or the block gas limit when
+// zero, caps the search, as does what the sender can pay at msg.GasPrice.
+// When msg fails even at the cap, a revert comes back as a *RevertError
+// carrying the decoded revert data and any other failure wraps its
+// execution error.
+func (e *EVM) EstimateGas(msg CallMsg, number *uint64) (uint64, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	block, state, err := e.callState(number)
+	if err != nil {
+		return 0, err
+	}
+
+	hi := block.GasLimit
+	if msg.Gas != 0 {
+		hi = msg.Gas
+	}
+	if msg.GasPrice != nil && msg.GasPrice.Sign() > 0 {
+		available := new(big.Int).Set(state.getBalance(msg.From))
+		if msg.Value != nil {
+			available.Sub(available, msg.Value)
+			if available.Sign() < 0 {
+				return 0, fmt.Errorf("insufficient balance for transfer")
+			}
+		}
+		allowance := available.Div(available, msg.GasPrice)
+		if allowance.IsUint64() && allowance.Uint64() < hi {
+			hi = allowance.Uint64()
+		}
+	}
+
+	run := func(gas uint64) (*TransactionResult, error) {
+		view := &EVM{StateDB: state.copyOnWrite(), ChainID: e.ChainID, Block: block, precompiles: e.precompiles}
+		m := msg
+		m.Gas = gas
+		return view.call(m, block)
+	}
+
+	// Everything below the intrinsic gas fails without running, and a
+	// successful run needs at least the gas it used
+	result, err := run(hi)
+	if err != nil {
+		return 0, err
+	}
+	if !result.Success {
+		if result.Revert != nil {
+			return 0, result.Revert
+		}
+		return 0, fmt.Errorf("gas required exceeds allowance (%d): %w", hi, result.Err)
+	}
+	lo := IntrinsicGas(msg.Data, msg.AccessList, msg.To == nil) - 1
+	if result.GasUsed-1 > lo {
+		lo = result.GasUsed - 1
+	}
+
+	// lo always fails and hi always succeeds
+	for lo+1 < hi {
+		mid := lo + (hi-lo)/2
+		result, err := run(mid)
+		if err == nil && result.Success {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi, nil
+}
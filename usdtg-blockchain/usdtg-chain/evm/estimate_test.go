@@ -0,0 +1,91 @@
+package evm
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// needsGas is runtime code that reverts unless GAS reports at least 50000
+var needsGas = []byte{
+	byte(PUSH1 + 2), 0x00, 0xc3, 0x50, byte(GAS), byte(LT), byte(PUSH1), 10, byte(JUMPI),
+	byte(STOP),
+	byte(JUMPDEST), byte(PUSH1), 0, byte(PUSH1), 0, byte(REVERT),
+}
+
+func TestEstimateGasBranchingOnGas(t *testing.T) {
+	e := newTestEVM()
+	contract := *execute(t, e, nil, 0, initCode(needsGas)).ContractAddress
+	msg := CallMsg{From: testSender, To: &contract}
+
+	// GAS must see 50000 after the intrinsic gas, PUSH3 and GAS itself,
+	// although a successful run uses far less
+	const want = TxGas + 3 + 2 + 50_000
+	got, err := e.EstimateGas(msg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("estimated %d, want %d", got, want)
+	}
+	for gas, success := range map[uint64]bool{want - 1: false, want: true} {
+		msg.Gas = gas
+		result, err := e.Call(msg, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Success != success {
+			t.Fatalf("gas %d: success %v", gas, result.Success)
+		}
+		if success && result.GasUsed != TxGas+3+2+3+3+10 {
+			t.Fatalf("a successful run used %d gas", result.GasUsed)
+		}
+	}
+
+	// A cap below the need fails with the revert
+	msg.Gas = want - 1
+	var revert *RevertError
+	if _, err := e.EstimateGas(msg, nil); !errors.As(err, &revert) {
+		t.Fatalf("estimate under the cap: got %v, want a revert", err)
+	}
+}
+
+func TestEstimateGas(t *testing.T) {
+	e := newTestEVM()
+	contract := *execute(t, e, nil, 0, initCode(storeAndLoad)).ContractAddress
+
+	if got, err := e.EstimateGas(CallMsg{From: testSender, To: &testBeneficiary, Value: big.NewInt(1)}, nil); err != nil || got != TxGas {
+		t.Fatalf("transfer: estimated %d, %v", got, err)
+	}
+	// The estimate is the lowest gas limit that succeeds
+	msg := CallMsg{From: testSender, To: &contract, Data: wordBytes(7)}
+	got, err := e.EstimateGas(msg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Gas = got
+	if result, err := e.Call(msg, nil); err != nil || !result.Success {
+		t.Fatalf("call with the estimate %d failed: %v", got, err)
+	}
+	msg.Gas = got - 1
+	if result, err := e.Call(msg, nil); err != nil || result.Success {
+		t.Fatalf("call below the estimate %d succeeded: %v", got, err)
+	}
+
+	// An endless loop runs out at the cap
+	loop := *execute(t, e, nil, 0, initCode([]byte{byte(JUMPDEST), byte(PUSH1), 0, byte(JUMP)})).ContractAddress
+	if _, err := e.EstimateGas(CallMsg{From: testSender, To: &loop, Gas: 100_000}, nil); err == nil || !strings.Contains(err.Error(), "gas required exceeds allowance (100000)") {
+		t.Fatalf("endless loop: got %v", err)
+	}
+
+	// What the sender can pay caps the search
+	poor := BytesToAddress([]byte{0x0b})
+	e.StateDB.addBalance(poor, big.NewInt(30_000))
+	if _, err := e.EstimateGas(CallMsg{From: poor, To: &contract, Data: wordBytes(7), GasPrice: big.NewInt(1)}, nil); err == nil || !strings.Contains(err.Error(), "allowance (30000)") {
+		t.Fatalf("capped by the balance: got %v", err)
+	}
+	if _, err := e.EstimateGas(CallMsg{From: poor, To: &contract, GasPrice: big.NewInt(1), Value: big.NewInt(30_001)}, nil); err == nil {
+		t.Fatal("estimated a transfer the sender cannot pay")
+	}
+}
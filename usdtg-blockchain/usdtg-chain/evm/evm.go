@@ -1,204 +1,330 @@
 package evm
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"math/big"
 	"sync"
+	"time"
 )
 
 // EVM represents a simplified Ethereum Virtual Machine
 type EVM struct {
-	StateDB    *StateDB
-	ChainID    *big.Int
-	mu         sync.RWMutex
-}
-
-// StateDB represents the blockchain state database
-type StateDB struct {
-	Accounts map[string]*Account
-	Storage  map[string]map[string]string
-	mu       sync.RWMutex
+	StateDB *StateDB
+	ChainID *big.Int
+	Block   BlockContext
+	// AllowUnsigned accepts unsigned transactions, which any client can
+	// send on behalf of any address, in blocks and the mempool. Only for
+	// dev chains.
+	AllowUnsigned bool
+	mu            sync.RWMutex // guards the state, receipts and state history
+
+	receipts map[Hash]*Receipt
+	blocks   map[uint64]*blockReceipts
+	history  []stateLayer    // states of recent blocks, oldest first
+	hashes   map[uint64]Hash // hashes of the last 256 blocks, see SetBlockHash
+
+	// changedAccounts, changedSlots and changedBlocks are what committed
+	// blocks changed since the last ClearChanges, see Changes
+	changedAccounts map[Address]struct{}
+	changedSlots    map[Address]map[Hash]struct{}
+	changedBlocks   map[uint64]struct{}
+
+	// precompiles are the standard precompiled contracts and those added
+	// by RegisterPrecompile. Registering replaces the map, so views share
+	// it.
+	precompiles map[Address]PrecompiledContract
 }
 
 // Account represents an Ethereum account
 type Account struct {
-	Address   string   `json:"address"`
-	Nonce     uint64   `json:"nonce"`
-	Balance   *big.Int `json:"balance"`
-	Code      []byte   `json:"code"`
-	CodeHash  string   `json:"code_hash"`
-	Storage   map[string]string `json:"storage"`
+	Address  Address       `json:"address"`
+	Nonce    uint64        `json:"nonce"`
+	Balance  *big.Int      `json:"balance"`
+	Code     Bytes         `json:"code"`
+	CodeHash Hash          `json:"code_hash"`
+	Storage  map[Hash]Hash `json:"storage"`
+
+	// root caches the storage root until Storage changes; it is filled
+	// with mu held for writing
+	root *Hash
 }
 
-// Transaction represents an EVM transaction
+// Transaction represents an EVM transaction. A nil To creates a contract.
+// Signed transactions carry V, R and S and get From from Sender.
 type EVMTransaction struct {
-	From     string   `json:"from"`
-	To       string   `json:"to"`
-	Value    *big.Int `json:"value"`
-	Data     []byte   `json:"data"`
-	Gas      uint64   `json:"gas"`
-	GasPrice *big.Int `json:"gas_price"`
-	Nonce    uint64   `json:"nonce"`
-	Hash     string   `json:"hash"`
+	Type       uint8      `json:"type"`
+	ChainID    *big.Int   `json:"chain_id,omitempty"`
+	From       Address    `json:"from"`
+	To         *Address   `json:"to"`
+	Value      *big.Int   `json:"value"`
+	Data       Bytes      `json:"data"`
+	Gas        uint64     `json:"gas"`
+	GasPrice   *big.Int   `json:"gas_price,omitempty"`
+	GasTipCap  *big.Int   `json:"max_priority_fee_per_gas,omitempty"` // dynamic fee transactions
+	GasFeeCap  *big.Int   `json:"max_fee_per_gas,omitempty"`          // dynamic fee transactions
+	AccessList AccessList `json:"access_list,omitempty"`
+	Nonce      uint64     `json:"nonce"`
+	V          *big.Int   `json:"v,omitempty"`
+	R          *big.Int   `json:"r,omitempty"`
+	S          *big.Int   `json:"s,omitempty"`
+	Hash       Hash       `json:"hash"`
 }
 
 // Contract represents a smart contract
 type Contract struct {
-	Address   string   `json:"address"`
-	Code      []byte   `json:"code"`
-	ABI       string   `json:"abi"`
-	Balance   *big.Int `json:"balance"`
-	CodeHash  string   `json:"code_hash"`
+	Address  Address  `json:"address"`
+	Code     Bytes    `json:"code"`
+	ABI      string   `json:"abi"`
+	Balance  *big.Int `json:"balance"`
+	CodeHash Hash     `json:"code_hash"`
 }
 
 // TransactionResult represents the result of a transaction
 type TransactionResult struct {
-	Success  bool   `json:"success"`
-	GasUsed  uint64 `json:"gas_used"`
-	Error    string `json:"error,omitempty"`
-	Return   []byte `json:"return,omitempty"`
+	TxHash  Hash   `json:"transaction_hash"`
+	Success bool   `json:"success"`
+	GasUsed uint64 `json:"gas_used"`
+	// EffectiveGasPrice is what the sender paid per unit of gas
+	EffectiveGasPrice *big.Int `json:"effective_gas_price"`
+	Error             string   `json:"error,omitempty"`
+	// ErrorCode names the kind of failure, see ErrorCode
+	ErrorCode string `json:"error_code,omitempty"`
+	// Revert holds the decoded revert data of a reverted transaction
+	Revert *RevertError `json:"revert,omitempty"`
+	// Err is the failure as a Go error, which errors.Is matches against
+	// the Err values; a revert is the *RevertError in Revert
+	Err    error  `json:"-"`
+	Return Bytes  `json:"return,omitempty"`
+	Logs   []*Log `json:"logs,omitempty"`
+
+	// ContractAddress is set when the transaction created a contract
+	ContractAddress *Address `json:"contract_address,omitempty"`
 }
 
 // NewEVM creates a new simplified EVM instance
 func NewEVM() *EVM {
-	return &EVM{
-		StateDB: &StateDB{
-			Accounts: make(map[string]*Account),
-			Storage:  make(map[string]map[string]string),
-		},
+	e := &EVM{
+		StateDB: newStateDB(),
 		ChainID: big.NewInt(1337), // USDTg Chain ID
+		Block: BlockContext{
+			GasLimit:    30_000_000,
+			BaseFee:     big.NewInt(0),
+			BlobBaseFee: big.NewInt(1),
+		},
+		receipts: make(map[Hash]*Receipt),
+		blocks:   make(map[uint64]*blockReceipts),
+		hashes:   make(map[uint64]Hash),
+
+		changedAccounts: make(map[Address]struct{}),
+		changedSlots:    make(map[Address]map[Hash]struct{}),
+		changedBlocks:   make(map[uint64]struct{}),
+
+		precompiles: standardPrecompiles,
 	}
+	e.Block.GetHash = e.getHash
+	return e
 }
 
 // CreateAccount creates a new account
-func (e *EVM) CreateAccount(address string) {
-	e.StateDB.mu.Lock()
-	defer e.StateDB.mu.Unlock()
-
-	if _, exists := e.StateDB.Accounts[address]; !exists {
-		e.StateDB.Accounts[address] = &Account{
-			Address:  address,
-			Nonce:    0,
-			Balance:  big.NewInt(0),
-			Code:     []byte{},
-			CodeHash: "",
-			Storage:  make(map[string]string),
-		}
-	}
+func (e *EVM) CreateAccount(address Address) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.StateDB.getOrNewAccount(address)
 }
 
-// DeployContract deploys a smart contract
-func (e *EVM) DeployContract(from, code string, value *big.Int) (*Contract, error) {
-	e.StateDB.mu.Lock()
-	defer e.StateDB.mu.Unlock()
+// applyTransaction validates and executes a transaction and records its
+// receipt; the caller holds mu
+func (e *EVM) applyTransaction(tx *EVMTransaction) (*TransactionResult, error) {
+	block := e.blockContext()
 
-	// Generate contract address
-	contractAddr := e.generateContractAddress(from, e.StateDB.Accounts[from].Nonce)
-	
-	// Create contract account
-	e.StateDB.Accounts[contractAddr] = &Account{
-		Address:  contractAddr,
-		Nonce:    0,
-		Balance:  value,
-		Code:     []byte(code),
-		CodeHash: e.calculateHash([]byte(code)),
-		Storage:  make(map[string]string),
+	// Validate transaction
+	if err := e.validateTransaction(tx, block); err != nil {
+		return nil, err
 	}
 
-	// Update sender account
-	e.StateDB.Accounts[from].Nonce++
-	if e.StateDB.Accounts[from].Balance.Cmp(value) < 0 {
-		return nil, fmt.Errorf("insufficient balance")
+	gasPrice := tx.effectiveGasPrice(block.BaseFee)
+	result := e.applyMessage(tx, block, gasPrice)
+	if tx.Hash == (Hash{}) {
+		tx.Hash = tx.hash()
 	}
-	e.StateDB.Accounts[from].Balance.Sub(e.StateDB.Accounts[from].Balance, value)
-
-	contract := &Contract{
-		Address:   contractAddr,
-		Code:      []byte(code),
-		ABI:       "", // ABI will be set separately
-		Balance:   value,
-		CodeHash:  e.calculateHash([]byte(code)),
+	result.TxHash = tx.Hash
+
+	receipt := &Receipt{
+		Type:              tx.Type,
+		TxHash:            tx.Hash,
+		BlockNumber:       block.Number,
+		From:              tx.From,
+		To:                tx.To,
+		ContractAddress:   result.ContractAddress,
+		Status:            ReceiptStatusFailed,
+		GasUsed:           result.GasUsed,
+		EffectiveGasPrice: gasPrice,
+		Logs:              result.Logs,
+		result:            result,
 	}
+	if result.Success {
+		receipt.Status = ReceiptStatusSuccessful
+	}
+	if receipt.Logs == nil {
+		receipt.Logs = []*Log{}
+	}
+	e.addReceipt(receipt)
 
-	return contract, nil
+	return result, nil
 }
 
-// ExecuteTransaction executes an EVM transaction
-func (e *EVM) ExecuteTransaction(tx *EVMTransaction) (*TransactionResult, error) {
-	e.StateDB.mu.Lock()
-	defer e.StateDB.mu.Unlock()
-
-	// Validate transaction
-	if err := e.validateTransaction(tx); err != nil {
-		return nil, err
+// applyMessage runs a validated transaction at the given gas price and
+// returns its result; the caller holds mu. The sender buys tx.Gas up
+// front and gets back what is left after refunds. The fee recipient earns
+// the tip on the gas used; the base fee is burnt.
+func (e *EVM) applyMessage(tx *EVMTransaction, block BlockContext, gasPrice *big.Int) *TransactionResult {
+	state := e.StateDB
+	state.subBalance(tx.From, new(big.Int).Mul(new(big.Int).SetUint64(tx.Gas), gasPrice))
+
+	state.prepare(tx.From, tx.To, block.Coinbase, tx.AccessList, e.precompiles)
+	in := newInterpreter(e, block, TxContext{Origin: tx.From, GasPrice: gasPrice})
+	gas := tx.Gas - IntrinsicGas(tx.Data, tx.AccessList, tx.To == nil)
+
+	var (
+		ret          []byte
+		gasLeft      uint64
+		err          error
+		contractAddr Address
+	)
+	if tx.To == nil {
+		contractAddr = CreateAddress(tx.From, tx.Nonce)
+		ret, gasLeft, err = in.create(tx.From, tx.Data, gas, tx.Value, contractAddr)
+	} else {
+		state.setNonce(tx.From, tx.Nonce+1)
+		ret, gasLeft, err = in.call(tx.From, *tx.To, tx.Data, gas, tx.Value)
 	}
 
-	// Simple transaction execution
-	result := &TransactionResult{
-		Success:  true,
-		GasUsed:  tx.Gas,
-		Return:   []byte{},
+	gasUsed := tx.Gas - gasLeft
+	refund := state.refund
+	if max := gasUsed / RefundQuotient; refund > max {
+		refund = max
 	}
+	gasUsed -= refund
+	gasLeft += refund
 
-	// Update accounts
-	if e.StateDB.Accounts[tx.From] != nil {
-		e.StateDB.Accounts[tx.From].Nonce++
-		e.StateDB.Accounts[tx.From].Balance.Sub(e.StateDB.Accounts[tx.From].Balance, tx.Value)
+	state.addBalance(tx.From, new(big.Int).Mul(new(big.Int).SetUint64(gasLeft), gasPrice))
+	tip := new(big.Int).Sub(gasPrice, block.BaseFee)
+	if tip.Sign() > 0 {
+		state.addBalance(block.Coinbase, tip.Mul(tip, new(big.Int).SetUint64(gasUsed)))
 	}
 
-	if e.StateDB.Accounts[tx.To] != nil {
-		e.StateDB.Accounts[tx.To].Balance.Add(e.StateDB.Accounts[tx.To].Balance, tx.Value)
+	state.finalise()
+
+	result := &TransactionResult{
+		Success:           err == nil,
+		GasUsed:           gasUsed,
+		EffectiveGasPrice: gasPrice,
+		Return:            ret,
+	}
+	if err == ErrExecutionReverted {
+		result.Revert = NewRevertError(ret)
+		err = result.Revert
+	}
+	if err != nil {
+		result.Err = err
+		result.Error = err.Error()
+		result.ErrorCode = ErrorCode(err)
+	} else {
+		if tx.To == nil {
+			result.ContractAddress = &contractAddr
+		}
+		result.Logs = state.logs
 	}
 
-	return result, nil
+	return result
 }
 
-// validateTransaction validates a transaction
-func (e *EVM) validateTransaction(tx *EVMTransaction) error {
-	// Check if sender account exists
-	if _, exists := e.StateDB.Accounts[tx.From]; !exists {
-		return fmt.Errorf("sender account does not exist")
+// blockContext returns the context of the block being executed, stamping
+// the current time when none is set
+func (e *EVM) blockContext() BlockContext {
+	block := e.Block
+	if block.Time == 0 {
+		block.Time = uint64(time.Now().Unix())
 	}
+	return block
+}
 
+// validateTransaction checks that a transaction can be included in the
+// block: the nonce, the gas limit and price, and that the sender can pay
+// for all gas plus the value
+func (e *EVM) validateTransaction(tx *EVMTransaction, block BlockContext) error {
 	// Check nonce
-	if e.StateDB.Accounts[tx.From].Nonce != tx.Nonce {
-		return fmt.Errorf("invalid nonce")
+	if nonce := e.StateDB.getNonce(tx.From); nonce != tx.Nonce {
+		return fmt.Errorf("invalid nonce: have %d, want %d", tx.Nonce, nonce)
+	}
+	return e.validateFees(tx, block)
+}
+
+// validateFees checks everything about a transaction but its nonce: the
+// amounts, the gas limit and price, and that the sender can pay for all
+// gas plus the value
+func (e *EVM) validateFees(tx *EVMTransaction, block BlockContext) error {
+	// Check amounts
+	if tx.Value == nil || tx.Value.Sign() < 0 {
+		return fmt.Errorf("invalid value %v", tx.Value)
+	}
+	for _, price := range []*big.Int{tx.GasPrice, tx.GasTipCap, tx.GasFeeCap} {
+		if price != nil && price.Sign() < 0 {
+			return fmt.Errorf("negative gas price %s", price)
+		}
+	}
+
+	// Check gas
+	if tx.To == nil && len(tx.Data) > MaxInitCodeSize {
+		return fmt.Errorf("%w: code size %d, limit %d", ErrMaxInitCodeSizeExceeded, len(tx.Data), MaxInitCodeSize)
+	}
+	if gas := IntrinsicGas(tx.Data, tx.AccessList, tx.To == nil); tx.Gas < gas {
+		return fmt.Errorf("intrinsic gas too low: have %d, want %d", tx.Gas, gas)
+	}
+	if tx.Gas > block.GasLimit {
+		return fmt.Errorf("gas limit %d exceeds block gas limit %d", tx.Gas, block.GasLimit)
+	}
+	if tx.Type == DynamicFeeTxType {
+		if tx.GasTipCap == nil || tx.GasFeeCap == nil {
+			return fmt.Errorf("dynamic fee transaction without fee caps")
+		}
+		if tx.GasFeeCap.Cmp(tx.GasTipCap) < 0 {
+			return fmt.Errorf("max priority fee per gas %s higher than max fee per gas %s", tx.GasTipCap, tx.GasFeeCap)
+		}
+		if tx.GasFeeCap.Cmp(block.BaseFee) < 0 {
+			return fmt.Errorf("max fee per gas %s below base fee %s", tx.GasFeeCap, block.BaseFee)
+		}
+	} else if tx.GasPrice == nil || tx.GasPrice.Cmp(block.BaseFee) < 0 {
+		return fmt.Errorf("gas price %v below base fee %s", tx.GasPrice, block.BaseFee)
 	}
 
 	// Check balance
-	totalCost := new(big.Int).Mul(tx.GasPrice, big.NewInt(int64(tx.Gas)))
+	totalCost := new(big.Int).Mul(tx.maxGasPrice(), new(big.Int).SetUint64(tx.Gas))
 	totalCost.Add(totalCost, tx.Value)
-	if e.StateDB.Accounts[tx.From].Balance.Cmp(totalCost) < 0 {
-		return fmt.Errorf("insufficient balance")
+	if balance := e.StateDB.getBalance(tx.From); balance.Cmp(totalCost) < 0 {
+		return fmt.Errorf("insufficient balance: have %s, want %s", balance, totalCost)
 	}
 
 	return nil
 }
 
-// generateContractAddress generates a contract address
-func (e *EVM) generateContractAddress(from string, nonce uint64) string {
-	data := fmt.Sprintf("%s%d", from, nonce)
-	hash := sha256.Sum256([]byte(data))
-	return "0x" + hex.EncodeToString(hash[:20])
-}
-
-// calculateHash calculates hash of data
-func (e *EVM) calculateHash(data []byte) string {
-	hash := sha256.Sum256(data)
-	return hex.EncodeToString(hash[:])
+// GetAccount returns an account by address
+func (e *EVM) GetAccount(address Address) *Account {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.StateDB.getAccount(address)
 }
 
-// GetAccount returns an account by address
-func (e *EVM) GetAccount(address string) *Account {
-	e.StateDB.mu.RLock()
-	defer e.StateDB.mu.RUnlock()
-	return e.StateDB.Accounts[address]
+// GetNonce returns the nonce of an account, zero if it does not exist
+func (e *EVM) GetNonce(address Address) uint64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.StateDB.getNonce(address)
 }
 
 // GetBalance returns the balance of an account
-func (e *EVM) GetBalance(address string) *big.Int {
+func (e *EVM) GetBalance(address Address) *big.Int {
 	account := e.GetAccount(address)
 	if account == nil {
 		return big.NewInt(0)
@@ -206,29 +332,33 @@ func (e *EVM) GetBalance(address string) *big.Int {
 	return account.Balance
 }
 
-// AddBalance adds balance to an account
-func (e *EVM) AddBalance(address string, amount *big.Int) {
-	e.StateDB.mu.Lock()
-	defer e.StateDB.mu.Unlock()
+// GetStorage returns the value of a storage slot, zero if unset
+func (e *EVM) GetStorage(address Address, slot Hash) Hash {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.StateDB.getState(address, slot)
+}
 
-	if _, exists := e.StateDB.Accounts[address]; !exists {
-		e.CreateAccount(address)
-	}
-	
-	e.StateDB.Accounts[address].Balance.Add(e.StateDB.Accounts[address].Balance, amount)
+// StorageRoot returns the root hash of an account's storage trie. It
+// caches the root, so it takes mu for writing.
+func (e *EVM) StorageRoot(address Address) Hash {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.StateDB.storageRoot(address)
 }
 
 // GetContract returns a contract by address
-func (e *EVM) GetContract(address string) *Contract {
+func (e *EVM) GetContract(address Address) *Contract {
 	account := e.GetAccount(address)
 	if account == nil || len(account.Code) == 0 {
 		return nil
 	}
 
 	return &Contract{
-		Address: address,
-		Code:    account.Code,
-		ABI:     "", // ABI will be set separately
-		Balance: account.Balance,
+		Address:  address,
+		Code:     account.Code,
+		ABI:      "", // ABI will be set separately
+		Balance:  account.Balance,
+		CodeHash: account.CodeHash,
 	}
 }
@@ -0,0 +1,132 @@
+package evm
+
+import (
+	"fmt"
+)
+
+// MaxFilterBlockRange caps the number of blocks one log query may scan
+const MaxFilterBlockRange = 10_000
+
+// FilterQuery selects logs by block range, emitting contract and topics.
+//
+// A nil FromBlock or ToBlock stands for the current block. An empty
+// Addresses matches any contract. Topics are matched by position: an
+// empty entry matches any topic, otherwise the log's topic at that
+// position must be one of the listed hashes. Logs with fewer topics than
+// the query constrains do not match.
+type FilterQuery struct {
+	FromBlock *uint64   `json:"from_block"`
+	ToBlock   *uint64   `json:"to_block"`
+	Addresses []Address `json:"addresses"`
+	Topics    [][]Hash  `json:"topics"`
+}
+
+// FilterLogs returns the logs matching q, in block order. Blocks and
+// receipts whose bloom rules out a match are skipped without looking at
+// their logs.
+func (e *EVM) FilterLogs(q FilterQuery) ([]*Log, error) {
+	latest := e.BlockNumber()
+	from, to := latest, latest
+	if q.FromBlock != nil {
+		from = *q.FromBlock
+	}
+	if q.ToBlock != nil {
+		to = *q.ToBlock
+	}
+	if from > to {
+		return nil, fmt.Errorf("invalid block range: from %d is after to %d", from, to)
+	}
+	if to-from >= MaxFilterBlockRange {
+		return nil, fmt.Errorf("block range %d-%d exceeds %d blocks", from, to, MaxFilterBlockRange)
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	logs := []*Log{}
+	for number := from; ; number++ {
+		if block := e.blocks[number]; block != nil && q.bloomMatches(block.bloom) {
+			for _, receipt := range block.receipts {
+				if !q.bloomMatches(receipt.Bloom) {
+					continue
+				}
+				for _, log := range receipt.Logs {
+					if q.matches(log) {
+						logs = append(logs, log)
+					}
+				}
+			}
+		}
+		if number == to {
+			break
+		}
+	}
+	return logs, nil
+}
+
+// bloomMatches reports whether a bloom may contain logs matching q
+func (q *FilterQuery) bloomMatches(bloom Bloom) bool {
+	if len(q.Addresses) > 0 {
+		found := false
+		for _, addr := range q.Addresses {
+			if bloom.Test(addr[:]) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, options := range q.Topics {
+		if len(options) == 0 {
+			continue
+		}
+		found := false
+		for _, topic := range options {
+			if bloom.Test(topic[:]) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether a log matches q's addresses and topics
+func (q *FilterQuery) matches(log *Log) bool {
+	if len(q.Addresses) > 0 {
+		found := false
+		for _, addr := range q.Addresses {
+			if log.Address == addr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(q.Topics) > len(log.Topics) {
+		return false
+	}
+	for i, options := range q.Topics {
+		if len(options) == 0 {
+			continue
+		}
+		found := false
+		for _, topic := range options {
+			if log.Topics[i] == topic {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
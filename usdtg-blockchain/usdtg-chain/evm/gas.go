@@ -0,0 +1,425 @@
+package evm
+
+import (
+	"math"
+	"math/big"
+	"math/bits"
+)
+
+// Gas costs for the Cancun rule set
+const (
+	GasQuickStep   uint64 = 2
+	GasFastestStep uint64 = 3
+	GasFastStep    uint64 = 5
+	GasMidStep     uint64 = 8
+	GasSlowStep    uint64 = 10
+	GasExtStep     uint64 = 20
+
+	JumpdestGas             uint64 = 1
+	Keccak256Gas            uint64 = 30
+	Keccak256WordGas        uint64 = 6
+	CopyGas                 uint64 = 3
+	MemoryGas               uint64 = 3
+	QuadCoeffDiv            uint64 = 512
+	ExpByteGas              uint64 = 50
+	LogGas                  uint64 = 375
+	LogTopicGas             uint64 = 375
+	LogDataGas              uint64 = 8
+	SelfdestructGas         uint64 = 5000
+	CreateBySelfdestructGas uint64 = 25000
+
+	// Transactions
+	TxGas                 uint64 = 21000
+	TxGasContractCreation uint64 = 53000
+	TxDataZeroGas         uint64 = 4
+	TxDataNonZeroGas      uint64 = 16
+	RefundQuotient        uint64 = 5 // EIP-3529: refunds are capped at gasUsed/5
+
+	// EIP-2930
+	TxAccessListAddressGas    uint64 = 2400
+	TxAccessListStorageKeyGas uint64 = 1900
+
+	// Contract creation
+	CreateGas       uint64 = 32000
+	CreateDataGas   uint64 = 200 // per byte of deployed code
+	InitCodeWordGas uint64 = 2   // EIP-3860
+	MaxCodeSize            = 24576
+	MaxInitCodeSize        = 2 * MaxCodeSize
+	CallCreateDepth        = 1024
+
+	// Message calls
+	CallValueTransferGas uint64 = 9000
+	CallNewAccountGas    uint64 = 25000
+	CallStipend          uint64 = 2300 // free gas for a callee receiving value
+
+	// EIP-2929
+	ColdAccountAccessCost uint64 = 2600
+	ColdSloadCost         uint64 = 2100
+	WarmStorageReadCost   uint64 = 100
+
+	// EIP-2200 and EIP-3529
+	SstoreSentryGas     uint64 = 2300
+	SstoreSetGas        uint64 = 20000
+	SstoreResetGas      uint64 = 5000
+	SstoreClearsRefund  uint64 = SstoreResetGas - ColdSloadCost + 1900 // 4800
+	TransientStorageGas uint64 = 100
+
+	// Precompiled contracts
+	EcrecoverGas            uint64 = 3000
+	Sha256BaseGas           uint64 = 60
+	Sha256PerWordGas        uint64 = 12
+	Ripemd160BaseGas        uint64 = 600
+	Ripemd160PerWordGas     uint64 = 120
+	IdentityBaseGas         uint64 = 15
+	IdentityPerWordGas      uint64 = 3
+	ModExpMinGas            uint64 = 200 // EIP-2565
+	Bn256AddGas             uint64 = 150 // EIP-1108
+	Bn256ScalarMulGas       uint64 = 6000
+	Bn256PairingBaseGas     uint64 = 45000
+	Bn256PairingPerPointGas uint64 = 34000
+	Blake2FRoundGas         uint64 = 1 // EIP-152
+)
+
+// IntrinsicGas returns what a transaction costs before any code runs: the
+// base cost, the calldata, the access list and, for creations, the init
+// code words (EIP-3860)
+func IntrinsicGas(data []byte, accessList AccessList, creation bool) uint64 {
+	gas := TxGas
+	if creation {
+		gas = TxGasContractCreation
+	}
+	var nonZero uint64
+	for _, b := range data {
+		if b != 0 {
+			nonZero++
+		}
+	}
+	zero := uint64(len(data)) - nonZero
+	gas += nonZero*TxDataNonZeroGas + zero*TxDataZeroGas
+	gas += uint64(len(accessList))*TxAccessListAddressGas + uint64(accessList.StorageKeys())*TxAccessListStorageKeyGas
+	if creation {
+		gas += toWordSize(uint64(len(data))) * InitCodeWordGas
+	}
+	return gas
+}
+
+// maxMemorySize bounds memory so that the quadratic cost fits in a uint64
+const maxMemorySize = 0x1FFFFFFFE0
+
+// toWordSize returns the number of 32-byte words needed for size bytes
+func toWordSize(size uint64) uint64 {
+	if size > math.MaxUint64-31 {
+		return math.MaxUint64/32 + 1
+	}
+	return (size + 31) / 32
+}
+
+// safeAdd adds two gas values and reports overflow
+func safeAdd(a, b uint64) (uint64, bool) {
+	sum, carry := bits.Add64(a, b, 0)
+	return sum, carry != 0
+}
+
+// safeMul multiplies two gas values and reports overflow
+func safeMul(a, b uint64) (uint64, bool) {
+	hi, lo := bits.Mul64(a, b)
+	return lo, hi != 0
+}
+
+// memoryGasCost returns the cost of growing memory to newSize bytes. Only
+// the difference to what was already paid is charged.
+func memoryGasCost(mem *Memory, newSize uint64) (uint64, error) {
+	if newSize == 0 {
+		return 0, nil
+	}
+	if newSize > maxMemorySize {
+		return 0, ErrGasUintOverflow
+	}
+
+	words := toWordSize(newSize)
+	newSize = words * 32
+	if newSize > uint64(mem.len()) {
+		total := words*MemoryGas + words*words/QuadCoeffDiv
+		fee := total - mem.lastGasCost
+		mem.lastGasCost = total
+		return fee, nil
+	}
+	return 0, nil
+}
+
+// memoryCopierGas charges memory expansion plus CopyGas per word of the
+// length found at stack position pos
+func memoryCopierGas(pos int) gasFunc {
+	return func(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+		gas, err := memoryGasCost(mem, memorySize)
+		if err != nil {
+			return 0, err
+		}
+		length := stack.back(pos)
+		if !length.IsUint64() {
+			return 0, ErrGasUintOverflow
+		}
+		words, overflow := safeMul(toWordSize(length.Uint64()), CopyGas)
+		if overflow {
+			return 0, ErrGasUintOverflow
+		}
+		if gas, overflow = safeAdd(gas, words); overflow {
+			return 0, ErrGasUintOverflow
+		}
+		return gas, nil
+	}
+}
+
+var (
+	gasCallDataCopy   = memoryCopierGas(2)
+	gasCodeCopy       = memoryCopierGas(2)
+	gasReturnDataCopy = memoryCopierGas(2)
+	gasMcopy          = memoryCopierGas(2)
+)
+
+func pureMemoryGascost(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return memoryGasCost(mem, memorySize)
+}
+
+func gasKeccak256(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	gas, err := memoryGasCost(mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	size := stack.back(1)
+	if !size.IsUint64() {
+		return 0, ErrGasUintOverflow
+	}
+	words, overflow := safeMul(toWordSize(size.Uint64()), Keccak256WordGas)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	if gas, overflow = safeAdd(gas, words); overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return gas, nil
+}
+
+func gasExp(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	expBytes := uint64((stack.back(1).BitLen() + 7) / 8)
+	return expBytes * ExpByteGas, nil
+}
+
+func makeGasLog(n uint64) gasFunc {
+	return func(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+		size := stack.back(1)
+		if !size.IsUint64() {
+			return 0, ErrGasUintOverflow
+		}
+
+		gas, err := memoryGasCost(mem, memorySize)
+		if err != nil {
+			return 0, err
+		}
+		var overflow bool
+		if gas, overflow = safeAdd(gas, n*LogTopicGas); overflow {
+			return 0, ErrGasUintOverflow
+		}
+		dataGas, overflow := safeMul(size.Uint64(), LogDataGas)
+		if overflow {
+			return 0, ErrGasUintOverflow
+		}
+		if gas, overflow = safeAdd(gas, dataGas); overflow {
+			return 0, ErrGasUintOverflow
+		}
+		return gas, nil
+	}
+}
+
+// gasAccountAccess charges the cold surcharge the first time an address is
+// touched in a transaction (EIP-2929). The warm cost is the constant gas.
+func gasAccountAccess(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	addr := wordToAddress(stack.peek())
+	if in.evm.StateDB.addAddressToAccessList(addr) {
+		return ColdAccountAccessCost - WarmStorageReadCost, nil
+	}
+	return 0, nil
+}
+
+func gasExtCodeCopy(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	gas, err := memoryCopierGas(3)(in, f, stack, mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	addr := wordToAddress(stack.peek())
+	if in.evm.StateDB.addAddressToAccessList(addr) {
+		var overflow bool
+		if gas, overflow = safeAdd(gas, ColdAccountAccessCost-WarmStorageReadCost); overflow {
+			return 0, ErrGasUintOverflow
+		}
+	}
+	return gas, nil
+}
+
+func gasSLoad(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	if in.evm.StateDB.addSlotToAccessList(f.address, BigToHash(stack.peek())) {
+		return ColdSloadCost, nil
+	}
+	return WarmStorageReadCost, nil
+}
+
+// gasSStore implements the net gas metering of EIP-2200 with the access
+// costs of EIP-2929 and the reduced refunds of EIP-3529
+func gasSStore(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	if f.gas <= SstoreSentryGas {
+		return 0, ErrOutOfGas
+	}
+
+	state := in.evm.StateDB
+	key, value := BigToHash(stack.back(0)), BigToHash(stack.back(1))
+
+	var cost uint64
+	if state.addSlotToAccessList(f.address, key) {
+		cost = ColdSloadCost
+	}
+
+	current := state.getState(f.address, key)
+	if current == value {
+		return cost + WarmStorageReadCost, nil
+	}
+
+	var zero Hash
+	original := state.getCommittedState(f.address, key)
+	if original == current {
+		if original == zero {
+			return cost + SstoreSetGas, nil
+		}
+		if value == zero {
+			state.addRefund(SstoreClearsRefund)
+		}
+		return cost + (SstoreResetGas - ColdSloadCost), nil
+	}
+
+	if original != zero {
+		if current == zero {
+			state.subRefund(SstoreClearsRefund)
+		} else if value == zero {
+			state.addRefund(SstoreClearsRefund)
+		}
+	}
+	if original == value {
+		if original == zero {
+			state.addRefund(SstoreSetGas - WarmStorageReadCost)
+		} else {
+			state.addRefund(SstoreResetGas - ColdSloadCost - WarmStorageReadCost)
+		}
+	}
+	return cost + WarmStorageReadCost, nil
+}
+
+// gasCreate charges memory expansion and the EIP-3860 cost per word of
+// init code
+func gasCreate(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return createGas(mem, memorySize, stack.back(2), InitCodeWordGas)
+}
+
+// gasCreate2 additionally charges hashing the init code for the address
+func gasCreate2(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return createGas(mem, memorySize, stack.back(2), InitCodeWordGas+Keccak256WordGas)
+}
+
+func createGas(mem *Memory, memorySize uint64, size *big.Int, wordGas uint64) (uint64, error) {
+	gas, err := memoryGasCost(mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	if !size.IsUint64() || size.Uint64() > MaxInitCodeSize {
+		return 0, ErrMaxInitCodeSizeExceeded
+	}
+	words := toWordSize(size.Uint64()) * wordGas
+	var overflow bool
+	if gas, overflow = safeAdd(gas, words); overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return gas, nil
+}
+
+func gasSelfdestruct(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	var gas uint64
+	state := in.evm.StateDB
+	beneficiary := wordToAddress(stack.peek())
+
+	if state.addAddressToAccessList(beneficiary) {
+		gas = ColdAccountAccessCost
+	}
+	if state.empty(beneficiary) && state.getBalance(f.address).Sign() != 0 {
+		gas += CreateBySelfdestructGas
+	}
+	return gas, nil
+}
+
+// gasCall charges for the value transfer of a CALL and for the account it
+// creates, which only happens when value is sent to an empty account
+func gasCall(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	var extra uint64
+	if stack.back(2).Sign() != 0 {
+		extra = CallValueTransferGas
+		if in.evm.StateDB.empty(wordToAddress(stack.back(1))) {
+			extra += CallNewAccountGas
+		}
+	}
+	return callGas(in, f, stack, mem, memorySize, extra)
+}
+
+func gasCallCode(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	var extra uint64
+	if stack.back(2).Sign() != 0 {
+		extra = CallValueTransferGas
+	}
+	return callGas(in, f, stack, mem, memorySize, extra)
+}
+
+func gasDelegateCall(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return callGas(in, f, stack, mem, memorySize, 0)
+}
+
+func gasStaticCall(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return callGas(in, f, stack, mem, memorySize, 0)
+}
+
+// callGas charges memory expansion, the cold access surcharge of the
+// callee (EIP-2929) and extra, plus the gas forwarded to the callee: what
+// the caller asked for, but at most all but one 64th of what is left
+// after the other costs (EIP-150). The forwarded gas is left in
+// in.callGasTemp for the operation.
+func callGas(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64, extra uint64) (uint64, error) {
+	gas, err := memoryGasCost(mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	if in.evm.StateDB.addAddressToAccessList(wordToAddress(stack.back(1))) {
+		extra += ColdAccountAccessCost - WarmStorageReadCost
+	}
+	var overflow bool
+	if gas, overflow = safeAdd(gas, extra); overflow {
+		return 0, ErrGasUintOverflow
+	}
+	if f.gas < gas {
+		return 0, ErrOutOfGas
+	}
+
+	available := f.gas - gas
+	available -= available / 64
+	in.callGasTemp = available
+	if requested := stack.back(0); requested.IsUint64() && requested.Uint64() < available {
+		in.callGasTemp = requested.Uint64()
+	}
+	return gas + in.callGasTemp, nil
+}
+
+// calcMemSize returns offset+length as a uint64, or reports overflow. A
+// zero length never touches memory regardless of the offset.
+func calcMemSize(offset, length *big.Int) (uint64, bool) {
+	if length.Sign() == 0 {
+		return 0, false
+	}
+	if !offset.IsUint64() || !length.IsUint64() {
+		return 0, true
+	}
+	return safeAdd(offset.Uint64(), length.Uint64())
+}
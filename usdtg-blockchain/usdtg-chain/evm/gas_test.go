@@ -0,0 +1,115 @@
+package evm
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestFeeCharging(t *testing.T) {
+	e := newTestEVM()
+	failing := deploy(t, e, []byte{byte(INVALID)})
+	e.Block.BaseFee = big.NewInt(10)
+	coinbase := BytesToAddress([]byte{0xc0})
+	e.Block.Coinbase = coinbase
+	to := BytesToAddress([]byte{0x70})
+	before := e.GetBalance(testSender).Int64()
+
+	// A legacy transaction pays its gas price, of which what exceeds the
+	// base fee goes to the coinbase and the rest is burnt
+	result := applyTx(t, e, &EVMTransaction{
+		From: testSender, To: &to, Value: big.NewInt(1000), Gas: 50_000, GasPrice: big.NewInt(15), Nonce: e.GetNonce(testSender),
+	})
+	if result.GasUsed != TxGas || result.EffectiveGasPrice.Int64() != 15 {
+		t.Fatalf("used %d gas at %s", result.GasUsed, result.EffectiveGasPrice)
+	}
+	balances := []struct {
+		addr Address
+		want int64
+	}{
+		{testSender, before - 1000 - 21000*15},
+		{to, 1000},
+		{coinbase, 21000 * 5},
+	}
+	for _, b := range balances {
+		if got := e.GetBalance(b.addr); got.Int64() != b.want {
+			t.Fatalf("balance of %s is %s, want %d", b.addr, got, b.want)
+		}
+	}
+
+	// A dynamic fee transaction pays the base fee plus its tip, capped
+	// at its fee cap
+	result = applyTx(t, e, &EVMTransaction{
+		Type: DynamicFeeTxType, From: testSender, To: &to, Value: new(big.Int), Gas: 21000,
+		GasTipCap: big.NewInt(5), GasFeeCap: big.NewInt(12), Nonce: e.GetNonce(testSender),
+	})
+	if result.EffectiveGasPrice.Int64() != 12 {
+		t.Fatalf("effective gas price %s, want 12", result.EffectiveGasPrice)
+	}
+	if got := e.GetBalance(coinbase).Int64(); got != 21000*5+21000*2 {
+		t.Fatalf("coinbase balance %d", got)
+	}
+
+	// A failed execution pays for all its gas
+	before = e.GetBalance(testSender).Int64()
+	result = applyTx(t, e, &EVMTransaction{
+		From: testSender, To: &failing, Value: new(big.Int), Gas: 30_000, GasPrice: big.NewInt(10), Nonce: e.GetNonce(testSender),
+	})
+	if result.Success || result.GasUsed != 30_000 {
+		t.Fatalf("failed call used %d gas", result.GasUsed)
+	}
+	if got := e.GetBalance(testSender).Int64(); got != before-30_000*10 {
+		t.Fatalf("sender paid %d for a failed call", before-got)
+	}
+
+	// Transactions priced below the base fee or that the sender cannot
+	// pay for stay out of the block
+	for _, tx := range []*EVMTransaction{
+		{From: testSender, To: &to, Value: new(big.Int), Gas: 21000, GasPrice: big.NewInt(9)},
+		{Type: DynamicFeeTxType, From: testSender, To: &to, Value: new(big.Int), Gas: 21000, GasTipCap: new(big.Int), GasFeeCap: big.NewInt(9)},
+		{From: testSender, To: &to, Value: big.NewInt(before), Gas: 21000, GasPrice: big.NewInt(10)},
+	} {
+		tx.Nonce = e.GetNonce(testSender)
+		tx.Hash = tx.hash()
+		if _, included, _, _ := e.BuildBlock(e.Block.Number+1, e.Block.Time+1, nil, []*EVMTransaction{tx}); len(included) != 0 {
+			t.Fatalf("included %+v", tx)
+		}
+	}
+}
+
+func TestSstoreRefunds(t *testing.T) {
+	// Stores the first calldata word in slot 0
+	store := []byte{byte(PUSH1), 0, byte(CALLDATALOAD), byte(PUSH1), 0, byte(SSTORE), byte(STOP)}
+	storeGas := TxGas + 3 + 3 + 3 + ColdSloadCost
+
+	tests := []struct {
+		name  string
+		value int64
+		gas   uint64
+	}{
+		// Changing a set slot costs the reset price
+		{"reset", 2, storeGas + 31*TxDataZeroGas + TxDataNonZeroGas + SstoreResetGas - ColdSloadCost},
+		// Clearing it is refunded 4800, under the cap of a fifth
+		{"clear", 0, storeGas + 32*TxDataZeroGas + SstoreResetGas - ColdSloadCost - SstoreClearsRefund},
+		// Writing the same value only reads
+		{"no-op", 1, storeGas + 31*TxDataZeroGas + TxDataNonZeroGas + WarmStorageReadCost},
+	}
+	for _, tt := range tests {
+		e := newTestEVM()
+		contract := deploy(t, e, store)
+		execute(t, e, &contract, 0, wordBytes(1))
+		result := execute(t, e, &contract, 0, wordBytes(tt.value))
+		if result.GasUsed != tt.gas {
+			t.Errorf("%s: used %d gas, want %d", tt.name, result.GasUsed, tt.gas)
+		}
+		if got := e.GetStorage(contract, Hash{}); got != BytesToHash(wordBytes(tt.value)) {
+			t.Errorf("%s: slot 0 is %s", tt.name, got)
+		}
+	}
+
+	// SSTORE needs more than the 2300 gas of a stipend left
+	_, _, result := runCode(t, store, wordBytes(1), storeGas-ColdSloadCost+31*TxDataZeroGas+TxDataNonZeroGas+SstoreSentryGas)
+	if result.Success || !errors.Is(result.Err, ErrOutOfGas) {
+		t.Fatalf("SSTORE with the stipend left: %+v", result)
+	}
+}
@@ -0,0 +1,162 @@
+package evm
+
+import "fmt"
+
+// StateHistory is the number of recent blocks whose state is kept for
+// calls at an earlier block
+const StateHistory = 128
+
+// blockHashHistory is the number of recent block hashes BLOCKHASH can
+// return
+const blockHashHistory = 256
+
+// stateLayer is the state at the end of a block. Each layer is a
+// copy-on-write layer over the one before it, so a block costs only the
+// accounts it changed.
+type stateLayer struct {
+	number uint64
+	state  *StateDB
+}
+
+// BlockNumber returns the number of the latest block executed
+func (e *EVM) BlockNumber() uint64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.Block.Number
+}
+
+// SetBlockNumber moves to a later block without executing anything, for
+// blocks that carry no EVM part. The state of the current block is kept
+// for calls at that block. Earlier numbers are ignored.
+func (e *EVM) SetBlockNumber(number uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.setBlockNumber(number)
+}
+
+// setBlockNumber is SetBlockNumber for callers holding mu
+func (e *EVM) setBlockNumber(number uint64) {
+	if number <= e.Block.Number {
+		return
+	}
+	e.commitBlock()
+	e.Block.Number = number
+}
+
+// commitBlock freezes the current state as the state of the current block
+// and continues on a new layer over it. Once more than StateHistory
+// blocks are kept, the oldest layer is merged into the next.
+func (e *EVM) commitBlock() {
+	e.history = append(e.history, stateLayer{number: e.Block.Number, state: e.StateDB})
+	e.StateDB = e.StateDB.copyOnWrite()
+
+	if len(e.history) > StateHistory {
+		base, next := e.history[0].state, e.history[1].state
+		base.absorb(next)
+		child := e.StateDB
+		if len(e.history) > 2 {
+			child = e.history[2].state
+		}
+		child.parent = base
+		e.history[1].state = base
+		e.history = e.history[1:]
+	}
+}
+
+// stateAt returns the state at the end of the given block, or the current
+// state for the current block; the caller holds mu. The result must not
+// be modified.
+func (e *EVM) stateAt(number uint64) (*StateDB, error) {
+	if number > e.Block.Number {
+		return nil, fmt.Errorf("block %d is in the future, current block is %d", number, e.Block.Number)
+	}
+	if number == e.Block.Number {
+		return e.StateDB, nil
+	}
+	// Blocks without a layer of their own changed nothing since the
+	// latest earlier layer
+	for i := len(e.history) - 1; i >= 0; i-- {
+		if e.history[i].number <= number {
+			return e.history[i].state, nil
+		}
+	}
+	return nil, fmt.Errorf("state of block %d is not available", number)
+}
+
+// callState returns the block context and state a call at the given block
+// runs in: the state at the end of that block, or for nil the current
+// state in the context of the next block, which is what a transaction sent
+// now would see. The caller holds mu.
+func (e *EVM) callState(number *uint64) (BlockContext, *StateDB, error) {
+	block := e.blockContext()
+	if number == nil {
+		block.Number++
+		block.PrevRandao = e.prevRandao(block.Number)
+		return block, e.StateDB, nil
+	}
+	block.Number = *number
+	block.PrevRandao = e.prevRandao(block.Number)
+	state, err := e.stateAt(*number)
+	return block, state, err
+}
+
+// AccountAt returns an account as of the end of the given block, or as
+// of now for nil, and nil if it did not exist then. Blocks older than the
+// last StateHistory are not available. The result must not be modified.
+func (e *EVM) AccountAt(address Address, number *uint64) (*Account, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	_, state, err := e.callState(number)
+	if err != nil {
+		return nil, err
+	}
+	return state.getAccount(address), nil
+}
+
+// StorageAt returns the value of a storage slot as of the end of the
+// given block, or as of now for nil; see AccountAt
+func (e *EVM) StorageAt(address Address, slot Hash, number *uint64) (Hash, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	_, state, err := e.callState(number)
+	if err != nil {
+		return Hash{}, err
+	}
+	return state.getState(address, slot), nil
+}
+
+// SetBlockHash records the hash of a block of the native chain once it is
+// part of the chain. BLOCKHASH returns it to the 256 blocks after it, and
+// it is the PREVRANDAO of the next block.
+func (e *EVM) SetBlockHash(number uint64, hash Hash) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.hashes[number] = hash
+	if number >= blockHashHistory {
+		delete(e.hashes, number-blockHashHistory)
+	}
+}
+
+// getHash returns the hash of a recent block, or nil if it is not known.
+// It is the GetHash of the block context and runs with mu held.
+func (e *EVM) getHash(number uint64) []byte {
+	hash, ok := e.hashes[number]
+	if !ok {
+		return nil
+	}
+	return hash[:]
+}
+
+// prevRandao returns the PREVRANDAO of a block. Without a beacon chain the
+// hash of the parent block stands in for the randomness; it is known
+// before the block is built, so contracts must not rely on it for
+// anything of value. The caller holds mu.
+func (e *EVM) prevRandao(number uint64) []byte {
+	if number == 0 {
+		return nil
+	}
+	return e.getHash(number - 1)
+}
@@ -0,0 +1,751 @@
+package evm
+
+import (
+	"fmt"
+	"math/big"
+)
+
+var (
+	tt255   = new(big.Int).Lsh(big.NewInt(1), 255)
+	tt256   = new(big.Int).Lsh(big.NewInt(1), 256)
+	tt256m1 = new(big.Int).Sub(tt256, big.NewInt(1))
+	tt160m1 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 160), big.NewInt(1))
+
+	word1  = big.NewInt(1)
+	word32 = big.NewInt(32)
+)
+
+// u256 wraps x into [0, 2^256)
+func u256(x *big.Int) *big.Int {
+	return x.And(x, tt256m1)
+}
+
+// s256 interprets a word as a two's complement signed integer
+func s256(x *big.Int) *big.Int {
+	if x.Cmp(tt255) < 0 {
+		return x
+	}
+	return new(big.Int).Sub(x, tt256)
+}
+
+// boolWord returns 1 for true and 0 for false
+func boolWord(b bool) *big.Int {
+	if b {
+		return big.NewInt(1)
+	}
+	return new(big.Int)
+}
+
+// wordToAddress takes the low 20 bytes of a word as an address
+func wordToAddress(w *big.Int) Address {
+	return BytesToAddress(w.Bytes())
+}
+
+// addressWord converts an address to a word
+func addressWord(addr Address) *big.Int {
+	return new(big.Int).SetBytes(addr[:])
+}
+
+// getData returns size bytes of data starting at offset, zero padded
+func getData(data []byte, offset *big.Int, size uint64) []byte {
+	out := make([]byte, size)
+	if offset.IsUint64() && offset.Uint64() < uint64(len(data)) {
+		copy(out, data[offset.Uint64():])
+	}
+	return out
+}
+
+// Arithmetic
+
+func opAdd(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	stack.push(u256(x.Add(x, y)))
+	return nil, nil
+}
+
+func opMul(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	stack.push(u256(x.Mul(x, y)))
+	return nil, nil
+}
+
+func opSub(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	stack.push(u256(x.Sub(x, y)))
+	return nil, nil
+}
+
+func opDiv(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	if y.Sign() == 0 {
+		stack.push(new(big.Int))
+	} else {
+		stack.push(x.Div(x, y))
+	}
+	return nil, nil
+}
+
+func opSdiv(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y := s256(stack.pop()), s256(stack.pop())
+	if y.Sign() == 0 {
+		stack.push(new(big.Int))
+	} else {
+		// Quo truncates towards zero like the EVM
+		stack.push(u256(new(big.Int).Quo(x, y)))
+	}
+	return nil, nil
+}
+
+func opMod(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	if y.Sign() == 0 {
+		stack.push(new(big.Int))
+	} else {
+		stack.push(x.Mod(x, y))
+	}
+	return nil, nil
+}
+
+func opSmod(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y := s256(stack.pop()), s256(stack.pop())
+	if y.Sign() == 0 {
+		stack.push(new(big.Int))
+	} else {
+		// Rem takes the sign of the dividend like the EVM
+		stack.push(u256(new(big.Int).Rem(x, y)))
+	}
+	return nil, nil
+}
+
+func opAddmod(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y, z := stack.pop(), stack.pop(), stack.pop()
+	if z.Sign() == 0 {
+		stack.push(new(big.Int))
+	} else {
+		x.Add(x, y)
+		stack.push(x.Mod(x, z))
+	}
+	return nil, nil
+}
+
+func opMulmod(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y, z := stack.pop(), stack.pop(), stack.pop()
+	if z.Sign() == 0 {
+		stack.push(new(big.Int))
+	} else {
+		x.Mul(x, y)
+		stack.push(x.Mod(x, z))
+	}
+	return nil, nil
+}
+
+func opExp(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	base, exponent := stack.pop(), stack.pop()
+	stack.push(new(big.Int).Exp(base, exponent, tt256))
+	return nil, nil
+}
+
+func opSignExtend(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	back, num := stack.pop(), stack.pop()
+	if back.Cmp(big.NewInt(31)) < 0 {
+		bit := uint(back.Uint64()*8 + 7)
+		mask := new(big.Int).Lsh(big.NewInt(1), bit)
+		mask.Sub(mask, big.NewInt(1))
+		if num.Bit(int(bit)) > 0 {
+			num.Or(num, mask.Not(mask))
+		} else {
+			num.And(num, mask)
+		}
+	}
+	stack.push(u256(num))
+	return nil, nil
+}
+
+// Comparison and bitwise logic
+
+func opLt(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	stack.push(boolWord(x.Cmp(y) < 0))
+	return nil, nil
+}
+
+func opGt(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	stack.push(boolWord(x.Cmp(y) > 0))
+	return nil, nil
+}
+
+func opSlt(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y := s256(stack.pop()), s256(stack.pop())
+	stack.push(boolWord(x.Cmp(y) < 0))
+	return nil, nil
+}
+
+func opSgt(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y := s256(stack.pop()), s256(stack.pop())
+	stack.push(boolWord(x.Cmp(y) > 0))
+	return nil, nil
+}
+
+func opEq(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	stack.push(boolWord(x.Cmp(y) == 0))
+	return nil, nil
+}
+
+func opIszero(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x := stack.pop()
+	stack.push(boolWord(x.Sign() == 0))
+	return nil, nil
+}
+
+func opAnd(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	stack.push(x.And(x, y))
+	return nil, nil
+}
+
+func opOr(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	stack.push(x.Or(x, y))
+	return nil, nil
+}
+
+func opXor(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	stack.push(x.Xor(x, y))
+	return nil, nil
+}
+
+func opNot(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	x := stack.pop()
+	stack.push(x.Xor(x, tt256m1))
+	return nil, nil
+}
+
+func opByte(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	th, val := stack.pop(), stack.pop()
+	if th.Cmp(word32) < 0 {
+		shift := uint(31-th.Uint64()) * 8
+		val.Rsh(val, shift)
+		stack.push(val.And(val, big.NewInt(0xff)))
+	} else {
+		stack.push(new(big.Int))
+	}
+	return nil, nil
+}
+
+func opSHL(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	shift, value := stack.pop(), stack.pop()
+	if shift.Cmp(big.NewInt(256)) >= 0 {
+		stack.push(new(big.Int))
+	} else {
+		stack.push(u256(value.Lsh(value, uint(shift.Uint64()))))
+	}
+	return nil, nil
+}
+
+func opSHR(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	shift, value := stack.pop(), stack.pop()
+	if shift.Cmp(big.NewInt(256)) >= 0 {
+		stack.push(new(big.Int))
+	} else {
+		stack.push(value.Rsh(value, uint(shift.Uint64())))
+	}
+	return nil, nil
+}
+
+func opSAR(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	shift, value := stack.pop(), s256(stack.pop())
+	if shift.Cmp(big.NewInt(256)) >= 0 {
+		if value.Sign() < 0 {
+			stack.push(new(big.Int).Set(tt256m1))
+		} else {
+			stack.push(new(big.Int))
+		}
+		return nil, nil
+	}
+	// Rsh rounds towards negative infinity, which is an arithmetic shift
+	stack.push(u256(new(big.Int).Rsh(value, uint(shift.Uint64()))))
+	return nil, nil
+}
+
+func opKeccak256(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	offset, size := stack.pop(), stack.pop()
+	data := mem.getPtr(offset.Uint64(), size.Uint64())
+	stack.push(new(big.Int).SetBytes(Keccak256(data)))
+	return nil, nil
+}
+
+// Environment
+
+func opAddress(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(addressWord(f.address))
+	return nil, nil
+}
+
+func opBalance(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	addr := wordToAddress(stack.pop())
+	stack.push(in.evm.StateDB.getBalance(addr))
+	return nil, nil
+}
+
+func opOrigin(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(addressWord(in.tx.Origin))
+	return nil, nil
+}
+
+func opCaller(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(addressWord(f.caller))
+	return nil, nil
+}
+
+func opCallValue(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(new(big.Int).Set(f.value))
+	return nil, nil
+}
+
+func opCallDataLoad(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	offset := stack.pop()
+	stack.push(new(big.Int).SetBytes(getData(f.input, offset, 32)))
+	return nil, nil
+}
+
+func opCallDataSize(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(big.NewInt(int64(len(f.input))))
+	return nil, nil
+}
+
+func opCallDataCopy(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	memOffset, dataOffset, length := stack.pop(), stack.pop(), stack.pop()
+	mem.set(memOffset.Uint64(), length.Uint64(), getData(f.input, dataOffset, length.Uint64()))
+	return nil, nil
+}
+
+func opCodeSize(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(big.NewInt(int64(len(f.code))))
+	return nil, nil
+}
+
+func opCodeCopy(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	memOffset, codeOffset, length := stack.pop(), stack.pop(), stack.pop()
+	mem.set(memOffset.Uint64(), length.Uint64(), getData(f.code, codeOffset, length.Uint64()))
+	return nil, nil
+}
+
+func opGasprice(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(new(big.Int).Set(in.tx.GasPrice))
+	return nil, nil
+}
+
+func opExtCodeSize(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	addr := wordToAddress(stack.pop())
+	stack.push(big.NewInt(int64(len(in.evm.StateDB.getCode(addr)))))
+	return nil, nil
+}
+
+func opExtCodeCopy(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	addr := wordToAddress(stack.pop())
+	memOffset, codeOffset, length := stack.pop(), stack.pop(), stack.pop()
+	code := in.evm.StateDB.getCode(addr)
+	mem.set(memOffset.Uint64(), length.Uint64(), getData(code, codeOffset, length.Uint64()))
+	return nil, nil
+}
+
+func opReturnDataSize(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(big.NewInt(int64(len(f.returnData))))
+	return nil, nil
+}
+
+func opReturnDataCopy(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	memOffset, dataOffset, length := stack.pop(), stack.pop(), stack.pop()
+	if !dataOffset.IsUint64() {
+		return nil, ErrReturnDataOutOfBounds
+	}
+	end, overflow := safeAdd(dataOffset.Uint64(), length.Uint64())
+	if overflow || uint64(len(f.returnData)) < end {
+		return nil, ErrReturnDataOutOfBounds
+	}
+	mem.set(memOffset.Uint64(), length.Uint64(), f.returnData[dataOffset.Uint64():end])
+	return nil, nil
+}
+
+func opExtCodeHash(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	addr := wordToAddress(stack.pop())
+	stack.push(new(big.Int).SetBytes(in.evm.StateDB.getCodeHash(addr)))
+	return nil, nil
+}
+
+// Block information
+
+func opBlockhash(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	num := stack.pop()
+	current := in.block.Number
+	if in.block.GetHash == nil || !num.IsUint64() || current == 0 {
+		stack.push(new(big.Int))
+		return nil, nil
+	}
+
+	n := num.Uint64()
+	lower := uint64(0)
+	if current > 256 {
+		lower = current - 256
+	}
+	if n >= lower && n < current {
+		stack.push(new(big.Int).SetBytes(in.block.GetHash(n)))
+	} else {
+		stack.push(new(big.Int))
+	}
+	return nil, nil
+}
+
+func opCoinbase(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(addressWord(in.block.Coinbase))
+	return nil, nil
+}
+
+func opTimestamp(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(new(big.Int).SetUint64(in.block.Time))
+	return nil, nil
+}
+
+func opNumber(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(new(big.Int).SetUint64(in.block.Number))
+	return nil, nil
+}
+
+func opPrevRandao(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(new(big.Int).SetBytes(in.block.PrevRandao))
+	return nil, nil
+}
+
+func opGasLimit(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(new(big.Int).SetUint64(in.block.GasLimit))
+	return nil, nil
+}
+
+func opChainID(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(new(big.Int).Set(in.evm.ChainID))
+	return nil, nil
+}
+
+func opSelfBalance(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(in.evm.StateDB.getBalance(f.address))
+	return nil, nil
+}
+
+func opBaseFee(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(new(big.Int).Set(in.block.BaseFee))
+	return nil, nil
+}
+
+func opBlobHash(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	index := stack.pop()
+	if index.IsUint64() && index.Uint64() < uint64(len(in.tx.BlobHashes)) {
+		stack.push(new(big.Int).SetBytes(in.tx.BlobHashes[index.Uint64()]))
+	} else {
+		stack.push(new(big.Int))
+	}
+	return nil, nil
+}
+
+func opBlobBaseFee(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(new(big.Int).Set(in.block.BlobBaseFee))
+	return nil, nil
+}
+
+// Stack, memory, storage and flow
+
+func opPop(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.pop()
+	return nil, nil
+}
+
+func opMload(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	offset := stack.pop()
+	stack.push(new(big.Int).SetBytes(mem.getPtr(offset.Uint64(), 32)))
+	return nil, nil
+}
+
+func opMstore(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	offset, val := stack.pop(), stack.pop()
+	mem.set32(offset.Uint64(), val)
+	return nil, nil
+}
+
+func opMstore8(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	offset, val := stack.pop(), stack.pop()
+	mem.store[offset.Uint64()] = byte(val.Uint64() & 0xff)
+	return nil, nil
+}
+
+func opSload(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	key := stack.pop()
+	stack.push(in.evm.StateDB.getState(f.address, BigToHash(key)).Big())
+	return nil, nil
+}
+
+func opSstore(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	key, val := stack.pop(), stack.pop()
+	in.evm.StateDB.setState(f.address, BigToHash(key), BigToHash(val))
+	return nil, nil
+}
+
+func opJump(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	dest := stack.pop()
+	if !f.validJumpdest(dest) {
+		return nil, ErrInvalidJump
+	}
+	*pc = dest.Uint64()
+	return nil, nil
+}
+
+func opJumpi(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	dest, cond := stack.pop(), stack.pop()
+	if cond.Sign() == 0 {
+		*pc++
+		return nil, nil
+	}
+	if !f.validJumpdest(dest) {
+		return nil, ErrInvalidJump
+	}
+	*pc = dest.Uint64()
+	return nil, nil
+}
+
+func opPc(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(new(big.Int).SetUint64(*pc))
+	return nil, nil
+}
+
+func opMsize(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(big.NewInt(int64(mem.len())))
+	return nil, nil
+}
+
+func opGas(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(new(big.Int).SetUint64(f.gas))
+	return nil, nil
+}
+
+func opJumpdest(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	return nil, nil
+}
+
+func opTload(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	key := stack.pop()
+	stack.push(in.evm.StateDB.getTransientState(f.address, BigToHash(key)).Big())
+	return nil, nil
+}
+
+func opTstore(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	key, val := stack.pop(), stack.pop()
+	in.evm.StateDB.setTransientState(f.address, BigToHash(key), BigToHash(val))
+	return nil, nil
+}
+
+func opMcopy(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	dst, src, length := stack.pop(), stack.pop(), stack.pop()
+	mem.copy(dst.Uint64(), src.Uint64(), length.Uint64())
+	return nil, nil
+}
+
+func opPush0(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.push(new(big.Int))
+	return nil, nil
+}
+
+// makePush returns PUSHn. Missing code bytes at the end are read as zero.
+func makePush(size uint64) executionFunc {
+	return func(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+		start := *pc + 1
+		data := make([]byte, size)
+		if start < uint64(len(f.code)) {
+			copy(data, f.code[start:])
+		}
+		stack.push(new(big.Int).SetBytes(data))
+		*pc += size
+		return nil, nil
+	}
+}
+
+func makeDup(n int) executionFunc {
+	return func(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+		stack.dup(n)
+		return nil, nil
+	}
+}
+
+func makeSwap(n int) executionFunc {
+	return func(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+		stack.swap(n)
+		return nil, nil
+	}
+}
+
+func makeLog(n int) executionFunc {
+	return func(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+		offset, size := stack.pop(), stack.pop()
+		topics := make([]Hash, n)
+		for i := 0; i < n; i++ {
+			topics[i] = BigToHash(stack.pop())
+		}
+
+		in.evm.StateDB.addLog(&Log{
+			Address: f.address,
+			Topics:  topics,
+			Data:    mem.getCopy(offset.Uint64(), size.Uint64()),
+		})
+		return nil, nil
+	}
+}
+
+// Contract creation
+
+func opCreate(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	value, offset, size := stack.pop(), stack.pop(), stack.pop()
+	input := mem.getCopy(offset.Uint64(), size.Uint64())
+	addr := CreateAddress(f.address, in.evm.StateDB.getNonce(f.address))
+	return create(in, f, stack, input, value, addr)
+}
+
+func opCreate2(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	value, offset, size, salt := stack.pop(), stack.pop(), stack.pop(), stack.pop()
+	input := mem.getCopy(offset.Uint64(), size.Uint64())
+	addr := CreateAddress2(f.address, BigToHash(salt), input)
+	return create(in, f, stack, input, value, addr)
+}
+
+// create forwards all but one 64th of the remaining gas (EIP-150) to the
+// init code and pushes the new address, or zero if the creation failed.
+// Only a revert leaves its output in the return data buffer.
+func create(in *Interpreter, f *frame, stack *Stack, input []byte, value *big.Int, addr Address) ([]byte, error) {
+	gas := f.gas - f.gas/64
+	f.useGas(gas)
+
+	ret, gasLeft, err := in.create(f.address, input, gas, value, addr)
+	if err != nil {
+		stack.push(new(big.Int))
+	} else {
+		stack.push(addressWord(addr))
+	}
+	f.gas += gasLeft
+
+	if err == ErrExecutionReverted {
+		return ret, nil
+	}
+	return nil, nil
+}
+
+// opCall sends value and input to the callee. In a static call it may
+// not send value.
+func opCall(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.pop() // the gas asked for, already settled by gasCall
+	addr, value := wordToAddress(stack.pop()), stack.pop()
+	inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop()
+	if in.readOnly && value.Sign() != 0 {
+		return nil, fmt.Errorf("%w: CALL with value", ErrWriteProtection)
+	}
+
+	gas := in.callGasTemp
+	if value.Sign() != 0 {
+		gas += CallStipend
+	}
+	input := mem.getCopy(inOffset.Uint64(), inSize.Uint64())
+	ret, gasLeft, err := in.call(f.address, addr, input, gas, value)
+	return callResult(f, stack, mem, retOffset, retSize, ret, gasLeft, err)
+}
+
+// opCallCode runs the callee's code on the caller's own account
+func opCallCode(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.pop()
+	addr, value := wordToAddress(stack.pop()), stack.pop()
+	inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop()
+
+	gas := in.callGasTemp
+	if value.Sign() != 0 {
+		gas += CallStipend
+	}
+	input := mem.getCopy(inOffset.Uint64(), inSize.Uint64())
+	ret, gasLeft, err := in.callCode(f.address, addr, input, gas, value)
+	return callResult(f, stack, mem, retOffset, retSize, ret, gasLeft, err)
+}
+
+// opDelegateCall runs the callee's code with the caller, value and
+// storage of the current frame
+func opDelegateCall(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.pop()
+	addr := wordToAddress(stack.pop())
+	inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop()
+
+	input := mem.getCopy(inOffset.Uint64(), inSize.Uint64())
+	ret, gasLeft, err := in.delegateCall(f, addr, input, in.callGasTemp)
+	return callResult(f, stack, mem, retOffset, retSize, ret, gasLeft, err)
+}
+
+// opStaticCall calls without value and without allowing state changes
+func opStaticCall(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	stack.pop()
+	addr := wordToAddress(stack.pop())
+	inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop()
+
+	input := mem.getCopy(inOffset.Uint64(), inSize.Uint64())
+	ret, gasLeft, err := in.staticCall(f.address, addr, input, in.callGasTemp)
+	return callResult(f, stack, mem, retOffset, retSize, ret, gasLeft, err)
+}
+
+// callResult pushes 1 if a call succeeded and 0 otherwise, copies its
+// output to the output area and takes back the gas it did not use. Only
+// successful and reverted calls leave output in memory and in the return
+// data buffer.
+func callResult(f *frame, stack *Stack, mem *Memory, retOffset, retSize *big.Int, ret []byte, gasLeft uint64, err error) ([]byte, error) {
+	if err != nil {
+		stack.push(new(big.Int))
+	} else {
+		stack.push(big.NewInt(1))
+	}
+	if err == nil || err == ErrExecutionReverted {
+		// Output beyond the output area is dropped, and an area longer
+		// than the output keeps its remaining bytes
+		mem.set(retOffset.Uint64(), retSize.Uint64(), ret)
+	} else {
+		ret = nil
+	}
+	f.gas += gasLeft
+	return ret, nil
+}
+
+// Halting operations
+
+func opStop(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	return nil, nil
+}
+
+func opReturn(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	offset, size := stack.pop(), stack.pop()
+	return mem.getCopy(offset.Uint64(), size.Uint64()), nil
+}
+
+func opRevert(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	offset, size := stack.pop(), stack.pop()
+	return mem.getCopy(offset.Uint64(), size.Uint64()), nil
+}
+
+func opInvalid(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	return nil, fmt.Errorf("%w: INVALID at pc %d", ErrInvalidOpcode, *pc)
+}
+
+// opSelfdestruct sends the whole balance to the beneficiary. Since Cancun
+// (EIP-6780) the account itself is only deleted if it was created in the
+// same transaction; a balance it names itself the beneficiary of is then
+// burnt.
+func opSelfdestruct(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error) {
+	beneficiary := wordToAddress(stack.pop())
+	state := in.evm.StateDB
+
+	balance := state.getBalance(f.address)
+	state.subBalance(f.address, balance)
+	state.addBalance(beneficiary, balance)
+	state.selfDestruct(f.address)
+	return nil, nil
+}
@@ -0,0 +1,257 @@
+package evm
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+var (
+	testSender      = BytesToAddress([]byte{0x5e, 0x4d})
+	testBeneficiary = BytesToAddress([]byte{0xbe, 0xef})
+)
+
+// newTestEVM returns an EVM with a funded testSender that accepts
+// unsigned transactions
+func newTestEVM() *EVM {
+	e := NewEVM()
+	e.AllowUnsigned = true
+	e.StateDB.addBalance(testSender, big.NewInt(1_000_000))
+	return e
+}
+
+// initCode returns init code that deploys runtime, at most 255 bytes
+func initCode(runtime []byte) []byte {
+	code := []byte{
+		byte(PUSH1), byte(len(runtime)), byte(DUP1),
+		byte(PUSH1), 11, byte(PUSH1), 0, byte(CODECOPY),
+		byte(PUSH1), 0, byte(RETURN),
+	}
+	return append(code, runtime...)
+}
+
+// applyTx runs tx alone in the next block and returns its result
+func applyTx(t *testing.T, e *EVM, tx *EVMTransaction) *TransactionResult {
+	t.Helper()
+	tx.Hash = tx.hash()
+	_, included, _, _ := e.BuildBlock(e.Block.Number+1, e.Block.Time+1, nil, []*EVMTransaction{tx})
+	if len(included) != 1 {
+		t.Fatalf("transaction %s left out of the block", tx.Hash)
+	}
+	return e.GetReceipt(tx.Hash).result
+}
+
+// execute runs an unsigned transaction from testSender at gas price zero
+func execute(t *testing.T, e *EVM, to *Address, value int64, data []byte) *TransactionResult {
+	t.Helper()
+	result := applyTx(t, e, &EVMTransaction{
+		From:     testSender,
+		To:       to,
+		Value:    big.NewInt(value),
+		Data:     data,
+		Gas:      200_000,
+		GasPrice: new(big.Int),
+		Nonce:    e.GetNonce(testSender),
+	})
+	if !result.Success {
+		t.Fatalf("transaction failed: %s", result.Error)
+	}
+	return result
+}
+
+func TestSelfdestructInCreatingTransaction(t *testing.T) {
+	e := newTestEVM()
+
+	// ADDRESS SELFDESTRUCT: the new contract names itself the beneficiary
+	result := execute(t, e, nil, 1000, []byte{byte(ADDRESS), byte(SELFDESTRUCT)})
+
+	if account := e.GetAccount(*result.ContractAddress); account != nil {
+		t.Fatalf("contract still exists with balance %s", account.Balance)
+	}
+	if got := e.GetBalance(testSender); got.Cmp(big.NewInt(999_000)) != 0 {
+		t.Fatalf("sender balance %s, want the 1000 sent burnt", got)
+	}
+}
+
+func TestSelfdestructLaterTransaction(t *testing.T) {
+	e := newTestEVM()
+
+	// PUSH20 beneficiary SELFDESTRUCT
+	runtime := append([]byte{byte(PUSH1) + 19}, testBeneficiary[:]...)
+	runtime = append(runtime, byte(SELFDESTRUCT))
+	contract := *execute(t, e, nil, 500, initCode(runtime)).ContractAddress
+
+	execute(t, e, &contract, 0, nil)
+
+	account := e.GetAccount(contract)
+	if account == nil || len(account.Code) != len(runtime) {
+		t.Fatal("contract created in an earlier transaction was deleted")
+	}
+	if account.Balance.Sign() != 0 {
+		t.Fatalf("contract kept balance %s", account.Balance)
+	}
+	if got := e.GetBalance(testBeneficiary); got.Cmp(big.NewInt(500)) != 0 {
+		t.Fatalf("beneficiary balance %s, want 500", got)
+	}
+}
+
+// callerCode returns runtime code that calls target with op, forwarding gas
+// or, when gas is nil, everything it may, and returns the first word of the
+// output followed by the success flag
+func callerCode(op OpCode, target Address, gas []byte) []byte {
+	code := []byte{byte(PUSH1), 32, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0}
+	if op == CALL || op == CALLCODE {
+		code = append(code, byte(PUSH1), 0)
+	}
+	code = append(code, byte(PUSH1)+19)
+	code = append(code, target[:]...)
+	if gas == nil {
+		code = append(code, byte(GAS))
+	} else {
+		code = append(code, byte(PUSH1)+byte(len(gas)-1))
+		code = append(code, gas...)
+	}
+	return append(code, byte(op), byte(PUSH1), 32, byte(MSTORE), byte(PUSH1), 64, byte(PUSH1), 0, byte(RETURN))
+}
+
+// deploy creates a contract running runtime
+func deploy(t *testing.T, e *EVM, runtime []byte) Address {
+	t.Helper()
+	return *execute(t, e, nil, 0, initCode(runtime)).ContractAddress
+}
+
+// callOutput splits the output of callerCode
+func callOutput(t *testing.T, result *TransactionResult) (Hash, bool) {
+	t.Helper()
+	if len(result.Return) != 64 {
+		t.Fatalf("returned %x", result.Return)
+	}
+	return BytesToHash(result.Return[:32]), result.Return[63] == 1
+}
+
+func TestStaticCallForbidsWrites(t *testing.T) {
+	e := newTestEVM()
+	writer := deploy(t, e, []byte{byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE), byte(STOP)})
+	logger := deploy(t, e, []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(LOG0), byte(STOP)})
+	creator := deploy(t, e, []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(CREATE), byte(STOP)})
+	reader := deploy(t, e, append([]byte{byte(PUSH1), 42}, returnTop...))
+
+	for _, tt := range []struct {
+		name   string
+		target Address
+	}{{"SSTORE", writer}, {"LOG0", logger}, {"CREATE", creator}} {
+		caller := deploy(t, e, callerCode(STATICCALL, tt.target, nil))
+		result := execute(t, e, &caller, 0, nil)
+		if _, ok := callOutput(t, result); ok {
+			t.Errorf("%s in a static call succeeded", tt.name)
+		}
+		// CREATE would have raised the nonce of the creator
+		if len(result.Logs) != 0 || e.StorageRoot(tt.target) != emptyRoot || e.GetNonce(tt.target) != 1 {
+			t.Errorf("%s in a static call changed the state", tt.name)
+		}
+	}
+
+	caller := deploy(t, e, callerCode(STATICCALL, reader, nil))
+	if out, ok := callOutput(t, execute(t, e, &caller, 0, nil)); !ok || out != BytesToHash([]byte{42}) {
+		t.Fatalf("static call of a reader returned %s, %v", out, ok)
+	}
+
+	// The restriction holds in calls made from a static call, which
+	// themselves succeed
+	middle := deploy(t, e, callerCode(CALL, writer, nil))
+	caller = deploy(t, e, callerCode(STATICCALL, middle, nil))
+	if _, ok := callOutput(t, execute(t, e, &caller, 0, nil)); !ok {
+		t.Fatal("static call of the middle contract failed")
+	}
+	if got := e.GetStorage(writer, Hash{}); got != (Hash{}) {
+		t.Fatal("a call from a static call wrote storage")
+	}
+	if _, ok := callOutput(t, execute(t, e, &middle, 0, nil)); !ok || e.GetStorage(writer, Hash{}) != BytesToHash([]byte{1}) {
+		t.Fatal("a plain call could not write storage")
+	}
+}
+
+func TestDelegateCallContext(t *testing.T) {
+	e := newTestEVM()
+	// Stores CALLER in slot 0 and returns ADDRESS
+	target := deploy(t, e, append([]byte{byte(CALLER), byte(PUSH1), 0, byte(SSTORE), byte(ADDRESS)}, returnTop...))
+
+	caller := deploy(t, e, callerCode(DELEGATECALL, target, nil))
+	out, ok := callOutput(t, execute(t, e, &caller, 0, nil))
+	if !ok || out != BytesToHash(caller[:]) {
+		t.Fatalf("ADDRESS in a delegate call is %s, want %s", out, caller)
+	}
+	if got := e.GetStorage(caller, Hash{}); got != BytesToHash(testSender[:]) {
+		t.Fatalf("CALLER in a delegate call is %s, want %s", got, testSender)
+	}
+	if got := e.GetStorage(target, Hash{}); got != (Hash{}) {
+		t.Fatal("a delegate call wrote the storage of the code's account")
+	}
+
+	caller = deploy(t, e, callerCode(CALL, target, nil))
+	out, ok = callOutput(t, execute(t, e, &caller, 0, nil))
+	if !ok || out != BytesToHash(target[:]) || e.GetStorage(target, Hash{}) != BytesToHash(caller[:]) {
+		t.Fatalf("plain call ran at %s", out)
+	}
+}
+
+func TestCallForwardsAllButOne64th(t *testing.T) {
+	e := newTestEVM()
+	target := deploy(t, e, append([]byte{byte(GAS)}, returnTop...))
+
+	// The caller spends 20 gas on pushes and GAS, the call 100 plus 2500
+	// for the cold target and 3 for a word of memory
+	caller := deploy(t, e, callerCode(CALL, target, nil))
+	result := applyTx(t, e, &EVMTransaction{
+		From: testSender, To: &caller, Value: new(big.Int), Gas: 100_000, GasPrice: new(big.Int), Nonce: e.GetNonce(testSender),
+	})
+	available := uint64(100_000) - TxGas - 20 - WarmStorageReadCost - (ColdAccountAccessCost - WarmStorageReadCost) - MemoryGas
+	if out, ok := callOutput(t, result); !ok || out != BytesToHash(new(big.Int).SetUint64(available-available/64-2).Bytes()) {
+		t.Fatalf("callee saw %s gas, want %d", new(big.Int).SetBytes(out[:]), available-available/64-2)
+	}
+
+	// A smaller request is forwarded as is
+	caller = deploy(t, e, callerCode(CALL, target, []byte{0x03, 0xe8}))
+	if out, ok := callOutput(t, execute(t, e, &caller, 0, nil)); !ok || out != BytesToHash([]byte{0x03, 0xe6}) {
+		t.Fatalf("callee saw %s gas, want 998", new(big.Int).SetBytes(out[:]))
+	}
+}
+
+func TestCallDepthLimit(t *testing.T) {
+	e := newTestEVM()
+	// Calls itself and stores whether that succeeded in slot 0
+	recurse := []byte{
+		byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0,
+		byte(ADDRESS), byte(GAS), byte(CALL), byte(PUSH1), 0, byte(SSTORE), byte(STOP),
+	}
+	contract := deploy(t, e, recurse)
+
+	// Calls made with in.depth above CallCreateDepth fail without running.
+	// Slot 0 starts at 2 and is left by the outermost frame, which runs at
+	// in.depth+1.
+	unchanged := BytesToHash([]byte{2})
+	for _, tt := range []struct {
+		depth int
+		slot  Hash
+		err   error
+	}{
+		{CallCreateDepth - 1, BytesToHash([]byte{1}), nil},
+		{CallCreateDepth, Hash{}, nil},
+		{CallCreateDepth + 1, unchanged, ErrDepth},
+	} {
+		e.StateDB.prepare(testSender, &contract, e.Block.Coinbase, nil, e.precompiles)
+		e.StateDB.setState(contract, Hash{}, unchanged)
+		in := newInterpreter(e, e.Block, TxContext{Origin: testSender, GasPrice: new(big.Int)})
+		in.depth = tt.depth
+		_, gas, err := in.call(testSender, contract, nil, 1_000_000, new(big.Int))
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("depth %d: got %v, want %v", tt.depth, err, tt.err)
+		}
+		if err != nil && gas != 1_000_000 {
+			t.Fatalf("depth %d: a call past the limit used gas", tt.depth)
+		}
+		if got := e.GetStorage(contract, Hash{}); got != tt.slot {
+			t.Fatalf("depth %d: slot 0 is %s, want %s", tt.depth, got, tt.slot)
+		}
+	}
+}
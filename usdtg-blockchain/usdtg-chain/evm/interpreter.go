@@ -0,0 +1,360 @@
+package evm
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// BlockContext describes the block a transaction executes in
+type BlockContext struct {
+	Coinbase    Address
+	Number      uint64
+	Time        uint64
+	GasLimit    uint64
+	BaseFee     *big.Int
+	BlobBaseFee *big.Int
+	PrevRandao  []byte
+	// GetHash returns the hash of an earlier block, used by BLOCKHASH
+	GetHash func(number uint64) []byte
+}
+
+// TxContext describes the transaction being executed
+type TxContext struct {
+	Origin     Address
+	GasPrice   *big.Int
+	BlobHashes [][]byte
+}
+
+// Log is an event emitted by LOG0 to LOG4. The position fields are filled
+// in once the emitting transaction succeeds.
+type Log struct {
+	Address Address `json:"address"`
+	Topics  []Hash  `json:"topics"`
+	Data    Bytes   `json:"data"`
+
+	BlockNumber uint64 `json:"block_number"`
+	TxHash      Hash   `json:"transaction_hash"`
+	TxIndex     uint   `json:"transaction_index"`
+	Index       uint   `json:"log_index"` // position in the block
+}
+
+// frame is the execution context of one call: the code being run, its
+// inputs and the gas it has left
+type frame struct {
+	caller  Address
+	address Address
+	value   *big.Int
+	input   []byte
+	code    []byte
+	gas     uint64
+
+	jumpdests  bitvec
+	returnData []byte // output of the last call made by this frame
+}
+
+func newFrame(caller, address Address, value *big.Int, input, code []byte, gas uint64) *frame {
+	return &frame{
+		caller:  caller,
+		address: address,
+		value:   value,
+		input:   input,
+		code:    code,
+		gas:     gas,
+	}
+}
+
+// useGas deducts gas and reports whether there was enough
+func (f *frame) useGas(gas uint64) bool {
+	if f.gas < gas {
+		return false
+	}
+	f.gas -= gas
+	return true
+}
+
+// validJumpdest reports whether dest is a JUMPDEST that is not part of
+// PUSH data
+func (f *frame) validJumpdest(dest *big.Int) bool {
+	if !dest.IsUint64() || dest.Uint64() >= uint64(len(f.code)) {
+		return false
+	}
+	udest := dest.Uint64()
+	if OpCode(f.code[udest]) != JUMPDEST {
+		return false
+	}
+	if f.jumpdests == nil {
+		f.jumpdests = codeBitmap(f.code)
+	}
+	return f.jumpdests.codeSegment(udest)
+}
+
+// bitvec marks which code positions hold PUSH data
+type bitvec []byte
+
+func (bits bitvec) set(pos uint64) {
+	bits[pos/8] |= 1 << (pos % 8)
+}
+
+// codeSegment reports whether pos is an instruction rather than PUSH data
+func (bits bitvec) codeSegment(pos uint64) bool {
+	return bits[pos/8]&(1<<(pos%8)) == 0
+}
+
+// codeBitmap marks the PUSH data bytes of code
+func codeBitmap(code []byte) bitvec {
+	bits := make(bitvec, len(code)/8+1+4)
+	for pc := uint64(0); pc < uint64(len(code)); {
+		op := OpCode(code[pc])
+		pc++
+		if op.IsPush() {
+			n := uint64(op - PUSH1 + 1)
+			for i := uint64(0); i < n && pc+i < uint64(len(code)); i++ {
+				bits.set(pc + i)
+			}
+			pc += n
+		}
+	}
+	return bits
+}
+
+// Interpreter executes bytecode for a single transaction
+type Interpreter struct {
+	evm   *EVM
+	block BlockContext
+	tx    TxContext
+	table *JumpTable
+	depth int
+
+	readOnly    bool   // inside a static call, where writes are forbidden
+	callGasTemp uint64 // gas a call operation forwards, set by its gas function
+}
+
+func newInterpreter(evm *EVM, block BlockContext, tx TxContext) *Interpreter {
+	return &Interpreter{
+		evm:   evm,
+		block: block,
+		tx:    tx,
+		table: &cancunInstructionSet,
+	}
+}
+
+// call transfers value and runs the code of the recipient. It returns the
+// output, the gas left and the execution error. A failed call undoes its
+// state changes and, except for reverts, consumes all gas.
+func (in *Interpreter) call(caller, addr Address, input []byte, gas uint64, value *big.Int) ([]byte, uint64, error) {
+	if in.depth > CallCreateDepth {
+		return nil, gas, ErrDepth
+	}
+	state := in.evm.StateDB
+	if state.getBalance(caller).Cmp(value) < 0 {
+		return nil, gas, ErrInsufficientBalance
+	}
+
+	snapshot := state.snapshot()
+	state.transfer(caller, addr, value)
+	return in.execute(snapshot, caller, addr, addr, value, input, gas)
+}
+
+// callCode runs the code of addr in the context of the caller, which
+// keeps the value it sends (CALLCODE)
+func (in *Interpreter) callCode(caller, addr Address, input []byte, gas uint64, value *big.Int) ([]byte, uint64, error) {
+	if in.depth > CallCreateDepth {
+		return nil, gas, ErrDepth
+	}
+	state := in.evm.StateDB
+	if state.getBalance(caller).Cmp(value) < 0 {
+		return nil, gas, ErrInsufficientBalance
+	}
+	return in.execute(state.snapshot(), caller, caller, addr, value, input, gas)
+}
+
+// delegateCall runs the code of addr in the context of the parent frame,
+// whose caller and value it keeps (DELEGATECALL)
+func (in *Interpreter) delegateCall(parent *frame, addr Address, input []byte, gas uint64) ([]byte, uint64, error) {
+	if in.depth > CallCreateDepth {
+		return nil, gas, ErrDepth
+	}
+	return in.execute(in.evm.StateDB.snapshot(), parent.caller, parent.address, addr, parent.value, input, gas)
+}
+
+// staticCall runs the code of addr without value and forbids state
+// changes in it and everything it calls (STATICCALL)
+func (in *Interpreter) staticCall(caller, addr Address, input []byte, gas uint64) ([]byte, uint64, error) {
+	if in.depth > CallCreateDepth {
+		return nil, gas, ErrDepth
+	}
+	if !in.readOnly {
+		in.readOnly = true
+		defer func() { in.readOnly = false }()
+	}
+	return in.execute(in.evm.StateDB.snapshot(), caller, addr, addr, new(big.Int), input, gas)
+}
+
+// execute runs the precompile or the code at codeAddr as a frame at
+// address and reverts to snapshot if it fails
+func (in *Interpreter) execute(snapshot int, caller, address, codeAddr Address, value *big.Int, input []byte, gas uint64) ([]byte, uint64, error) {
+	state := in.evm.StateDB
+
+	var (
+		ret []byte
+		err error
+	)
+	if p := in.evm.precompiles[codeAddr]; p != nil {
+		ret, gas, err = in.runPrecompile(p, caller, input, gas, value)
+	} else {
+		code := state.getCode(codeAddr)
+		if len(code) == 0 {
+			return nil, gas, nil
+		}
+		f := newFrame(caller, address, value, input, code, gas)
+		in.depth++
+		ret, err = in.run(f)
+		in.depth--
+		gas = f.gas
+	}
+
+	if err != nil {
+		state.revertToSnapshot(snapshot)
+		if err != ErrExecutionReverted {
+			gas = 0
+		}
+	}
+	return ret, gas, err
+}
+
+// create runs init code for a new contract at addr and stores the runtime
+// code it returns. The nonce of the caller is incremented even if the
+// creation fails. Like call, it returns the output, the gas left and the
+// execution error.
+func (in *Interpreter) create(caller Address, code []byte, gas uint64, value *big.Int, addr Address) ([]byte, uint64, error) {
+	if in.depth > CallCreateDepth {
+		return nil, gas, ErrDepth
+	}
+	state := in.evm.StateDB
+	if state.getBalance(caller).Cmp(value) < 0 {
+		return nil, gas, ErrInsufficientBalance
+	}
+	state.setNonce(caller, state.getNonce(caller)+1)
+
+	state.addAddressToAccessList(addr)
+	if state.getNonce(addr) != 0 || len(state.getCode(addr)) != 0 {
+		return nil, 0, ErrContractAddressCollision
+	}
+
+	snapshot := state.snapshot()
+	state.createContract(addr)
+	state.setNonce(addr, 1) // EIP-161
+	state.transfer(caller, addr, value)
+
+	f := newFrame(caller, addr, value, nil, code, gas)
+	in.depth++
+	ret, err := in.run(f)
+	in.depth--
+	if err == nil {
+		err = in.deployCode(f, ret)
+	}
+	if err != nil {
+		state.revertToSnapshot(snapshot)
+		if err != ErrExecutionReverted {
+			f.gas = 0
+		}
+	}
+	return ret, f.gas, err
+}
+
+// deployCode checks the runtime code returned by init code, charges the
+// deposit cost and stores it
+func (in *Interpreter) deployCode(f *frame, code []byte) error {
+	if len(code) > MaxCodeSize {
+		return ErrMaxCodeSizeExceeded
+	}
+	// EIP-3541: 0xEF is reserved for the EVM object format
+	if len(code) > 0 && code[0] == 0xEF {
+		return ErrInvalidCode
+	}
+	if !f.useGas(uint64(len(code)) * CreateDataGas) {
+		return ErrCodeStoreOutOfGas
+	}
+	in.evm.StateDB.setCode(f.address, code)
+	return nil
+}
+
+// run executes the code of a frame until it halts or fails
+func (in *Interpreter) run(f *frame) ([]byte, error) {
+	if len(f.code) == 0 {
+		return nil, nil
+	}
+
+	var (
+		pc    uint64
+		stack = newStack()
+		mem   = newMemory()
+	)
+
+	for {
+		var op OpCode
+		if pc < uint64(len(f.code)) {
+			op = OpCode(f.code[pc])
+		}
+		operation := in.table[op]
+		if operation == nil {
+			return nil, fmt.Errorf("%w: opcode %#x at pc %d", ErrInvalidOpcode, byte(op), pc)
+		}
+
+		if sLen := stack.len(); sLen < operation.minStack {
+			return nil, fmt.Errorf("%w: %v at pc %d needs %d items, have %d", ErrStackUnderflow, op, pc, operation.minStack, sLen)
+		} else if sLen > operation.maxStack {
+			return nil, ErrStackOverflow
+		}
+
+		if in.readOnly && operation.writes {
+			return nil, fmt.Errorf("%w: %v at pc %d", ErrWriteProtection, op, pc)
+		}
+
+		if !f.useGas(operation.constantGas) {
+			return nil, ErrOutOfGas
+		}
+
+		var memorySize uint64
+		if operation.memorySize != nil {
+			size, overflow := operation.memorySize(stack)
+			if overflow {
+				return nil, ErrGasUintOverflow
+			}
+			words := toWordSize(size)
+			if words > maxMemorySize/32 {
+				return nil, ErrGasUintOverflow
+			}
+			memorySize = words * 32
+		}
+
+		if operation.dynamicGas != nil {
+			cost, err := operation.dynamicGas(in, f, stack, mem, memorySize)
+			if err != nil {
+				return nil, err
+			}
+			if !f.useGas(cost) {
+				return nil, ErrOutOfGas
+			}
+		}
+		if memorySize > 0 {
+			mem.resize(memorySize)
+		}
+
+		res, err := operation.execute(&pc, in, f, stack, mem)
+		if operation.returns {
+			f.returnData = res
+		}
+
+		switch {
+		case err != nil:
+			return nil, err
+		case operation.reverts:
+			return res, ErrExecutionReverted
+		case operation.halts:
+			return res, nil
+		case !operation.jumps:
+			pc++
+		}
+	}
+}
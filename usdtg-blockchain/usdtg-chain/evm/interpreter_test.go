@@ -0,0 +1,166 @@
+package evm
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// returnTop is the code that returns the top of the stack as a word
+var returnTop = []byte{byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN)}
+
+// returnTopGas is what returnTop costs, including one word of memory
+const returnTopGas = 3 + 3 + MemoryGas + 3 + 3
+
+// runCode deploys runtime and calls it from testSender with the given gas
+// and calldata, without requiring the call to succeed
+func runCode(t *testing.T, runtime, data []byte, gas uint64) (*EVM, Address, *TransactionResult) {
+	t.Helper()
+	e := newTestEVM()
+	contract := *execute(t, e, nil, 0, initCode(runtime)).ContractAddress
+	result := applyTx(t, e, &EVMTransaction{
+		From:     testSender,
+		To:       &contract,
+		Value:    new(big.Int),
+		Data:     data,
+		Gas:      gas,
+		GasPrice: new(big.Int),
+		Nonce:    e.GetNonce(testSender),
+	})
+	return e, contract, result
+}
+
+func word(hexValue string) string {
+	return strings.Repeat("0", 64-len(hexValue)) + hexValue
+}
+
+func TestInterpreterGas(t *testing.T) {
+	// Setting and clearing a slot refunds 19900, capped at a fifth of the
+	// gas used
+	setClear := TxGas + 3 + 3 + ColdSloadCost + SstoreSetGas + 3 + 3 + WarmStorageReadCost
+
+	tests := []struct {
+		name string
+		code []byte
+		data []byte
+		want string
+		gas  uint64
+	}{
+		{
+			name: "add",
+			code: append([]byte{byte(PUSH1), 2, byte(PUSH1), 3, byte(ADD)}, returnTop...),
+			want: word("5"),
+			gas:  TxGas + 3 + 3 + 3 + returnTopGas,
+		},
+		{
+			name: "division by zero is zero",
+			code: append([]byte{byte(PUSH1), 0, byte(PUSH1), 7, byte(DIV)}, returnTop...),
+			want: word("0"),
+			gas:  TxGas + 3 + 3 + 5 + returnTopGas,
+		},
+		{
+			name: "SDIV of the minimum by -1 overflows to the minimum",
+			code: append([]byte{byte(PUSH1), 0, byte(NOT), byte(PUSH1), 1, byte(PUSH1), 255, byte(SHL), byte(SDIV)}, returnTop...),
+			want: "80" + strings.Repeat("0", 62),
+			gas:  TxGas + 3 + 3 + 3 + 3 + 3 + 5 + returnTopGas,
+		},
+		{
+			name: "EXP charges per exponent byte",
+			code: append([]byte{byte(PUSH1) + 1, 1, 0, byte(PUSH1), 2, byte(EXP)}, returnTop...),
+			want: word("0"),
+			gas:  TxGas + 3 + 3 + 10 + 2*ExpByteGas + returnTopGas,
+		},
+		{
+			name: "KECCAK256 charges per word and for memory",
+			code: append([]byte{byte(PUSH1), 32, byte(PUSH1), 0, byte(KECCAK256)}, returnTop...),
+			want: "290decd9548b62a8d60345a988386fc84ba6bc95484008f6362f93160ef3e563",
+			gas:  TxGas + 3 + 3 + Keccak256Gas + Keccak256WordGas + MemoryGas + returnTopGas - MemoryGas,
+		},
+		{
+			name: "calldata costs 4 per zero and 16 per other byte",
+			code: append([]byte{byte(CALLDATASIZE)}, returnTop...),
+			data: []byte{0, 1, 0, 2},
+			want: word("4"),
+			gas:  TxGas + 2*TxDataZeroGas + 2*TxDataNonZeroGas + 2 + returnTopGas,
+		},
+		{
+			name: "cold then warm SLOAD",
+			code: []byte{byte(PUSH1), 0, byte(SLOAD), byte(PUSH1), 0, byte(SLOAD), byte(STOP)},
+			gas:  TxGas + 3 + ColdSloadCost + 3 + WarmStorageReadCost,
+		},
+		{
+			name: "SSTORE to a cold empty slot",
+			code: []byte{byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE), byte(STOP)},
+			gas:  TxGas + 3 + 3 + ColdSloadCost + SstoreSetGas,
+		},
+		{
+			name: "SSTORE refund cap",
+			code: []byte{byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE), byte(PUSH1), 0, byte(PUSH1), 0, byte(SSTORE), byte(STOP)},
+			gas:  setClear - setClear/RefundQuotient,
+		},
+		{
+			name: "JUMP to a JUMPDEST",
+			code: []byte{byte(PUSH1), 4, byte(JUMP), byte(INVALID), byte(JUMPDEST), byte(STOP)},
+			gas:  TxGas + 3 + 8 + 1,
+		},
+	}
+	for _, tt := range tests {
+		_, _, result := runCode(t, tt.code, tt.data, 100_000)
+		if !result.Success {
+			t.Errorf("%s: failed: %s", tt.name, result.Error)
+			continue
+		}
+		if got := hex.EncodeToString(result.Return); got != tt.want {
+			t.Errorf("%s: returned %s, want %s", tt.name, got, tt.want)
+		}
+		if result.GasUsed != tt.gas {
+			t.Errorf("%s: used %d gas, want %d", tt.name, result.GasUsed, tt.gas)
+		}
+	}
+}
+
+func TestInterpreterSstore(t *testing.T) {
+	e, contract, result := runCode(t, []byte{byte(PUSH1), 42, byte(PUSH1), 7, byte(SSTORE), byte(STOP)}, nil, 100_000)
+	if !result.Success {
+		t.Fatal(result.Error)
+	}
+	if got := e.GetStorage(contract, BytesToHash([]byte{7})); got != BytesToHash([]byte{42}) {
+		t.Fatalf("slot 7 = %s, want 42", got)
+	}
+}
+
+func TestInterpreterErrors(t *testing.T) {
+	// JUMPDEST PUSH1 0 PUSH1 0 JUMP grows the stack by one per loop
+	overflow := []byte{byte(JUMPDEST), byte(PUSH1), 0, byte(PUSH1), 0, byte(JUMP)}
+
+	tests := []struct {
+		name    string
+		code    []byte
+		gas     uint64
+		err     error
+		allUsed bool
+	}{
+		{"stack underflow", []byte{byte(ADD)}, 50_000, ErrStackUnderflow, true},
+		{"stack overflow", overflow, 100_000, ErrStackOverflow, true},
+		{"jump to a non-JUMPDEST", []byte{byte(PUSH1), 3, byte(JUMP), byte(STOP)}, 50_000, ErrInvalidJump, true},
+		{"jump into push data", []byte{byte(PUSH1), byte(JUMPDEST), byte(PUSH1), 1, byte(JUMP)}, 50_000, ErrInvalidJump, true},
+		{"invalid opcode", []byte{byte(INVALID)}, 50_000, ErrInvalidOpcode, true},
+		{"out of gas", []byte{byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE)}, 30_000, ErrOutOfGas, true},
+		{"revert", []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(REVERT)}, 50_000, ErrExecutionReverted, false},
+	}
+	for _, tt := range tests {
+		_, _, result := runCode(t, tt.code, nil, tt.gas)
+		if result.Success {
+			t.Errorf("%s: succeeded", tt.name)
+			continue
+		}
+		if !errors.Is(result.Err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, result.Err, tt.err)
+		}
+		if got := result.GasUsed == tt.gas; got != tt.allUsed {
+			t.Errorf("%s: used %d of %d gas", tt.name, result.GasUsed, tt.gas)
+		}
+	}
+}
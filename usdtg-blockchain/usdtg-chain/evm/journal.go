@@ -0,0 +1,143 @@
+package evm
+
+import "math/big"
+
+// journalEntry is a state change that can be undone
+type journalEntry interface {
+	revert(s *StateDB)
+}
+
+// journal records the state changes of the current transaction so that
+// any suffix of them can be undone. Outside a transaction there is no
+// journal and changes are not recorded.
+type journal struct {
+	entries []journalEntry
+}
+
+func (j *journal) append(entry journalEntry) {
+	if j == nil {
+		return
+	}
+	j.entries = append(j.entries, entry)
+}
+
+// length is the number of recorded changes, used as a snapshot id
+func (j *journal) length() int {
+	return len(j.entries)
+}
+
+// revert undoes the changes recorded after snapshot, newest first
+func (j *journal) revert(s *StateDB, snapshot int) {
+	for i := len(j.entries) - 1; i >= snapshot; i-- {
+		j.entries[i].revert(s)
+	}
+	j.entries = j.entries[:snapshot]
+}
+
+type (
+	createAccountChange struct {
+		addr Address
+	}
+	balanceChange struct {
+		addr Address
+		prev *big.Int
+	}
+	nonceChange struct {
+		addr Address
+		prev uint64
+	}
+	codeChange struct {
+		addr     Address
+		prevCode []byte
+		prevHash Hash
+	}
+	// prev is zero when the slot was unset
+	storageChange struct {
+		addr Address
+		key  Hash
+		prev Hash
+	}
+	transientStorageChange struct {
+		addr Address
+		key  Hash
+		prev Hash
+	}
+	refundChange struct {
+		prev uint64
+	}
+	createContractChange struct {
+		addr Address
+	}
+	selfDestructChange struct {
+		addr Address
+	}
+	addLogChange               struct{}
+	accessListAddAccountChange struct {
+		addr Address
+	}
+	accessListAddSlotChange struct {
+		addr Address
+		key  Hash
+	}
+)
+
+func (ch createAccountChange) revert(s *StateDB) {
+	delete(s.Accounts, ch.addr)
+}
+
+func (ch createContractChange) revert(s *StateDB) {
+	delete(s.created, ch.addr)
+}
+
+func (ch selfDestructChange) revert(s *StateDB) {
+	delete(s.destructed, ch.addr)
+}
+
+func (ch balanceChange) revert(s *StateDB) {
+	s.Accounts[ch.addr].Balance = ch.prev
+}
+
+func (ch nonceChange) revert(s *StateDB) {
+	s.Accounts[ch.addr].Nonce = ch.prev
+}
+
+func (ch codeChange) revert(s *StateDB) {
+	account := s.Accounts[ch.addr]
+	account.Code = ch.prevCode
+	account.CodeHash = ch.prevHash
+}
+
+func (ch storageChange) revert(s *StateDB) {
+	account := s.Accounts[ch.addr]
+	account.root = nil
+	storage := account.Storage
+	if ch.prev == (Hash{}) {
+		delete(storage, ch.key)
+	} else {
+		storage[ch.key] = ch.prev
+	}
+}
+
+func (ch transientStorageChange) revert(s *StateDB) {
+	if ch.prev == (Hash{}) {
+		delete(s.transient[ch.addr], ch.key)
+	} else {
+		s.transient[ch.addr][ch.key] = ch.prev
+	}
+}
+
+func (ch refundChange) revert(s *StateDB) {
+	s.refund = ch.prev
+}
+
+func (ch addLogChange) revert(s *StateDB) {
+	s.logs = s.logs[:len(s.logs)-1]
+}
+
+func (ch accessListAddAccountChange) revert(s *StateDB) {
+	delete(s.accessList.addresses, ch.addr)
+}
+
+func (ch accessListAddSlotChange) revert(s *StateDB) {
+	delete(s.accessList.slots[ch.addr], ch.key)
+}
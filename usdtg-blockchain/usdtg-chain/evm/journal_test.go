@@ -0,0 +1,93 @@
+package evm
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+func TestJournalRevert(t *testing.T) {
+	a, b, c := BytesToAddress([]byte{0x0a}), BytesToAddress([]byte{0x0b}), BytesToAddress([]byte{0x0c})
+	k1, k2 := BytesToHash([]byte{1}), BytesToHash([]byte{2})
+
+	parent := newStateDB()
+	parent.addBalance(a, big.NewInt(100))
+	parent.setNonce(a, 1)
+	parent.Accounts[a].Storage[k1] = BytesToHash([]byte{5})
+	root, storageRoot := parent.root(), parent.storageRoot(a)
+
+	s := parent.copyOnWrite()
+	s.prepare(a, nil, Address{}, nil, nil)
+	snap := s.snapshot()
+	s.addBalance(a, big.NewInt(50))
+	s.setNonce(a, 2)
+	s.setCode(a, []byte{byte(STOP)})
+	s.setState(a, k1, BytesToHash([]byte{7}))
+	s.setState(a, k2, BytesToHash([]byte{9}))
+	s.addBalance(b, big.NewInt(1))
+	s.setTransientState(a, k1, BytesToHash([]byte{3}))
+	s.addRefund(100)
+	s.addLog(&Log{Address: a})
+	s.addSlotToAccessList(c, k1)
+
+	// An inner snapshot undoes only what came after it
+	inner := s.snapshot()
+	s.setState(a, k1, BytesToHash([]byte{8}))
+	s.subBalance(a, big.NewInt(10))
+	s.addSlotToAccessList(c, k2)
+	s.revertToSnapshot(inner)
+	if s.getState(a, k1) != BytesToHash([]byte{7}) || s.getBalance(a).Int64() != 150 {
+		t.Fatalf("inner revert left slot 1 = %s, balance %s", s.getState(a, k1), s.getBalance(a))
+	}
+	if s.accessList.slots[c][k2] || !s.accessList.slots[c][k1] {
+		t.Fatal("inner revert did not restore the access list")
+	}
+
+	s.revertToSnapshot(snap)
+	switch {
+	case s.getBalance(a).Int64() != 100 || s.getNonce(a) != 1 || len(s.getCode(a)) != 0:
+		t.Fatalf("account not restored: balance %s, nonce %d, code %x", s.getBalance(a), s.getNonce(a), s.getCode(a))
+	case s.getState(a, k1) != BytesToHash([]byte{5}) || s.getState(a, k2) != (Hash{}):
+		t.Fatalf("storage not restored: %s, %s", s.getState(a, k1), s.getState(a, k2))
+	case s.exist(b):
+		t.Fatal("created account not removed")
+	case s.getTransientState(a, k1) != (Hash{}):
+		t.Fatal("transient storage not restored")
+	case s.refund != 0 || len(s.logs) != 0:
+		t.Fatalf("refund %d and %d logs left", s.refund, len(s.logs))
+	case s.accessList.addresses[c] || s.accessList.slots[c][k1]:
+		t.Fatal("access list not restored")
+	case s.storageRoot(a) != storageRoot || s.root() != root:
+		t.Fatal("state root changed")
+	}
+	if !bytes.Equal(parent.getAccount(a).Code, []byte{}) || parent.getNonce(a) != 1 || parent.getState(a, k1) != BytesToHash([]byte{5}) {
+		t.Fatal("the layer wrote its parent")
+	}
+}
+
+func TestNestedCallRevert(t *testing.T) {
+	e := newTestEVM()
+	// Stores 1 in slot 0 and logs, then reverts
+	inner := deploy(t, e, []byte{
+		byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE), byte(PUSH1), 0, byte(PUSH1), 0, byte(LOG0),
+		byte(PUSH1), 0, byte(PUSH1), 0, byte(REVERT),
+	})
+	// Stores 1 in slot 0 and logs, then calls inner
+	outer := deploy(t, e, append([]byte{
+		byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE), byte(PUSH1), 0, byte(PUSH1), 0, byte(LOG0),
+	}, callerCode(CALL, inner, nil)...))
+
+	result := execute(t, e, &outer, 0, nil)
+	if _, ok := callOutput(t, result); ok {
+		t.Fatal("the inner call succeeded")
+	}
+	if len(result.Logs) != 1 || result.Logs[0].Address != outer {
+		t.Fatalf("logs %+v, want only the outer one", result.Logs)
+	}
+	if e.GetStorage(outer, Hash{}) != BytesToHash([]byte{1}) {
+		t.Fatal("the outer write was reverted")
+	}
+	if e.GetStorage(inner, Hash{}) != (Hash{}) {
+		t.Fatal("the inner write was kept")
+	}
+}
@@ -0,0 +1,232 @@
+package evm
+
+type (
+	executionFunc func(pc *uint64, in *Interpreter, f *frame, stack *Stack, mem *Memory) ([]byte, error)
+	gasFunc       func(in *Interpreter, f *frame, stack *Stack, mem *Memory, memorySize uint64) (uint64, error)
+	// memorySizeFunc returns the memory size required by the operation and
+	// whether computing it overflowed
+	memorySizeFunc func(stack *Stack) (uint64, bool)
+)
+
+// operation describes how an opcode executes and what it costs
+type operation struct {
+	execute     executionFunc
+	constantGas uint64
+	dynamicGas  gasFunc
+	memorySize  memorySizeFunc
+
+	minStack int // words that must be on the stack
+	maxStack int // stack size above which the operation overflows
+
+	halts   bool // stops execution (STOP, RETURN, SELFDESTRUCT)
+	jumps   bool // sets the program counter itself
+	writes  bool // modifies state, forbidden in static calls
+	reverts bool // REVERT
+	returns bool // sets the return data buffer of the calling frame
+}
+
+// JumpTable maps every opcode to its operation; nil entries are invalid
+type JumpTable [256]*operation
+
+func minStack(pops, pushes int) int {
+	return pops
+}
+
+func maxStack(pops, pushes int) int {
+	return stackLimit + pops - pushes
+}
+
+func minSwapStack(n int) int { return minStack(n, n) }
+func maxSwapStack(n int) int { return maxStack(n, n) }
+func minDupStack(n int) int  { return minStack(n, n+1) }
+func maxDupStack(n int) int  { return maxStack(n, n+1) }
+
+// cancunInstructionSet is the instruction set of the Cancun hard fork,
+// which includes Shanghai's PUSH0
+var cancunInstructionSet = newCancunInstructionSet()
+
+func newCancunInstructionSet() JumpTable {
+	tbl := JumpTable{
+		STOP:       {execute: opStop, minStack: minStack(0, 0), maxStack: maxStack(0, 0), halts: true},
+		ADD:        {execute: opAdd, constantGas: GasFastestStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		MUL:        {execute: opMul, constantGas: GasFastStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		SUB:        {execute: opSub, constantGas: GasFastestStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		DIV:        {execute: opDiv, constantGas: GasFastStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		SDIV:       {execute: opSdiv, constantGas: GasFastStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		MOD:        {execute: opMod, constantGas: GasFastStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		SMOD:       {execute: opSmod, constantGas: GasFastStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		ADDMOD:     {execute: opAddmod, constantGas: GasMidStep, minStack: minStack(3, 1), maxStack: maxStack(3, 1)},
+		MULMOD:     {execute: opMulmod, constantGas: GasMidStep, minStack: minStack(3, 1), maxStack: maxStack(3, 1)},
+		EXP:        {execute: opExp, constantGas: GasSlowStep, dynamicGas: gasExp, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		SIGNEXTEND: {execute: opSignExtend, constantGas: GasFastStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+
+		LT:     {execute: opLt, constantGas: GasFastestStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		GT:     {execute: opGt, constantGas: GasFastestStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		SLT:    {execute: opSlt, constantGas: GasFastestStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		SGT:    {execute: opSgt, constantGas: GasFastestStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		EQ:     {execute: opEq, constantGas: GasFastestStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		ISZERO: {execute: opIszero, constantGas: GasFastestStep, minStack: minStack(1, 1), maxStack: maxStack(1, 1)},
+		AND:    {execute: opAnd, constantGas: GasFastestStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		OR:     {execute: opOr, constantGas: GasFastestStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		XOR:    {execute: opXor, constantGas: GasFastestStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		NOT:    {execute: opNot, constantGas: GasFastestStep, minStack: minStack(1, 1), maxStack: maxStack(1, 1)},
+		BYTE:   {execute: opByte, constantGas: GasFastestStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		SHL:    {execute: opSHL, constantGas: GasFastestStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		SHR:    {execute: opSHR, constantGas: GasFastestStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+		SAR:    {execute: opSAR, constantGas: GasFastestStep, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+
+		KECCAK256: {execute: opKeccak256, constantGas: Keccak256Gas, dynamicGas: gasKeccak256, memorySize: memoryKeccak256, minStack: minStack(2, 1), maxStack: maxStack(2, 1)},
+
+		ADDRESS:        {execute: opAddress, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		BALANCE:        {execute: opBalance, constantGas: WarmStorageReadCost, dynamicGas: gasAccountAccess, minStack: minStack(1, 1), maxStack: maxStack(1, 1)},
+		ORIGIN:         {execute: opOrigin, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		CALLER:         {execute: opCaller, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		CALLVALUE:      {execute: opCallValue, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		CALLDATALOAD:   {execute: opCallDataLoad, constantGas: GasFastestStep, minStack: minStack(1, 1), maxStack: maxStack(1, 1)},
+		CALLDATASIZE:   {execute: opCallDataSize, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		CALLDATACOPY:   {execute: opCallDataCopy, constantGas: GasFastestStep, dynamicGas: gasCallDataCopy, memorySize: memoryCallDataCopy, minStack: minStack(3, 0), maxStack: maxStack(3, 0)},
+		CODESIZE:       {execute: opCodeSize, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		CODECOPY:       {execute: opCodeCopy, constantGas: GasFastestStep, dynamicGas: gasCodeCopy, memorySize: memoryCodeCopy, minStack: minStack(3, 0), maxStack: maxStack(3, 0)},
+		GASPRICE:       {execute: opGasprice, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		EXTCODESIZE:    {execute: opExtCodeSize, constantGas: WarmStorageReadCost, dynamicGas: gasAccountAccess, minStack: minStack(1, 1), maxStack: maxStack(1, 1)},
+		EXTCODECOPY:    {execute: opExtCodeCopy, constantGas: WarmStorageReadCost, dynamicGas: gasExtCodeCopy, memorySize: memoryExtCodeCopy, minStack: minStack(4, 0), maxStack: maxStack(4, 0)},
+		RETURNDATASIZE: {execute: opReturnDataSize, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		RETURNDATACOPY: {execute: opReturnDataCopy, constantGas: GasFastestStep, dynamicGas: gasReturnDataCopy, memorySize: memoryReturnDataCopy, minStack: minStack(3, 0), maxStack: maxStack(3, 0)},
+		EXTCODEHASH:    {execute: opExtCodeHash, constantGas: WarmStorageReadCost, dynamicGas: gasAccountAccess, minStack: minStack(1, 1), maxStack: maxStack(1, 1)},
+
+		BLOCKHASH:   {execute: opBlockhash, constantGas: GasExtStep, minStack: minStack(1, 1), maxStack: maxStack(1, 1)},
+		COINBASE:    {execute: opCoinbase, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		TIMESTAMP:   {execute: opTimestamp, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		NUMBER:      {execute: opNumber, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		PREVRANDAO:  {execute: opPrevRandao, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		GASLIMIT:    {execute: opGasLimit, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		CHAINID:     {execute: opChainID, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		SELFBALANCE: {execute: opSelfBalance, constantGas: GasFastStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		BASEFEE:     {execute: opBaseFee, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		BLOBHASH:    {execute: opBlobHash, constantGas: GasFastestStep, minStack: minStack(1, 1), maxStack: maxStack(1, 1)},
+		BLOBBASEFEE: {execute: opBlobBaseFee, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+
+		POP:      {execute: opPop, constantGas: GasQuickStep, minStack: minStack(1, 0), maxStack: maxStack(1, 0)},
+		MLOAD:    {execute: opMload, constantGas: GasFastestStep, dynamicGas: pureMemoryGascost, memorySize: memoryMLoad, minStack: minStack(1, 1), maxStack: maxStack(1, 1)},
+		MSTORE:   {execute: opMstore, constantGas: GasFastestStep, dynamicGas: pureMemoryGascost, memorySize: memoryMStore, minStack: minStack(2, 0), maxStack: maxStack(2, 0)},
+		MSTORE8:  {execute: opMstore8, constantGas: GasFastestStep, dynamicGas: pureMemoryGascost, memorySize: memoryMStore8, minStack: minStack(2, 0), maxStack: maxStack(2, 0)},
+		SLOAD:    {execute: opSload, dynamicGas: gasSLoad, minStack: minStack(1, 1), maxStack: maxStack(1, 1)},
+		SSTORE:   {execute: opSstore, dynamicGas: gasSStore, minStack: minStack(2, 0), maxStack: maxStack(2, 0), writes: true},
+		JUMP:     {execute: opJump, constantGas: GasMidStep, minStack: minStack(1, 0), maxStack: maxStack(1, 0), jumps: true},
+		JUMPI:    {execute: opJumpi, constantGas: GasSlowStep, minStack: minStack(2, 0), maxStack: maxStack(2, 0), jumps: true},
+		PC:       {execute: opPc, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		MSIZE:    {execute: opMsize, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		GAS:      {execute: opGas, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+		JUMPDEST: {execute: opJumpdest, constantGas: JumpdestGas, minStack: minStack(0, 0), maxStack: maxStack(0, 0)},
+		TLOAD:    {execute: opTload, constantGas: TransientStorageGas, minStack: minStack(1, 1), maxStack: maxStack(1, 1)},
+		TSTORE:   {execute: opTstore, constantGas: TransientStorageGas, minStack: minStack(2, 0), maxStack: maxStack(2, 0), writes: true},
+		MCOPY:    {execute: opMcopy, constantGas: GasFastestStep, dynamicGas: gasMcopy, memorySize: memoryMcopy, minStack: minStack(3, 0), maxStack: maxStack(3, 0)},
+		PUSH0:    {execute: opPush0, constantGas: GasQuickStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)},
+
+		CREATE:       {execute: opCreate, constantGas: CreateGas, dynamicGas: gasCreate, memorySize: memoryCreate, minStack: minStack(3, 1), maxStack: maxStack(3, 1), writes: true, returns: true},
+		CALL:         {execute: opCall, constantGas: WarmStorageReadCost, dynamicGas: gasCall, memorySize: memoryCall, minStack: minStack(7, 1), maxStack: maxStack(7, 1), returns: true},
+		CALLCODE:     {execute: opCallCode, constantGas: WarmStorageReadCost, dynamicGas: gasCallCode, memorySize: memoryCall, minStack: minStack(7, 1), maxStack: maxStack(7, 1), returns: true},
+		RETURN:       {execute: opReturn, dynamicGas: pureMemoryGascost, memorySize: memoryReturn, minStack: minStack(2, 0), maxStack: maxStack(2, 0), halts: true},
+		DELEGATECALL: {execute: opDelegateCall, constantGas: WarmStorageReadCost, dynamicGas: gasDelegateCall, memorySize: memoryDelegateCall, minStack: minStack(6, 1), maxStack: maxStack(6, 1), returns: true},
+		CREATE2:      {execute: opCreate2, constantGas: CreateGas, dynamicGas: gasCreate2, memorySize: memoryCreate, minStack: minStack(4, 1), maxStack: maxStack(4, 1), writes: true, returns: true},
+		STATICCALL:   {execute: opStaticCall, constantGas: WarmStorageReadCost, dynamicGas: gasStaticCall, memorySize: memoryDelegateCall, minStack: minStack(6, 1), maxStack: maxStack(6, 1), returns: true},
+		REVERT:       {execute: opRevert, dynamicGas: pureMemoryGascost, memorySize: memoryRevert, minStack: minStack(2, 0), maxStack: maxStack(2, 0), reverts: true},
+		INVALID:      {execute: opInvalid, minStack: minStack(0, 0), maxStack: maxStack(0, 0)},
+		SELFDESTRUCT: {execute: opSelfdestruct, constantGas: SelfdestructGas, dynamicGas: gasSelfdestruct, minStack: minStack(1, 0), maxStack: maxStack(1, 0), halts: true, writes: true},
+	}
+
+	for i := 0; i < 32; i++ {
+		tbl[PUSH1+OpCode(i)] = &operation{execute: makePush(uint64(i + 1)), constantGas: GasFastestStep, minStack: minStack(0, 1), maxStack: maxStack(0, 1)}
+	}
+	for i := 1; i <= 16; i++ {
+		tbl[DUP1+OpCode(i-1)] = &operation{execute: makeDup(i), constantGas: GasFastestStep, minStack: minDupStack(i), maxStack: maxDupStack(i)}
+		tbl[SWAP1+OpCode(i-1)] = &operation{execute: makeSwap(i), constantGas: GasFastestStep, minStack: minSwapStack(i + 1), maxStack: maxSwapStack(i + 1)}
+	}
+	for i := 0; i <= 4; i++ {
+		tbl[LOG0+OpCode(i)] = &operation{execute: makeLog(i), constantGas: LogGas, dynamicGas: makeGasLog(uint64(i)), memorySize: memoryLog, minStack: minStack(2+i, 0), maxStack: maxStack(2+i, 0), writes: true}
+	}
+	return tbl
+}
+
+// Memory size functions
+
+func memoryKeccak256(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), stack.back(1))
+}
+
+func memoryCallDataCopy(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), stack.back(2))
+}
+
+func memoryReturnDataCopy(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), stack.back(2))
+}
+
+func memoryCodeCopy(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), stack.back(2))
+}
+
+func memoryExtCodeCopy(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(1), stack.back(3))
+}
+
+func memoryMLoad(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), word32)
+}
+
+func memoryMStore(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), word32)
+}
+
+func memoryMStore8(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), word1)
+}
+
+func memoryMcopy(stack *Stack) (uint64, bool) {
+	dst, src := stack.back(0), stack.back(1)
+	if dst.Cmp(src) < 0 {
+		dst = src
+	}
+	return calcMemSize(dst, stack.back(2))
+}
+
+func memoryLog(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), stack.back(1))
+}
+
+func memoryCreate(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(1), stack.back(2))
+}
+
+func memoryCall(stack *Stack) (uint64, bool) {
+	return callMemSize(stack, 3)
+}
+
+func memoryDelegateCall(stack *Stack) (uint64, bool) {
+	return callMemSize(stack, 2)
+}
+
+// callMemSize covers both the input and the output area of a call, given
+// as offset and size pairs starting at stack position pos
+func callMemSize(stack *Stack, pos int) (uint64, bool) {
+	in, overflow := calcMemSize(stack.back(pos), stack.back(pos+1))
+	if overflow {
+		return 0, true
+	}
+	out, overflow := calcMemSize(stack.back(pos+2), stack.back(pos+3))
+	if overflow {
+		return 0, true
+	}
+	if out > in {
+		return out, false
+	}
+	return in, false
+}
+
+func memoryReturn(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), stack.back(1))
+}
+
+func memoryRevert(stack *Stack) (uint64, bool) {
+	return calcMemSize(stack.back(0), stack.back(1))
+}
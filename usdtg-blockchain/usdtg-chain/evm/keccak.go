@@ -0,0 +1,105 @@
+package evm
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Keccak-256 as used by Ethereum. This is the original Keccak submission
+// with 0x01 padding, not the standardized SHA3-256 with 0x06 padding.
+
+const keccakRate = 136 // (1600 - 2*256) / 8
+
+var keccakRoundConstants = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808A, 0x8000000080008000,
+	0x000000000000808B, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008A, 0x0000000000000088, 0x0000000080008009, 0x000000008000000A,
+	0x000000008000808B, 0x800000000000008B, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800A, 0x800000008000000A,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+// keccakRotations holds the rotation offset of lane x+5y
+var keccakRotations = [25]int{
+	0, 1, 62, 28, 27,
+	36, 44, 6, 55, 20,
+	3, 10, 43, 25, 39,
+	41, 45, 15, 21, 8,
+	18, 2, 61, 56, 14,
+}
+
+// keccakF1600 applies the Keccak-f[1600] permutation to the state
+func keccakF1600(a *[25]uint64) {
+	var b [25]uint64
+	var c, d [5]uint64
+
+	for round := 0; round < 24; round++ {
+		// θ
+		for x := 0; x < 5; x++ {
+			c[x] = a[x] ^ a[x+5] ^ a[x+10] ^ a[x+15] ^ a[x+20]
+		}
+		for x := 0; x < 5; x++ {
+			d[x] = c[(x+4)%5] ^ bits.RotateLeft64(c[(x+1)%5], 1)
+		}
+		for i := 0; i < 25; i++ {
+			a[i] ^= d[i%5]
+		}
+
+		// ρ and π
+		for x := 0; x < 5; x++ {
+			for y := 0; y < 5; y++ {
+				b[y+5*((2*x+3*y)%5)] = bits.RotateLeft64(a[x+5*y], keccakRotations[x+5*y])
+			}
+		}
+
+		// χ
+		for y := 0; y < 5; y++ {
+			for x := 0; x < 5; x++ {
+				a[x+5*y] = b[x+5*y] ^ (^b[(x+1)%5+5*y] & b[(x+2)%5+5*y])
+			}
+		}
+
+		// ι
+		a[0] ^= keccakRoundConstants[round]
+	}
+}
+
+// Keccak256 returns the Keccak-256 hash of the concatenated inputs
+func Keccak256(data ...[]byte) []byte {
+	var state [25]uint64
+	var block [keccakRate]byte
+	n := 0
+
+	absorb := func() {
+		for i := 0; i < keccakRate/8; i++ {
+			state[i] ^= binary.LittleEndian.Uint64(block[i*8:])
+		}
+		keccakF1600(&state)
+		n = 0
+	}
+
+	for _, d := range data {
+		for len(d) > 0 {
+			copied := copy(block[n:], d)
+			n += copied
+			d = d[copied:]
+			if n == keccakRate {
+				absorb()
+			}
+		}
+	}
+
+	// Pad the final block
+	for i := n; i < keccakRate; i++ {
+		block[i] = 0
+	}
+	block[n] ^= 0x01
+	block[keccakRate-1] ^= 0x80
+	absorb()
+
+	out := make([]byte, 32)
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint64(out[i*8:], state[i])
+	}
+	return out
+}
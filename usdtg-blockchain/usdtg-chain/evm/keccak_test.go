@@ -0,0 +1,42 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestKeccak256(t *testing.T) {
+	sequence := func(n int) []byte {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(i % 251)
+		}
+		return data
+	}
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"empty", nil, "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+		{"abc", []byte("abc"), "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45"},
+		{"function selector", []byte("transfer(address,uint256)"), "a9059cbb2ab09eb219583f4a59a5d0623ade346d962bcd4e46b11da047c9049b"},
+		{"event topic", []byte("Transfer(address,address,uint256)"), "ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"},
+		// One byte short of, exactly and beyond the 136-byte rate
+		{"135 bytes", sequence(135), "cbdfd9dee5faad3818d6b06f95a219fd290b0e1706f6a82e5a595b9ce9faca62"},
+		{"136 bytes", sequence(136), "7ce759f1ab7f9ce437719970c26b0a66ff11fe3e38e17df89cf5d29c7d7f807e"},
+		{"300 bytes", sequence(300), "4699841dafd5e26cca72b05a41d38c96b4b468e5a6cbf694cbebe77dacdf6528"},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(Keccak256(tt.input)); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	// Inputs are hashed as one message however they are split
+	data := sequence(300)
+	if !bytes.Equal(Keccak256(data[:7], data[7:200], nil, data[200:]), Keccak256(data)) {
+		t.Error("split input hashes differently")
+	}
+}
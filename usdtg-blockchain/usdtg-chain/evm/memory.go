@@ -0,0 +1,66 @@
+package evm
+
+import "math/big"
+
+// Memory is the byte-addressed, word-aligned scratch memory of a frame
+type Memory struct {
+	store       []byte
+	lastGasCost uint64
+}
+
+func newMemory() *Memory {
+	return &Memory{}
+}
+
+// resize grows the memory to size bytes. size is always a multiple of 32.
+func (m *Memory) resize(size uint64) {
+	if uint64(len(m.store)) < size {
+		m.store = append(m.store, make([]byte, size-uint64(len(m.store)))...)
+	}
+}
+
+// set copies value into memory at offset. The memory must already be
+// large enough.
+func (m *Memory) set(offset, size uint64, value []byte) {
+	if size > 0 {
+		copy(m.store[offset:offset+size], value)
+	}
+}
+
+// set32 writes val as a 32-byte big-endian word at offset
+func (m *Memory) set32(offset uint64, val *big.Int) {
+	word := m.store[offset : offset+32]
+	for i := range word {
+		word[i] = 0
+	}
+	val.FillBytes(word)
+}
+
+// getCopy returns a copy of size bytes starting at offset
+func (m *Memory) getCopy(offset, size uint64) []byte {
+	if size == 0 {
+		return nil
+	}
+	out := make([]byte, size)
+	copy(out, m.store[offset:offset+size])
+	return out
+}
+
+// getPtr returns a slice of the memory without copying it
+func (m *Memory) getPtr(offset, size uint64) []byte {
+	if size == 0 {
+		return nil
+	}
+	return m.store[offset : offset+size]
+}
+
+// copy moves size bytes from src to dst, handling overlaps (MCOPY)
+func (m *Memory) copy(dst, src, size uint64) {
+	if size > 0 {
+		copy(m.store[dst:dst+size], m.store[src:src+size])
+	}
+}
+
+func (m *Memory) len() int {
+	return len(m.store)
+}
@@ -0,0 +1,282 @@
+package evm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// Changes are what the blocks committed since the last ClearChanges did to
+// the EVM, for the caller to store along with the blocks. Restore loads
+// the stored result back without executing the blocks again.
+type Changes struct {
+	// Accounts holds the accounts the blocks changed, nil for one that no
+	// longer exists
+	Accounts map[Address]*Account
+	// Storage holds the storage slots the blocks changed, per account, zero
+	// for a cleared slot. Changes leaves the Storage of the accounts nil
+	// and reports their slots here, so a large contract costs only the
+	// slots that changed; Dump keeps the storage in the accounts.
+	Storage map[Address]map[Hash]Hash
+	// Receipts holds the encoded receipts of each block that executed
+	// transactions
+	Receipts map[uint64][]byte
+}
+
+// Changes returns the changes of the blocks committed since the last
+// ClearChanges. The accounts are copies without their storage.
+func (e *EVM) Changes() (Changes, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	changes := Changes{
+		Accounts: make(map[Address]*Account, len(e.changedAccounts)),
+		Storage:  make(map[Address]map[Hash]Hash, len(e.changedSlots)),
+		Receipts: make(map[uint64][]byte, len(e.changedBlocks)),
+	}
+	for addr := range e.changedAccounts {
+		var account *Account
+		if a := e.StateDB.getAccount(addr); a != nil {
+			cpy := *a
+			cpy.Storage = nil
+			account = &cpy
+		}
+		changes.Accounts[addr] = account
+	}
+	for addr, keys := range e.changedSlots {
+		slots := make(map[Hash]Hash, len(keys))
+		for key := range keys {
+			slots[key] = e.StateDB.getState(addr, key)
+		}
+		changes.Storage[addr] = slots
+	}
+	for number := range e.changedBlocks {
+		if err := e.addReceipts(changes, number); err != nil {
+			return Changes{}, err
+		}
+	}
+	return changes, nil
+}
+
+// Dump returns the whole state and the receipts of all blocks in the form
+// of Changes, as for an EVM that starts from nothing
+func (e *EVM) Dump() (Changes, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	changes := Changes{
+		Accounts: make(map[Address]*Account),
+		Receipts: make(map[uint64][]byte, len(e.blocks)),
+	}
+	for state := e.StateDB; state != nil; state = state.parent {
+		for addr, account := range state.Accounts {
+			if _, ok := changes.Accounts[addr]; !ok {
+				changes.Accounts[addr] = account.copy()
+			}
+		}
+	}
+	for number := range e.blocks {
+		if err := e.addReceipts(changes, number); err != nil {
+			return Changes{}, err
+		}
+	}
+	return changes, nil
+}
+
+// addReceipts encodes the receipts of a block into changes; the caller
+// holds mu
+func (e *EVM) addReceipts(changes Changes, number uint64) error {
+	data, err := encodeReceipts(e.blocks[number].receipts)
+	if err != nil {
+		return fmt.Errorf("encoding receipts of block %d: %w", number, err)
+	}
+	changes.Receipts[number] = data
+	return nil
+}
+
+// ClearChanges forgets the changes so far, once they are stored
+func (e *EVM) ClearChanges() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.changedAccounts = make(map[Address]struct{})
+	e.changedSlots = make(map[Address]map[Hash]struct{})
+	e.changedBlocks = make(map[uint64]struct{})
+}
+
+// trackChanges records the accounts, storage slots and receipts of a block
+// executed on view for Changes; the caller holds mu. The slots are those
+// that differ from the state the block started from.
+func (e *EVM) trackChanges(view *EVM) {
+	for addr, account := range view.StateDB.Accounts {
+		e.changedAccounts[addr] = struct{}{}
+
+		var prev map[Hash]Hash
+		if a := view.StateDB.parent.getAccount(addr); a != nil {
+			prev = a.Storage
+		}
+		for key, value := range account.Storage {
+			if prev[key] != value {
+				e.markSlot(addr, key)
+			}
+		}
+		for key := range prev {
+			if _, ok := account.Storage[key]; !ok {
+				e.markSlot(addr, key)
+			}
+		}
+	}
+	for number := range view.blocks {
+		e.changedBlocks[number] = struct{}{}
+	}
+}
+
+// markSlot records a changed storage slot for Changes; the caller holds mu
+func (e *EVM) markSlot(addr Address, key Hash) {
+	if e.changedSlots[addr] == nil {
+		e.changedSlots[addr] = make(map[Hash]struct{})
+	}
+	e.changedSlots[addr][key] = struct{}{}
+}
+
+// Restore replaces the state with the given accounts and the receipts
+// with those encoded in Changes, and moves to the given block. It starts
+// over from there: the states of earlier blocks are not available. All of
+// it counts as changed until ClearChanges.
+func (e *EVM) Restore(number uint64, accounts []*Account, receipts [][]byte) error {
+	state := newStateDB()
+	for _, account := range accounts {
+		if account.Balance == nil {
+			account.Balance = new(big.Int)
+		}
+		if account.Storage == nil {
+			account.Storage = make(map[Hash]Hash)
+		}
+		state.Accounts[account.Address] = account
+	}
+
+	changedAccounts := make(map[Address]struct{}, len(accounts))
+	changedSlots := make(map[Address]map[Hash]struct{})
+	for addr, account := range state.Accounts {
+		changedAccounts[addr] = struct{}{}
+		if len(account.Storage) > 0 {
+			keys := make(map[Hash]struct{}, len(account.Storage))
+			for key := range account.Storage {
+				keys[key] = struct{}{}
+			}
+			changedSlots[addr] = keys
+		}
+	}
+	byHash := make(map[Hash]*Receipt)
+	blocks := make(map[uint64]*blockReceipts)
+	changedBlocks := make(map[uint64]struct{}, len(receipts))
+	for _, data := range receipts {
+		block, err := decodeReceipts(data)
+		if err != nil {
+			return err
+		}
+		if len(block.receipts) == 0 {
+			continue
+		}
+		for _, receipt := range block.receipts {
+			byHash[receipt.TxHash] = receipt
+		}
+		number := block.receipts[0].BlockNumber
+		blocks[number] = block
+		changedBlocks[number] = struct{}{}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.StateDB = state
+	e.history = nil
+	e.Block.Number = number
+	e.receipts = byHash
+	e.blocks = blocks
+	e.changedAccounts = changedAccounts
+	e.changedSlots = changedSlots
+	e.changedBlocks = changedBlocks
+	return nil
+}
+
+// StateRoot returns the root of the current state, see Header. It caches
+// storage roots, so it takes mu for writing.
+func (e *EVM) StateRoot() Hash {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.StateDB.root()
+}
+
+// storedReceipt is a receipt as Changes encodes it, along with the result
+// of its transaction
+type storedReceipt struct {
+	*Receipt
+	Result *TransactionResult `json:"result"`
+}
+
+// encodeReceipts encodes the receipts of a block. The logs of a result
+// are those of its receipt, so they are left out.
+func encodeReceipts(receipts []*Receipt) ([]byte, error) {
+	stored := make([]storedReceipt, len(receipts))
+	for i, receipt := range receipts {
+		result := *receipt.result
+		result.Logs = nil
+		stored[i] = storedReceipt{Receipt: receipt, Result: &result}
+	}
+	return json.Marshal(stored)
+}
+
+// decodeReceipts decodes the receipts of a block, as encodeReceipts wrote
+// them, and rebuilds the block's totals
+func decodeReceipts(data []byte) (*blockReceipts, error) {
+	var stored []storedReceipt
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("decoding receipts: %w", err)
+	}
+
+	block := new(blockReceipts)
+	for _, s := range stored {
+		if s.Receipt == nil || s.Result == nil {
+			return nil, fmt.Errorf("decoding receipts: incomplete receipt")
+		}
+		receipt, result := s.Receipt, s.Result
+		if result.Success {
+			result.Logs = receipt.Logs
+		}
+		result.Err = restoreError(result)
+		receipt.result = result
+
+		block.receipts = append(block.receipts, receipt)
+		block.bloom.Or(receipt.Bloom)
+		block.logs += uint(len(receipt.Logs))
+		block.gasUsed = receipt.CumulativeGasUsed
+	}
+	return block, nil
+}
+
+// restoredError is an execution error read back from its message and
+// code, which errors.Is matches as the original
+type restoredError struct {
+	msg string
+	err error
+}
+
+func (e *restoredError) Error() string { return e.msg }
+func (e *restoredError) Unwrap() error { return e.err }
+
+// restoreError rebuilds the Err of a decoded result
+func restoreError(result *TransactionResult) error {
+	if result.Revert != nil {
+		return result.Revert
+	}
+	if result.Error == "" {
+		return nil
+	}
+	for _, c := range executionErrorCodes {
+		if c.code == result.ErrorCode {
+			return &restoredError{msg: result.Error, err: c.err}
+		}
+	}
+	return &restoredError{msg: result.Error}
+}
@@ -0,0 +1,406 @@
+package evm
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// PrecompiledContract is a contract implemented by the node rather than
+// by bytecode. Every node must run the same precompiles at the same
+// addresses, or they will disagree on the state.
+type PrecompiledContract interface {
+	// RequiredGas returns the cost of running the contract on input
+	RequiredGas(input []byte) uint64
+	// Run executes the contract. Returning ErrExecutionReverted reverts
+	// the call with the output as revert data and keeps the gas left;
+	// any other error fails the call and consumes all its gas.
+	Run(ctx *PrecompileContext, input []byte) ([]byte, error)
+}
+
+// PrecompileContext is the call a precompiled contract runs in, with
+// read-only access to the state
+type PrecompileContext struct {
+	Caller Address
+	Value  *big.Int
+	Block  BlockContext
+	state  *StateDB
+}
+
+// GetBalance returns the balance of an account
+func (c *PrecompileContext) GetBalance(addr Address) *big.Int {
+	return c.state.getBalance(addr)
+}
+
+// GetNonce returns the nonce of an account
+func (c *PrecompileContext) GetNonce(addr Address) uint64 {
+	return c.state.getNonce(addr)
+}
+
+// GetCode returns the code of an account
+func (c *PrecompileContext) GetCode(addr Address) []byte {
+	return append([]byte(nil), c.state.getCode(addr)...)
+}
+
+// GetStorage returns a storage slot of an account
+func (c *PrecompileContext) GetStorage(addr Address, key Hash) Hash {
+	return c.state.getState(addr, key)
+}
+
+// pointEvaluationAddress is where Ethereum has the KZG point evaluation
+// precompile
+var pointEvaluationAddress = BytesToAddress([]byte{0x0a})
+
+// standardPrecompiles are the Cancun precompiled contracts at 0x01 to
+// 0x09. The KZG point evaluation precompile of EIP-4844 is left out: the
+// node does not bundle the KZG trusted setup and accepts no blob
+// transactions, so 0x0a is an empty account, kept free by
+// RegisterPrecompile.
+var standardPrecompiles = map[Address]PrecompiledContract{
+	BytesToAddress([]byte{0x01}): ecrecover{},
+	BytesToAddress([]byte{0x02}): sha256hash{},
+	BytesToAddress([]byte{0x03}): ripemd160hash{},
+	BytesToAddress([]byte{0x04}): dataCopy{},
+	BytesToAddress([]byte{0x05}): bigModExp{},
+	BytesToAddress([]byte{0x06}): bn256Add{},
+	BytesToAddress([]byte{0x07}): bn256ScalarMul{},
+	BytesToAddress([]byte{0x08}): bn256Pairing{},
+	BytesToAddress([]byte{0x09}): blake2F{},
+}
+
+// RegisterPrecompile adds a precompiled contract at addr, such as one
+// exposing chain data to contracts. The standard precompiles cannot be
+// replaced, and 0x0a is kept free for point evaluation. Register before
+// executing any block, in the same way on every node.
+func (e *EVM) RegisterPrecompile(addr Address, p PrecompiledContract) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := standardPrecompiles[addr]; ok {
+		return fmt.Errorf("%s is a standard precompile", addr.Hex())
+	}
+	if addr == pointEvaluationAddress {
+		return fmt.Errorf("%s is reserved for the point evaluation precompile", addr.Hex())
+	}
+	if _, ok := e.precompiles[addr]; ok {
+		return fmt.Errorf("a precompile is already registered at %s", addr.Hex())
+	}
+	precompiles := make(map[Address]PrecompiledContract, len(e.precompiles)+1)
+	for a, c := range e.precompiles {
+		precompiles[a] = c
+	}
+	precompiles[addr] = p
+	e.precompiles = precompiles
+	return nil
+}
+
+// runPrecompile charges for and runs a precompiled contract. Like call,
+// it returns the output, the gas left and the execution error.
+func (in *Interpreter) runPrecompile(p PrecompiledContract, caller Address, input []byte, gas uint64, value *big.Int) ([]byte, uint64, error) {
+	cost := p.RequiredGas(input)
+	if gas < cost {
+		return nil, 0, ErrOutOfGas
+	}
+	gas -= cost
+
+	ctx := &PrecompileContext{Caller: caller, Value: value, Block: in.block, state: in.evm.StateDB}
+	ret, err := p.Run(ctx, input)
+	switch {
+	case err == ErrExecutionReverted:
+		return ret, gas, err
+	case err != nil:
+		return nil, 0, fmt.Errorf("%w: %v", ErrPrecompileFailed, err)
+	}
+	return ret, gas, nil
+}
+
+// Errors of the standard precompiles
+var (
+	errPrecompileInput  = errors.New("invalid input length")
+	errBlake2FFinalFlag = errors.New("blake2f: final flag must be 0 or 1")
+)
+
+// wordGas returns base plus perWord for every 32-byte word of input
+func wordGas(input []byte, base, perWord uint64) uint64 {
+	return base + toWordSize(uint64(len(input)))*perWord
+}
+
+// rightPad returns data zero padded to at least size bytes
+func rightPad(data []byte, size int) []byte {
+	if len(data) >= size {
+		return data
+	}
+	out := make([]byte, size)
+	copy(out, data)
+	return out
+}
+
+// ecrecover recovers the address that signed a hash. Invalid signatures
+// return no output rather than failing.
+type ecrecover struct{}
+
+func (ecrecover) RequiredGas(input []byte) uint64 {
+	return EcrecoverGas
+}
+
+func (ecrecover) Run(ctx *PrecompileContext, input []byte) ([]byte, error) {
+	input = rightPad(input, 128)
+	// v is 27 or 28 in a full word
+	for _, b := range input[32:63] {
+		if b != 0 {
+			return nil, nil
+		}
+	}
+	v := input[63]
+	if v != 27 && v != 28 {
+		return nil, nil
+	}
+
+	r := new(big.Int).SetBytes(input[64:96])
+	s := new(big.Int).SetBytes(input[96:128])
+	pub, err := RecoverPubkey(input[:32], r, s, v-27)
+	if err != nil {
+		return nil, nil
+	}
+	addr := PubkeyToAddress(pub)
+	return BytesToHash(addr[:]).Bytes(), nil
+}
+
+// sha256hash returns the SHA-256 digest of the input
+type sha256hash struct{}
+
+func (sha256hash) RequiredGas(input []byte) uint64 {
+	return wordGas(input, Sha256BaseGas, Sha256PerWordGas)
+}
+
+func (sha256hash) Run(ctx *PrecompileContext, input []byte) ([]byte, error) {
+	h := sha256.Sum256(input)
+	return h[:], nil
+}
+
+// ripemd160hash returns the RIPEMD-160 digest of the input, left padded
+// to 32 bytes
+type ripemd160hash struct{}
+
+func (ripemd160hash) RequiredGas(input []byte) uint64 {
+	return wordGas(input, Ripemd160BaseGas, Ripemd160PerWordGas)
+}
+
+func (ripemd160hash) Run(ctx *PrecompileContext, input []byte) ([]byte, error) {
+	return BytesToHash(Ripemd160(input)).Bytes(), nil
+}
+
+// dataCopy returns its input
+type dataCopy struct{}
+
+func (dataCopy) RequiredGas(input []byte) uint64 {
+	return wordGas(input, IdentityBaseGas, IdentityPerWordGas)
+}
+
+func (dataCopy) Run(ctx *PrecompileContext, input []byte) ([]byte, error) {
+	return append([]byte(nil), input...), nil
+}
+
+// bigModExp computes base^exp mod mod on numbers of arbitrary length. The
+// input holds the three lengths as words, then the three numbers.
+type bigModExp struct{}
+
+// modExpLengths reads the base, exponent and modulus lengths
+func modExpLengths(input []byte) (baseLen, expLen, modLen *big.Int) {
+	header := getData(input, new(big.Int), 96)
+	return new(big.Int).SetBytes(header[:32]),
+		new(big.Int).SetBytes(header[32:64]),
+		new(big.Int).SetBytes(header[64:96])
+}
+
+// RequiredGas follows EIP-2565: the multiplication complexity times the
+// number of iterations, over three, and at least ModExpMinGas
+func (bigModExp) RequiredGas(input []byte) uint64 {
+	baseLen, expLen, modLen := modExpLengths(input)
+
+	// The bit length of the exponent's first 32 bytes, less one
+	var expHead *big.Int
+	if baseLen.IsUint64() {
+		offset := new(big.Int).Add(baseLen, big.NewInt(96))
+		headLen := uint64(32)
+		if expLen.Cmp(big.NewInt(32)) < 0 {
+			headLen = expLen.Uint64()
+		}
+		expHead = new(big.Int).SetBytes(getData(input, offset, headLen))
+	} else {
+		expHead = new(big.Int)
+	}
+	iterations := new(big.Int)
+	if expHead.BitLen() > 0 {
+		iterations.SetInt64(int64(expHead.BitLen() - 1))
+	}
+	if expLen.Cmp(big.NewInt(32)) > 0 {
+		extra := new(big.Int).Sub(expLen, big.NewInt(32))
+		iterations.Add(iterations, extra.Lsh(extra, 3))
+	}
+	if iterations.Sign() == 0 {
+		iterations.SetInt64(1)
+	}
+
+	// ceil(max(baseLen, modLen) / 8)²
+	words := baseLen
+	if modLen.Cmp(words) > 0 {
+		words = modLen
+	}
+	words = new(big.Int).Add(words, big.NewInt(7))
+	words.Rsh(words, 3)
+	gas := words.Mul(words, words)
+	gas.Mul(gas, iterations).Div(gas, big.NewInt(3))
+
+	if !gas.IsUint64() {
+		return math.MaxUint64
+	}
+	if gas.Uint64() < ModExpMinGas {
+		return ModExpMinGas
+	}
+	return gas.Uint64()
+}
+
+func (bigModExp) Run(ctx *PrecompileContext, input []byte) ([]byte, error) {
+	baseLen, expLen, modLen := modExpLengths(input)
+	if baseLen.Sign() == 0 && modLen.Sign() == 0 {
+		return []byte{}, nil
+	}
+	// The gas paid bounds the lengths that get here
+	if !baseLen.IsUint64() || !expLen.IsUint64() || !modLen.IsUint64() {
+		return nil, errPrecompileInput
+	}
+
+	offset := big.NewInt(96)
+	base := new(big.Int).SetBytes(getData(input, offset, baseLen.Uint64()))
+	offset.Add(offset, baseLen)
+	exp := new(big.Int).SetBytes(getData(input, offset, expLen.Uint64()))
+	offset.Add(offset, expLen)
+	mod := new(big.Int).SetBytes(getData(input, offset, modLen.Uint64()))
+
+	out := make([]byte, modLen.Uint64())
+	if mod.BitLen() == 0 {
+		return out, nil
+	}
+	result := new(big.Int).Exp(base, exp, mod)
+	return result.Mod(result, mod).FillBytes(out), nil
+}
+
+// bn256Add adds two G1 points
+type bn256Add struct{}
+
+func (bn256Add) RequiredGas(input []byte) uint64 {
+	return Bn256AddGas
+}
+
+func (bn256Add) Run(ctx *PrecompileContext, input []byte) ([]byte, error) {
+	input = rightPad(input, 128)
+	a, err := decodeG1(input[:64])
+	if err != nil {
+		return nil, err
+	}
+	b, err := decodeG1(input[64:128])
+	if err != nil {
+		return nil, err
+	}
+	return encodeG1(a.add(b)), nil
+}
+
+// bn256ScalarMul multiplies a G1 point by a scalar
+type bn256ScalarMul struct{}
+
+func (bn256ScalarMul) RequiredGas(input []byte) uint64 {
+	return Bn256ScalarMulGas
+}
+
+func (bn256ScalarMul) Run(ctx *PrecompileContext, input []byte) ([]byte, error) {
+	input = rightPad(input, 96)
+	p, err := decodeG1(input[:64])
+	if err != nil {
+		return nil, err
+	}
+	return encodeG1(p.mul(new(big.Int).SetBytes(input[64:96]))), nil
+}
+
+// bn256Pairing checks that the product of the pairings of (G1, G2) pairs
+// is one and returns 1 if it is, 0 otherwise
+type bn256Pairing struct{}
+
+func (bn256Pairing) RequiredGas(input []byte) uint64 {
+	return Bn256PairingBaseGas + uint64(len(input)/192)*Bn256PairingPerPointGas
+}
+
+func (bn256Pairing) Run(ctx *PrecompileContext, input []byte) ([]byte, error) {
+	if len(input)%192 != 0 {
+		return nil, errPrecompileInput
+	}
+	var (
+		g1 []*g1Point
+		g2 []*g2Point
+	)
+	for i := 0; i < len(input); i += 192 {
+		p, err := decodeG1(input[i : i+64])
+		if err != nil {
+			return nil, err
+		}
+		q, err := decodeG2(input[i+64 : i+192])
+		if err != nil {
+			return nil, err
+		}
+		g1 = append(g1, p)
+		g2 = append(g2, q)
+	}
+
+	out := make([]byte, 32)
+	if bn256PairingCheck(g1, g2) {
+		out[31] = 1
+	}
+	return out, nil
+}
+
+// blake2F runs the BLAKE2b compression function F (EIP-152). The input
+// is the number of rounds, the state, the message block, the offset
+// counter and the final block flag.
+type blake2F struct{}
+
+const blake2FInputLength = 213
+
+func (blake2F) RequiredGas(input []byte) uint64 {
+	if len(input) != blake2FInputLength {
+		return 0
+	}
+	return uint64(binary.BigEndian.Uint32(input[:4])) * Blake2FRoundGas
+}
+
+func (blake2F) Run(ctx *PrecompileContext, input []byte) ([]byte, error) {
+	if len(input) != blake2FInputLength {
+		return nil, errPrecompileInput
+	}
+	if input[212] > 1 {
+		return nil, errBlake2FFinalFlag
+	}
+
+	var (
+		h [8]uint64
+		m [16]uint64
+		t [2]uint64
+	)
+	for i := range h {
+		h[i] = binary.LittleEndian.Uint64(input[4+i*8:])
+	}
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint64(input[68+i*8:])
+	}
+	t[0] = binary.LittleEndian.Uint64(input[196:])
+	t[1] = binary.LittleEndian.Uint64(input[204:])
+	blake2bF(&h, &m, t, input[212] == 1, binary.BigEndian.Uint32(input[:4]))
+
+	out := make([]byte, 64)
+	for i, v := range h {
+		binary.LittleEndian.PutUint64(out[i*8:], v)
+	}
+	return out, nil
+}
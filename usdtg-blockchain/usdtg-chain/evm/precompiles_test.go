@@ -0,0 +1,119 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// blake2FInput is the EIP-152 test input with the given rounds and final
+// flag: the state of BLAKE2b-512 hashing "abc" in one block
+func blake2FInput(rounds, final string) string {
+	return rounds +
+		"48c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b" +
+		"6162630000000000000000000000000000000000000000000000000000000000" + strings.Repeat("00", 96) +
+		"0300000000000000" + "0000000000000000" + final
+}
+
+func TestPrecompiles(t *testing.T) {
+	word := func(s string) string {
+		return strings.Repeat("0", 64-len(s)) + s
+	}
+	tests := []struct {
+		name  string
+		p     PrecompiledContract
+		input string
+		want  string
+		gas   uint64
+	}{
+		{"ecrecover", ecrecover{}, eip155Hash + word("1b") + eip155R + eip155S, word(strings.ToLower(eip155Address[2:])), EcrecoverGas},
+		{"ecrecover wrong v", ecrecover{}, eip155Hash + word("1d") + eip155R + eip155S, "", EcrecoverGas},
+		{"ecrecover v not a word", ecrecover{}, eip155Hash + "01" + word("1b")[2:] + eip155R + eip155S, "", EcrecoverGas},
+		{"ecrecover s zero", ecrecover{}, eip155Hash + word("1b") + eip155R + word(""), "", EcrecoverGas},
+
+		{"sha256", sha256hash{}, hex.EncodeToString([]byte("abc")), "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", 72},
+		{"sha256 empty", sha256hash{}, "", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", 60},
+
+		{"ripemd160 empty", ripemd160hash{}, "", word("9c1185a5c5e9fc54612808977ee8f548b2258d31"), 600},
+		{"ripemd160", ripemd160hash{}, hex.EncodeToString([]byte("abc")), word("8eb208f7e05d987a9b044a8e98c6b087f15a0bfc"), 720},
+		{"ripemd160 message digest", ripemd160hash{}, hex.EncodeToString([]byte("message digest")), word("5d0689ef49d2fae572b881b123a85ffa21595f36"), 720},
+
+		{"identity", dataCopy{}, strings.Repeat("ab", 33), strings.Repeat("ab", 33), 15 + 2*3},
+		{"identity empty", dataCopy{}, "", "", 15},
+
+		{"modexp", bigModExp{}, word("1") + word("1") + word("1") + "030507", "05", ModExpMinGas},
+		{"modexp zero modulus", bigModExp{}, word("1") + word("1") + word("1") + "030500", "00", ModExpMinGas},
+		// EIP-198: Fermat's little theorem with the secp256k1 field prime
+		{"modexp fermat", bigModExp{}, word("1") + word("20") + word("20") + "03" +
+			"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2e" +
+			"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", word("1"), 1360},
+		{"modexp no base or modulus", bigModExp{}, word("0") + word("20") + word("0"), "", ModExpMinGas},
+
+		// EIP-152
+		{"blake2f 0 rounds", blake2F{}, blake2FInput("00000000", "01"),
+			"08c9bcf367e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d282e6ad7f520e511f6c3e2b8c68059b9442be0454267ce079217e1319cde05b", 0},
+		{"blake2f 12 rounds", blake2F{}, blake2FInput("0000000c", "01"),
+			"ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923", 12},
+		{"blake2f not final", blake2F{}, blake2FInput("0000000c", "00"),
+			"75ab69d3190a562c51aef8d88f1c2775876944407270c42c9844252c26d2875298743e7f6d5ea2f2d3e8d226039cd31b4e426ac4f2d3d666a610c2116fde4735", 12},
+		{"blake2f 1 round", blake2F{}, blake2FInput("00000001", "01"),
+			"b63a380cb2897d521994a85234ee2c181b5f844d2c624c002677e9703449d2fba551b3a8333bcdf5f2f7e08993d53923de3d64fcc68c034e717b9293fed7a421", 1},
+	}
+	for _, tt := range tests {
+		input, err := hex.DecodeString(tt.input)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if gas := tt.p.RequiredGas(input); gas != tt.gas {
+			t.Fatalf("%s: gas %d, want %d", tt.name, gas, tt.gas)
+		}
+		out, err := tt.p.Run(nil, input)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := hex.EncodeToString(out); got != tt.want {
+			t.Fatalf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRipemd160Long(t *testing.T) {
+	got := Ripemd160(bytes.Repeat([]byte("a"), 1_000_000))
+	if want := "52783243c1697bdbe16d37f97f68f08325dc1528"; hex.EncodeToString(got) != want {
+		t.Fatalf("got %x, want %s", got, want)
+	}
+}
+
+func TestBlake2FErrors(t *testing.T) {
+	valid, _ := hex.DecodeString(blake2FInput("0000000c", "01"))
+	if _, err := (blake2F{}).Run(nil, valid[:212]); !errors.Is(err, errPrecompileInput) {
+		t.Fatalf("short input: got %v", err)
+	}
+	if _, err := (blake2F{}).Run(nil, append(valid, 0)); !errors.Is(err, errPrecompileInput) {
+		t.Fatalf("long input: got %v", err)
+	}
+	badFlag := append([]byte(nil), valid...)
+	badFlag[212] = 2
+	if _, err := (blake2F{}).Run(nil, badFlag); !errors.Is(err, errBlake2FFinalFlag) {
+		t.Fatalf("final flag 2: got %v", err)
+	}
+}
+
+func TestRegisterPrecompile(t *testing.T) {
+	e := NewEVM()
+	if err := e.RegisterPrecompile(BytesToAddress([]byte{0x01}), dataCopy{}); err == nil {
+		t.Fatal("replaced ecrecover")
+	}
+	if err := e.RegisterPrecompile(pointEvaluationAddress, dataCopy{}); err == nil {
+		t.Fatal("registered at the point evaluation address")
+	}
+	addr := BytesToAddress([]byte{0x0b})
+	if err := e.RegisterPrecompile(addr, dataCopy{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.RegisterPrecompile(addr, dataCopy{}); err == nil {
+		t.Fatal("registered twice at the same address")
+	}
+}
@@ -0,0 +1,137 @@
+package evm
+
+import "math/big"
+
+// Receipt statuses
+const (
+	ReceiptStatusFailed     = 0
+	ReceiptStatusSuccessful = 1
+)
+
+// Receipt records the outcome of an executed transaction
+type Receipt struct {
+	Type              uint8    `json:"type"`
+	TxHash            Hash     `json:"transaction_hash"`
+	TxIndex           uint     `json:"transaction_index"`
+	BlockNumber       uint64   `json:"block_number"`
+	From              Address  `json:"from"`
+	To                *Address `json:"to"`
+	ContractAddress   *Address `json:"contract_address,omitempty"`
+	Status            uint64   `json:"status"`
+	GasUsed           uint64   `json:"gas_used"`
+	EffectiveGasPrice *big.Int `json:"effective_gas_price"`
+	CumulativeGasUsed uint64   `json:"cumulative_gas_used"`
+	Logs              []*Log   `json:"logs"`
+	Bloom             Bloom    `json:"logs_bloom"`
+
+	result *TransactionResult
+}
+
+// blockReceipts holds the receipts of one block and the bloom of all
+// their logs
+type blockReceipts struct {
+	receipts []*Receipt
+	bloom    Bloom
+	logs     uint // number of logs, the index of the next one
+	gasUsed  uint64
+}
+
+// hash returns the hash of an unsigned transaction, which has no network
+// encoding to hash: the Keccak-256 hash of the RLP list of its fields and
+// sender, which the nonce makes unique per sender. Signed transactions
+// are identified by the hash of their encoding, see DecodeTransaction.
+func (tx *EVMTransaction) hash() Hash {
+	to := rlpEncodeBytes(nil)
+	if tx.To != nil {
+		to = rlpEncodeBytes(tx.To[:])
+	}
+	return BytesToHash(Keccak256(rlpEncodeList(
+		rlpEncodeUint(tx.Nonce),
+		rlpEncodeBig(tx.GasPrice),
+		rlpEncodeUint(tx.Gas),
+		to,
+		rlpEncodeBig(tx.Value),
+		rlpEncodeBytes(tx.Data),
+		rlpEncodeBytes(tx.From[:]),
+	)))
+}
+
+// encode returns the consensus encoding of the receipt, which the
+// receipts root commits to: the RLP list of status, cumulative gas used,
+// bloom and logs, prefixed with the type of typed transactions
+func (r *Receipt) encode() []byte {
+	logs := make([][]byte, len(r.Logs))
+	for i, log := range r.Logs {
+		topics := make([][]byte, len(log.Topics))
+		for j, topic := range log.Topics {
+			topics[j] = rlpEncodeBytes(topic[:])
+		}
+		logs[i] = rlpEncodeList(rlpEncodeBytes(log.Address[:]), rlpEncodeList(topics...), rlpEncodeBytes(log.Data))
+	}
+	enc := rlpEncodeList(
+		rlpEncodeUint(r.Status),
+		rlpEncodeUint(r.CumulativeGasUsed),
+		rlpEncodeBytes(r.Bloom[:]),
+		rlpEncodeList(logs...),
+	)
+	if r.Type != LegacyTxType {
+		return append([]byte{r.Type}, enc...)
+	}
+	return enc
+}
+
+// addReceipt appends the receipt of an executed transaction to its block,
+// numbering it and its logs and folding its bloom into the block's; the
+// caller holds mu
+func (e *EVM) addReceipt(receipt *Receipt) {
+	block := e.blocks[receipt.BlockNumber]
+	if block == nil {
+		block = new(blockReceipts)
+		e.blocks[receipt.BlockNumber] = block
+	}
+	receipt.TxIndex = uint(len(block.receipts))
+	block.gasUsed += receipt.GasUsed
+	receipt.CumulativeGasUsed = block.gasUsed
+	for _, log := range receipt.Logs {
+		log.BlockNumber = receipt.BlockNumber
+		log.TxHash = receipt.TxHash
+		log.TxIndex = receipt.TxIndex
+		log.Index = block.logs
+		block.logs++
+	}
+	receipt.Bloom = CreateBloom(receipt.Logs)
+	block.bloom.Or(receipt.Bloom)
+	block.receipts = append(block.receipts, receipt)
+	e.receipts[receipt.TxHash] = receipt
+}
+
+// GetReceipt returns the receipt of a transaction, nil if it is unknown
+func (e *EVM) GetReceipt(txHash Hash) *Receipt {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.receipts[txHash]
+}
+
+// GetTransactionResult returns the result of an executed transaction,
+// including its output, nil if it is unknown
+func (e *EVM) GetTransactionResult(txHash Hash) *TransactionResult {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if receipt := e.receipts[txHash]; receipt != nil {
+		return receipt.result
+	}
+	return nil
+}
+
+// GetBlockReceipts returns the receipts of the transactions executed in a
+// block, in order, and the bloom of their logs
+func (e *EVM) GetBlockReceipts(number uint64) ([]*Receipt, Bloom) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	block := e.blocks[number]
+	if block == nil {
+		return nil, Bloom{}
+	}
+	return append([]*Receipt(nil), block.receipts...), block.bloom
+}
@@ -0,0 +1,121 @@
+package evm
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+)
+
+// Selectors of the revert payloads Solidity produces itself: Error(string)
+// from require and revert, Panic(uint256) from failed asserts and checked
+// arithmetic
+var (
+	errorSelector = Keccak256([]byte("Error(string)"))[:4]
+	panicSelector = Keccak256([]byte("Panic(uint256)"))[:4]
+)
+
+// panicReasons describes Solidity's panic codes
+var panicReasons = map[uint64]string{
+	0x00: "generic panic",
+	0x01: "assert(false)",
+	0x11: "arithmetic underflow or overflow",
+	0x12: "division or modulo by zero",
+	0x21: "enum overflow",
+	0x22: "invalid encoded storage byte array accessed",
+	0x31: "out-of-bounds array access; popping on an empty array",
+	0x32: "out-of-bounds access of an array or bytesSlice",
+	0x41: "out of memory",
+	0x51: "uninitialized function",
+}
+
+// Kinds of revert payload
+const (
+	RevertKindNone   = ""       // no data, or too short to have a selector
+	RevertKindError  = "error"  // Error(string)
+	RevertKindPanic  = "panic"  // Panic(uint256)
+	RevertKindCustom = "custom" // a custom error, identified by its selector
+)
+
+// RevertError is an execution that ended in REVERT, with the data it
+// returned decoded as far as possible
+type RevertError struct {
+	Kind string `json:"kind,omitempty"`
+	// Reason is the message of an Error(string), or what a panic code means
+	Reason    string   `json:"reason,omitempty"`
+	PanicCode *big.Int `json:"panic_code,omitempty"`
+	// Selector identifies the error of a custom error or malformed payload
+	Selector Bytes `json:"selector,omitempty"`
+	Data     Bytes `json:"data"`
+}
+
+// NewRevertError decodes revert data
+func NewRevertError(data []byte) *RevertError {
+	e := &RevertError{Data: data}
+	if len(data) < 4 {
+		return e
+	}
+	if reason, ok := UnpackRevert(data); ok {
+		e.Kind, e.Reason = RevertKindError, reason
+		return e
+	}
+	if code, ok := UnpackPanic(data); ok {
+		e.Kind, e.PanicCode = RevertKindPanic, code
+		if code.IsUint64() {
+			e.Reason = panicReasons[code.Uint64()]
+		}
+		if e.Reason == "" {
+			e.Reason = "unknown panic code"
+		}
+		return e
+	}
+	e.Kind, e.Selector = RevertKindCustom, data[:4]
+	return e
+}
+
+func (e *RevertError) Error() string {
+	switch e.Kind {
+	case RevertKindError:
+		return ErrExecutionReverted.Error() + ": " + e.Reason
+	case RevertKindPanic:
+		return fmt.Sprintf("%v: panic: %s (%#x)", ErrExecutionReverted, e.Reason, e.PanicCode)
+	case RevertKindCustom:
+		return fmt.Sprintf("%v: custom error %v", ErrExecutionReverted, e.Selector)
+	}
+	return ErrExecutionReverted.Error()
+}
+
+// Unwrap makes errors.Is(err, ErrExecutionReverted) hold
+func (e *RevertError) Unwrap() error {
+	return ErrExecutionReverted
+}
+
+// UnpackRevert decodes the message of an Error(string) revert payload.
+// It reports false when the data is not such a payload.
+func UnpackRevert(data []byte) (string, bool) {
+	if len(data) < 4 || !bytes.Equal(data[:4], errorSelector) {
+		return "", false
+	}
+	args := data[4:]
+	if len(args) < 64 {
+		return "", false
+	}
+	offset := new(big.Int).SetBytes(args[:32])
+	if !offset.IsUint64() || offset.Uint64() > uint64(len(args))-32 {
+		return "", false
+	}
+	start := offset.Uint64()
+	size := new(big.Int).SetBytes(args[start : start+32])
+	if !size.IsUint64() || size.Uint64() > uint64(len(args))-start-32 {
+		return "", false
+	}
+	return string(args[start+32 : start+32+size.Uint64()]), true
+}
+
+// UnpackPanic decodes the code of a Panic(uint256) revert payload. It
+// reports false when the data is not such a payload.
+func UnpackPanic(data []byte) (*big.Int, bool) {
+	if len(data) != 4+32 || !bytes.Equal(data[:4], panicSelector) {
+		return nil, false
+	}
+	return new(big.Int).SetBytes(data[4:]), true
+}
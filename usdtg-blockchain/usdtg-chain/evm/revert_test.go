@@ -0,0 +1,122 @@
+package evm
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// revertCalldata is runtime code that reverts with its calldata
+var revertCalldata = []byte{
+	byte(CALLDATASIZE), byte(PUSH1), 0, byte(PUSH1), 0, byte(CALLDATACOPY),
+	byte(CALLDATASIZE), byte(PUSH1), 0, byte(REVERT),
+}
+
+// errorPayload is the revert data of require(false, "not enough")
+const errorPayload = "08c379a0" +
+	"0000000000000000000000000000000000000000000000000000000000000020" +
+	"000000000000000000000000000000000000000000000000000000000000000a" +
+	"6e6f7420656e6f75676800000000000000000000000000000000000000000000"
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex %q", s)
+	}
+	return b
+}
+
+func TestNewRevertError(t *testing.T) {
+	if hex.EncodeToString(errorSelector) != "08c379a0" || hex.EncodeToString(panicSelector) != "4e487b71" {
+		t.Fatalf("selectors %x and %x", errorSelector, panicSelector)
+	}
+
+	panicPayload := func(code string) string { return "4e487b71" + word(code) }
+	tests := []struct {
+		name     string
+		data     string
+		kind     string
+		reason   string
+		selector string
+		message  string
+	}{
+		{"empty", "", RevertKindNone, "", "", "execution reverted"},
+		{"shorter than a selector", "08c379", RevertKindNone, "", "", "execution reverted"},
+		{"Error(string)", errorPayload, RevertKindError, "not enough", "", "execution reverted: not enough"},
+		{"assert", panicPayload("01"), RevertKindPanic, "assert(false)", "", "execution reverted: panic: assert(false) (0x1)"},
+		{"overflow", panicPayload("11"), RevertKindPanic, "arithmetic underflow or overflow", "", "execution reverted: panic: arithmetic underflow or overflow (0x11)"},
+		{"unknown panic", panicPayload("99"), RevertKindPanic, "unknown panic code", "", "execution reverted: panic: unknown panic code (0x99)"},
+		{"custom error", "cafebabe" + word("2a"), RevertKindCustom, "", "cafebabe", "execution reverted: custom error 0xcafebabe"},
+		// Malformed standard payloads are reported by their selector
+		{"Error with a bad offset", "08c379a0" + word("40") + word("00"), RevertKindCustom, "", "08c379a0", ""},
+		{"Error with a long size", "08c379a0" + word("20") + word("21") + word("00"), RevertKindCustom, "", "08c379a0", ""},
+		{"Panic with extra data", panicPayload("01") + "00", RevertKindCustom, "", "4e487b71", ""},
+	}
+	for _, tt := range tests {
+		data := mustHex(t, tt.data)
+		err := NewRevertError(data)
+		if err.Kind != tt.kind || err.Reason != tt.reason || hex.EncodeToString(err.Selector) != tt.selector {
+			t.Errorf("%s: decoded %+v", tt.name, err)
+		}
+		if tt.message != "" && err.Error() != tt.message {
+			t.Errorf("%s: message %q, want %q", tt.name, err.Error(), tt.message)
+		}
+		if hex.EncodeToString(err.Data) != tt.data {
+			t.Errorf("%s: data %x", tt.name, err.Data)
+		}
+		if !errors.Is(err, ErrExecutionReverted) || ErrorCode(err) != "execution_reverted" {
+			t.Errorf("%s: %v is not a revert", tt.name, err)
+		}
+	}
+
+	if code := NewRevertError(mustHex(t, panicPayload("12"))).PanicCode; code == nil || code.Cmp(big.NewInt(0x12)) != 0 {
+		t.Fatalf("panic code %v", code)
+	}
+}
+
+func TestRevertResult(t *testing.T) {
+	e := newTestEVM()
+	contract := *execute(t, e, nil, 0, initCode(revertCalldata)).ContractAddress
+	result := applyTx(t, e, &EVMTransaction{
+		From:     testSender,
+		To:       &contract,
+		Value:    new(big.Int),
+		Data:     mustHex(t, errorPayload),
+		Gas:      100_000,
+		GasPrice: new(big.Int),
+		Nonce:    e.GetNonce(testSender),
+	})
+	if result.Success || result.Revert == nil || result.Revert.Reason != "not enough" {
+		t.Fatalf("result %+v", result)
+	}
+	if result.ErrorCode != "execution_reverted" || result.Error != "execution reverted: not enough" {
+		t.Fatalf("error %q (%s)", result.Error, result.ErrorCode)
+	}
+	var revert *RevertError
+	if !errors.As(result.Err, &revert) || revert != result.Revert {
+		t.Fatalf("Err is %v", result.Err)
+	}
+	// A revert returns the unused gas
+	if result.GasUsed >= 50_000 {
+		t.Fatalf("revert used %d gas", result.GasUsed)
+	}
+
+	// Other failures have no revert data and use all the gas
+	result = applyTx(t, e, &EVMTransaction{
+		From:     testSender,
+		To:       &contract,
+		Value:    new(big.Int),
+		Data:     make([]byte, 4096),
+		Gas:      TxGas + 4096*TxDataZeroGas + 10,
+		GasPrice: new(big.Int),
+		Nonce:    e.GetNonce(testSender),
+	})
+	if result.Success || result.Revert != nil || result.ErrorCode != "out_of_gas" || !errors.Is(result.Err, ErrOutOfGas) {
+		t.Fatalf("out of gas result %+v", result)
+	}
+	if result.GasUsed != TxGas+4096*TxDataZeroGas+10 {
+		t.Fatalf("out of gas used %d gas", result.GasUsed)
+	}
+}
@@ -0,0 +1,198 @@
+package evm
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+// Recursive Length Prefix encoding, as used to derive contract addresses
+// and to encode transactions
+
+// rlpEncodeBytes encodes a byte string. A single byte below 0x80 is its
+// own encoding.
+func rlpEncodeBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return []byte{b[0]}
+	}
+	return append(rlpHeader(0x80, len(b)), b...)
+}
+
+// rlpEncodeUint encodes an integer as its big endian bytes without
+// leading zeros; zero is the empty string
+func rlpEncodeUint(u uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], u)
+	i := 0
+	for i < len(buf) && buf[i] == 0 {
+		i++
+	}
+	return rlpEncodeBytes(buf[i:])
+}
+
+// rlpEncodeBig encodes a non-negative integer like rlpEncodeUint; nil is
+// zero
+func rlpEncodeBig(b *big.Int) []byte {
+	if b == nil {
+		return rlpEncodeBytes(nil)
+	}
+	return rlpEncodeBytes(b.Bytes())
+}
+
+// rlpEncodeList encodes a list of already encoded items
+func rlpEncodeList(items ...[]byte) []byte {
+	size := 0
+	for _, item := range items {
+		size += len(item)
+	}
+	out := rlpHeader(0xc0, size)
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+// rlpHeader returns the prefix for a string (offset 0x80) or list (offset
+// 0xc0) payload of the given size
+func rlpHeader(offset byte, size int) []byte {
+	if size < 56 {
+		return []byte{offset + byte(size)}
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(size))
+	i := 0
+	for buf[i] == 0 {
+		i++
+	}
+	return append([]byte{offset + 55 + byte(8-i)}, buf[i:]...)
+}
+
+// RLP decoding errors
+var (
+	ErrRLPTooShort      = errors.New("rlp: value size exceeds available input")
+	ErrRLPNonCanonical  = errors.New("rlp: non-canonical encoding")
+	ErrRLPExpectedList  = errors.New("rlp: expected list")
+	ErrRLPExpectedBytes = errors.New("rlp: expected string")
+	ErrRLPTrailingBytes = errors.New("rlp: input contains more than one value")
+)
+
+// rlpSplit splits the first value off b, returning whether it is a list,
+// its payload and the remaining input. Only canonical encodings are
+// accepted.
+func rlpSplit(b []byte) (list bool, content, rest []byte, err error) {
+	if len(b) == 0 {
+		return false, nil, nil, ErrRLPTooShort
+	}
+	prefix := b[0]
+	var offset, size uint64
+	switch {
+	case prefix < 0x80:
+		return false, b[:1], b[1:], nil
+	case prefix < 0xb8:
+		offset, size = 1, uint64(prefix-0x80)
+		if size == 1 && len(b) > 1 && b[1] < 0x80 {
+			return false, nil, nil, ErrRLPNonCanonical
+		}
+	case prefix < 0xc0:
+		offset, size, err = rlpLongSize(b, prefix-0xb7)
+	case prefix < 0xf8:
+		list, offset, size = true, 1, uint64(prefix-0xc0)
+	default:
+		list = true
+		offset, size, err = rlpLongSize(b, prefix-0xf7)
+	}
+	if err != nil {
+		return false, nil, nil, err
+	}
+	if size > uint64(len(b))-offset {
+		return false, nil, nil, ErrRLPTooShort
+	}
+	return list, b[offset : offset+size], b[offset+size:], nil
+}
+
+// rlpLongSize reads the big endian size of a long string or list
+func rlpLongSize(b []byte, sizeLen byte) (offset, size uint64, err error) {
+	if uint64(len(b)) < 1+uint64(sizeLen) {
+		return 0, 0, ErrRLPTooShort
+	}
+	if b[1] == 0 {
+		return 0, 0, ErrRLPNonCanonical
+	}
+	for _, c := range b[1 : 1+sizeLen] {
+		if size > (1<<56)-1 {
+			return 0, 0, ErrRLPTooShort
+		}
+		size = size<<8 | uint64(c)
+	}
+	if size < 56 {
+		return 0, 0, ErrRLPNonCanonical
+	}
+	return 1 + uint64(sizeLen), size, nil
+}
+
+// rlpDecodeList decodes b as a single list and returns the raw encodings
+// of its items
+func rlpDecodeList(b []byte) ([][]byte, error) {
+	list, content, rest, err := rlpSplit(b)
+	if err != nil {
+		return nil, err
+	}
+	if !list {
+		return nil, ErrRLPExpectedList
+	}
+	if len(rest) > 0 {
+		return nil, ErrRLPTrailingBytes
+	}
+	var items [][]byte
+	for len(content) > 0 {
+		_, _, next, err := rlpSplit(content)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, content[:len(content)-len(next)])
+		content = next
+	}
+	return items, nil
+}
+
+// rlpDecodeBytes decodes an item holding a string
+func rlpDecodeBytes(item []byte) ([]byte, error) {
+	list, content, rest, err := rlpSplit(item)
+	if err != nil {
+		return nil, err
+	}
+	if list {
+		return nil, ErrRLPExpectedBytes
+	}
+	if len(rest) > 0 {
+		return nil, ErrRLPTrailingBytes
+	}
+	return content, nil
+}
+
+// rlpDecodeBig decodes an item holding an integer of at most 256 bits
+func rlpDecodeBig(item []byte) (*big.Int, error) {
+	b, err := rlpDecodeBytes(item)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > 0 && b[0] == 0 {
+		return nil, ErrRLPNonCanonical
+	}
+	if len(b) > 32 {
+		return nil, errors.New("rlp: integer exceeds 256 bits")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// rlpDecodeUint decodes an item holding an integer of at most 64 bits
+func rlpDecodeUint(item []byte) (uint64, error) {
+	n, err := rlpDecodeBig(item)
+	if err != nil {
+		return 0, err
+	}
+	if !n.IsUint64() {
+		return 0, errors.New("rlp: integer exceeds 64 bits")
+	}
+	return n.Uint64(), nil
+}
@@ -0,0 +1,182 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// lorem is 56 bytes, the shortest string with a long header
+const lorem = "Lorem ipsum dolor sit amet, consectetur adipisicing elit"
+
+func TestRLPEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		{"empty string", rlpEncodeBytes(nil), "80"},
+		{"single byte", rlpEncodeBytes([]byte{0x0f}), "0f"},
+		{"byte 0x80", rlpEncodeBytes([]byte{0x80}), "8180"},
+		{"dog", rlpEncodeBytes([]byte("dog")), "83646f67"},
+		{"long string", rlpEncodeBytes([]byte(lorem)), "b838" + hex.EncodeToString([]byte(lorem))},
+		{"zero", rlpEncodeUint(0), "80"},
+		{"15", rlpEncodeUint(15), "0f"},
+		{"1024", rlpEncodeUint(1024), "820400"},
+		{"nil big", rlpEncodeBig(nil), "80"},
+		{"2^64", rlpEncodeBig(new(big.Int).Lsh(big.NewInt(1), 64)), "89010000000000000000"},
+		{"empty list", rlpEncodeList(), "c0"},
+		{"cat dog", rlpEncodeList(rlpEncodeBytes([]byte("cat")), rlpEncodeBytes([]byte("dog"))), "c88363617483646f67"},
+		{"nested", rlpEncodeList(rlpEncodeList(), rlpEncodeList(rlpEncodeList())), "c3c0c1c0"},
+		{"long list", rlpEncodeList(rlpEncodeBytes([]byte(lorem))), "f83ab838" + hex.EncodeToString([]byte(lorem))},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(tt.got); got != tt.want {
+			t.Errorf("%s: encoded %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRLPDecode(t *testing.T) {
+	items, err := rlpDecodeList(rlpEncodeList(
+		rlpEncodeBytes([]byte(lorem)), rlpEncodeUint(1024), rlpEncodeBig(new(big.Int).Lsh(big.NewInt(1), 255)), rlpEncodeList(),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 4 {
+		t.Fatalf("decoded %d items, want 4", len(items))
+	}
+	if s, err := rlpDecodeBytes(items[0]); err != nil || string(s) != lorem {
+		t.Fatalf("item 0 = %q, %v", s, err)
+	}
+	if n, err := rlpDecodeUint(items[1]); err != nil || n != 1024 {
+		t.Fatalf("item 1 = %d, %v", n, err)
+	}
+	if n, err := rlpDecodeBig(items[2]); err != nil || n.Cmp(new(big.Int).Lsh(big.NewInt(1), 255)) != 0 {
+		t.Fatalf("item 2 = %v, %v", n, err)
+	}
+	if inner, err := rlpDecodeList(items[3]); err != nil || len(inner) != 0 {
+		t.Fatalf("item 3 = %x, %v", inner, err)
+	}
+	if n, err := rlpDecodeUint([]byte{0x80}); err != nil || n != 0 {
+		t.Fatalf("empty string as an integer = %d, %v", n, err)
+	}
+}
+
+func TestRLPDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode func([]byte) error
+		input  string
+		want   error
+	}{
+		{"empty input", decodeBytes, "", ErrRLPTooShort},
+		{"short string", decodeBytes, "83646f", ErrRLPTooShort},
+		{"short list", decodeList, "c883636174", ErrRLPTooShort},
+		{"short size", decodeBytes, "b9ff", ErrRLPTooShort},
+		{"single byte with a header", decodeBytes, "8105", ErrRLPNonCanonical},
+		{"long header for a short string", decodeBytes, "b803646f67", ErrRLPNonCanonical},
+		{"size with a leading zero", decodeBytes, "b90038" + hex.EncodeToString([]byte(lorem)), ErrRLPNonCanonical},
+		{"long header for a short list", decodeList, "f803c0c0c0", ErrRLPNonCanonical},
+		{"integer with a leading zero", decodeUint, "820001", ErrRLPNonCanonical},
+		{"list as a string", decodeBytes, "c0", ErrRLPExpectedBytes},
+		{"string as a list", decodeList, "83646f67", ErrRLPExpectedList},
+		{"trailing bytes after a list", decodeList, "c000", ErrRLPTrailingBytes},
+		{"trailing bytes after a string", decodeBytes, "83646f6700", ErrRLPTrailingBytes},
+		{"bad item in a list", decodeList, "c28105", ErrRLPNonCanonical},
+	}
+	for _, tt := range tests {
+		input, _ := hex.DecodeString(tt.input)
+		if err := tt.decode(input); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// Integers are limited to their field sizes
+	if _, err := rlpDecodeBig(rlpEncodeBytes(bytes.Repeat([]byte{1}, 33))); err == nil || !strings.Contains(err.Error(), "256 bits") {
+		t.Errorf("33 byte integer: got %v", err)
+	}
+	if _, err := rlpDecodeUint(rlpEncodeBig(new(big.Int).Lsh(big.NewInt(1), 64))); err == nil || !strings.Contains(err.Error(), "64 bits") {
+		t.Errorf("2^64 as a uint64: got %v", err)
+	}
+}
+
+func decodeBytes(b []byte) error {
+	_, err := rlpDecodeBytes(b)
+	return err
+}
+
+func decodeList(b []byte) error {
+	_, err := rlpDecodeList(b)
+	return err
+}
+
+func decodeUint(b []byte) error {
+	_, err := rlpDecodeUint(b)
+	return err
+}
+
+func TestTransactionEncodingRoundTrip(t *testing.T) {
+	raw, _ := hex.DecodeString(eip155Raw)
+	tx, err := DecodeTransaction(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tx.encode(); !bytes.Equal(got, raw) {
+		t.Fatalf("legacy transaction re-encoded as %x", got)
+	}
+
+	to := BytesToAddress([]byte{0x35})
+	typed := []*EVMTransaction{
+		{
+			Type: AccessListTxType, ChainID: big.NewInt(1337), Nonce: 3, GasPrice: big.NewInt(7), Gas: 50_000,
+			To: &to, Value: big.NewInt(1), Data: []byte{0xde, 0xad},
+			V: big.NewInt(1), R: big.NewInt(2), S: big.NewInt(3),
+			AccessList: AccessList{{Address: to, StorageKeys: []Hash{{}, BytesToHash([]byte{9})}}},
+		},
+		{
+			Type: DynamicFeeTxType, ChainID: big.NewInt(1337), Nonce: 4, GasTipCap: big.NewInt(2), GasFeeCap: big.NewInt(100),
+			Gas: 60_000, Value: new(big.Int), Data: []byte(lorem), AccessList: AccessList{},
+			V: new(big.Int), R: big.NewInt(5), S: big.NewInt(6),
+		},
+	}
+	for _, want := range typed {
+		encoded := want.encode()
+		got, err := DecodeTransaction(encoded)
+		if err != nil {
+			t.Fatalf("type %d: %v", want.Type, err)
+		}
+		if !bytes.Equal(got.encode(), encoded) {
+			t.Fatalf("type %d: re-encoded as %x, want %x", want.Type, got.encode(), encoded)
+		}
+		if got.Hash != BytesToHash(Keccak256(encoded)) {
+			t.Fatalf("type %d: hash %s", want.Type, got.Hash)
+		}
+		if (got.To == nil) != (want.To == nil) || got.Nonce != want.Nonce || got.AccessList.StorageKeys() != want.AccessList.StorageKeys() {
+			t.Fatalf("type %d: decoded %+v", want.Type, got)
+		}
+	}
+
+	invalid := []struct {
+		name  string
+		input []byte
+	}{
+		{"empty", nil},
+		{"unknown type", append([]byte{0x05}, rlpEncodeList()...)},
+		{"missing fields", rlpEncodeList(rlpEncodeUint(1))},
+		{"short recipient", rlpEncodeList(
+			rlpEncodeUint(0), rlpEncodeUint(1), rlpEncodeUint(21000), rlpEncodeBytes([]byte{1, 2}),
+			rlpEncodeUint(0), rlpEncodeBytes(nil), rlpEncodeUint(27), rlpEncodeUint(1), rlpEncodeUint(1),
+		)},
+		{"truncated", raw[:len(raw)-1]},
+	}
+	for _, tt := range invalid {
+		if _, err := DecodeTransaction(tt.input); err == nil {
+			t.Errorf("%s: decoded", tt.name)
+		}
+	}
+}
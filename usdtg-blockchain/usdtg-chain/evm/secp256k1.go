@@ -0,0 +1,180 @@
+package evm
+
+import "math/big"
+
+// secp256k1, the curve y² = x³ + 7 over the field of size p, on which
+// Ethereum accounts sign. Only public key recovery is implemented; points
+// are kept in Jacobian coordinates (x = X/Z², y = Y/Z³) so that scalar
+// multiplication needs no field inversions until the end.
+
+var (
+	secp256k1P, _      = new(big.Int).SetString("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", 16)
+	secp256k1N, _      = new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+	secp256k1HalfN     = new(big.Int).Rsh(secp256k1N, 1)
+	secp256k1Gx, _     = new(big.Int).SetString("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", 16)
+	secp256k1Gy, _     = new(big.Int).SetString("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8", 16)
+	secp256k1SqrtExp   = new(big.Int).Rsh(new(big.Int).Add(secp256k1P, big.NewInt(1)), 2)
+	secp256k1Generator = &jacobianPoint{x: secp256k1Gx, y: secp256k1Gy, z: big.NewInt(1)}
+)
+
+// jacobianPoint is a curve point; z is zero for the point at infinity
+type jacobianPoint struct {
+	x, y, z *big.Int
+}
+
+func (pt *jacobianPoint) infinity() bool {
+	return pt.z.Sign() == 0
+}
+
+func infinityPoint() *jacobianPoint {
+	return &jacobianPoint{x: new(big.Int), y: new(big.Int), z: new(big.Int)}
+}
+
+// fieldMod reduces v modulo p in place
+func fieldMod(v *big.Int) *big.Int {
+	return v.Mod(v, secp256k1P)
+}
+
+// double returns 2·pt
+func (pt *jacobianPoint) double() *jacobianPoint {
+	if pt.infinity() || pt.y.Sign() == 0 {
+		return infinityPoint()
+	}
+	a := fieldMod(new(big.Int).Mul(pt.x, pt.x))
+	b := fieldMod(new(big.Int).Mul(pt.y, pt.y))
+	c := fieldMod(new(big.Int).Mul(b, b))
+	d := new(big.Int).Add(pt.x, b)
+	d.Mul(d, d).Sub(d, a).Sub(d, c).Lsh(d, 1)
+	fieldMod(d)
+	e := new(big.Int).Mul(a, big.NewInt(3))
+	f := fieldMod(new(big.Int).Mul(e, e))
+
+	x3 := new(big.Int).Sub(f, new(big.Int).Lsh(d, 1))
+	fieldMod(x3)
+	y3 := new(big.Int).Sub(d, x3)
+	y3.Mul(y3, e).Sub(y3, new(big.Int).Lsh(c, 3))
+	fieldMod(y3)
+	z3 := new(big.Int).Mul(pt.y, pt.z)
+	fieldMod(z3.Lsh(z3, 1))
+	return &jacobianPoint{x: x3, y: y3, z: z3}
+}
+
+// add returns pt + q
+func (pt *jacobianPoint) add(q *jacobianPoint) *jacobianPoint {
+	if pt.infinity() {
+		return q
+	}
+	if q.infinity() {
+		return pt
+	}
+	z1z1 := fieldMod(new(big.Int).Mul(pt.z, pt.z))
+	z2z2 := fieldMod(new(big.Int).Mul(q.z, q.z))
+	u1 := fieldMod(new(big.Int).Mul(pt.x, z2z2))
+	u2 := fieldMod(new(big.Int).Mul(q.x, z1z1))
+	s1 := fieldMod(new(big.Int).Mul(pt.y, q.z))
+	fieldMod(s1.Mul(s1, z2z2))
+	s2 := fieldMod(new(big.Int).Mul(q.y, pt.z))
+	fieldMod(s2.Mul(s2, z1z1))
+
+	if u1.Cmp(u2) == 0 {
+		if s1.Cmp(s2) == 0 {
+			return pt.double()
+		}
+		return infinityPoint()
+	}
+
+	h := fieldMod(new(big.Int).Sub(u2, u1))
+	i := new(big.Int).Lsh(h, 1)
+	fieldMod(i.Mul(i, i))
+	j := fieldMod(new(big.Int).Mul(h, i))
+	r := new(big.Int).Sub(s2, s1)
+	fieldMod(r.Lsh(r, 1))
+	v := fieldMod(new(big.Int).Mul(u1, i))
+
+	x3 := new(big.Int).Mul(r, r)
+	x3.Sub(x3, j).Sub(x3, new(big.Int).Lsh(v, 1))
+	fieldMod(x3)
+	y3 := new(big.Int).Sub(v, x3)
+	y3.Mul(y3, r).Sub(y3, new(big.Int).Lsh(new(big.Int).Mul(s1, j), 1))
+	fieldMod(y3)
+	z3 := new(big.Int).Add(pt.z, q.z)
+	z3.Mul(z3, z3).Sub(z3, z1z1).Sub(z3, z2z2).Mul(z3, h)
+	fieldMod(z3)
+	return &jacobianPoint{x: x3, y: y3, z: z3}
+}
+
+// mul returns k·pt by double-and-add
+func (pt *jacobianPoint) mul(k *big.Int) *jacobianPoint {
+	result := infinityPoint()
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		result = result.double()
+		if k.Bit(i) == 1 {
+			result = result.add(pt)
+		}
+	}
+	return result
+}
+
+// affine returns the point's x and y coordinates
+func (pt *jacobianPoint) affine() (x, y *big.Int) {
+	zinv := new(big.Int).ModInverse(pt.z, secp256k1P)
+	zinv2 := fieldMod(new(big.Int).Mul(zinv, zinv))
+	x = fieldMod(new(big.Int).Mul(pt.x, zinv2))
+	y = fieldMod(new(big.Int).Mul(pt.y, zinv2))
+	fieldMod(y.Mul(y, zinv))
+	return x, y
+}
+
+// RecoverPubkey returns the uncompressed public key, x and y as 32 bytes
+// each, whose key signed hash with (r, s). recid is the recovery id: bit
+// 0 is the parity of the signature point's y, bit 1 whether its x
+// overflowed the group order. Any s in [1, n) is accepted.
+func RecoverPubkey(hash []byte, r, s *big.Int, recid byte) ([]byte, error) {
+	if recid > 3 || r.Sign() <= 0 || r.Cmp(secp256k1N) >= 0 || s.Sign() <= 0 || s.Cmp(secp256k1N) >= 0 {
+		return nil, ErrInvalidSignature
+	}
+
+	// The signature point R has x coordinate r (or r + n) and the y of
+	// the given parity
+	x := new(big.Int).Set(r)
+	if recid&2 != 0 {
+		x.Add(x, secp256k1N)
+		if x.Cmp(secp256k1P) >= 0 {
+			return nil, ErrInvalidSignature
+		}
+	}
+	rhs := new(big.Int).Exp(x, big.NewInt(3), secp256k1P)
+	fieldMod(rhs.Add(rhs, big.NewInt(7)))
+	y := new(big.Int).Exp(rhs, secp256k1SqrtExp, secp256k1P)
+	if fieldMod(new(big.Int).Mul(y, y)).Cmp(rhs) != 0 {
+		return nil, ErrInvalidSignature
+	}
+	if y.Bit(0) != uint(recid&1) {
+		y.Sub(secp256k1P, y)
+	}
+	point := &jacobianPoint{x: x, y: y, z: big.NewInt(1)}
+
+	// Q = r⁻¹(s·R - e·G)
+	rinv := new(big.Int).ModInverse(r, secp256k1N)
+	e := new(big.Int).SetBytes(hash)
+	u1 := new(big.Int).Mul(e, rinv)
+	u1.Neg(u1).Mod(u1, secp256k1N)
+	u2 := new(big.Int).Mul(s, rinv)
+	u2.Mod(u2, secp256k1N)
+	q := secp256k1Generator.mul(u1).add(point.mul(u2))
+	if q.infinity() {
+		return nil, ErrInvalidSignature
+	}
+
+	qx, qy := q.affine()
+	pub := make([]byte, 64)
+	qx.FillBytes(pub[:32])
+	qy.FillBytes(pub[32:])
+	return pub, nil
+}
+
+// PubkeyToAddress derives the address of an uncompressed public key: the
+// last 20 bytes of its Keccak-256 hash
+func PubkeyToAddress(pub []byte) Address {
+	return BytesToAddress(Keccak256(pub)[12:])
+}
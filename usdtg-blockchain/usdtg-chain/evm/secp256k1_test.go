@@ -0,0 +1,97 @@
+package evm
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// The example transaction of EIP-155: nonce 9, gas price 20 gwei, gas
+// 21000, 1 ether to 0x3535…35 on chain 1, signed with the key 0x4646…46
+const (
+	eip155Raw     = "f86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83"
+	eip155Hash    = "daf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53"
+	eip155R       = "28ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276"
+	eip155S       = "67cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83"
+	eip155Pubkey  = "4bc2a31265153f07e70e0bab08724e6b85e217f8cd628ceb62974247bb493382ce28cab79ad7119ee1ad3ebcdb98a16805211530ecc6cfefa1b88e6dff99232a"
+	eip155Address = "0x9d8A62f656a8d1615C1294fd71e9CFb3E4855A4F"
+)
+
+func hexBig(t *testing.T, s string) *big.Int {
+	t.Helper()
+	v, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("invalid hex %q", s)
+	}
+	return v
+}
+
+func TestRecoverPubkey(t *testing.T) {
+	hash, _ := hex.DecodeString(eip155Hash)
+	r, s := hexBig(t, eip155R), hexBig(t, eip155S)
+
+	pub, err := RecoverPubkey(hash, r, s, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(pub); got != eip155Pubkey {
+		t.Fatalf("recovered %s, want %s", got, eip155Pubkey)
+	}
+	if got := PubkeyToAddress(pub).Hex(); got != eip155Address {
+		t.Fatalf("address %s, want %s", got, eip155Address)
+	}
+
+	// The other recovery id yields another key
+	if other, err := RecoverPubkey(hash, r, s, 1); err == nil && hex.EncodeToString(other) == eip155Pubkey {
+		t.Fatal("recovery id 1 recovered the same key")
+	}
+
+	invalid := []struct {
+		name  string
+		r, s  *big.Int
+		recid byte
+	}{
+		{"zero r", new(big.Int), s, 0},
+		{"s = n", r, secp256k1N, 0},
+		{"recovery id 4", r, s, 4},
+		// r + n is not below p
+		{"overflowed r", r, s, 2},
+	}
+	for _, tt := range invalid {
+		if _, err := RecoverPubkey(hash, tt.r, tt.s, tt.recid); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, ErrInvalidSignature)
+		}
+	}
+}
+
+func TestPubkeyToAddress(t *testing.T) {
+	// The key of private key 1 is the generator
+	pub := append(secp256k1Gx.FillBytes(make([]byte, 32)), secp256k1Gy.FillBytes(make([]byte, 32))...)
+	if got, want := PubkeyToAddress(pub).Hex(), "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf"; got != want {
+		t.Fatalf("address %s, want %s", got, want)
+	}
+}
+
+func TestSenderEIP155(t *testing.T) {
+	raw, _ := hex.DecodeString(eip155Raw)
+	tx, err := DecodeTransaction(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tx.signingHash(big.NewInt(1)); hex.EncodeToString(got[:]) != eip155Hash {
+		t.Fatalf("signing hash %x, want %s", got, eip155Hash)
+	}
+	from, err := Sender(tx, big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := from.Hex(); got != eip155Address {
+		t.Fatalf("sender %s, want %s", got, eip155Address)
+	}
+
+	tx, _ = DecodeTransaction(raw)
+	if _, err := Sender(tx, big.NewInt(1337)); !errors.Is(err, ErrInvalidChainID) {
+		t.Fatalf("sender on another chain: got %v, want %v", err, ErrInvalidChainID)
+	}
+}
@@ -0,0 +1,50 @@
+package evm
+
+import "math/big"
+
+// stackLimit is the maximum number of words on the stack
+const stackLimit = 1024
+
+// Stack is the EVM operand stack. Every word is kept in [0, 2^256).
+type Stack struct {
+	data []*big.Int
+}
+
+func newStack() *Stack {
+	return &Stack{data: make([]*big.Int, 0, 16)}
+}
+
+func (s *Stack) push(v *big.Int) {
+	s.data = append(s.data, v)
+}
+
+func (s *Stack) pop() *big.Int {
+	v := s.data[len(s.data)-1]
+	s.data = s.data[:len(s.data)-1]
+	return v
+}
+
+// peek returns the top word without removing it
+func (s *Stack) peek() *big.Int {
+	return s.data[len(s.data)-1]
+}
+
+// back returns the n-th word from the top, starting at 0
+func (s *Stack) back(n int) *big.Int {
+	return s.data[len(s.data)-1-n]
+}
+
+// swap exchanges the top word with the n-th word below it
+func (s *Stack) swap(n int) {
+	top := len(s.data) - 1
+	s.data[top], s.data[top-n] = s.data[top-n], s.data[top]
+}
+
+// dup pushes a copy of the n-th word from the top, starting at 1
+func (s *Stack) dup(n int) {
+	s.push(new(big.Int).Set(s.data[len(s.data)-n]))
+}
+
+func (s *Stack) len() int {
+	return len(s.data)
+}
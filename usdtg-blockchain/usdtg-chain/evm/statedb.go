@@ -0,0 +1,477 @@
+package evm
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+)
+
+// StateDB represents the blockchain state database. Its methods are not
+// safe for concurrent use; EVM serializes access through its mu.
+//
+// A StateDB may be a copy-on-write layer over a parent state: reads fall
+// through to the parent, and an account is copied into the layer before
+// it is first modified, so the parent is never written. Accounts then
+// holds only the accounts the layer changed.
+type StateDB struct {
+	Accounts map[Address]*Account
+	parent   *StateDB
+
+	// Transaction scoped state, reset by prepare
+	journal       *journal
+	originStorage map[Address]map[Hash]Hash
+	transient     map[Address]map[Hash]Hash
+	accessList    *accessList
+	refund        uint64
+	logs          []*Log
+	// Contracts created in the transaction, and those of them that
+	// self-destructed, which finalise deletes (EIP-6780)
+	created    map[Address]struct{}
+	destructed map[Address]struct{}
+}
+
+// finalise ends the transaction, deleting the contracts that
+// self-destructed in it, after which changes can no longer be reverted
+func (s *StateDB) finalise() {
+	for addr := range s.destructed {
+		s.deleteAccount(addr)
+	}
+	s.journal = nil
+	s.created = nil
+	s.destructed = nil
+}
+
+// snapshot returns an id for the current state that revertToSnapshot can
+// return to
+func (s *StateDB) snapshot() int {
+	return s.journal.length()
+}
+
+// revertToSnapshot undoes all state changes made since the snapshot was
+// taken, including logs, refunds and access list additions
+func (s *StateDB) revertToSnapshot(id int) {
+	s.journal.revert(s, id)
+}
+
+// emptyCodeHash is the Keccak-256 hash of empty code
+var emptyCodeHash = BytesToHash(Keccak256(nil))
+
+func newStateDB() *StateDB {
+	return &StateDB{
+		Accounts: make(map[Address]*Account),
+	}
+}
+
+// prepare resets the transaction scoped state before a transaction runs
+// and warms the sender, the recipient, the precompiles (EIP-2929) and the
+// entries of the access list (EIP-2930)
+func (s *StateDB) prepare(origin Address, to *Address, coinbase Address, accessList AccessList, precompiles map[Address]PrecompiledContract) {
+	s.journal = new(journal)
+	s.originStorage = make(map[Address]map[Hash]Hash)
+	s.transient = make(map[Address]map[Hash]Hash)
+	s.accessList = newAccessList()
+	s.refund = 0
+	s.logs = nil
+	s.created = make(map[Address]struct{})
+	s.destructed = make(map[Address]struct{})
+
+	s.accessList.addAddress(origin)
+	if to != nil {
+		s.accessList.addAddress(*to)
+	}
+	// EIP-3651: the coinbase starts warm
+	s.accessList.addAddress(coinbase)
+	for addr := range precompiles {
+		s.accessList.addAddress(addr)
+	}
+	for _, tuple := range accessList {
+		s.accessList.addAddress(tuple.Address)
+		for _, key := range tuple.StorageKeys {
+			s.accessList.addSlot(tuple.Address, key)
+		}
+	}
+}
+
+// copyOnWrite returns a new layer over s
+func (s *StateDB) copyOnWrite() *StateDB {
+	return &StateDB{
+		Accounts: make(map[Address]*Account),
+		parent:   s,
+	}
+}
+
+// absorb moves the accounts changed by child, a layer over s, into s
+func (s *StateDB) absorb(child *StateDB) {
+	for addr, account := range child.Accounts {
+		s.Accounts[addr] = account
+	}
+}
+
+// getAccount returns an account for reading, looking through the layers
+// from the top
+func (s *StateDB) getAccount(addr Address) *Account {
+	for state := s; state != nil; state = state.parent {
+		if account := state.Accounts[addr]; account != nil {
+			return account
+		}
+	}
+	return nil
+}
+
+// getOrNewAccount returns an account of this layer for writing, copying
+// it from a parent layer or creating it as needed
+func (s *StateDB) getOrNewAccount(addr Address) *Account {
+	account := s.Accounts[addr]
+	if account == nil && s.parent != nil {
+		if parent := s.parent.getAccount(addr); parent != nil {
+			account = parent.copy()
+			s.Accounts[addr] = account
+		}
+	}
+	if account == nil {
+		account = newAccount(addr)
+		s.Accounts[addr] = account
+		s.journal.append(createAccountChange{addr: addr})
+	}
+	return account
+}
+
+// newAccount returns an empty account
+func newAccount(addr Address) *Account {
+	return &Account{
+		Address:  addr,
+		Balance:  big.NewInt(0),
+		Code:     []byte{},
+		CodeHash: emptyCodeHash,
+		Storage:  make(map[Hash]Hash),
+	}
+}
+
+// deleteAccount removes an account. A parent layer cannot be written, so
+// an account it holds is replaced by an empty one instead, which leaves
+// the state root as removing it would (EIP-161).
+func (s *StateDB) deleteAccount(addr Address) {
+	if s.parent == nil || s.parent.getAccount(addr) == nil {
+		delete(s.Accounts, addr)
+		return
+	}
+	s.Accounts[addr] = newAccount(addr)
+}
+
+// createContract records that the contract at addr is created in the
+// current transaction
+func (s *StateDB) createContract(addr Address) {
+	if _, ok := s.created[addr]; ok {
+		return
+	}
+	s.created[addr] = struct{}{}
+	s.journal.append(createContractChange{addr: addr})
+}
+
+// selfDestruct marks the contract at addr for deletion at the end of the
+// transaction and burns its balance, but only if the transaction created
+// it; older contracts stay (EIP-6780)
+func (s *StateDB) selfDestruct(addr Address) {
+	if _, ok := s.created[addr]; !ok {
+		return
+	}
+	s.subBalance(addr, s.getBalance(addr))
+	if _, ok := s.destructed[addr]; ok {
+		return
+	}
+	s.destructed[addr] = struct{}{}
+	s.journal.append(selfDestructChange{addr: addr})
+}
+
+// exist reports whether the account is present in the state
+func (s *StateDB) exist(addr Address) bool {
+	return s.getAccount(addr) != nil
+}
+
+// empty reports whether the account is missing or has no nonce, balance
+// and code (EIP-161)
+func (s *StateDB) empty(addr Address) bool {
+	account := s.getAccount(addr)
+	return account == nil || (account.Nonce == 0 && account.Balance.Sign() == 0 && len(account.Code) == 0)
+}
+
+func (s *StateDB) getBalance(addr Address) *big.Int {
+	if account := s.getAccount(addr); account != nil {
+		return new(big.Int).Set(account.Balance)
+	}
+	return new(big.Int)
+}
+
+func (s *StateDB) addBalance(addr Address, amount *big.Int) {
+	account := s.getOrNewAccount(addr)
+	s.journal.append(balanceChange{addr: addr, prev: account.Balance})
+	account.Balance = new(big.Int).Add(account.Balance, amount)
+}
+
+func (s *StateDB) subBalance(addr Address, amount *big.Int) {
+	account := s.getOrNewAccount(addr)
+	s.journal.append(balanceChange{addr: addr, prev: account.Balance})
+	account.Balance = new(big.Int).Sub(account.Balance, amount)
+}
+
+// applyTransfer mints or moves the value of a native transfer
+func (s *StateDB) applyTransfer(t Transfer) error {
+	if t.Value == nil || t.Value.Sign() < 0 {
+		return fmt.Errorf("invalid transfer value %v", t.Value)
+	}
+	if t.From == nil {
+		s.addBalance(t.To, t.Value)
+		return nil
+	}
+	return s.transfer(*t.From, t.To, t.Value)
+}
+
+// transfer moves value between accounts after checking the balance
+func (s *StateDB) transfer(from, to Address, value *big.Int) error {
+	if value.Sign() == 0 {
+		s.getOrNewAccount(to)
+		return nil
+	}
+	if s.getBalance(from).Cmp(value) < 0 {
+		return ErrInsufficientBalance
+	}
+	s.subBalance(from, value)
+	s.addBalance(to, value)
+	return nil
+}
+
+func (s *StateDB) getNonce(addr Address) uint64 {
+	if account := s.getAccount(addr); account != nil {
+		return account.Nonce
+	}
+	return 0
+}
+
+func (s *StateDB) setNonce(addr Address, nonce uint64) {
+	account := s.getOrNewAccount(addr)
+	s.journal.append(nonceChange{addr: addr, prev: account.Nonce})
+	account.Nonce = nonce
+}
+
+func (s *StateDB) setCode(addr Address, code []byte) {
+	account := s.getOrNewAccount(addr)
+	s.journal.append(codeChange{addr: addr, prevCode: account.Code, prevHash: account.CodeHash})
+	account.Code = code
+	account.CodeHash = BytesToHash(Keccak256(code))
+}
+
+func (s *StateDB) getCode(addr Address) []byte {
+	if account := s.getAccount(addr); account != nil {
+		return account.Code
+	}
+	return nil
+}
+
+// getCodeHash returns the Keccak-256 hash of the account code, or nil for
+// empty accounts as required by EXTCODEHASH
+func (s *StateDB) getCodeHash(addr Address) []byte {
+	if s.empty(addr) {
+		return nil
+	}
+	return Keccak256(s.getCode(addr))
+}
+
+// getState returns a storage slot, zero if unset
+func (s *StateDB) getState(addr Address, key Hash) Hash {
+	if account := s.getAccount(addr); account != nil {
+		return account.Storage[key]
+	}
+	return Hash{}
+}
+
+// storageRoot returns the root of an account's storage trie. As on
+// Ethereum, slots are keyed by their Keccak-256 hash and values are RLP
+// encoded without leading zeros.
+func (s *StateDB) storageRoot(addr Address) Hash {
+	account := s.getAccount(addr)
+	if account == nil {
+		return emptyRoot
+	}
+	return account.storageRoot()
+}
+
+// storageRoot returns the root of the account's storage trie, computing
+// it only after the storage changed. The caller holds mu for writing.
+func (a *Account) storageRoot() Hash {
+	if a.root != nil {
+		return *a.root
+	}
+	kv := make(map[string][]byte, len(a.Storage))
+	for key, value := range a.Storage {
+		kv[string(Keccak256(key[:]))] = rlpEncodeBytes(bytes.TrimLeft(value[:], "\x00"))
+	}
+	root := trieRoot(kv)
+	a.root = &root
+	return root
+}
+
+// root returns the state root: the root of the trie that maps the
+// Keccak-256 hash of each address to the RLP list of the account's nonce,
+// balance, storage root and code hash, as on Ethereum. Empty accounts are
+// left out (EIP-161), so touching an account does not change the root.
+func (s *StateDB) root() Hash {
+	accounts := make(map[Address]*Account)
+	for state := s; state != nil; state = state.parent {
+		for addr, account := range state.Accounts {
+			if _, ok := accounts[addr]; !ok {
+				accounts[addr] = account
+			}
+		}
+	}
+
+	kv := make(map[string][]byte, len(accounts))
+	for addr, account := range accounts {
+		if account.Nonce == 0 && account.Balance.Sign() == 0 && len(account.Code) == 0 {
+			continue
+		}
+		storageRoot := account.storageRoot()
+		kv[string(Keccak256(addr[:]))] = rlpEncodeList(
+			rlpEncodeUint(account.Nonce),
+			rlpEncodeBig(account.Balance),
+			rlpEncodeBytes(storageRoot[:]),
+			rlpEncodeBytes(account.CodeHash[:]),
+		)
+	}
+	return trieRoot(kv)
+}
+
+// getCommittedState returns the value a slot had when the transaction
+// started, used by SSTORE gas accounting (EIP-2200)
+func (s *StateDB) getCommittedState(addr Address, key Hash) Hash {
+	if value, ok := s.originStorage[addr][key]; ok {
+		return value
+	}
+	return s.getState(addr, key)
+}
+
+// setState writes a storage slot. Zero values are removed so that only
+// non-empty slots are stored.
+func (s *StateDB) setState(addr Address, key, value Hash) {
+	account := s.getOrNewAccount(addr)
+	prev := account.Storage[key]
+
+	if s.originStorage[addr] == nil {
+		s.originStorage[addr] = make(map[Hash]Hash)
+	}
+	if _, ok := s.originStorage[addr][key]; !ok {
+		s.originStorage[addr][key] = prev
+	}
+
+	s.journal.append(storageChange{addr: addr, key: key, prev: prev})
+	account.root = nil
+	if value == (Hash{}) {
+		delete(account.Storage, key)
+	} else {
+		account.Storage[key] = value
+	}
+}
+
+// getTransientState reads transient storage (EIP-1153)
+func (s *StateDB) getTransientState(addr Address, key Hash) Hash {
+	return s.transient[addr][key]
+}
+
+// setTransientState writes transient storage, discarded after the
+// transaction
+func (s *StateDB) setTransientState(addr Address, key, value Hash) {
+	if s.transient[addr] == nil {
+		s.transient[addr] = make(map[Hash]Hash)
+	}
+	s.journal.append(transientStorageChange{addr: addr, key: key, prev: s.transient[addr][key]})
+	if value == (Hash{}) {
+		delete(s.transient[addr], key)
+	} else {
+		s.transient[addr][key] = value
+	}
+}
+
+func (s *StateDB) addRefund(gas uint64) {
+	s.journal.append(refundChange{prev: s.refund})
+	s.refund += gas
+}
+
+func (s *StateDB) subRefund(gas uint64) {
+	if gas > s.refund {
+		panic(fmt.Sprintf("refund counter below zero (gas: %d > refund: %d)", gas, s.refund))
+	}
+	s.journal.append(refundChange{prev: s.refund})
+	s.refund -= gas
+}
+
+func (s *StateDB) addLog(log *Log) {
+	s.journal.append(addLogChange{})
+	s.logs = append(s.logs, log)
+}
+
+// addAddressToAccessList warms an address and reports whether it was cold
+func (s *StateDB) addAddressToAccessList(addr Address) bool {
+	if !s.accessList.addAddress(addr) {
+		return false
+	}
+	s.journal.append(accessListAddAccountChange{addr: addr})
+	return true
+}
+
+// addSlotToAccessList warms a storage slot, and its address, and reports
+// whether the slot was cold
+func (s *StateDB) addSlotToAccessList(addr Address, key Hash) bool {
+	s.addAddressToAccessList(addr)
+	if !s.accessList.addSlot(addr, key) {
+		return false
+	}
+	s.journal.append(accessListAddSlotChange{addr: addr, key: key})
+	return true
+}
+
+// accessList tracks the addresses and storage slots touched by the
+// current transaction (EIP-2929)
+type accessList struct {
+	addresses map[Address]bool
+	slots     map[Address]map[Hash]bool
+}
+
+func newAccessList() *accessList {
+	return &accessList{
+		addresses: make(map[Address]bool),
+		slots:     make(map[Address]map[Hash]bool),
+	}
+}
+
+// addAddress warms an address and reports whether it was cold
+func (al *accessList) addAddress(addr Address) bool {
+	if al.addresses[addr] {
+		return false
+	}
+	al.addresses[addr] = true
+	return true
+}
+
+// addSlot warms a storage slot and reports whether it was cold. The
+// address must already be in the list.
+func (al *accessList) addSlot(addr Address, key Hash) bool {
+	if al.slots[addr] == nil {
+		al.slots[addr] = make(map[Hash]bool)
+	}
+	if al.slots[addr][key] {
+		return false
+	}
+	al.slots[addr][key] = true
+	return true
+}
+
+// copy returns a deep copy of the account. Balances, code and the cached
+// storage root are replaced rather than modified in place, so they can be
+// shared.
+func (a *Account) copy() *Account {
+	cpy := *a
+	cpy.Storage = make(map[Hash]Hash, len(a.Storage))
+	for key, value := range a.Storage {
+		cpy.Storage[key] = value
+	}
+	return &cpy
+}
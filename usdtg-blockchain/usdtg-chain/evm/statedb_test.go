@@ -0,0 +1,76 @@
+package evm
+
+import (
+	"math/big"
+	"testing"
+)
+
+// freshStorageRoot computes an account's storage root without its cache
+func freshStorageRoot(e *EVM, addr Address) Hash {
+	account := e.GetAccount(addr).copy()
+	account.root = nil
+	return account.storageRoot()
+}
+
+func TestStorageRootCache(t *testing.T) {
+	e := newTestEVM()
+
+	// Stores the first calldata word in slot 0, then reverts if the second
+	// one is non-zero
+	runtime := []byte{
+		byte(PUSH1), 0, byte(CALLDATALOAD), byte(PUSH1), 0, byte(SSTORE),
+		byte(PUSH1), 32, byte(CALLDATALOAD), byte(PUSH1), 13, byte(JUMPI), byte(STOP),
+		byte(JUMPDEST), byte(PUSH1), 0, byte(DUP1), byte(REVERT),
+	}
+	contract := *execute(t, e, nil, 0, initCode(runtime)).ContractAddress
+	store := func(value byte, revert bool) *TransactionResult {
+		data := make([]byte, 64)
+		data[31] = value
+		if revert {
+			data[63] = 1
+		}
+		return applyTx(t, e, &EVMTransaction{
+			From:     testSender,
+			To:       &contract,
+			Value:    new(big.Int),
+			Data:     data,
+			Gas:      100_000,
+			GasPrice: new(big.Int),
+			Nonce:    e.GetNonce(testSender),
+		})
+	}
+
+	if root := e.StorageRoot(contract); root != emptyRoot {
+		t.Fatalf("storage root %s before any store, want the empty root", root)
+	}
+	var roots []Hash
+	for _, value := range []byte{1, 2} {
+		if result := store(value, false); !result.Success {
+			t.Fatalf("store %d failed: %s", value, result.Error)
+		}
+		root := e.StorageRoot(contract)
+		if want := freshStorageRoot(e, contract); root != want {
+			t.Fatalf("storage root %s after storing %d, want %s", root, value, want)
+		}
+		roots = append(roots, root)
+	}
+	if roots[0] == roots[1] || roots[1] == emptyRoot {
+		t.Fatalf("storage roots %v do not follow the stores", roots)
+	}
+
+	// A store undone by a revert leaves the cached root valid
+	if result := store(3, true); result.Revert == nil {
+		t.Fatalf("store did not revert: %+v", result)
+	}
+	if root := e.StorageRoot(contract); root != roots[1] || root != freshStorageRoot(e, contract) {
+		t.Fatalf("storage root %s after a reverted store, want %s", root, roots[1])
+	}
+
+	// Clearing the slot empties the trie again
+	if result := store(0, false); !result.Success {
+		t.Fatal(result.Error)
+	}
+	if root := e.StorageRoot(contract); root != emptyRoot {
+		t.Fatalf("storage root %s after clearing the slot, want the empty root", root)
+	}
+}
@@ -0,0 +1,294 @@
+package evm
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Transaction types (EIP-2718)
+const (
+	LegacyTxType     = 0x00
+	AccessListTxType = 0x01 // EIP-2930
+	DynamicFeeTxType = 0x02 // EIP-1559
+)
+
+// AccessTuple lists storage slots of one account that a transaction
+// declares it will touch
+type AccessTuple struct {
+	Address     Address `json:"address"`
+	StorageKeys []Hash  `json:"storage_keys"`
+}
+
+// AccessList is the EIP-2930 access list of a transaction. The listed
+// accounts and slots start warm, for an up-front intrinsic gas charge.
+type AccessList []AccessTuple
+
+// StorageKeys returns the number of slots in the list
+func (al AccessList) StorageKeys() int {
+	n := 0
+	for _, tuple := range al {
+		n += len(tuple.StorageKeys)
+	}
+	return n
+}
+
+func (al AccessList) encode() []byte {
+	tuples := make([][]byte, len(al))
+	for i, tuple := range al {
+		keys := make([][]byte, len(tuple.StorageKeys))
+		for j, key := range tuple.StorageKeys {
+			keys[j] = rlpEncodeBytes(key[:])
+		}
+		tuples[i] = rlpEncodeList(rlpEncodeBytes(tuple.Address[:]), rlpEncodeList(keys...))
+	}
+	return rlpEncodeList(tuples...)
+}
+
+func decodeAccessList(item []byte) (AccessList, error) {
+	tuples, err := rlpDecodeList(item)
+	if err != nil {
+		return nil, err
+	}
+	al := make(AccessList, len(tuples))
+	for i, raw := range tuples {
+		fields, err := rlpDecodeList(raw)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("access list tuple has %d fields, want 2", len(fields))
+		}
+		addr, err := rlpDecodeBytes(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(addr) != AddressLength {
+			return nil, fmt.Errorf("access list address has %d bytes", len(addr))
+		}
+		al[i].Address = BytesToAddress(addr)
+		keys, err := rlpDecodeList(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		al[i].StorageKeys = make([]Hash, len(keys))
+		for j, rawKey := range keys {
+			key, err := rlpDecodeBytes(rawKey)
+			if err != nil {
+				return nil, err
+			}
+			if len(key) != HashLength {
+				return nil, fmt.Errorf("access list storage key has %d bytes", len(key))
+			}
+			al[i].StorageKeys[j] = BytesToHash(key)
+		}
+	}
+	return al, nil
+}
+
+// DecodeTransaction decodes a signed transaction in its network encoding:
+// an RLP list for legacy transactions, or a type byte followed by an RLP
+// list for typed ones. The sender is not recovered; see Sender.
+func DecodeTransaction(raw []byte) (*EVMTransaction, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("empty transaction")
+	}
+	tx := &EVMTransaction{Hash: BytesToHash(Keccak256(raw))}
+	payload := raw
+	if raw[0] < 0xc0 {
+		tx.Type = raw[0]
+		payload = raw[1:]
+	}
+
+	fields, err := rlpDecodeList(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction encoding: %w", err)
+	}
+	var to, data []byte
+	var accessList rlpRaw
+	switch tx.Type {
+	case LegacyTxType:
+		if len(fields) != 9 {
+			return nil, fmt.Errorf("legacy transaction has %d fields, want 9", len(fields))
+		}
+		err = decodeFields(fields, []interface{}{&tx.Nonce, &tx.GasPrice, &tx.Gas, &to, &tx.Value, &data, &tx.V, &tx.R, &tx.S})
+	case AccessListTxType:
+		if len(fields) != 11 {
+			return nil, fmt.Errorf("access list transaction has %d fields, want 11", len(fields))
+		}
+		err = decodeFields(fields, []interface{}{&tx.ChainID, &tx.Nonce, &tx.GasPrice, &tx.Gas, &to, &tx.Value, &data, &accessList, &tx.V, &tx.R, &tx.S})
+	case DynamicFeeTxType:
+		if len(fields) != 12 {
+			return nil, fmt.Errorf("dynamic fee transaction has %d fields, want 12", len(fields))
+		}
+		err = decodeFields(fields, []interface{}{&tx.ChainID, &tx.Nonce, &tx.GasTipCap, &tx.GasFeeCap, &tx.Gas, &to, &tx.Value, &data, &accessList, &tx.V, &tx.R, &tx.S})
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrTxTypeNotSupported, tx.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction: %w", err)
+	}
+
+	switch len(to) {
+	case 0:
+	case AddressLength:
+		addr := BytesToAddress(to)
+		tx.To = &addr
+	default:
+		return nil, fmt.Errorf("invalid transaction: recipient has %d bytes", len(to))
+	}
+	tx.Data = data
+	if accessList != nil {
+		if tx.AccessList, err = decodeAccessList(accessList); err != nil {
+			return nil, fmt.Errorf("invalid access list: %w", err)
+		}
+	}
+	return tx, nil
+}
+
+// rlpRaw is an RLP item kept in its encoded form
+type rlpRaw []byte
+
+// decodeFields decodes RLP items into the matching destinations: *uint64
+// and **big.Int for integers, *[]byte for strings and *rlpRaw for items
+// decoded later
+func decodeFields(items [][]byte, dst []interface{}) error {
+	for i, item := range items {
+		var err error
+		switch d := dst[i].(type) {
+		case *uint64:
+			*d, err = rlpDecodeUint(item)
+		case **big.Int:
+			*d, err = rlpDecodeBig(item)
+		case *[]byte:
+			*d, err = rlpDecodeBytes(item)
+		case *rlpRaw:
+			*d = item
+		}
+		if err != nil {
+			return fmt.Errorf("field %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// encode returns the network encoding of a signed transaction, whose
+// Keccak-256 hash is the transaction hash
+func (tx *EVMTransaction) encode() []byte {
+	to := rlpEncodeBytes(nil)
+	if tx.To != nil {
+		to = rlpEncodeBytes(tx.To[:])
+	}
+	v, r, s := rlpEncodeBig(tx.V), rlpEncodeBig(tx.R), rlpEncodeBig(tx.S)
+	switch tx.Type {
+	case AccessListTxType:
+		return append([]byte{tx.Type}, rlpEncodeList(
+			rlpEncodeBig(tx.ChainID), rlpEncodeUint(tx.Nonce), rlpEncodeBig(tx.GasPrice), rlpEncodeUint(tx.Gas),
+			to, rlpEncodeBig(tx.Value), rlpEncodeBytes(tx.Data), tx.AccessList.encode(), v, r, s,
+		)...)
+	case DynamicFeeTxType:
+		return append([]byte{tx.Type}, rlpEncodeList(
+			rlpEncodeBig(tx.ChainID), rlpEncodeUint(tx.Nonce), rlpEncodeBig(tx.GasTipCap), rlpEncodeBig(tx.GasFeeCap),
+			rlpEncodeUint(tx.Gas), to, rlpEncodeBig(tx.Value), rlpEncodeBytes(tx.Data), tx.AccessList.encode(), v, r, s,
+		)...)
+	}
+	return rlpEncodeList(
+		rlpEncodeUint(tx.Nonce), rlpEncodeBig(tx.GasPrice), rlpEncodeUint(tx.Gas),
+		to, rlpEncodeBig(tx.Value), rlpEncodeBytes(tx.Data), v, r, s,
+	)
+}
+
+// Signed reports whether the transaction carries a signature
+func (tx *EVMTransaction) Signed() bool {
+	return tx.R != nil && tx.S != nil && tx.V != nil
+}
+
+// signingHash returns the hash the sender signs. Legacy transactions
+// commit to the chain ID as in EIP-155; typed ones include it as a field
+// and prefix their type.
+func (tx *EVMTransaction) signingHash(chainID *big.Int) Hash {
+	to := rlpEncodeBytes(nil)
+	if tx.To != nil {
+		to = rlpEncodeBytes(tx.To[:])
+	}
+	switch tx.Type {
+	case AccessListTxType:
+		return BytesToHash(Keccak256([]byte{tx.Type}, rlpEncodeList(
+			rlpEncodeBig(chainID), rlpEncodeUint(tx.Nonce), rlpEncodeBig(tx.GasPrice), rlpEncodeUint(tx.Gas),
+			to, rlpEncodeBig(tx.Value), rlpEncodeBytes(tx.Data), tx.AccessList.encode(),
+		)))
+	case DynamicFeeTxType:
+		return BytesToHash(Keccak256([]byte{tx.Type}, rlpEncodeList(
+			rlpEncodeBig(chainID), rlpEncodeUint(tx.Nonce), rlpEncodeBig(tx.GasTipCap), rlpEncodeBig(tx.GasFeeCap),
+			rlpEncodeUint(tx.Gas), to, rlpEncodeBig(tx.Value), rlpEncodeBytes(tx.Data), tx.AccessList.encode(),
+		)))
+	}
+	return BytesToHash(Keccak256(rlpEncodeList(
+		rlpEncodeUint(tx.Nonce), rlpEncodeBig(tx.GasPrice), rlpEncodeUint(tx.Gas),
+		to, rlpEncodeBig(tx.Value), rlpEncodeBytes(tx.Data),
+		rlpEncodeBig(chainID), rlpEncodeUint(0), rlpEncodeUint(0),
+	)))
+}
+
+// Sender recovers the address that signed tx for the given chain and
+// stores it in tx.From. Legacy transactions must be replay protected
+// (EIP-155), and s must be in the lower half of the curve order
+// (EIP-2).
+func Sender(tx *EVMTransaction, chainID *big.Int) (Address, error) {
+	if !tx.Signed() {
+		return Address{}, ErrInvalidSignature
+	}
+
+	var recid *big.Int
+	if tx.Type == LegacyTxType {
+		v := tx.V.Uint64()
+		if !tx.V.IsUint64() || v < 35 {
+			if v == 27 || v == 28 {
+				return Address{}, ErrUnprotectedTx
+			}
+			return Address{}, ErrInvalidSignature
+		}
+		// v = chainID*2 + 35 + recid
+		txChainID := new(big.Int).Sub(tx.V, big.NewInt(35))
+		recid = new(big.Int).And(txChainID, big.NewInt(1))
+		tx.ChainID = txChainID.Rsh(txChainID, 1)
+	} else {
+		recid = tx.V
+	}
+	if tx.ChainID == nil || tx.ChainID.Cmp(chainID) != 0 {
+		return Address{}, fmt.Errorf("%w: have %v, want %s", ErrInvalidChainID, tx.ChainID, chainID)
+	}
+	if recid.Cmp(big.NewInt(1)) > 0 || tx.S.Cmp(secp256k1HalfN) > 0 {
+		return Address{}, ErrInvalidSignature
+	}
+
+	hash := tx.signingHash(chainID)
+	pub, err := RecoverPubkey(hash[:], tx.R, tx.S, byte(recid.Uint64()))
+	if err != nil {
+		return Address{}, err
+	}
+	tx.From = PubkeyToAddress(pub)
+	return tx.From, nil
+}
+
+// effectiveGasPrice returns the price per gas the sender pays in a block
+// with the given base fee: the gas price, or for dynamic fee transactions
+// the base fee plus the tip, capped at the fee cap
+func (tx *EVMTransaction) effectiveGasPrice(baseFee *big.Int) *big.Int {
+	if tx.Type != DynamicFeeTxType {
+		return tx.GasPrice
+	}
+	price := new(big.Int).Add(baseFee, tx.GasTipCap)
+	if price.Cmp(tx.GasFeeCap) > 0 {
+		price.Set(tx.GasFeeCap)
+	}
+	return price
+}
+
+// maxGasPrice returns the most the sender may pay per gas, which its
+// balance must cover
+func (tx *EVMTransaction) maxGasPrice() *big.Int {
+	if tx.Type == DynamicFeeTxType {
+		return tx.GasFeeCap
+	}
+	return tx.GasPrice
+}
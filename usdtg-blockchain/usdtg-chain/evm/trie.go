@@ -0,0 +1,115 @@
+package evm
+
+import (
+	"bytes"
+	"sort"
+)
+
+// emptyRoot is the root hash of an empty Merkle Patricia trie
+var emptyRoot = BytesToHash(Keccak256(rlpEncodeBytes(nil)))
+
+// trieItem is a key, split into nibbles, and its value
+type trieItem struct {
+	nibbles []byte
+	value   []byte
+}
+
+// trieRoot computes the root hash of the Merkle Patricia trie holding the
+// given key/value pairs, as Ethereum does for storage and state roots. The
+// trie is built in memory; only its hash is kept.
+func trieRoot(kv map[string][]byte) Hash {
+	if len(kv) == 0 {
+		return emptyRoot
+	}
+	items := make([]trieItem, 0, len(kv))
+	for k, v := range kv {
+		items = append(items, trieItem{nibbles: keyNibbles([]byte(k)), value: v})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return bytes.Compare(items[i].nibbles, items[j].nibbles) < 0
+	})
+	return BytesToHash(Keccak256(trieNode(items, 0)))
+}
+
+// trieNode returns the RLP encoding of the node holding the sorted items,
+// whose keys all share their first depth nibbles
+func trieNode(items []trieItem, depth int) []byte {
+	if len(items) == 1 {
+		item := items[0]
+		return rlpEncodeList(rlpEncodeBytes(hexPrefix(item.nibbles[depth:], true)), rlpEncodeBytes(item.value))
+	}
+
+	// Keys are sorted, so the prefix shared by all of them is the one the
+	// first and last share
+	first, last := items[0].nibbles[depth:], items[len(items)-1].nibbles[depth:]
+	prefix := 0
+	for prefix < len(first) && prefix < len(last) && first[prefix] == last[prefix] {
+		prefix++
+	}
+	if prefix > 0 {
+		return rlpEncodeList(rlpEncodeBytes(hexPrefix(first[:prefix], false)), trieRef(trieNode(items, depth+prefix)))
+	}
+
+	// Branch: one child per nibble, plus the value of a key ending here,
+	// which sorts first
+	children := make([][]byte, 17)
+	var value []byte
+	i := 0
+	if len(items[0].nibbles) == depth {
+		value = items[0].value
+		i++
+	}
+	for nibble := byte(0); nibble < 16; nibble++ {
+		j := i
+		for j < len(items) && items[j].nibbles[depth] == nibble {
+			j++
+		}
+		if j > i {
+			children[nibble] = trieRef(trieNode(items[i:j], depth+1))
+		} else {
+			children[nibble] = rlpEncodeBytes(nil)
+		}
+		i = j
+	}
+	children[16] = rlpEncodeBytes(value)
+	return rlpEncodeList(children...)
+}
+
+// trieRef embeds nodes shorter than a hash in their parent and refers to
+// the others by hash
+func trieRef(node []byte) []byte {
+	if len(node) < 32 {
+		return node
+	}
+	return rlpEncodeBytes(Keccak256(node))
+}
+
+// keyNibbles splits a key into 4-bit nibbles
+func keyNibbles(key []byte) []byte {
+	nibbles := make([]byte, len(key)*2)
+	for i, b := range key {
+		nibbles[2*i] = b >> 4
+		nibbles[2*i+1] = b & 0x0f
+	}
+	return nibbles
+}
+
+// hexPrefix packs nibbles into bytes, flagging whether the path ends in a
+// leaf and whether it has an odd length
+func hexPrefix(nibbles []byte, leaf bool) []byte {
+	var flag byte
+	if leaf {
+		flag = 2
+	}
+	out := make([]byte, len(nibbles)/2+1)
+	if len(nibbles)%2 == 1 {
+		out[0] = (flag+1)<<4 | nibbles[0]
+		nibbles = nibbles[1:]
+	} else {
+		out[0] = flag << 4
+	}
+	for i := 0; i < len(nibbles); i += 2 {
+		out[i/2+1] = nibbles[i]<<4 | nibbles[i+1]
+	}
+	return out
+}
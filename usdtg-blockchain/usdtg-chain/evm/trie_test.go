@@ -0,0 +1,65 @@
+package evm
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// hexHash decodes a hash written in hex
+func hexHash(t *testing.T, s string) Hash {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != HashLength {
+		t.Fatalf("invalid hash %q", s)
+	}
+	return BytesToHash(b)
+}
+
+func TestTrieRoot(t *testing.T) {
+	tests := []struct {
+		name string
+		kv   map[string][]byte
+		want string
+	}{
+		{"empty", nil, "56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"},
+		// The "dogs" case of the Ethereum trie tests: an extension, a
+		// branch with a value and leaves
+		{"dogs", map[string][]byte{
+			"doe":          []byte("reindeer"),
+			"dog":          []byte("puppy"),
+			"dogglesworth": []byte("cat"),
+		}, "8aad789dff2f538bca5d8ea56e8abe10f4c7ba3a5dea95fea4cd6e7c3a1168d3"},
+	}
+	for _, tt := range tests {
+		if got := trieRoot(tt.kv); got != hexHash(t, tt.want) {
+			t.Fatalf("%s: root %s, want 0x%s", tt.name, got, tt.want)
+		}
+	}
+	if emptyRoot != hexHash(t, tests[0].want) {
+		t.Fatalf("emptyRoot is %s", emptyRoot)
+	}
+}
+
+func TestStorageRoot(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage map[Hash]Hash
+		want    string
+	}{
+		{"no slots", nil, "56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"},
+		{"slot 0 = 1", map[Hash]Hash{{}: BytesToHash([]byte{1})}, "821e2556a290c86405f8160a2d662042a431ba456b9db265c79bb837c04be5f0"},
+		{"slots 0 = 1 and 7 = 42", map[Hash]Hash{
+			{}:                     BytesToHash([]byte{1}),
+			BytesToHash([]byte{7}): BytesToHash([]byte{42}),
+		}, "ff3124b517bbc0cd2c40bca587f2b14a6cc1f93779b7fc5f12da5dbf00df891b"},
+	}
+	for _, tt := range tests {
+		account := newAccount(testSender)
+		for key, value := range tt.storage {
+			account.Storage[key] = value
+		}
+		if got := account.storageRoot(); got != hexHash(t, tt.want) {
+			t.Fatalf("%s: storage root %s, want 0x%s", tt.name, got, tt.want)
+		}
+	}
+}
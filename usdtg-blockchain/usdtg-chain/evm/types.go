@@ -0,0 +1,209 @@
+package evm
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Lengths of hashes and addresses in bytes
+const (
+	HashLength    = 32
+	AddressLength = 20
+)
+
+// Address parsing errors
+var (
+	ErrInvalidAddress  = errors.New("invalid address: expected 0x followed by 40 hex characters")
+	ErrAddressChecksum = errors.New("invalid address checksum")
+)
+
+// Address is the 20-byte address of an account
+type Address [AddressLength]byte
+
+// BytesToAddress converts b to an address, keeping the last 20 bytes if
+// b is longer and left padding it with zeros if it is shorter
+func BytesToAddress(b []byte) Address {
+	var a Address
+	if len(b) > AddressLength {
+		b = b[len(b)-AddressLength:]
+	}
+	copy(a[AddressLength-len(b):], b)
+	return a
+}
+
+// ParseAddress parses a 0x-prefixed hex address. Addresses in mixed case
+// must carry a valid EIP-55 checksum; all lower or all upper case
+// addresses are accepted as is.
+func ParseAddress(s string) (Address, error) {
+	var a Address
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return a, ErrInvalidAddress
+	}
+	digits := s[2:]
+	if len(digits) != 2*AddressLength {
+		return a, ErrInvalidAddress
+	}
+	if _, err := hex.Decode(a[:], []byte(digits)); err != nil {
+		return a, ErrInvalidAddress
+	}
+	if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) && a.Hex()[2:] != digits {
+		return a, ErrAddressChecksum
+	}
+	return a, nil
+}
+
+// Bytes returns the address as a byte slice
+func (a Address) Bytes() []byte {
+	return a[:]
+}
+
+// Hex returns the EIP-55 checksummed hex form of the address: a hex
+// letter is upper case when the matching nibble of the Keccak-256 hash of
+// the lower case address is 8 or more
+func (a Address) Hex() string {
+	buf := []byte(hex.EncodeToString(a[:]))
+	hash := Keccak256(buf)
+	for i, c := range buf {
+		if c < 'a' {
+			continue
+		}
+		nibble := hash[i/2]
+		if i%2 == 0 {
+			nibble >>= 4
+		}
+		if nibble&0xf >= 8 {
+			buf[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(buf)
+}
+
+// String implements fmt.Stringer
+func (a Address) String() string {
+	return a.Hex()
+}
+
+// MarshalText encodes the address in checksummed hex
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(a.Hex()), nil
+}
+
+// UnmarshalText parses and validates a hex address
+func (a *Address) UnmarshalText(text []byte) error {
+	addr, err := ParseAddress(string(text))
+	if err != nil {
+		return fmt.Errorf("%w: %q", err, text)
+	}
+	*a = addr
+	return nil
+}
+
+// CreateAddress returns the address of a contract created by from with
+// the given nonce: the last 20 bytes of keccak256(rlp([from, nonce]))
+func CreateAddress(from Address, nonce uint64) Address {
+	data := rlpEncodeList(rlpEncodeBytes(from[:]), rlpEncodeUint(nonce))
+	return BytesToAddress(Keccak256(data)[12:])
+}
+
+// CreateAddress2 returns the address CREATE2 deploys to, which depends
+// only on the creator, the salt and the init code (EIP-1014)
+func CreateAddress2(from Address, salt Hash, initCode []byte) Address {
+	return BytesToAddress(Keccak256([]byte{0xff}, from[:], salt[:], Keccak256(initCode))[12:])
+}
+
+// Hash is a 32-byte Keccak-256 hash
+type Hash [HashLength]byte
+
+// BytesToHash converts b to a hash, keeping the last 32 bytes if b is
+// longer and left padding it with zeros if it is shorter
+func BytesToHash(b []byte) Hash {
+	var h Hash
+	if len(b) > HashLength {
+		b = b[len(b)-HashLength:]
+	}
+	copy(h[HashLength-len(b):], b)
+	return h
+}
+
+// BigToHash converts a 256-bit word to a hash
+func BigToHash(b *big.Int) Hash {
+	var h Hash
+	b.FillBytes(h[:])
+	return h
+}
+
+// Bytes returns the hash as a byte slice
+func (h Hash) Bytes() []byte {
+	return h[:]
+}
+
+// Big returns the hash as a 256-bit word
+func (h Hash) Big() *big.Int {
+	return new(big.Int).SetBytes(h[:])
+}
+
+// Hex returns the 0x-prefixed hex form of the hash
+func (h Hash) Hex() string {
+	return "0x" + hex.EncodeToString(h[:])
+}
+
+// String implements fmt.Stringer
+func (h Hash) String() string {
+	return h.Hex()
+}
+
+// MarshalText encodes the hash in hex
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.Hex()), nil
+}
+
+// UnmarshalText parses a 0x-prefixed hash of exactly 32 bytes
+func (h *Hash) UnmarshalText(text []byte) error {
+	var b Bytes
+	if err := b.UnmarshalText(text); err != nil {
+		return err
+	}
+	if len(b) != HashLength {
+		return fmt.Errorf("invalid hash: expected %d bytes, got %d", HashLength, len(b))
+	}
+	copy(h[:], b)
+	return nil
+}
+
+// Bytes is a byte slice that encodes as 0x-prefixed hex in JSON
+type Bytes []byte
+
+// String implements fmt.Stringer
+func (b Bytes) String() string {
+	return "0x" + hex.EncodeToString(b)
+}
+
+// MarshalText encodes the bytes in hex
+func (b Bytes) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText decodes hex, with or without the 0x prefix
+func (b *Bytes) UnmarshalText(text []byte) error {
+	decoded, err := DecodeHex(string(text))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// DecodeHex decodes a hex string, with or without the 0x prefix
+func DecodeHex(s string) ([]byte, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		s = s[2:]
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex: %w", err)
+	}
+	return b, nil
+}
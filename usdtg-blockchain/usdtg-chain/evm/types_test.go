@@ -0,0 +1,119 @@
+package evm
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func mustAddress(t *testing.T, s string) Address {
+	t.Helper()
+	a, err := ParseAddress(s)
+	if err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return a
+}
+
+func TestAddressChecksum(t *testing.T) {
+	// The examples of EIP-55
+	for _, want := range []string{
+		"0x52908400098527886E0F7030069857D2E4169EE7",
+		"0x8617E340B3D01FA5F11F306F4090FD50E238070D",
+		"0xde709f2102306220921060314715629080e2fb77",
+		"0x27b1fdb04752bbc536007a920d24acb045561c26",
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	} {
+		a := mustAddress(t, strings.ToLower(want))
+		if got := a.Hex(); got != want {
+			t.Errorf("checksummed %s, want %s", got, want)
+		}
+		if b := mustAddress(t, want); b != a {
+			t.Errorf("%s parsed as %s", want, b)
+		}
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		in   string
+		want error
+	}{
+		{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", nil},
+		{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", nil},
+		{"0X5AAEB6053F3E94C9B9A09F33669435E7EF1BEAED", nil},
+		{"0x5AAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", ErrAddressChecksum},
+		{"5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", ErrInvalidAddress},
+		{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1bea", ErrInvalidAddress},
+		{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed00", ErrInvalidAddress},
+		{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaeg", ErrInvalidAddress},
+	}
+	for _, tt := range tests {
+		if _, err := ParseAddress(tt.in); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.in, err, tt.want)
+		}
+	}
+
+	var a Address
+	if err := json.Unmarshal([]byte(`"0x5AAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"`), &a); !errors.Is(err, ErrAddressChecksum) {
+		t.Fatalf("unmarshaled a bad checksum: %v", err)
+	}
+}
+
+func TestCreateAddress(t *testing.T) {
+	from := mustAddress(t, "0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0")
+	for nonce, want := range []string{
+		"0xcd234a471b72ba2f1ccf0a70fcaba648a5eecd8d",
+		"0x343c43a37d37dff08ae8c4a11544c718abb4fcf8",
+		"0xf778b86fa74e846c4f0a1fbd1335fe81c00a0c91",
+		"0xfffd933a0bc612844eaf0c6fe3e5b8e9b6c1d19c",
+	} {
+		if got := CreateAddress(from, uint64(nonce)); got != mustAddress(t, want) {
+			t.Errorf("nonce %d: address %s, want %s", nonce, got, want)
+		}
+	}
+}
+
+func TestCreateAddress2(t *testing.T) {
+	// The examples of EIP-1014
+	tests := []struct {
+		from, salt, initCode, want string
+	}{
+		{"0x0000000000000000000000000000000000000000", "00", "00", "0x4D1A2e2bB4F88F0250f26Ffff098B0b30B26BF38"},
+		{"0xdeadbeef00000000000000000000000000000000", "00", "00", "0xB928f69Bb1D91Cd65274e3c79d8986362984fDA3"},
+		{"0xdeadbeef00000000000000000000000000000000", "feed000000000000000000000000000000000000", "00", "0xD04116cDd17beBE565EB2422F2497E06cC1C9833"},
+		{"0x0000000000000000000000000000000000000000", "00", "deadbeef", "0x70f2b2914A2a4b783FaEFb75f459A580616Fcb5e"},
+		{"0x00000000000000000000000000000000deadbeef", "cafebabe", "deadbeef", "0x60f3f640a8508fC6a86d45DF051962668E1e8AC7"},
+		{"0x00000000000000000000000000000000deadbeef", "cafebabe", strings.Repeat("deadbeef", 11), "0x1d8bfDC5D46DC4f61D6b6115972536eBE6A8854C"},
+		{"0x0000000000000000000000000000000000000000", "00", "", "0xE33C0C7F7df4809055C3ebA6c09CFe4BaF1BD9e0"},
+	}
+	for _, tt := range tests {
+		got := CreateAddress2(mustAddress(t, tt.from), BytesToHash(mustHex(t, tt.salt)), mustHex(t, tt.initCode))
+		if got.Hex() != tt.want {
+			t.Errorf("%s, salt %s, code %s: address %s, want %s", tt.from, tt.salt, tt.initCode, got, tt.want)
+		}
+	}
+}
+
+func TestBytesJSON(t *testing.T) {
+	encoded, err := json.Marshal(Bytes{0xde, 0xad})
+	if err != nil || string(encoded) != `"0xdead"` {
+		t.Fatalf("encoded %s, %v", encoded, err)
+	}
+	for _, in := range []string{`"0xdead"`, `"dead"`, `"0XDEAD"`} {
+		var b Bytes
+		if err := json.Unmarshal([]byte(in), &b); err != nil || b.String() != "0xdead" {
+			t.Errorf("%s decoded as %s, %v", in, b, err)
+		}
+	}
+	for _, in := range []string{`"0xdea"`, `"0xzz"`} {
+		var b Bytes
+		if err := json.Unmarshal([]byte(in), &b); err == nil {
+			t.Errorf("%s decoded", in)
+		}
+	}
+}
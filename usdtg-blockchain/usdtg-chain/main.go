@@ -2,15 +2,20 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"usdtg-chain/blockchain"
 	"usdtg-chain/evm"
+	"usdtg-chain/p2p"
 
 	"github.com/gorilla/mux"
 )
@@ -18,14 +23,62 @@ import (
 var bc *blockchain.Blockchain
 var evmInstance *evm.EVM
 
-func StartServer() {
+// devMode allows unsigned EVM transactions, see NodeConfig.DevMode
+var devMode bool
+var p2pNode *p2p.Node
+
+func StartServer(cfg NodeConfig) error {
 	fmt.Println("🚀 USDTg Blockchain başlatılıyor...")
 
-	// Blockchain'i başlat
-	bc = blockchain.NewBlockchain()
+	// Dev mode mines a block for every transaction and faucet request, whose
+	// rewards go to the fee recipient
+	if cfg.DevMode && cfg.FeeRecipient == (evm.Address{}) {
+		return fmt.Errorf("dev mode mines blocks and needs a fee recipient for their rewards (-fee-recipient)")
+	}
 
-	// EVM'i başlat
+	// EVM'i başlat; blokların EVM işlemlerini zincir çalıştırır
 	evmInstance = evm.NewEVM()
+	evmInstance.Block.Coinbase = cfg.FeeRecipient
+	devMode = cfg.DevMode
+	evmInstance.AllowUnsigned = devMode
+	if devMode {
+		fmt.Println("⚠️  Dev modu: imzasız EVM işlemleri kabul ediliyor")
+	}
+	cfg.Chain.EVM = evmInstance
+	cfg.Chain.Faucet = devMode
+
+	// Blockchain'i başlat
+	chain, err := openChain(cfg)
+	if err != nil {
+		return err
+	}
+	bc = chain
+	defer bc.Close()
+	fmt.Printf("🗂️  Pruning modu: %s\n", bc.Pruning().Mode)
+	fmt.Printf("💾 Depolama: %s\n", cfg.Chain.Storage.Backend)
+
+	// P2P ağını başlat
+	if cfg.P2P.Enabled {
+		// Disk düğümleri adres defterini ve kimlik anahtarını veri dizininde saklar
+		if cfg.Chain.Storage.Backend == blockchain.StorageDisk {
+			if cfg.P2P.AddrBookPath == "" {
+				cfg.P2P.AddrBookPath = filepath.Join(cfg.Chain.Storage.Path, "addrbook.json")
+			}
+			if cfg.P2P.KeyPath == "" {
+				cfg.P2P.KeyPath = filepath.Join(cfg.Chain.Storage.Path, "node_key.json")
+			}
+		}
+		node, err := p2p.NewNode(cfg.P2P, bc)
+		if err != nil {
+			return err
+		}
+		if err := node.Start(); err != nil {
+			return err
+		}
+		defer node.Stop()
+		p2pNode = node
+		fmt.Printf("🔗 P2P ağı %s adresinde dinliyor (node %s)\n", node.Addr(), node.ID())
+	}
 
 	// Router oluştur
 	r := mux.NewRouter()
@@ -43,6 +96,8 @@ func StartServer() {
 	r.HandleFunc("/api/blockchain/mine", mineHandler).Methods("POST")
 	r.HandleFunc("/api/blockchain/mine", optionsHandler).Methods("OPTIONS")
 	r.HandleFunc("/api/blockchain/transaction", addTransactionHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/blockchain/export", exportHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/blockchain/dump", dumpHandler).Methods("GET", "OPTIONS")
 
 	// EVM API endpoint'leri
 	r.HandleFunc("/api/evm/account/{address}", evmAccountHandler).Methods("GET", "OPTIONS")
@@ -50,19 +105,31 @@ func StartServer() {
 	r.HandleFunc("/api/evm/contract/{address}", evmContractHandler).Methods("GET", "OPTIONS")
 	r.HandleFunc("/api/evm/transaction", evmTransactionHandler).Methods("POST", "OPTIONS")
 	r.HandleFunc("/api/evm/balance/{address}", evmBalanceHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/evm/storage/{address}/{slot}", evmStorageHandler).Methods("GET", "OPTIONS")
 	r.HandleFunc("/api/evm/balance/add", evmAddBalanceHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/evm/receipt/{hash}", evmReceiptHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/evm/block/{number}", evmBlockHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/evm/logs", evmLogsHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/evm/call", evmCallHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/evm/estimate", evmEstimateGasHandler).Methods("POST", "OPTIONS")
+
+	// Ethereum JSON-RPC
+	registerRPCRoutes(r)
+
+	// Ağ API endpoint'leri
+	registerNetRoutes(r, cfg.AdminToken)
 
 	// Health check
 	r.HandleFunc("/health", healthHandler).Methods("GET", "OPTIONS")
 
 	// Server oluştur
 	srv := &http.Server{
-		Addr:    ":8080",
+		Addr:    cfg.ListenAddr,
 		Handler: r,
 	}
 
 	// Server'ı başlat
-	fmt.Println("🌐 HTTP Server port 8080'de başlatılıyor...")
+	fmt.Printf("🌐 HTTP Server %s adresinde başlatılıyor...\n", cfg.ListenAddr)
 	fmt.Println("📊 Blockchain API: http://localhost:8080")
 	fmt.Println("🏥 Health Check: http://localhost:8080/health")
 	fmt.Println("🔗 EVM API: http://localhost:8080/api/evm")
@@ -72,7 +139,30 @@ func StartServer() {
 	if err := srv.ListenAndServe(); err != nil {
 		fmt.Printf("❌ Server hatası: %v\n", err)
 		log.Printf("Server hatası: %v", err)
+		return err
+	}
+	return nil
+}
+
+// openChain creates the blockchain, importing it from a file when configured
+func openChain(cfg NodeConfig) (*blockchain.Blockchain, error) {
+	if cfg.Import == "" {
+		return blockchain.NewBlockchainWithConfig(cfg.Chain)
+	}
+
+	f, err := os.Open(cfg.Import)
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
+
+	fmt.Printf("📥 Zincir içe aktarılıyor: %s\n", cfg.Import)
+	chain, err := blockchain.ImportChain(f, cfg.Chain)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("✅ %d blok doğrulandı ve içe aktarıldı\n", len(chain.Chain))
+	return chain, nil
 }
 
 // OPTIONS handler for preflight requests
@@ -87,6 +177,11 @@ func optionsHandler(w http.ResponseWriter, r *http.Request) {
 // CORS middleware
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, netRoutePrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
@@ -138,14 +233,29 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 			"block":           "/api/blockchain/block/{index}",
 			"mine":            "/api/blockchain/mine",
 			"transaction":     "/api/blockchain/transaction",
+			"export":          "/api/blockchain/export",
+			"dump":            "/api/blockchain/dump",
+			"rpc":             "/rpc",
 			"health":          "/health",
 		},
+		"net_endpoints": map[string]string{
+			"info":  "/api/net/info",
+			"peers": "/api/net/peers",
+			"peer":  "/api/net/peers/{id}",
+			"ban":   "/api/net/peers/{id}/ban",
+		},
 		"evm_endpoints": map[string]string{
 			"account":         "/api/evm/account/{address}",
 			"deploy_contract": "/api/evm/contract/deploy",
 			"contract":        "/api/evm/contract/{address}",
 			"transaction":     "/api/evm/transaction",
 			"balance":         "/api/evm/balance/{address}",
+			"storage":         "/api/evm/storage/{address}/{slot}",
+			"receipt":         "/api/evm/receipt/{hash}",
+			"block":           "/api/evm/block/{number}",
+			"logs":            "/api/evm/logs",
+			"call":            "/api/evm/call",
+			"estimate":        "/api/evm/estimate",
 		},
 	}
 
@@ -162,6 +272,10 @@ func statusHandler(w http.ResponseWriter, r *http.Request) {
 		"version":          "1.0.0",
 		"timestamp":        time.Now().Format(time.RFC3339),
 		"blockchain_valid": bc.IsChainValid(),
+		"height":           bc.Height(),
+	}
+	if p2pNode != nil {
+		response["sync"] = p2pNode.SyncStatus()
 	}
 
 	json.NewEncoder(w).Encode(response)
@@ -233,6 +347,10 @@ func blockHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	block, err := bc.GetBlockByIndex(index)
+	if errors.Is(err, blockchain.ErrBlockPruned) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -241,9 +359,96 @@ func blockHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(block)
 }
 
+// exportHandler streams the chain in the export file format
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := parseHeightRange(w, r)
+	if !ok {
+		return
+	}
+
+	opts := blockchain.ExportOptions{From: from, To: to}
+	state := r.URL.Query().Get("state")
+	opts.IncludeState = state == "true" || state == "1"
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	fw := &flushWriter{w: w}
+	if err := bc.Export(fw, opts); err != nil {
+		log.Printf("Export hatası: %v", err)
+		fw.fail(err, http.StatusBadRequest)
+		return
+	}
+}
+
+// dumpHandler streams the full chain JSON block by block using chunked
+// transfer encoding
+func dumpHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := parseHeightRange(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fw := &flushWriter{w: w}
+	if err := bc.WriteJSON(fw, from, to); err != nil {
+		log.Printf("Dump hatası: %v", err)
+		fw.fail(err, http.StatusBadRequest)
+		return
+	}
+}
+
+// parseHeightRange reads the optional from/to query parameters
+func parseHeightRange(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	from, to := 0, blockchain.LatestHeight
+
+	query := r.URL.Query()
+	if v := query.Get("from"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid from height", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		from = n
+	}
+	if v := query.Get("to"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid to height", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		to = n
+	}
+	return from, to, true
+}
+
+// flushWriter flushes the response after every write so each block is sent
+// to the client as its own chunk
+type flushWriter struct {
+	w       http.ResponseWriter
+	started bool // part of the body has been sent
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	fw.started = true
+	n, err := fw.w.Write(p)
+	if f, ok := fw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
+
+// fail reports an error of the stream. Before anything was sent it is an
+// ordinary error response; afterwards the status is gone, so the
+// connection is aborted and the client sees a truncated stream.
+func (fw *flushWriter) fail(err error, code int) {
+	if !fw.started {
+		http.Error(fw.w, err.Error(), code)
+		return
+	}
+	panic(http.ErrAbortHandler)
+}
+
 func mineHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("🔍 Mining request received: %s %s\n", r.Method, r.URL.Path)
-	fmt.Printf("🔍 Request headers: %v\n", r.Header)
 
 	w.Header().Set("Content-Type", "application/json")
 
@@ -257,29 +462,60 @@ func mineHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The reward is paid in USDTg, so it goes to an EVM address
 	if request.MinerAddress == "" {
-		request.MinerAddress = "anonymous_miner"
+		if evmInstance.Block.Coinbase == (evm.Address{}) {
+			http.Error(w, "miner_address is required, the node has no fee recipient", http.StatusBadRequest)
+			return
+		}
+		request.MinerAddress = evmInstance.Block.Coinbase.Hex()
+	}
+	if addr, err := evm.ParseAddress(request.MinerAddress); err != nil {
+		http.Error(w, "Invalid miner_address: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if addr == (evm.Address{}) {
+		http.Error(w, "Invalid miner_address: the reward would be lost to the zero address", http.StatusBadRequest)
+		return
 	}
 
-	// MOCK RESPONSE - Skip actual mining for now
-	fmt.Printf("🔍 Returning mock mining response...\n")
+	start := time.Now()
+	block, err := mineBlock(request.MinerAddress)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	response := map[string]interface{}{
-		"message": "Block mined successfully! (Mock)",
+		"message": "Block mined successfully!",
 		"block": map[string]interface{}{
-			"index":     2,
-			"hash":      "0x123456789abcdef",
-			"prev_hash": "0x987654321fedcba",
-			"timestamp": time.Now().Format(time.RFC3339),
-			"miner":     request.MinerAddress,
+			"index":            block.Index,
+			"hash":             block.Hash,
+			"prev_hash":        block.PrevHash,
+			"timestamp":        block.Timestamp.Format(time.RFC3339),
+			"miner":            request.MinerAddress,
+			"transactions":     len(block.Transactions),
+			"evm_transactions": len(block.EVMTransactions),
 		},
-		"mining_time": "0.001s",
+		"mining_time": time.Since(start).String(),
 		"timestamp":   time.Now().Format(time.RFC3339),
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
+// mineBlock mines the pending native and EVM transactions into a block
+// and announces it to peers
+func mineBlock(minerAddress string) (blockchain.Block, error) {
+	block, err := bc.MinePendingTransactions(minerAddress)
+	if err != nil {
+		return block, err
+	}
+	if p2pNode != nil {
+		p2pNode.BroadcastBlock(block)
+	}
+	return block, nil
+}
+
 func addTransactionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -302,11 +538,18 @@ func addTransactionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if request.Token == "" {
-		request.Token = "USDTg"
+		request.Token = blockchain.NativeToken
 	}
 
 	// Add transaction
-	bc.AddTransaction(request.From, request.To, request.Amount, request.Token)
+	tx, err := bc.AddTransaction(request.From, request.To, request.Amount, request.Token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if p2pNode != nil {
+		p2pNode.BroadcastTransaction(tx)
+	}
 
 	response := map[string]interface{}{
 		"message": "Transaction added successfully!",
@@ -315,6 +558,7 @@ func addTransactionHandler(w http.ResponseWriter, r *http.Request) {
 			"to":     request.To,
 			"amount": request.Amount,
 			"token":  request.Token,
+			"hash":   tx.Hash,
 		},
 		"pending_transactions": len(bc.PendingTx),
 		"timestamp":            time.Now().Format(time.RFC3339),
@@ -323,14 +567,37 @@ func addTransactionHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// evmAddressParam parses the {address} path variable, answering 400 when
+// it is not a valid address
+func evmAddressParam(w http.ResponseWriter, r *http.Request) (evm.Address, bool) {
+	address, err := evm.ParseAddress(mux.Vars(r)["address"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return evm.Address{}, false
+	}
+	return address, true
+}
+
+// requireDevMode writes an error and returns false unless the node runs
+// in dev mode, where unsigned transactions are accepted
+func requireDevMode(w http.ResponseWriter) bool {
+	if !devMode {
+		http.Error(w, "Unsigned transactions are only accepted in dev mode; send a signed transaction in \"raw\"", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
 // EVM Account Handler
 func evmAccountHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	vars := mux.Vars(r)
-	addressStr := vars["address"]
+	address, ok := evmAddressParam(w, r)
+	if !ok {
+		return
+	}
 
-	account := evmInstance.GetAccount(addressStr)
+	account := evmInstance.GetAccount(address)
 
 	if account == nil {
 		http.Error(w, "Account not found", http.StatusNotFound)
@@ -338,55 +605,123 @@ func evmAccountHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := map[string]interface{}{
-		"address":   account.Address,
-		"nonce":     account.Nonce,
-		"balance":   account.Balance.String(),
-		"code_hash": account.CodeHash,
-		"has_code":  len(account.Code) > 0,
-		"timestamp": time.Now().Format(time.RFC3339),
+		"address":      account.Address,
+		"nonce":        account.Nonce,
+		"balance":      account.Balance.String(),
+		"code_hash":    account.CodeHash,
+		"storage_root": evmInstance.StorageRoot(address),
+		"has_code":     len(account.Code) > 0,
+		"timestamp":    time.Now().Format(time.RFC3339),
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
+// parseDecimal parses an optional non-negative decimal amount; empty
+// means zero
+func parseDecimal(s string) (*big.Int, bool) {
+	if s == "" {
+		return new(big.Int), true
+	}
+	n, ok := new(big.Int).SetString(s, 10)
+	return n, ok && n.Sign() >= 0
+}
+
+// parseGas parses an optional decimal gas limit; empty means zero, which
+// asks for an estimate
+func parseGas(s string) (uint64, bool) {
+	if s == "" {
+		return 0, true
+	}
+	gas, err := strconv.ParseUint(s, 10, 64)
+	return gas, err == nil
+}
+
 // EVM Deploy Contract Handler
 func evmDeployContractHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	if !requireDevMode(w) {
+		return
+	}
+
 	var request struct {
-		From  string `json:"from"`
-		Code  string `json:"code"`
-		Value string `json:"value"`
+		From  evm.Address `json:"from"`
+		Code  evm.Bytes   `json:"code"`
+		Args  evm.Bytes   `json:"args"`
+		Value string      `json:"value"`
+		Gas   string      `json:"gas"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	from := request.From
-	code := request.Code
-	value := new(big.Int)
-	value.SetString(request.Value, 10)
+	value, ok := parseDecimal(request.Value)
+	if !ok {
+		http.Error(w, "Invalid value: "+request.Value, http.StatusBadRequest)
+		return
+	}
+	gas, ok := parseGas(request.Gas)
+	if !ok {
+		http.Error(w, "Invalid gas: "+request.Gas, http.StatusBadRequest)
+		return
+	}
+	data := append(append([]byte{}, request.Code...), request.Args...)
 
-	// Create account if not exists
-	evmInstance.CreateAccount(from)
+	// Without a gas limit, use what the creation needs
+	if gas == 0 {
+		estimate, err := evmInstance.EstimateGas(evm.CallMsg{From: from, Value: value, Data: data}, nil)
+		if err != nil {
+			writeEVMEstimateError(w, err)
+			return
+		}
+		gas = estimate
+	}
 
 	// Deploy contract
-	contract, err := evmInstance.DeployContract(from, code, value)
+	tx := &evm.EVMTransaction{
+		From:     from,
+		Value:    value,
+		Data:     data,
+		Gas:      gas,
+		GasPrice: new(big.Int).Set(evmInstance.Block.BaseFee),
+		Nonce:    bc.PendingNonce(from),
+	}
+	result, err := submitEVMTransaction(tx)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if result == nil {
+		writeEVMTransactionResult(w, tx, nil)
+		return
+	}
+	if !result.Success {
+		http.Error(w, "contract creation failed: "+result.Error, http.StatusBadRequest)
+		return
+	}
+	// Init code may return no runtime code, or the contract may be gone
+	// already, having self-destructed in its constructor
+	address := *result.ContractAddress
+	account := evmInstance.GetAccount(address)
+	if account == nil {
+		account = &evm.Account{Balance: new(big.Int), CodeHash: evm.BytesToHash(evm.Keccak256(nil))}
+	}
 
 	response := map[string]interface{}{
 		"message": "Contract deployed successfully!",
 		"contract": map[string]interface{}{
-			"address":   contract.Address,
-			"balance":   contract.Balance.String(),
-			"code_size": len(contract.Code),
+			"address":   address,
+			"balance":   account.Balance.String(),
+			"code_size": len(account.Code),
+			"code_hash": account.CodeHash,
+			"gas_used":  result.GasUsed,
 		},
-		"timestamp": time.Now().Format(time.RFC3339),
+		"transaction_hash": result.TxHash,
+		"timestamp":        time.Now().Format(time.RFC3339),
 	}
 
 	json.NewEncoder(w).Encode(response)
@@ -396,10 +731,11 @@ func evmDeployContractHandler(w http.ResponseWriter, r *http.Request) {
 func evmContractHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	vars := mux.Vars(r)
-	addressStr := vars["address"]
+	address, ok := evmAddressParam(w, r)
+	if !ok {
+		return
+	}
 
-	address := addressStr
 	contract := evmInstance.GetContract(address)
 
 	if contract == nil {
@@ -423,56 +759,150 @@ func evmTransactionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	var request struct {
-		From     string `json:"from"`
-		To       string `json:"to"`
-		Value    string `json:"value"`
-		Data     string `json:"data"`
-		Gas      string `json:"gas"`
-		GasPrice string `json:"gas_price"`
+		Raw      evm.Bytes   `json:"raw"`
+		From     evm.Address `json:"from"`
+		To       string      `json:"to"`
+		Value    string      `json:"value"`
+		Data     evm.Bytes   `json:"data"`
+		Gas      string      `json:"gas"`
+		GasPrice string      `json:"gas_price"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(request.Raw) > 0 {
+		tx, err := evm.DecodeTransaction(request.Raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err := submitEVMTransaction(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeEVMTransactionResult(w, tx, result)
+		return
+	}
+	if !requireDevMode(w) {
 		return
 	}
 
 	from := request.From
-	to := request.To
-	value := new(big.Int)
-	value.SetString(request.Value, 10)
-	data := []byte(request.Data)
-	gas, _ := strconv.ParseUint(request.Gas, 10, 64)
-	gasPrice := new(big.Int)
-	gasPrice.SetString(request.GasPrice, 10)
-
-	// Create accounts if not exist
-	evmInstance.CreateAccount(from)
-	evmInstance.CreateAccount(to)
+	var to *evm.Address
+	if request.To != "" {
+		addr, err := evm.ParseAddress(request.To)
+		if err != nil {
+			http.Error(w, "Invalid to address: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		to = &addr
+	}
+	value, ok := parseDecimal(request.Value)
+	if !ok {
+		http.Error(w, "Invalid value: "+request.Value, http.StatusBadRequest)
+		return
+	}
+	gas, ok := parseGas(request.Gas)
+	if !ok {
+		http.Error(w, "Invalid gas: "+request.Gas, http.StatusBadRequest)
+		return
+	}
+	gasPrice, ok := parseDecimal(request.GasPrice)
+	if !ok {
+		http.Error(w, "Invalid gas_price: "+request.GasPrice, http.StatusBadRequest)
+		return
+	}
+
+	// Without a gas limit, use what the transaction needs
+	if gas == 0 {
+		msg := evm.CallMsg{From: from, To: to, Value: value, Data: request.Data, GasPrice: gasPrice}
+		estimate, err := evmInstance.EstimateGas(msg, nil)
+		if err != nil {
+			writeEVMEstimateError(w, err)
+			return
+		}
+		gas = estimate
+	}
 
 	// Create transaction
 	tx := &evm.EVMTransaction{
 		From:     from,
 		To:       to,
 		Value:    value,
-		Data:     data,
+		Data:     request.Data,
 		Gas:      gas,
 		GasPrice: gasPrice,
-		Nonce:    evmInstance.GetAccount(from).Nonce,
+		Nonce:    bc.PendingNonce(from),
 	}
 
 	// Execute transaction
-	result, err := evmInstance.ExecuteTransaction(tx)
+	result, err := submitEVMTransaction(tx)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	writeEVMTransactionResult(w, tx, result)
+}
+
+// submitEVMTransaction adds an EVM transaction to the mempool. In dev mode
+// a block is mined right away, as on a local dev chain, so the result is
+// known at once. Otherwise, or when the transaction cannot run yet, the
+// result is nil until a block includes the transaction.
+func submitEVMTransaction(tx *evm.EVMTransaction) (*evm.TransactionResult, error) {
+	if _, err := bc.SubmitEVMTransaction(tx); err != nil {
+		return nil, err
+	}
+	if devMode {
+		if _, err := mineBlock(evmInstance.Block.Coinbase.Hex()); err != nil {
+			return nil, err
+		}
+	}
+	return evmInstance.GetTransactionResult(tx.Hash), nil
+}
+
+// writeEVMTransactionResult answers an EVM transaction with its result, or
+// as pending while no block has included it
+func writeEVMTransactionResult(w http.ResponseWriter, tx *evm.EVMTransaction, result *evm.TransactionResult) {
+	if result == nil {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":          "Transaction is pending until a block includes it",
+			"status":           "pending",
+			"transaction_hash": tx.Hash,
+			"from":             tx.From,
+			"timestamp":        time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	logs := result.Logs
+	if logs == nil {
+		logs = []*evm.Log{}
+	}
+	txResult := map[string]interface{}{
+		"transaction_hash": result.TxHash,
+		"from":             tx.From,
+		"gas_used":         result.GasUsed,
+		"fee":              new(big.Int).Mul(new(big.Int).SetUint64(result.GasUsed), result.EffectiveGasPrice).String(),
+		"success":          result.Success,
+		"return":           result.Return,
+		"error":            result.Error,
+		"error_code":       result.ErrorCode,
+		"revert":           result.Revert,
+		"logs":             logs,
+	}
+	if result.ContractAddress != nil {
+		txResult["contract_address"] = result.ContractAddress
+	}
+
 	response := map[string]interface{}{
-		"message": "Transaction executed successfully!",
-		"result": map[string]interface{}{
-			"gas_used": result.GasUsed,
-			"success":  result.Success,
-		},
+		"message":   "Transaction executed successfully!",
+		"result":    txResult,
 		"timestamp": time.Now().Format(time.RFC3339),
 	}
 
@@ -483,10 +913,11 @@ func evmTransactionHandler(w http.ResponseWriter, r *http.Request) {
 func evmBalanceHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	vars := mux.Vars(r)
-	addressStr := vars["address"]
+	address, ok := evmAddressParam(w, r)
+	if !ok {
+		return
+	}
 
-	address := addressStr
 	balance := evmInstance.GetBalance(address)
 
 	response := map[string]interface{}{
@@ -498,33 +929,284 @@ func evmBalanceHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// EVM Add Balance Handler
+// EVM Storage Handler
+func evmStorageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	address, ok := evmAddressParam(w, r)
+	if !ok {
+		return
+	}
+	slot, err := parseStorageSlot(mux.Vars(r)["slot"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]interface{}{
+		"address":   address,
+		"slot":      slot,
+		"value":     evmInstance.GetStorage(address, slot),
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseStorageSlot parses a storage slot given in 0x-prefixed hex or in
+// decimal
+func parseStorageSlot(s string) (evm.Hash, error) {
+	slot, ok := new(big.Int), false
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		_, ok = slot.SetString(s[2:], 16)
+	} else {
+		_, ok = slot.SetString(s, 10)
+	}
+	if !ok || slot.Sign() < 0 || slot.BitLen() > 256 {
+		return evm.Hash{}, fmt.Errorf("invalid storage slot %q: expected a 256-bit number in hex or decimal", s)
+	}
+	return evm.BigToHash(slot), nil
+}
+
+// EVM Add Balance Handler. A dev mode faucet: the USDTg is minted by a
+// faucet transaction in a block, so every node replaying the chain agrees.
 func evmAddBalanceHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	if !devMode {
+		http.Error(w, "The faucet is only available in dev mode", http.StatusForbidden)
+		return
+	}
+
 	var request struct {
-		Address string `json:"address"`
-		Amount  string `json:"amount"`
+		Address evm.Address `json:"address"`
+		Amount  string      `json:"amount"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	amount := new(big.Int)
-	amount.SetString(request.Amount, 10)
+	amount, ok := new(big.Int).SetString(request.Amount, 10)
+	if !ok || amount.Sign() <= 0 || !blockchain.WeiMultiple(amount) {
+		http.Error(w, fmt.Sprintf("Invalid amount %q: expected a positive wei amount in whole units of 10^%d wei", request.Amount, 18-blockchain.NativeDecimals), http.StatusBadRequest)
+		return
+	}
 
-	// Add balance to account
-	evmInstance.AddBalance(request.Address, amount)
+	// Mint through a block
+	tx, err := bc.AddTransaction(blockchain.FaucetAddress, request.Address.Hex(), blockchain.FromWei(amount), blockchain.NativeToken)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	block, err := mineBlock(evmInstance.Block.Coinbase.Hex())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	response := map[string]interface{}{
-		"message":     "Balance added successfully!",
-		"address":     request.Address,
-		"amount":      request.Amount,
-		"new_balance": evmInstance.GetBalance(request.Address).String(),
-		"timestamp":   time.Now().Format(time.RFC3339),
+		"message":          "Balance added successfully!",
+		"address":          request.Address,
+		"amount":           request.Amount,
+		"new_balance":      evmInstance.GetBalance(request.Address).String(),
+		"transaction_hash": tx.Hash,
+		"block":            block.Index,
+		"timestamp":        time.Now().Format(time.RFC3339),
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// EVM Receipt Handler
+func evmReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var hash evm.Hash
+	if err := hash.UnmarshalText([]byte(mux.Vars(r)["hash"])); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	receipt := evmInstance.GetReceipt(hash)
+	if receipt == nil {
+		http.Error(w, "Receipt not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(receipt)
+}
+
+// EVM Block Handler
+func evmBlockHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	number, err := strconv.ParseUint(mux.Vars(r)["number"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid block number", http.StatusBadRequest)
+		return
+	}
+
+	receipts, bloom := evmInstance.GetBlockReceipts(number)
+	if receipts == nil {
+		receipts = []*evm.Receipt{}
+	}
+
+	response := map[string]interface{}{
+		"number":     number,
+		"logs_bloom": bloom,
+		"receipts":   receipts,
+		"timestamp":  time.Now().Format(time.RFC3339),
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// EVM Logs Handler
+func evmLogsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var query evm.FilterQuery
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logs, err := evmInstance.FilterLogs(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]interface{}{
+		"logs":         logs,
+		"count":        len(logs),
+		"latest_block": evmInstance.BlockNumber(),
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// evmCallRequest is the body of the call and estimate endpoints
+type evmCallRequest struct {
+	From     evm.Address `json:"from"`
+	To       string      `json:"to"`
+	Value    string      `json:"value"`
+	Data     evm.Bytes   `json:"data"`
+	Gas      string      `json:"gas"`
+	GasPrice string      `json:"gas_price"`
+	Block    *uint64     `json:"block"`
+}
+
+// decodeEVMCallRequest reads a call request into a message and the block
+// to run it at, nil for the next block, answering bad requests itself
+func decodeEVMCallRequest(w http.ResponseWriter, r *http.Request) (evm.CallMsg, *uint64, bool) {
+	var request evmCallRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return evm.CallMsg{}, nil, false
+	}
+
+	msg := evm.CallMsg{From: request.From, Data: request.Data}
+	if request.To != "" {
+		addr, err := evm.ParseAddress(request.To)
+		if err != nil {
+			http.Error(w, "Invalid to address: "+err.Error(), http.StatusBadRequest)
+			return msg, nil, false
+		}
+		msg.To = &addr
+	}
+	var ok bool
+	if msg.Value, ok = parseDecimal(request.Value); !ok {
+		http.Error(w, "Invalid value: "+request.Value, http.StatusBadRequest)
+		return msg, nil, false
+	}
+	if msg.GasPrice, ok = parseDecimal(request.GasPrice); !ok {
+		http.Error(w, "Invalid gas_price: "+request.GasPrice, http.StatusBadRequest)
+		return msg, nil, false
+	}
+	if msg.Gas, ok = parseGas(request.Gas); !ok {
+		http.Error(w, "Invalid gas: "+request.Gas, http.StatusBadRequest)
+		return msg, nil, false
+	}
+
+	return msg, request.Block, true
+}
+
+// callBlock returns the number of the block a call ran at, the next one
+// for nil
+func callBlock(number *uint64) uint64 {
+	if number != nil {
+		return *number
+	}
+	return evmInstance.BlockNumber() + 1
+}
+
+// EVM Call Handler
+func evmCallHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	msg, number, ok := decodeEVMCallRequest(w, r)
+	if !ok {
+		return
+	}
+	result, err := evmInstance.Call(msg, number)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]interface{}{
+		"block":      callBlock(number),
+		"success":    result.Success,
+		"return":     result.Return,
+		"gas_used":   result.GasUsed,
+		"error":      result.Error,
+		"error_code": result.ErrorCode,
+		"revert":     result.Revert,
+		"timestamp":  time.Now().Format(time.RFC3339),
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
+
+// EVM Estimate Gas Handler
+func evmEstimateGasHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	msg, number, ok := decodeEVMCallRequest(w, r)
+	if !ok {
+		return
+	}
+	gas, err := evmInstance.EstimateGas(msg, number)
+	if err != nil {
+		writeEVMEstimateError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"block":     callBlock(number),
+		"gas":       gas,
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeEVMEstimateError answers a failed gas estimate, with the revert
+// reason and data when the execution reverted
+func writeEVMEstimateError(w http.ResponseWriter, err error) {
+	var revert *evm.RevertError
+	if !errors.As(err, &revert) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":      revert.Error(),
+		"error_code": evm.ErrorCode(revert),
+		"revert":     revert,
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"usdtg-chain/blockchain"
+	"usdtg-chain/evm"
+)
+
+func TestMineRequiresMiner(t *testing.T) {
+	startTestChain(t, blockchain.PruningConfig{})
+	mine := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mineHandler(w, httptest.NewRequest("POST", "/api/blockchain/mine", strings.NewReader(body)))
+		return w
+	}
+
+	// Without a fee recipient the reward needs an explicit owner
+	for _, body := range []string{`{}`, `{"miner_address": "0x0000000000000000000000000000000000000000"}`} {
+		if w := mine(body); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status %d, want 400", body, w.Code)
+		}
+	}
+	if bc.Height() != 0 {
+		t.Fatal("rejected requests mined a block")
+	}
+	if w := mine(`{"miner_address": "` + testMiner + `"}`); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	// The fee recipient is the default
+	evmInstance.Block.Coinbase = evm.BytesToAddress([]byte{0xfe})
+	if w := mine(`{}`); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if evmInstance.GetBalance(evmInstance.Block.Coinbase).Sign() == 0 {
+		t.Fatal("fee recipient not rewarded")
+	}
+}
+
+func TestDevModeRequiresFeeRecipient(t *testing.T) {
+	cfg := DefaultNodeConfig()
+	cfg.DevMode = true
+	if err := StartServer(cfg); err == nil || !strings.Contains(err.Error(), "fee recipient") {
+		t.Fatalf("dev mode without a fee recipient: %v", err)
+	}
+}
+
+func TestDumpHandler(t *testing.T) {
+	startTestChain(t, blockchain.PruningConfig{})
+	for i := 0; i < 3; i++ {
+		if _, err := bc.MinePendingTransactions(testMiner); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The dump is flushed as it is written, so the server sends it in
+	// chunks instead of buffering the whole response
+	w := httptest.NewRecorder()
+	dumpHandler(w, httptest.NewRequest("GET", "/api/blockchain/dump?from=1&to=2", nil))
+	if w.Code != http.StatusOK || !w.Flushed {
+		t.Fatalf("status %d, flushed %v", w.Code, w.Flushed)
+	}
+	var dump blockchain.Blockchain
+	if err := json.Unmarshal(w.Body.Bytes(), &dump); err != nil {
+		t.Fatal(err)
+	}
+	if len(dump.Chain) != 2 || dump.Chain[0].Index != 1 || dump.Chain[1].Index != 2 {
+		t.Fatalf("dumped %d blocks", len(dump.Chain))
+	}
+
+	for _, query := range []string{"?from=x", "?to=x", "?from=3&to=1", "?from=4"} {
+		w := httptest.NewRecorder()
+		dumpHandler(w, httptest.NewRequest("GET", "/api/blockchain/dump"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"usdtg-chain/p2p"
+
+	"github.com/gorilla/mux"
+)
+
+// netRoutePrefix is served without CORS, so that web pages cannot read
+// node details or preflight requests to the admin endpoints
+const netRoutePrefix = "/api/net/"
+
+// registerNetRoutes adds the networking endpoints to the router
+func registerNetRoutes(r *mux.Router, adminToken string) {
+	admin := func(h http.HandlerFunc) http.HandlerFunc {
+		return requireAdmin(adminToken, h)
+	}
+
+	r.HandleFunc("/api/net/info", netInfoHandler).Methods("GET")
+	r.HandleFunc("/api/net/peers", netPeersHandler).Methods("GET")
+	r.HandleFunc("/api/net/peers", admin(netAddPeerHandler)).Methods("POST")
+	r.HandleFunc("/api/net/peers/{id}", admin(netRemovePeerHandler)).Methods("DELETE")
+	r.HandleFunc("/api/net/peers/{id}/ban", admin(netBanPeerHandler)).Methods("POST")
+	r.HandleFunc("/api/net/peers/{id}/ban", admin(netUnbanPeerHandler)).Methods("DELETE")
+}
+
+// requireAdmin protects operator endpoints. With an admin token configured
+// the request must carry it as a bearer token; without one only loopback
+// clients are allowed, and not on behalf of a web page from another origin,
+// which a browser on the operator's machine would otherwise send.
+func requireAdmin(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		} else if !isLoopback(r.RemoteAddr) {
+			http.Error(w, "Admin endpoints are only available from localhost", http.StatusForbidden)
+			return
+		} else if crossOrigin(r) {
+			http.Error(w, "Admin endpoints cannot be called from web pages", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// crossOrigin reports whether a browser sent the request for a page that
+// was not served by the node itself
+func crossOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "none", "same-origin":
+	default:
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || u.Host != r.Host
+}
+
+// requireJSON writes an error and returns false unless the request body is
+// declared as JSON. Browsers cannot send such a body to another origin
+// without a preflight.
+func requireJSON(w http.ResponseWriter, r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+	return true
+}
+
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// requireP2P writes an error and returns false when networking is disabled
+func requireP2P(w http.ResponseWriter) bool {
+	if p2pNode == nil {
+		http.Error(w, "P2P networking is disabled", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+func netInfoHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	response := map[string]interface{}{
+		"enabled":   p2pNode != nil,
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+	if p2pNode != nil {
+		response["node"] = p2pNode.Info()
+		response["sync"] = p2pNode.SyncStatus()
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+func netPeersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireP2P(w) {
+		return
+	}
+
+	peers := p2pNode.Peers()
+	response := map[string]interface{}{
+		"peers":     peers,
+		"count":     len(peers),
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+func netAddPeerHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireP2P(w) {
+		return
+	}
+
+	var request struct {
+		Addr string `json:"addr"`
+	}
+	if !requireJSON(w, r) {
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Addr == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := p2pNode.AddPeer(request.Addr); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":   "Peer added successfully!",
+		"addr":      request.Addr,
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+func netRemovePeerHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireP2P(w) {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if err := p2pNode.RemovePeer(id); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, p2p.ErrPeerNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":   "Peer removed successfully!",
+		"id":        id,
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+func netBanPeerHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireP2P(w) {
+		return
+	}
+
+	// The body is optional; without it the default ban duration applies
+	var request struct {
+		DurationSeconds int64 `json:"duration_seconds"`
+	}
+	if r.ContentLength != 0 {
+		if !requireJSON(w, r) {
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.DurationSeconds < 0 {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	id := mux.Vars(r)["id"]
+	if err := p2pNode.BanPeer(id, time.Duration(request.DurationSeconds)*time.Second); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":   "Peer banned successfully!",
+		"id":        id,
+		"bans":      p2pNode.Bans(),
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+func netUnbanPeerHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireP2P(w) {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	p2pNode.UnbanPeer(id)
+
+	response := map[string]interface{}{
+		"message":   "Peer unbanned successfully!",
+		"id":        id,
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
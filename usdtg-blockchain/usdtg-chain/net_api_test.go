@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"usdtg-chain/blockchain"
+	"usdtg-chain/p2p"
+
+	"github.com/gorilla/mux"
+)
+
+const testAdminToken = "secret"
+
+// startTestP2P starts a node on a loopback port as the server's p2pNode
+// and a second node for it to dial, returning the second one's address
+func startTestP2P(t *testing.T) string {
+	t.Helper()
+	start := func() *p2p.Node {
+		chain := blockchain.NewBlockchain()
+		t.Cleanup(func() { chain.Close() })
+		cfg := p2p.DefaultConfig()
+		cfg.ListenAddr = "127.0.0.1:0"
+		n, err := p2p.NewNode(cfg, chain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := n.Start(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(n.Stop)
+		return n
+	}
+
+	p2pNode = start()
+	t.Cleanup(func() { p2pNode = nil })
+	return start().Addr()
+}
+
+// netRequest serves a request to the networking routes as it would arrive
+// from remoteAddr
+func netRequest(token, method, path, remoteAddr, body string, header map[string]string) *httptest.ResponseRecorder {
+	r := mux.NewRouter()
+	r.Use(corsMiddleware)
+	registerNetRoutes(r, token)
+
+	req := httptest.NewRequest(method, "http://localhost:8080"+path, strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestNetAdminAuth(t *testing.T) {
+	peer := startTestP2P(t)
+	body := `{"addr": "` + peer + `"}`
+	jsonType := map[string]string{"Content-Type": "application/json"}
+
+	tests := []struct {
+		name       string
+		token      string
+		remoteAddr string
+		header     map[string]string
+		body       string
+		want       int
+	}{
+		{"no token sent", testAdminToken, "127.0.0.1:5000", jsonType, body, http.StatusUnauthorized},
+		{"wrong token", testAdminToken, "127.0.0.1:5000", map[string]string{"Content-Type": "application/json", "Authorization": "Bearer wrong"}, body, http.StatusUnauthorized},
+		{"remote client", "", "192.0.2.1:5000", jsonType, body, http.StatusForbidden},
+		{"other origin", "", "127.0.0.1:5000", map[string]string{"Content-Type": "application/json", "Origin": "https://example.com"}, body, http.StatusForbidden},
+		{"cross-site fetch", "", "127.0.0.1:5000", map[string]string{"Content-Type": "application/json", "Sec-Fetch-Site": "cross-site"}, body, http.StatusForbidden},
+		{"other localhost port", "", "127.0.0.1:5000", map[string]string{"Content-Type": "application/json", "Origin": "http://localhost:3000"}, body, http.StatusForbidden},
+		{"text body", "", "127.0.0.1:5000", map[string]string{"Content-Type": "text/plain"}, body, http.StatusUnsupportedMediaType},
+		{"no content type", "", "127.0.0.1:5000", nil, body, http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		w := netRequest(tt.token, "POST", "/api/net/peers", tt.remoteAddr, tt.body, tt.header)
+		if w.Code != tt.want {
+			t.Fatalf("%s: status %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+	if n := len(p2pNode.Peers()); n != 0 {
+		t.Fatalf("rejected requests connected %d peers", n)
+	}
+
+	// A local command line client, and a client with the token from anywhere
+	w := netRequest("", "POST", "/api/net/peers", "127.0.0.1:5000", body, map[string]string{"Content-Type": "application/json; charset=utf-8"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("loopback client: status %d: %s", w.Code, w.Body)
+	}
+	if n := len(p2pNode.Peers()); n != 1 {
+		t.Fatalf("%d peers after adding one", n)
+	}
+	id := p2pNode.Peers()[0].ID
+	w = netRequest(testAdminToken, "POST", "/api/net/peers/"+id+"/ban", "192.0.2.1:5000", "", map[string]string{"Authorization": "Bearer " + testAdminToken})
+	if w.Code != http.StatusOK {
+		t.Fatalf("client with the token: status %d: %s", w.Code, w.Body)
+	}
+	if len(p2pNode.Bans()) != 1 {
+		t.Fatal("peer not banned")
+	}
+}
+
+func TestNetRoutesWithoutCORS(t *testing.T) {
+	startTestP2P(t)
+
+	for _, path := range []string{"/api/net/peers", "/api/net/info"} {
+		w := netRequest("", "OPTIONS", path, "127.0.0.1:5000", "", map[string]string{
+			"Origin":                        "https://example.com",
+			"Access-Control-Request-Method": "POST",
+		})
+		if w.Code == http.StatusOK {
+			t.Fatalf("%s: preflight answered", path)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Fatalf("%s: preflight allows origin %q", path, got)
+		}
+
+		w = netRequest("", "GET", path, "127.0.0.1:5000", "", nil)
+		if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Fatalf("%s: status %d, CORS %q", path, w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+		}
+	}
+}
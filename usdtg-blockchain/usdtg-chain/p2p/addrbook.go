@@ -0,0 +1,257 @@
+package p2p
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Address sources
+const (
+	SourceSeed    = "seed"
+	SourceStatic  = "static"
+	SourcePEX     = "pex"
+	SourceInbound = "inbound"
+)
+
+const (
+	backoffBase = time.Minute
+	backoffMax  = time.Hour
+	// Addresses that never connected are forgotten after this many
+	// consecutive failures. Seeds and static peers are always kept.
+	maxFailedAttempts = 10
+	maxAddrBookSize   = 1000
+)
+
+// KnownAddress is an address book entry
+type KnownAddress struct {
+	Addr        string    `json:"addr"`
+	Source      string    `json:"source"`
+	Attempts    int       `json:"attempts"`
+	LastAttempt time.Time `json:"last_attempt,omitempty"`
+	LastSuccess time.Time `json:"last_success,omitempty"`
+}
+
+// nextAttempt returns when the address may be dialed again. Each failed
+// attempt doubles the wait, up to backoffMax.
+func (ka *KnownAddress) nextAttempt() time.Time {
+	if ka.Attempts == 0 {
+		return time.Time{}
+	}
+
+	wait := backoffBase << uint(ka.Attempts-1)
+	if wait > backoffMax || wait <= 0 {
+		wait = backoffMax
+	}
+	return ka.LastAttempt.Add(wait)
+}
+
+// permanent reports whether the entry must never be evicted
+func (ka *KnownAddress) permanent() bool {
+	return ka.Source == SourceSeed || ka.Source == SourceStatic
+}
+
+// AddrBook keeps the addresses of known peers and persists them to a JSON
+// file so a restarted node can reconnect without seeds
+type AddrBook struct {
+	path  string
+	addrs map[string]*KnownAddress
+	mu    sync.Mutex
+}
+
+// NewAddrBook loads the address book from path. An empty path keeps the
+// book in memory only.
+func NewAddrBook(path string) (*AddrBook, error) {
+	book := &AddrBook{path: path, addrs: make(map[string]*KnownAddress)}
+	if path == "" {
+		return book, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return book, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*KnownAddress
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	for _, ka := range entries {
+		book.addrs[ka.Addr] = ka
+	}
+	return book, nil
+}
+
+// Add records an address. It reports whether the address was new.
+func (b *AddrBook) Add(addr, source string) bool {
+	if !validAddr(addr) {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ka, ok := b.addrs[addr]; ok {
+		// Configured addresses keep their stronger source
+		if source == SourceSeed || source == SourceStatic {
+			ka.Source = source
+		}
+		return false
+	}
+	if len(b.addrs) >= maxAddrBookSize && source != SourceSeed && source != SourceStatic {
+		return false
+	}
+
+	b.addrs[addr] = &KnownAddress{Addr: addr, Source: source}
+	return true
+}
+
+// Remove forgets an address
+func (b *AddrBook) Remove(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.addrs, addr)
+}
+
+// MarkAttempt records a failed dial
+func (b *AddrBook) MarkAttempt(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ka, ok := b.addrs[addr]
+	if !ok {
+		return
+	}
+	ka.Attempts++
+	ka.LastAttempt = time.Now()
+	if ka.Attempts >= maxFailedAttempts && ka.LastSuccess.IsZero() && !ka.permanent() {
+		delete(b.addrs, addr)
+	}
+}
+
+// MarkGood records a successful connection and resets the backoff
+func (b *AddrBook) MarkGood(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ka, ok := b.addrs[addr]; ok {
+		ka.Attempts = 0
+		ka.LastAttempt = time.Now()
+		ka.LastSuccess = ka.LastAttempt
+	}
+}
+
+// Candidates returns up to n addresses whose backoff has expired, skipping
+// those for which skip returns true
+func (b *AddrBook) Candidates(n int, skip func(addr string) bool) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	var ready []*KnownAddress
+	for _, ka := range b.addrs {
+		if now.Before(ka.nextAttempt()) || skip(ka.Addr) {
+			continue
+		}
+		ready = append(ready, ka)
+	}
+
+	// Prefer addresses that worked before, then the least recently tried
+	sort.Slice(ready, func(i, j int) bool {
+		if ready[i].LastSuccess.IsZero() != ready[j].LastSuccess.IsZero() {
+			return !ready[i].LastSuccess.IsZero()
+		}
+		return ready[i].LastAttempt.Before(ready[j].LastAttempt)
+	})
+
+	if len(ready) > n {
+		ready = ready[:n]
+	}
+	addrs := make([]string, len(ready))
+	for i, ka := range ready {
+		addrs[i] = ka.Addr
+	}
+	return addrs
+}
+
+// Random returns up to n random addresses, used to answer peer exchange
+// requests. Addresses that keep failing are not shared.
+func (b *AddrBook) Random(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	addrs := make([]string, 0, len(b.addrs))
+	for addr, ka := range b.addrs {
+		if ka.Attempts < 3 {
+			addrs = append(addrs, addr)
+		}
+	}
+	rand.Shuffle(len(addrs), func(i, j int) { addrs[i], addrs[j] = addrs[j], addrs[i] })
+
+	if len(addrs) > n {
+		addrs = addrs[:n]
+	}
+	return addrs
+}
+
+// Size returns the number of known addresses
+func (b *AddrBook) Size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.addrs)
+}
+
+// Entries returns a copy of all entries sorted by address
+func (b *AddrBook) Entries() []KnownAddress {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entries := make([]KnownAddress, 0, len(b.addrs))
+	for _, ka := range b.addrs {
+		entries = append(entries, *ka)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Addr < entries[j].Addr })
+	return entries
+}
+
+// Save writes the address book to its file atomically
+func (b *AddrBook) Save() error {
+	if b.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(b.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(b.path), 0o755); err != nil {
+		return err
+	}
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// validAddr reports whether addr is a dialable host:port
+func validAddr(addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" || port == "" || port == "0" {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		return false
+	}
+	return true
+}
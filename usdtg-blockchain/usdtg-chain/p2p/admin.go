@@ -0,0 +1,135 @@
+package p2p
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrPeerNotFound is returned when an operation names a peer that is not
+// connected
+var ErrPeerNotFound = errors.New("p2p: peer not connected")
+
+// NodeInfo summarizes the state of the P2P node
+type NodeInfo struct {
+	ID              string    `json:"id"`
+	ListenAddr      string    `json:"listen_addr"`
+	ChainID         string    `json:"chain_id"`
+	ProtocolVersion int       `json:"protocol_version"`
+	GenesisHash     string    `json:"genesis_hash"`
+	Height          int       `json:"height"`
+	Inbound         int       `json:"inbound"`
+	Outbound        int       `json:"outbound"`
+	MaxInbound      int       `json:"max_inbound"`
+	MaxOutbound     int       `json:"max_outbound"`
+	KnownAddrs      int       `json:"known_addrs"`
+	Allowlist       []string  `json:"allowlist,omitempty"`
+	Bans            []BanInfo `json:"bans"`
+}
+
+// BanInfo describes a banned node
+type BanInfo struct {
+	ID    string    `json:"id"`
+	Until time.Time `json:"until"`
+}
+
+// Info returns a summary of the node
+func (n *Node) Info() NodeInfo {
+	n.mu.RLock()
+	inbound := n.countPeers(Inbound)
+	outbound := n.countPeers(Outbound)
+	n.mu.RUnlock()
+
+	return NodeInfo{
+		ID:              n.id,
+		ListenAddr:      n.Addr(),
+		ChainID:         n.cfg.ChainID,
+		ProtocolVersion: ProtocolVersion,
+		GenesisHash:     n.chain.GenesisHash(),
+		Height:          n.chain.Height(),
+		Inbound:         inbound,
+		Outbound:        outbound,
+		MaxInbound:      n.cfg.MaxInbound,
+		MaxOutbound:     n.cfg.MaxOutbound,
+		KnownAddrs:      n.book.Size(),
+		Allowlist:       n.cfg.Allowlist,
+		Bans:            n.Bans(),
+	}
+}
+
+// Bans returns the active bans sorted by node ID
+func (n *Node) Bans() []BanInfo {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	bans := []BanInfo{}
+	for id, until := range n.banned {
+		if now.After(until) {
+			delete(n.banned, id)
+			continue
+		}
+		bans = append(bans, BanInfo{ID: id, Until: until})
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].ID < bans[j].ID })
+	return bans
+}
+
+// AddPeer remembers addr as a permanent address and dials it. Discovery
+// keeps redialing it if the connection drops. A peer that is already
+// connected, possibly dialed by discovery in the meantime, is not an error.
+func (n *Node) AddPeer(addr string) error {
+	if !validAddr(addr) {
+		return fmt.Errorf("p2p: invalid peer address %q", addr)
+	}
+	n.book.Add(addr, SourceStatic)
+
+	err := n.Connect(addr)
+	switch {
+	case err == nil:
+		n.book.MarkGood(addr)
+	case errors.Is(err, errDuplicatePeer):
+		return nil
+	default:
+		n.book.MarkAttempt(addr)
+	}
+	return err
+}
+
+// RemovePeer disconnects a peer and forgets its address so that discovery
+// does not dial it again
+func (n *Node) RemovePeer(id string) error {
+	n.mu.RLock()
+	p := n.peers[id]
+	n.mu.RUnlock()
+	if p == nil {
+		return ErrPeerNotFound
+	}
+
+	if p.ListenAddr != "" {
+		n.book.Remove(p.ListenAddr)
+	}
+	p.Close()
+	return nil
+}
+
+// BanPeer disconnects the node with the given ID, if connected, and refuses
+// it for d
+func (n *Node) BanPeer(id string, d time.Duration) error {
+	if !validNodeID(id) {
+		return fmt.Errorf("p2p: invalid node id %q", id)
+	}
+	if d <= 0 {
+		d = banDuration
+	}
+	n.ban(id, d)
+	return nil
+}
+
+// UnbanPeer lifts a ban
+func (n *Node) UnbanPeer(id string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.banned, id)
+}
@@ -0,0 +1,168 @@
+package p2p
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"time"
+)
+
+const (
+	discoveryInterval = 5 * time.Second
+	pexInterval       = 30 * time.Second
+	addrBookSaveEvery = time.Minute
+)
+
+// discoveryLoop keeps the outbound peer count up by dialing addresses from
+// the address book and periodically exchanges addresses with peers
+func (n *Node) discoveryLoop() {
+	defer n.wg.Done()
+
+	ticker := time.NewTicker(discoveryInterval)
+	defer ticker.Stop()
+	pex := time.NewTicker(pexInterval)
+	defer pex.Stop()
+	save := time.NewTicker(addrBookSaveEvery)
+	defer save.Stop()
+
+	n.ensurePeers()
+	for {
+		select {
+		case <-n.quit:
+			if err := n.book.Save(); err != nil {
+				log.Printf("p2p: saving address book: %v", err)
+			}
+			return
+		case <-ticker.C:
+			n.ensurePeers()
+		case <-pex.C:
+			if peers := n.peerList(); len(peers) > 0 {
+				n.requestAddrs(peers[rand.Intn(len(peers))])
+			}
+		case <-save.C:
+			if err := n.book.Save(); err != nil {
+				log.Printf("p2p: saving address book: %v", err)
+			}
+		}
+	}
+}
+
+// ensurePeers dials address book candidates while outbound slots are free
+func (n *Node) ensurePeers() {
+	n.mu.RLock()
+	need := n.cfg.MaxOutbound - n.countPeers(Outbound) - len(n.dialing)
+	n.mu.RUnlock()
+	if need <= 0 {
+		return
+	}
+
+	candidates := n.book.Candidates(need, func(addr string) bool {
+		return n.connectedTo(addr) || n.isDialing(addr) || n.isStatic(addr)
+	})
+	for _, addr := range candidates {
+		n.mu.Lock()
+		n.dialing[addr] = true
+		n.mu.Unlock()
+
+		n.wg.Add(1)
+		go n.dialKnown(addr)
+	}
+}
+
+// dialKnown dials an address book entry and records the outcome
+func (n *Node) dialKnown(addr string) {
+	defer n.wg.Done()
+	defer func() {
+		n.mu.Lock()
+		delete(n.dialing, addr)
+		n.mu.Unlock()
+	}()
+
+	err := n.Connect(addr)
+	switch {
+	case err == nil:
+		n.book.MarkGood(addr)
+	case errors.Is(err, errSelfConnection):
+		n.book.Remove(addr)
+	case errors.Is(err, errDuplicatePeer):
+	default:
+		n.book.MarkAttempt(addr)
+	}
+}
+
+// requestAddrs asks a peer for addresses
+func (n *Node) requestAddrs(p *Peer) {
+	p.mu.Lock()
+	p.addrsRequested = true
+	p.mu.Unlock()
+
+	if msg, err := newMessage(MsgGetAddrs, GetAddrs{}); err == nil {
+		p.Send(msg)
+	}
+}
+
+// serveAddrs answers a GetAddrs request with random known addresses
+func (n *Node) serveAddrs(p *Peer) {
+	addrs := n.book.Random(maxAddrsPerMsg)
+	if msg, err := newMessage(MsgAddrs, Addrs{Addrs: addrs}); err == nil {
+		p.Send(msg)
+	}
+}
+
+// handleAddrs adds addresses received from a peer to the address book.
+// Addresses that were not asked for are ignored.
+func (n *Node) handleAddrs(p *Peer, addrs Addrs) {
+	p.mu.Lock()
+	requested := p.addrsRequested
+	p.addrsRequested = false
+	p.mu.Unlock()
+
+	if !requested {
+		return
+	}
+	if len(addrs.Addrs) > maxAddrsPerMsg {
+		n.penalize(p, scoreInvalid, errors.New("too many addresses"))
+		return
+	}
+
+	// Peers that learned our address hand it back; when it is reachable
+	// under another name the self-connection check removes it instead
+	self := n.advertisedAddr()
+	for _, addr := range addrs.Addrs {
+		if addr != self {
+			n.book.Add(addr, SourcePEX)
+		}
+	}
+}
+
+// AddrBook returns the node's address book
+func (n *Node) AddrBook() *AddrBook {
+	return n.book
+}
+
+func (n *Node) isDialing(addr string) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.dialing[addr]
+}
+
+func (n *Node) isStatic(addr string) bool {
+	for _, static := range n.cfg.Peers {
+		if static == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// countPeers counts connected peers in a direction. The caller must hold
+// the lock.
+func (n *Node) countPeers(dir Direction) int {
+	count := 0
+	for _, p := range n.peers {
+		if p.Direction == dir {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,119 @@
+package p2p
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"usdtg-chain/blockchain"
+)
+
+// TestDiscoveryOverLoopback starts a seed and two nodes that only know the
+// seed; the second learns the first from the seed and dials it
+func TestDiscoveryOverLoopback(t *testing.T) {
+	chainSeed := blockchain.NewBlockchain()
+	defer chainSeed.Close()
+	seed := startTestNode(t, chainSeed, nil)
+	defer seed.Stop()
+
+	chainA := blockchain.NewBlockchain()
+	defer chainA.Close()
+	a := startTestNode(t, chainA, func(cfg *Config) { cfg.Seeds = []string{seed.Addr()} })
+	defer a.Stop()
+	waitFor(t, 10*time.Second, "a to reach the seed", func() bool {
+		return hasPeer(a, seed.ID()) && len(seed.AddrBook().Random(maxAddrsPerMsg)) == 1
+	})
+	if got := seed.AddrBook().Entries()[0]; got.Addr != a.Addr() || got.Source != SourceInbound {
+		t.Fatalf("seed learned %+v, want a's listen address", got)
+	}
+
+	bookPath := filepath.Join(t.TempDir(), "addrbook.json")
+	chainB := blockchain.NewBlockchain()
+	defer chainB.Close()
+	b := startTestNode(t, chainB, func(cfg *Config) {
+		cfg.Seeds = []string{seed.Addr()}
+		cfg.AddrBookPath = bookPath
+	})
+	waitFor(t, 3*discoveryInterval, "b to dial a", func() bool { return hasPeer(b, a.ID()) && hasPeer(a, b.ID()) })
+	b.Stop()
+
+	// The address book is saved on shutdown with both peers marked good and
+	// without b's own address, which the seed and a handed back
+	book, err := NewAddrBook(bookPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := book.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("saved %d addresses, want 2", len(entries))
+	}
+	for _, ka := range entries {
+		want := SourcePEX
+		if ka.Addr == seed.Addr() {
+			want = SourceSeed
+		} else if ka.Addr != a.Addr() {
+			t.Fatalf("unexpected address %s", ka.Addr)
+		}
+		if ka.Source != want || ka.LastSuccess.IsZero() {
+			t.Fatalf("entry %+v, want source %s and a success", ka, want)
+		}
+	}
+}
+
+func TestAddrBook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "addrbook.json")
+	book, err := NewAddrBook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, addr := range []string{"", "127.0.0.1", "127.0.0.1:0", "0.0.0.0:26656", "[::]:26656"} {
+		if book.Add(addr, SourcePEX) {
+			t.Fatalf("added invalid address %q", addr)
+		}
+	}
+	if !book.Add("127.0.0.1:1", SourcePEX) || !book.Add("127.0.0.1:2", SourceSeed) {
+		t.Fatal("valid addresses not added")
+	}
+	if book.Add("127.0.0.1:1", SourceStatic) {
+		t.Fatal("known address added again")
+	}
+
+	// A failed dial backs the address off; others are still candidates
+	book.MarkAttempt("127.0.0.1:2")
+	skipNone := func(string) bool { return false }
+	if got := book.Candidates(10, skipNone); len(got) != 1 || got[0] != "127.0.0.1:1" {
+		t.Fatalf("candidates %v, want only 127.0.0.1:1", got)
+	}
+	if got := book.Candidates(10, func(addr string) bool { return addr == "127.0.0.1:1" }); len(got) != 0 {
+		t.Fatalf("skipped address returned: %v", got)
+	}
+
+	// Addresses that never worked are dropped after repeated failures,
+	// seeds and static peers are kept
+	for i := 0; i < maxFailedAttempts; i++ {
+		book.MarkAttempt("127.0.0.1:2")
+	}
+	book.Add("127.0.0.1:3", SourcePEX)
+	for i := 0; i < maxFailedAttempts; i++ {
+		book.MarkAttempt("127.0.0.1:3")
+	}
+	if book.Size() != 2 {
+		t.Fatalf("book holds %d addresses, want 2", book.Size())
+	}
+	if got := book.Random(10); len(got) != 1 || got[0] != "127.0.0.1:1" {
+		t.Fatalf("shared %v, want only the address that does not fail", got)
+	}
+
+	if err := book.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := NewAddrBook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := loaded.Entries()
+	if len(entries) != 2 || entries[0].Source != SourceStatic || entries[1].Source != SourceSeed || entries[1].Attempts != maxFailedAttempts+1 {
+		t.Fatalf("reloaded %+v", entries)
+	}
+}
@@ -0,0 +1,159 @@
+package p2p
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"usdtg-chain/blockchain"
+)
+
+// ProtocolVersion is the wire protocol version exchanged in the handshake
+const ProtocolVersion = 2
+
+// maxMessageSize bounds a single frame to protect against memory exhaustion
+const maxMessageSize = 16 << 20
+
+// Message types
+const (
+	MsgHello = "hello"
+	MsgTx    = "tx"
+	MsgBlock = "block"
+	MsgPing  = "ping"
+	MsgPong  = "pong"
+
+	MsgGetHeaders = "get_headers"
+	MsgHeaders    = "headers"
+	MsgGetBlocks  = "get_blocks"
+	MsgBlocks     = "blocks"
+
+	MsgGetAddrs = "get_addrs"
+	MsgAddrs    = "addrs"
+)
+
+// Request limits enforced when serving sync requests
+const (
+	maxHeadersPerRequest = 512
+	maxBlocksPerRequest  = 32
+	maxAddrsPerMsg       = 100
+)
+
+// Message is a single frame on the wire: a 4-byte big-endian length
+// followed by the JSON encoded message
+type Message struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Hello is exchanged by both sides when a connection is opened
+type Hello struct {
+	Version     int    `json:"version"`
+	ChainID     string `json:"chain_id"`
+	GenesisHash string `json:"genesis_hash"`
+	Height      int    `json:"height"`
+	NodeID      string `json:"node_id"`
+	ListenAddr  string `json:"listen_addr,omitempty"`
+}
+
+// Ping carries a nonce echoed back in the matching Pong
+type Ping struct {
+	Nonce uint64 `json:"nonce"`
+}
+
+// GetHeaders requests up to Count headers starting at height From
+type GetHeaders struct {
+	RequestID uint64 `json:"request_id"`
+	From      int    `json:"from"`
+	Count     int    `json:"count"`
+}
+
+// Headers answers GetHeaders. Headers are blocks without transactions.
+type Headers struct {
+	RequestID uint64             `json:"request_id"`
+	Headers   []blockchain.Block `json:"headers"`
+}
+
+// GetBlocks requests full blocks at the given heights
+type GetBlocks struct {
+	RequestID uint64 `json:"request_id"`
+	Heights   []int  `json:"heights"`
+}
+
+// Blocks answers GetBlocks. Blocks the peer cannot serve, for example
+// because it pruned them, are left out.
+type Blocks struct {
+	RequestID uint64             `json:"request_id"`
+	Blocks    []blockchain.Block `json:"blocks"`
+}
+
+// GetAddrs asks a peer for the addresses it knows
+type GetAddrs struct{}
+
+// Addrs answers GetAddrs with dialable peer addresses
+type Addrs struct {
+	Addrs []string `json:"addrs"`
+}
+
+// response is the common part of all response payloads
+type response struct {
+	RequestID uint64 `json:"request_id"`
+}
+
+// newMessage encodes payload into a message of the given type
+func newMessage(msgType string, payload interface{}) (Message, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{Type: msgType, Payload: data}, nil
+}
+
+// decode unmarshals the payload into v
+func (m Message) decode(v interface{}) error {
+	if err := json.Unmarshal(m.Payload, v); err != nil {
+		return fmt.Errorf("p2p: invalid %s payload: %w", m.Type, err)
+	}
+	return nil
+}
+
+// writeMessage writes a length-prefixed frame
+func writeMessage(w io.Writer, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxMessageSize {
+		return fmt.Errorf("p2p: message too large (%d bytes)", len(data))
+	}
+
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	_, err = w.Write(frame)
+	return err
+}
+
+// readMessage reads a length-prefixed frame
+func readMessage(r io.Reader) (Message, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Message{}, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxMessageSize {
+		return Message{}, fmt.Errorf("p2p: message too large (%d bytes)", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return Message{}, err
+	}
+
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return Message{}, fmt.Errorf("p2p: invalid message: %w", err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,636 @@
+package p2p
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"usdtg-chain/blockchain"
+)
+
+// Config holds the P2P settings of a node
+type Config struct {
+	Enabled      bool     `json:"enabled"`
+	ListenAddr   string   `json:"listen_addr"`
+	ChainID      string   `json:"chain_id"`
+	Peers        []string `json:"peers"`
+	Seeds        []string `json:"seeds"`
+	AddrBookPath string   `json:"addr_book_path"`
+	KeyPath      string   `json:"key_path"`
+	Allowlist    []string `json:"allowlist"`
+	MaxInbound   int      `json:"max_inbound"`
+	MaxOutbound  int      `json:"max_outbound"`
+}
+
+// DefaultConfig returns the default P2P configuration
+func DefaultConfig() Config {
+	return Config{
+		ListenAddr:  ":26656",
+		ChainID:     "usdtg-1",
+		MaxInbound:  40,
+		MaxOutbound: 10,
+	}
+}
+
+// Validate checks the P2P configuration
+func (c Config) Validate() error {
+	if c.ChainID == "" {
+		return fmt.Errorf("p2p: chain_id is required")
+	}
+	if c.MaxInbound < 0 || c.MaxOutbound < 0 {
+		return fmt.Errorf("p2p: connection limits must not be negative")
+	}
+	for _, addr := range append(append([]string{}, c.Peers...), c.Seeds...) {
+		if !validAddr(addr) {
+			return fmt.Errorf("p2p: invalid peer address %q", addr)
+		}
+	}
+	for _, id := range c.Allowlist {
+		if !validNodeID(id) {
+			return fmt.Errorf("p2p: invalid node id %q in allowlist", id)
+		}
+	}
+	return nil
+}
+
+var (
+	errSelfConnection = errors.New("p2p: connected to self")
+	errDuplicatePeer  = errors.New("p2p: peer already connected")
+	errTooManyPeers   = errors.New("p2p: connection limit reached")
+	errBanned         = errors.New("p2p: peer is banned")
+	errStopped        = errors.New("p2p: node is stopping")
+)
+
+const (
+	seenCacheSize  = 20000
+	dialTimeout    = 5 * time.Second
+	redialInterval = 10 * time.Second
+)
+
+// Node runs the P2P subsystem: it accepts and dials TCP connections,
+// keeps the peer table and gossips transactions and blocks
+type Node struct {
+	cfg   Config
+	chain *blockchain.Blockchain
+	id    string
+	cert  tls.Certificate
+
+	listener net.Listener
+	peers    map[string]*Peer
+	banned   map[string]time.Time
+	book     *AddrBook
+	dialing  map[string]bool
+
+	seenTx     *seenCache
+	seenBlocks *seenCache
+	syncer     *syncManager
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+	mu   sync.RWMutex
+}
+
+// NewNode creates a P2P node for the chain
+func NewNode(cfg Config, chain *blockchain.Blockchain) (*Node, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	key, err := LoadOrCreateNodeKey(cfg.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("p2p: loading node key: %w", err)
+	}
+	cert, err := key.certificate()
+	if err != nil {
+		return nil, err
+	}
+
+	book, err := NewAddrBook(cfg.AddrBookPath)
+	if err != nil {
+		return nil, fmt.Errorf("p2p: loading address book: %w", err)
+	}
+	for _, addr := range cfg.Seeds {
+		book.Add(addr, SourceSeed)
+	}
+	for _, addr := range cfg.Peers {
+		book.Add(addr, SourceStatic)
+	}
+
+	n := &Node{
+		cfg:        cfg,
+		chain:      chain,
+		id:         key.ID(),
+		cert:       cert,
+		peers:      make(map[string]*Peer),
+		banned:     make(map[string]time.Time),
+		book:       book,
+		dialing:    make(map[string]bool),
+		seenTx:     newSeenCache(seenCacheSize),
+		seenBlocks: newSeenCache(seenCacheSize),
+		quit:       make(chan struct{}),
+	}
+	n.syncer = newSyncManager(n)
+	return n, nil
+}
+
+// ID returns the node ID
+func (n *Node) ID() string {
+	return n.id
+}
+
+// Addr returns the address the node listens on
+func (n *Node) Addr() string {
+	if n.listener == nil {
+		return ""
+	}
+	return n.listener.Addr().String()
+}
+
+// Start opens the listener and dials the configured peers
+func (n *Node) Start() error {
+	listener, err := net.Listen("tcp", n.cfg.ListenAddr)
+	if err != nil {
+		return err
+	}
+	n.listener = listener
+
+	n.wg.Add(3)
+	go n.acceptLoop()
+	go n.syncer.loop()
+	go n.discoveryLoop()
+
+	for _, addr := range n.cfg.Peers {
+		n.wg.Add(1)
+		go n.keepConnected(addr)
+	}
+	return nil
+}
+
+// Stop closes the listener and disconnects all peers
+func (n *Node) Stop() {
+	close(n.quit)
+	if n.listener != nil {
+		n.listener.Close()
+	}
+
+	for _, p := range n.peerList() {
+		p.Close()
+	}
+	n.wg.Wait()
+}
+
+// Connect dials a peer and performs the handshake
+func (n *Node) Connect(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+
+	p, err := n.setupPeer(conn, Outbound, addr)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	n.wg.Add(1)
+	go n.runPeer(p)
+	return nil
+}
+
+// Peers returns a snapshot of the connected peers
+func (n *Node) Peers() []PeerInfo {
+	peers := n.peerList()
+	infos := make([]PeerInfo, 0, len(peers))
+	for _, p := range peers {
+		infos = append(infos, p.Info())
+	}
+	return infos
+}
+
+// SyncStatus returns the block synchronization progress
+func (n *Node) SyncStatus() SyncStatus {
+	return n.syncer.Status()
+}
+
+// BroadcastTransaction gossips a locally created transaction
+func (n *Node) BroadcastTransaction(tx blockchain.Transaction) {
+	if n.seenTx.add(tx.Hash) {
+		n.relay(MsgTx, tx, nil)
+	}
+}
+
+// BroadcastBlock gossips a locally produced block
+func (n *Node) BroadcastBlock(block blockchain.Block) {
+	if n.seenBlocks.add(block.Hash) {
+		n.relay(MsgBlock, block, nil)
+	}
+}
+
+func (n *Node) acceptLoop() {
+	defer n.wg.Done()
+
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			select {
+			case <-n.quit:
+				return
+			default:
+			}
+			log.Printf("p2p: accept: %v", err)
+			continue
+		}
+
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+
+			p, err := n.setupPeer(conn, Inbound, "")
+			if err != nil {
+				conn.Close()
+				return
+			}
+			n.wg.Add(1)
+			n.runPeer(p)
+		}()
+	}
+}
+
+// keepConnected dials a static peer and redials it whenever it drops
+func (n *Node) keepConnected(addr string) {
+	defer n.wg.Done()
+
+	for {
+		if !n.connectedTo(addr) {
+			if err := n.Connect(addr); err != nil && !errors.Is(err, errDuplicatePeer) {
+				log.Printf("p2p: dial %s: %v", addr, err)
+			}
+		}
+
+		select {
+		case <-n.quit:
+			return
+		case <-time.After(redialInterval):
+		}
+	}
+}
+
+// setupPeer secures the connection, runs the handshake and registers the
+// peer. For outbound connections dialAddr is the address that was dialed.
+func (n *Node) setupPeer(conn net.Conn, dir Direction, dialAddr string) (*Peer, error) {
+	conn, remoteID, err := n.secure(conn, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	hello, err := n.handshake(conn)
+	if err != nil {
+		return nil, err
+	}
+	if hello.NodeID != remoteID {
+		return nil, errIDMismatch
+	}
+
+	p := newPeer(n, conn, dir, hello)
+	if dir == Outbound {
+		p.ListenAddr = dialAddr
+		p.static = n.isStatic(dialAddr)
+	} else {
+		p.ListenAddr = dialableAddr(p.ListenAddr, p.Addr)
+	}
+	if err := n.addPeer(p); err != nil {
+		return nil, err
+	}
+
+	if dir == Inbound && p.ListenAddr != "" {
+		n.book.Add(p.ListenAddr, SourceInbound)
+	}
+	return p, nil
+}
+
+// handshake exchanges Hello messages and checks that the remote node is on
+// the same chain
+func (n *Node) handshake(conn net.Conn) (Hello, error) {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	local := Hello{
+		Version:     ProtocolVersion,
+		ChainID:     n.cfg.ChainID,
+		GenesisHash: n.chain.GenesisHash(),
+		Height:      n.chain.Height(),
+		NodeID:      n.id,
+		ListenAddr:  n.advertisedAddr(),
+	}
+	msg, err := newMessage(MsgHello, local)
+	if err != nil {
+		return Hello{}, err
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- writeMessage(conn, msg) }()
+
+	reply, err := readMessage(conn)
+	if err != nil {
+		return Hello{}, err
+	}
+	if err := <-errc; err != nil {
+		return Hello{}, err
+	}
+	if reply.Type != MsgHello {
+		return Hello{}, fmt.Errorf("p2p: expected hello, got %s", reply.Type)
+	}
+
+	var remote Hello
+	if err := reply.decode(&remote); err != nil {
+		return Hello{}, err
+	}
+	switch {
+	case remote.Version != ProtocolVersion:
+		return Hello{}, fmt.Errorf("p2p: protocol version %d not supported", remote.Version)
+	case remote.ChainID != local.ChainID:
+		return Hello{}, fmt.Errorf("p2p: chain id mismatch: %s", remote.ChainID)
+	case remote.GenesisHash != local.GenesisHash:
+		return Hello{}, fmt.Errorf("p2p: genesis hash mismatch")
+	case remote.NodeID == "":
+		return Hello{}, fmt.Errorf("p2p: missing node id")
+	case remote.NodeID == n.id:
+		return Hello{}, errSelfConnection
+	}
+	return remote, nil
+}
+
+// advertisedAddr returns the listen address announced to peers
+func (n *Node) advertisedAddr() string {
+	return n.Addr()
+}
+
+// addPeer registers a peer after checking bans, duplicates and limits,
+// unless the node is stopping
+func (n *Node) addPeer(p *Peer) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// Stop closes the peers registered before it, so none may follow
+	select {
+	case <-n.quit:
+		return errStopped
+	default:
+	}
+	if until, ok := n.banned[p.ID]; ok {
+		if time.Now().Before(until) {
+			return errBanned
+		}
+		delete(n.banned, p.ID)
+	}
+	if _, ok := n.peers[p.ID]; ok {
+		return errDuplicatePeer
+	}
+
+	// Static peers are always allowed so operators can pin connections
+	limit := n.cfg.MaxInbound
+	if p.Direction == Outbound {
+		limit = n.cfg.MaxOutbound
+	}
+	if !p.static && n.countPeers(p.Direction) >= limit {
+		return errTooManyPeers
+	}
+
+	n.peers[p.ID] = p
+	return nil
+}
+
+// runPeer serves a registered peer until it disconnects
+func (n *Node) runPeer(p *Peer) {
+	defer n.wg.Done()
+
+	log.Printf("p2p: peer %s connected (%s, %s)", shortID(p.ID), p.Addr, p.Direction)
+	if p.Height() > n.chain.Height() {
+		n.syncer.Trigger()
+	}
+	if p.Direction == Outbound {
+		n.requestAddrs(p)
+	}
+	p.run()
+
+	n.mu.Lock()
+	if n.peers[p.ID] == p {
+		delete(n.peers, p.ID)
+	}
+	n.mu.Unlock()
+	log.Printf("p2p: peer %s disconnected", shortID(p.ID))
+}
+
+// handleMessage processes a message received from a peer
+func (n *Node) handleMessage(p *Peer, msg Message) {
+	switch msg.Type {
+	case MsgTx:
+		var tx blockchain.Transaction
+		if err := msg.decode(&tx); err != nil {
+			n.penalize(p, scoreInvalid, err)
+			return
+		}
+		n.handleTransaction(p, tx)
+
+	case MsgBlock:
+		var block blockchain.Block
+		if err := msg.decode(&block); err != nil {
+			n.penalize(p, scoreInvalid, err)
+			return
+		}
+		n.handleBlock(p, block)
+
+	case MsgPing:
+		var ping Ping
+		if err := msg.decode(&ping); err != nil {
+			n.penalize(p, scoreInvalid, err)
+			return
+		}
+		if reply, err := newMessage(MsgPong, ping); err == nil {
+			p.Send(reply)
+		}
+
+	case MsgPong:
+		var pong Ping
+		if err := msg.decode(&pong); err != nil {
+			n.penalize(p, scoreInvalid, err)
+			return
+		}
+		p.pong(pong.Nonce)
+
+	case MsgGetHeaders:
+		var req GetHeaders
+		if err := msg.decode(&req); err != nil {
+			n.penalize(p, scoreInvalid, err)
+			return
+		}
+		n.serveHeaders(p, req)
+
+	case MsgGetBlocks:
+		var req GetBlocks
+		if err := msg.decode(&req); err != nil {
+			n.penalize(p, scoreInvalid, err)
+			return
+		}
+		n.serveBlocks(p, req)
+
+	case MsgGetAddrs:
+		n.serveAddrs(p)
+
+	case MsgAddrs:
+		var addrs Addrs
+		if err := msg.decode(&addrs); err != nil {
+			n.penalize(p, scoreInvalid, err)
+			return
+		}
+		n.handleAddrs(p, addrs)
+
+	case MsgHeaders, MsgBlocks:
+		var resp response
+		if err := msg.decode(&resp); err != nil {
+			n.penalize(p, scoreInvalid, err)
+			return
+		}
+		if !p.deliver(resp.RequestID, msg) {
+			n.penalize(p, scoreInvalid, fmt.Errorf("unsolicited %s response", msg.Type))
+		}
+
+	default:
+		n.penalize(p, scoreProtocol, fmt.Errorf("unexpected %s message", msg.Type))
+	}
+}
+
+// handleTransaction adds a gossiped transaction and relays it if it is new
+func (n *Node) handleTransaction(p *Peer, tx blockchain.Transaction) {
+	if !n.seenTx.add(tx.Hash) {
+		return
+	}
+
+	added, err := n.chain.SubmitTransaction(tx)
+	if err != nil {
+		n.penalize(p, scoreInvalid, err)
+		return
+	}
+	if added {
+		p.adjustScore(scoreUseful)
+		n.relay(MsgTx, tx, p)
+	}
+}
+
+// handleBlock applies a gossiped block and relays it if it extends the chain
+func (n *Node) handleBlock(p *Peer, block blockchain.Block) {
+	p.setHeight(block.Index)
+	if !n.seenBlocks.add(block.Hash) {
+		return
+	}
+
+	height := n.chain.Height()
+	switch {
+	case block.Index <= height:
+		// Already known or a competing block at a settled height
+		return
+	case block.Index > height+1:
+		// We are behind; the block is fetched again by the sync manager
+		n.syncer.Trigger()
+		return
+	}
+
+	if err := n.chain.AddBlock(block); err != nil {
+		n.penalize(p, scoreInvalid, err)
+		return
+	}
+	p.adjustScore(scoreUseful)
+	n.relay(MsgBlock, block, p)
+}
+
+// relay sends a message to every peer except the one it came from
+func (n *Node) relay(msgType string, payload interface{}, from *Peer) {
+	msg, err := newMessage(msgType, payload)
+	if err != nil {
+		log.Printf("p2p: encoding %s: %v", msgType, err)
+		return
+	}
+
+	for _, p := range n.peerList() {
+		if p != from {
+			p.Send(msg)
+		}
+	}
+}
+
+// penalize lowers a peer's score and bans it once it falls below the
+// threshold
+func (n *Node) penalize(p *Peer, delta int, reason error) {
+	log.Printf("p2p: peer %s misbehaved: %v", shortID(p.ID), reason)
+	if p.adjustScore(delta) {
+		n.ban(p.ID, banDuration)
+	}
+}
+
+// ban disconnects a peer and refuses it until the ban expires
+func (n *Node) ban(id string, d time.Duration) {
+	n.mu.Lock()
+	n.banned[id] = time.Now().Add(d)
+	p := n.peers[id]
+	n.mu.Unlock()
+
+	if p != nil {
+		p.Close()
+	}
+}
+
+// peerList returns the connected peers
+func (n *Node) peerList() []*Peer {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	peers := make([]*Peer, 0, len(n.peers))
+	for _, p := range n.peers {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// connectedTo reports whether a peer with the given listen address is connected
+func (n *Node) connectedTo(addr string) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for _, p := range n.peers {
+		if p.ListenAddr == addr || p.Addr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// dialableAddr turns an advertised listen address such as ":26656" or
+// "0.0.0.0:26656" into one that can be dialed, using the host the
+// connection came from
+func dialableAddr(advertised, remote string) string {
+	host, port, err := net.SplitHostPort(advertised)
+	if err != nil {
+		return ""
+	}
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		return advertised
+	}
+
+	remoteHost, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return ""
+	}
+	return net.JoinHostPort(remoteHost, port)
+}
+
+// shortID shortens a node ID for logging
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -0,0 +1,144 @@
+package p2p
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"usdtg-chain/blockchain"
+)
+
+const testMiner = "0x00000000000000000000000000000000000000aa"
+
+// startTestNode starts a node for chain listening on a loopback port. The
+// caller stops it.
+func startTestNode(t *testing.T, chain *blockchain.Blockchain, configure func(*Config)) *Node {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.ListenAddr = "127.0.0.1:0"
+	if configure != nil {
+		configure(&cfg)
+	}
+	n, err := NewNode(cfg, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// mineBlocks mines count blocks on chain
+func mineBlocks(t *testing.T, chain *blockchain.Blockchain, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		if _, err := chain.MinePendingTransactions(testMiner); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// waitFor polls cond until it holds or the timeout expires
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// hasPeer reports whether n has a peer with the given ID
+func hasPeer(n *Node, id string) bool {
+	for _, p := range n.Peers() {
+		if p.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBlockGossip(t *testing.T) {
+	chainA, chainB, chainC := blockchain.NewBlockchain(), blockchain.NewBlockchain(), blockchain.NewBlockchain()
+	defer chainA.Close()
+	defer chainB.Close()
+	defer chainC.Close()
+	a := startTestNode(t, chainA, nil)
+	defer a.Stop()
+	b := startTestNode(t, chainB, nil)
+	defer b.Stop()
+	c := startTestNode(t, chainC, nil)
+	defer c.Stop()
+
+	// A line a - b - c: blocks reach c only through b's relay
+	if err := b.Connect(a.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Connect(b.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, "the peers to register", func() bool {
+		return hasPeer(a, b.ID()) && hasPeer(b, a.ID()) && hasPeer(b, c.ID()) && hasPeer(c, b.ID())
+	})
+
+	for i := 1; i <= 3; i++ {
+		block, err := chainA.MinePendingTransactions(testMiner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.BroadcastBlock(block)
+		waitFor(t, 5*time.Second, "the block to reach c", func() bool { return chainC.Height() == i })
+
+		got, err := chainC.GetBlockByIndex(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Hash != block.Hash {
+			t.Fatalf("block %d hash %s at c, want %s", i, got.Hash, block.Hash)
+		}
+	}
+	if hasPeer(a, c.ID()) {
+		t.Fatal("a and c connected directly")
+	}
+}
+
+func TestHandshakeRejectsOtherChain(t *testing.T) {
+	chainA, chainB := blockchain.NewBlockchain(), blockchain.NewBlockchain()
+	defer chainA.Close()
+	defer chainB.Close()
+	a := startTestNode(t, chainA, nil)
+	defer a.Stop()
+	b := startTestNode(t, chainB, func(cfg *Config) { cfg.ChainID = "usdtg-test" })
+	defer b.Stop()
+
+	if err := b.Connect(a.Addr()); err == nil {
+		t.Fatal("connected to a node on another chain")
+	}
+	if err := a.Connect(a.Addr()); err == nil {
+		t.Fatal("connected to self")
+	}
+	if len(a.Peers()) != 0 || len(b.Peers()) != 0 {
+		t.Fatalf("peers registered after failed handshakes: %d, %d", len(a.Peers()), len(b.Peers()))
+	}
+}
+
+// TestStopRefusesLatePeers checks that a peer finishing its handshake
+// while the node stops is refused rather than left running, which would
+// keep Stop waiting for it
+func TestStopRefusesLatePeers(t *testing.T) {
+	chain := blockchain.NewBlockchain()
+	defer chain.Close()
+	n := startTestNode(t, chain, nil)
+	n.Stop()
+
+	p := &Peer{ID: "late", Direction: Inbound, closed: make(chan struct{})}
+	if err := n.addPeer(p); !errors.Is(err, errStopped) {
+		t.Fatalf("addPeer after Stop: got %v", err)
+	}
+	if len(n.Peers()) != 0 {
+		t.Fatal("peer registered after Stop")
+	}
+}
@@ -0,0 +1,287 @@
+package p2p
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Direction tells who opened a connection
+type Direction string
+
+const (
+	Inbound  Direction = "inbound"
+	Outbound Direction = "outbound"
+)
+
+// Peer scoring. Peers earn score for useful messages and lose it for
+// invalid ones; a peer that drops below scoreBanThreshold is disconnected
+// and banned for banDuration.
+const (
+	scoreUseful       = 1
+	scoreMax          = 100
+	scoreInvalid      = -20
+	scoreProtocol     = -50
+	scoreBanThreshold = -100
+	banDuration       = time.Hour
+)
+
+const (
+	sendQueueSize    = 256
+	handshakeTimeout = 5 * time.Second
+	writeTimeout     = 10 * time.Second
+	pingInterval     = 30 * time.Second
+	readTimeout      = 3 * pingInterval
+)
+
+// Peer is a connected remote node
+type Peer struct {
+	ID          string
+	Addr        string
+	ListenAddr  string
+	Direction   Direction
+	ConnectedAt time.Time
+
+	conn   net.Conn
+	node   *Node
+	send   chan Message
+	closed chan struct{}
+	once   sync.Once
+
+	height    int
+	score     int
+	latency   time.Duration
+	pingNonce uint64
+	pingSent  time.Time
+	requests  map[uint64]chan Message
+	static    bool
+
+	addrsRequested bool
+	mu             sync.Mutex
+}
+
+var (
+	errPeerClosed     = errors.New("p2p: peer disconnected")
+	errRequestTimeout = errors.New("p2p: request timed out")
+	errQueueFull      = errors.New("p2p: send queue full")
+)
+
+// PeerInfo is a snapshot of a peer's state
+type PeerInfo struct {
+	ID          string    `json:"id"`
+	Addr        string    `json:"addr"`
+	ListenAddr  string    `json:"listen_addr,omitempty"`
+	Direction   Direction `json:"direction"`
+	Height      int       `json:"height"`
+	Score       int       `json:"score"`
+	LatencyMs   int64     `json:"latency_ms"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+func newPeer(node *Node, conn net.Conn, dir Direction, hello Hello) *Peer {
+	return &Peer{
+		ID:          hello.NodeID,
+		Addr:        conn.RemoteAddr().String(),
+		ListenAddr:  hello.ListenAddr,
+		Direction:   dir,
+		ConnectedAt: time.Now(),
+		conn:        conn,
+		node:        node,
+		send:        make(chan Message, sendQueueSize),
+		closed:      make(chan struct{}),
+		height:      hello.Height,
+		requests:    make(map[uint64]chan Message),
+	}
+}
+
+// Info returns a snapshot of the peer's state
+func (p *Peer) Info() PeerInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return PeerInfo{
+		ID:          p.ID,
+		Addr:        p.Addr,
+		ListenAddr:  p.ListenAddr,
+		Direction:   p.Direction,
+		Height:      p.height,
+		Score:       p.score,
+		LatencyMs:   p.latency.Milliseconds(),
+		ConnectedAt: p.ConnectedAt,
+	}
+}
+
+// Height returns the last height reported by the peer
+func (p *Peer) Height() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.height
+}
+
+// setHeight raises the known height of the peer
+func (p *Peer) setHeight(height int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if height > p.height {
+		p.height = height
+	}
+}
+
+// adjustScore changes the peer's score and reports whether it should be banned
+func (p *Peer) adjustScore(delta int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.score += delta
+	if p.score > scoreMax {
+		p.score = scoreMax
+	}
+	return p.score < scoreBanThreshold
+}
+
+// Send queues a message for the peer. Messages are dropped when the queue
+// is full so that a slow peer cannot stall gossip.
+func (p *Peer) Send(msg Message) bool {
+	select {
+	case p.send <- msg:
+		return true
+	case <-p.closed:
+		return false
+	default:
+		return false
+	}
+}
+
+// Close disconnects the peer
+func (p *Peer) Close() {
+	p.once.Do(func() {
+		close(p.closed)
+		p.conn.Close()
+	})
+}
+
+// request sends a request and waits for the response carrying the same
+// request ID
+func (p *Peer) request(msgType string, id uint64, payload interface{}, timeout time.Duration) (Message, error) {
+	msg, err := newMessage(msgType, payload)
+	if err != nil {
+		return Message{}, err
+	}
+
+	ch := make(chan Message, 1)
+	p.mu.Lock()
+	p.requests[id] = ch
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.requests, id)
+		p.mu.Unlock()
+	}()
+
+	if !p.Send(msg) {
+		return Message{}, errQueueFull
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case reply := <-ch:
+		return reply, nil
+	case <-timer.C:
+		return Message{}, errRequestTimeout
+	case <-p.closed:
+		return Message{}, errPeerClosed
+	}
+}
+
+// deliver hands a response to the request waiting for it. It reports false
+// for unsolicited responses.
+func (p *Peer) deliver(id uint64, msg Message) bool {
+	p.mu.Lock()
+	ch, ok := p.requests[id]
+	delete(p.requests, id)
+	p.mu.Unlock()
+
+	if ok {
+		ch <- msg
+	}
+	return ok
+}
+
+// run starts the peer's loops and blocks until the connection is closed
+func (p *Peer) run() {
+	go p.writeLoop()
+	go p.pingLoop()
+	p.readLoop()
+}
+
+func (p *Peer) readLoop() {
+	defer p.Close()
+
+	for {
+		p.conn.SetReadDeadline(time.Now().Add(readTimeout))
+		msg, err := readMessage(p.conn)
+		if err != nil {
+			return
+		}
+		p.node.handleMessage(p, msg)
+	}
+}
+
+func (p *Peer) writeLoop() {
+	defer p.Close()
+
+	for {
+		select {
+		case msg := <-p.send:
+			p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := writeMessage(p.conn, msg); err != nil {
+				return
+			}
+		case <-p.closed:
+			return
+		}
+	}
+}
+
+func (p *Peer) pingLoop() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	p.ping()
+	for {
+		select {
+		case <-ticker.C:
+			p.ping()
+		case <-p.closed:
+			return
+		}
+	}
+}
+
+// ping sends a ping used to measure latency and keep the connection alive
+func (p *Peer) ping() {
+	p.mu.Lock()
+	p.pingNonce = rand.Uint64()
+	p.pingSent = time.Now()
+	nonce := p.pingNonce
+	p.mu.Unlock()
+
+	if msg, err := newMessage(MsgPing, Ping{Nonce: nonce}); err == nil {
+		p.Send(msg)
+	}
+}
+
+// pong records the latency of a matching ping
+func (p *Peer) pong(nonce uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if nonce == p.pingNonce && !p.pingSent.IsZero() {
+		p.latency = time.Since(p.pingSent)
+		p.pingSent = time.Time{}
+	}
+}
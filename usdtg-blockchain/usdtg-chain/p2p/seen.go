@@ -0,0 +1,50 @@
+package p2p
+
+import "sync"
+
+// seenCache remembers recently seen hashes so gossip is not relayed twice.
+// It evicts the oldest entries once it reaches its capacity.
+type seenCache struct {
+	capacity int
+	entries  map[string]struct{}
+	order    []string
+	next     int
+	mu       sync.Mutex
+}
+
+func newSeenCache(capacity int) *seenCache {
+	return &seenCache{
+		capacity: capacity,
+		entries:  make(map[string]struct{}, capacity),
+		order:    make([]string, 0, capacity),
+	}
+}
+
+// add records hash and reports whether it was not seen before
+func (c *seenCache) add(hash string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[hash]; ok {
+		return false
+	}
+
+	if len(c.order) < c.capacity {
+		c.order = append(c.order, hash)
+	} else {
+		delete(c.entries, c.order[c.next])
+		c.order[c.next] = hash
+		c.next = (c.next + 1) % c.capacity
+	}
+	c.entries[hash] = struct{}{}
+	return true
+}
+
+// has reports whether hash was seen
+func (c *seenCache) has(hash string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.entries[hash]
+	return ok
+}
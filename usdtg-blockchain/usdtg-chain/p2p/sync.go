@@ -0,0 +1,403 @@
+package p2p
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"usdtg-chain/blockchain"
+)
+
+const (
+	syncInterval        = 10 * time.Second
+	syncRequestTimeout  = 10 * time.Second
+	syncMaxAttempts     = 4
+	syncBlocksPerChunk  = 16
+	syncMaxParallel     = 8
+	syncHeadersPerRound = maxHeadersPerRequest
+)
+
+// SyncStatus reports the progress of block synchronization
+type SyncStatus struct {
+	Syncing       bool      `json:"syncing"`
+	StartHeight   int       `json:"start_height"`
+	CurrentHeight int       `json:"current_height"`
+	TargetHeight  int       `json:"target_height"`
+	Peers         int       `json:"peers"`
+	LastError     string    `json:"last_error,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// syncManager catches the node up with its peers. It fetches headers
+// first from the best peer, checks that they link to the local head, then
+// downloads bodies in parallel from all peers that have them and applies
+// them in order through the normal block validation path.
+type syncManager struct {
+	node      *Node
+	trigger   chan struct{}
+	requestID uint64
+	status    SyncStatus
+	mu        sync.RWMutex
+}
+
+func newSyncManager(node *Node) *syncManager {
+	return &syncManager{
+		node:    node,
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+// Trigger asks the sync manager to check peers without waiting for the
+// next interval
+func (s *syncManager) Trigger() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Status returns the current sync progress
+func (s *syncManager) Status() SyncStatus {
+	s.mu.RLock()
+	status := s.status
+	s.mu.RUnlock()
+
+	status.CurrentHeight = s.node.chain.Height()
+	if status.TargetHeight < status.CurrentHeight {
+		status.TargetHeight = status.CurrentHeight
+	}
+	status.Peers = len(s.node.peerList())
+	return status
+}
+
+func (s *syncManager) loop() {
+	defer s.node.wg.Done()
+
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.node.quit:
+			return
+		case <-ticker.C:
+		case <-s.trigger:
+		}
+
+		if err := s.sync(); err != nil {
+			log.Printf("p2p: sync: %v", err)
+		}
+	}
+}
+
+// sync downloads blocks until the node reaches the best peer's height
+func (s *syncManager) sync() error {
+	peer := s.bestPeer()
+	if peer == nil {
+		return nil
+	}
+
+	start := s.node.chain.Height()
+	s.setStatus(func(st *SyncStatus) {
+		*st = SyncStatus{Syncing: true, StartHeight: start, TargetHeight: peer.Height()}
+	})
+
+	err := s.syncFrom(peer)
+	s.setStatus(func(st *SyncStatus) {
+		st.Syncing = false
+		st.LastError = ""
+		if err != nil {
+			st.LastError = err.Error()
+		}
+	})
+	return err
+}
+
+func (s *syncManager) syncFrom(peer *Peer) error {
+	for {
+		height := s.node.chain.Height()
+		target := peer.Height()
+		if height >= target {
+			return nil
+		}
+		s.setStatus(func(st *SyncStatus) { st.TargetHeight = target })
+
+		count := target - height
+		if count > syncHeadersPerRound {
+			count = syncHeadersPerRound
+		}
+
+		headers, err := s.fetchHeaders(peer, height+1, count)
+		if err != nil {
+			return err
+		}
+		if err := s.fetchAndApply(headers); err != nil {
+			return err
+		}
+
+		select {
+		case <-s.node.quit:
+			return nil
+		default:
+		}
+	}
+}
+
+// bestPeer returns the connected peer with the greatest height above ours
+func (s *syncManager) bestPeer() *Peer {
+	height := s.node.chain.Height()
+
+	var best *Peer
+	for _, p := range s.node.peerList() {
+		if h := p.Height(); h > height && (best == nil || h > best.Height()) {
+			best = p
+		}
+	}
+	return best
+}
+
+// fetchHeaders requests headers and validates that they form a chain on
+// top of the local head
+func (s *syncManager) fetchHeaders(peer *Peer, from, count int) ([]blockchain.Block, error) {
+	id := s.nextRequestID()
+	reply, err := peer.request(MsgGetHeaders, id, GetHeaders{RequestID: id, From: from, Count: count}, syncRequestTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("headers from %s: %w", shortID(peer.ID), err)
+	}
+
+	var resp Headers
+	if err := reply.decode(&resp); err != nil {
+		s.node.penalize(peer, scoreInvalid, err)
+		return nil, err
+	}
+	if len(resp.Headers) == 0 {
+		return nil, fmt.Errorf("headers from %s: empty response", shortID(peer.ID))
+	}
+
+	prev, err := s.node.chain.GetBlockHeader(from - 1)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range resp.Headers {
+		if err := s.validateHeader(prev, h); err != nil {
+			s.node.penalize(peer, scoreInvalid, err)
+			return nil, err
+		}
+		prev = h
+	}
+	return resp.Headers, nil
+}
+
+// validateHeader checks that header links to prev and that its hash covers
+// its contents
+func (s *syncManager) validateHeader(prev, header blockchain.Block) error {
+	switch {
+	case header.Index != prev.Index+1:
+		return fmt.Errorf("header %d: expected index %d", header.Index, prev.Index+1)
+	case header.PrevHash != prev.Hash:
+		return fmt.Errorf("header %d: does not link to block %d", header.Index, prev.Index)
+	case header.Hash != s.node.chain.CalculateHash(header):
+		return fmt.Errorf("header %d: invalid hash", header.Index)
+	}
+	return nil
+}
+
+// chunkResult is the outcome of downloading one chunk of bodies
+type chunkResult struct {
+	chunk  int
+	peer   *Peer
+	blocks []blockchain.Block
+	err    error
+}
+
+// fetchAndApply downloads the bodies for headers in parallel, retrying
+// failed chunks on other peers, and applies them in order
+func (s *syncManager) fetchAndApply(headers []blockchain.Block) error {
+	var chunks [][]blockchain.Block
+	for i := 0; i < len(headers); i += syncBlocksPerChunk {
+		end := i + syncBlocksPerChunk
+		if end > len(headers) {
+			end = len(headers)
+		}
+		chunks = append(chunks, headers[i:end])
+	}
+
+	bodies := make([][]blockchain.Block, len(chunks))
+	attempts := make([]int, len(chunks))
+	tried := make([]map[*Peer]bool, len(chunks))
+	for i := range tried {
+		tried[i] = make(map[*Peer]bool)
+	}
+
+	queue := make([]int, len(chunks))
+	for i := range queue {
+		queue[i] = i
+	}
+	busy := make(map[*Peer]bool)
+	results := make(chan chunkResult, len(chunks))
+	inFlight := 0
+	applied := 0
+
+	for applied < len(chunks) {
+		// Hand queued chunks to idle peers that have them
+		for len(queue) > 0 && inFlight < syncMaxParallel {
+			chunk := queue[0]
+			peer := s.pickPeer(chunks[chunk], busy, tried[chunk])
+			if peer == nil {
+				break
+			}
+			queue = queue[1:]
+			busy[peer] = true
+			tried[chunk][peer] = true
+			inFlight++
+			go func(chunk int, peer *Peer) {
+				blocks, err := s.fetchBodies(peer, chunks[chunk])
+				results <- chunkResult{chunk: chunk, peer: peer, blocks: blocks, err: err}
+			}(chunk, peer)
+		}
+		if inFlight == 0 {
+			return errors.New("no peer can serve the requested blocks")
+		}
+
+		res := <-results
+		inFlight--
+		delete(busy, res.peer)
+
+		if res.err != nil {
+			attempts[res.chunk]++
+			if attempts[res.chunk] >= syncMaxAttempts {
+				return fmt.Errorf("blocks %d-%d: %w", chunks[res.chunk][0].Index,
+					chunks[res.chunk][len(chunks[res.chunk])-1].Index, res.err)
+			}
+			queue = append(queue, res.chunk)
+			continue
+		}
+		bodies[res.chunk] = res.blocks
+
+		// Apply every chunk that is now contiguous with the chain
+		for applied < len(chunks) && bodies[applied] != nil {
+			for _, block := range bodies[applied] {
+				// Gossip may have delivered the block in the meantime
+				if block.Index <= s.node.chain.Height() {
+					continue
+				}
+				if err := s.node.chain.AddBlock(block); err != nil {
+					return err
+				}
+				s.node.seenBlocks.add(block.Hash)
+			}
+			bodies[applied] = nil
+			applied++
+		}
+	}
+	return nil
+}
+
+// pickPeer selects an idle peer that is high enough to serve the chunk,
+// preferring peers that have not failed it yet
+func (s *syncManager) pickPeer(chunk []blockchain.Block, busy, tried map[*Peer]bool) *Peer {
+	last := chunk[len(chunk)-1].Index
+
+	var fallback *Peer
+	for _, p := range s.node.peerList() {
+		if busy[p] || p.Height() < last {
+			continue
+		}
+		if !tried[p] {
+			return p
+		}
+		fallback = p
+	}
+	return fallback
+}
+
+// fetchBodies downloads the blocks of a chunk and checks them against the
+// already validated headers
+func (s *syncManager) fetchBodies(peer *Peer, headers []blockchain.Block) ([]blockchain.Block, error) {
+	heights := make([]int, len(headers))
+	for i, h := range headers {
+		heights[i] = h.Index
+	}
+
+	id := s.nextRequestID()
+	reply, err := peer.request(MsgGetBlocks, id, GetBlocks{RequestID: id, Heights: heights}, syncRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Blocks
+	if err := reply.decode(&resp); err != nil {
+		s.node.penalize(peer, scoreInvalid, err)
+		return nil, err
+	}
+	if len(resp.Blocks) != len(headers) {
+		return nil, fmt.Errorf("peer %s returned %d of %d blocks", shortID(peer.ID), len(resp.Blocks), len(headers))
+	}
+
+	for i, block := range resp.Blocks {
+		if block.Hash != headers[i].Hash || block.TxRoot != s.node.chain.CalculateTxRoot(block.Transactions) {
+			err := fmt.Errorf("block %d does not match its header", headers[i].Index)
+			s.node.penalize(peer, scoreInvalid, err)
+			return nil, err
+		}
+	}
+	return resp.Blocks, nil
+}
+
+func (s *syncManager) nextRequestID() uint64 {
+	return atomic.AddUint64(&s.requestID, 1)
+}
+
+func (s *syncManager) setStatus(update func(*SyncStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	update(&s.status)
+	s.status.UpdatedAt = time.Now()
+}
+
+// serveHeaders answers a GetHeaders request
+func (n *Node) serveHeaders(p *Peer, req GetHeaders) {
+	count := req.Count
+	if count > maxHeadersPerRequest {
+		count = maxHeadersPerRequest
+	}
+
+	resp := Headers{RequestID: req.RequestID, Headers: []blockchain.Block{}}
+	for i := req.From; i < req.From+count; i++ {
+		header, err := n.chain.GetBlockHeader(i)
+		if err != nil {
+			break
+		}
+		resp.Headers = append(resp.Headers, header)
+	}
+
+	if msg, err := newMessage(MsgHeaders, resp); err == nil {
+		p.Send(msg)
+	}
+}
+
+// serveBlocks answers a GetBlocks request, leaving out blocks that are
+// unknown or pruned
+func (n *Node) serveBlocks(p *Peer, req GetBlocks) {
+	heights := req.Heights
+	if len(heights) > maxBlocksPerRequest {
+		heights = heights[:maxBlocksPerRequest]
+	}
+
+	resp := Blocks{RequestID: req.RequestID, Blocks: []blockchain.Block{}}
+	for _, height := range heights {
+		block, err := n.chain.GetBlockByIndex(height)
+		if err != nil {
+			continue
+		}
+		resp.Blocks = append(resp.Blocks, block)
+	}
+
+	if msg, err := newMessage(MsgBlocks, resp); err == nil {
+		p.Send(msg)
+	}
+}
@@ -0,0 +1,65 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"usdtg-chain/blockchain"
+)
+
+// TestSyncOverLoopback catches up two empty nodes with a node that mined
+// several chunks of blocks; the second can download from both of the others
+func TestSyncOverLoopback(t *testing.T) {
+	const height = 3*syncBlocksPerChunk + 5
+
+	chainA := blockchain.NewBlockchain()
+	defer chainA.Close()
+	mineBlocks(t, chainA, height)
+	a := startTestNode(t, chainA, nil)
+	defer a.Stop()
+
+	chainB := blockchain.NewBlockchain()
+	defer chainB.Close()
+	b := startTestNode(t, chainB, func(cfg *Config) { cfg.Peers = []string{a.Addr()} })
+	defer b.Stop()
+	waitFor(t, 20*time.Second, "b to sync", func() bool { return chainB.Height() == height })
+
+	chainC := blockchain.NewBlockchain()
+	defer chainC.Close()
+	c := startTestNode(t, chainC, func(cfg *Config) { cfg.Peers = []string{a.Addr(), b.Addr()} })
+	defer c.Stop()
+	waitFor(t, 20*time.Second, "c to sync", func() bool { return chainC.Height() == height })
+
+	for i := 0; i <= height; i++ {
+		want, err := chainA.GetBlockByIndex(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, chain := range map[string]*blockchain.Blockchain{"b": chainB, "c": chainC} {
+			got, err := chain.GetBlockByIndex(i)
+			if err != nil {
+				t.Fatalf("%s: block %d: %v", name, i, err)
+			}
+			if got.Hash != want.Hash {
+				t.Fatalf("%s: block %d hash %s, want %s", name, i, got.Hash, want.Hash)
+			}
+		}
+	}
+	if got, want := chainC.GetBalance(testMiner)[blockchain.NativeToken], float64(height)*chainA.MiningReward; got != want {
+		t.Fatalf("miner balance %v at c, want %v", got, want)
+	}
+
+	waitFor(t, 5*time.Second, "the sync to finish", func() bool { return !c.SyncStatus().Syncing })
+	status := c.SyncStatus()
+	if status.CurrentHeight != height || status.TargetHeight != height || status.LastError != "" {
+		t.Fatalf("sync status %+v", status)
+	}
+
+	// Blocks mined after the sync arrive by gossip
+	block, err := chainA.MinePendingTransactions(testMiner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.BroadcastBlock(block)
+	waitFor(t, 5*time.Second, "the new block to reach c", func() bool { return chainC.Height() == height+1 })
+}
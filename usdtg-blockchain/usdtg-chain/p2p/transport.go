@@ -0,0 +1,219 @@
+package p2p
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Connections are encrypted with TLS 1.3. Each node holds a long-lived
+// ed25519 identity key and presents a self-signed certificate for it; both
+// sides must present one. The node ID is derived from the public key, so a
+// completed handshake proves that the remote side owns the ID it claims.
+
+var (
+	errNotAllowed     = errors.New("p2p: node is not on the allowlist")
+	errBadIdentity    = errors.New("p2p: invalid identity certificate")
+	errIDMismatch     = errors.New("p2p: node id does not match its key")
+	errNoPeerCert     = errors.New("p2p: peer presented no certificate")
+	errInvalidNodeKey = errors.New("p2p: invalid node key file")
+)
+
+// NodeKey is the identity key of a node
+type NodeKey struct {
+	PrivateKey ed25519.PrivateKey
+}
+
+// nodeKeyFile is the on-disk form of a NodeKey
+type nodeKeyFile struct {
+	PrivateKey string `json:"private_key"`
+}
+
+// GenerateNodeKey creates a new random identity key
+func GenerateNodeKey() (*NodeKey, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &NodeKey{PrivateKey: priv}, nil
+}
+
+// LoadOrCreateNodeKey reads the identity key from path, creating it on
+// first start. An empty path returns a new key that is not saved.
+func LoadOrCreateNodeKey(path string) (*NodeKey, error) {
+	if path == "" {
+		return GenerateNodeKey()
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := GenerateNodeKey()
+		if err != nil {
+			return nil, err
+		}
+		return key, key.Save(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file nodeKeyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidNodeKey, err)
+	}
+	seed, err := hex.DecodeString(file.PrivateKey)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errInvalidNodeKey
+	}
+	return &NodeKey{PrivateKey: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// Save writes the key to path, readable only by the owner
+func (k *NodeKey) Save(path string) error {
+	data, err := json.MarshalIndent(nodeKeyFile{PrivateKey: hex.EncodeToString(k.PrivateKey.Seed())}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// ID returns the node ID derived from the public key
+func (k *NodeKey) ID() string {
+	return NodeIDFromPublicKey(k.PrivateKey.Public().(ed25519.PublicKey))
+}
+
+// NodeIDFromPublicKey returns the hex encoded first 20 bytes of the
+// SHA-256 hash of an identity public key
+func NodeIDFromPublicKey(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:20])
+}
+
+// validNodeID reports whether id looks like a node ID
+func validNodeID(id string) bool {
+	b, err := hex.DecodeString(id)
+	return err == nil && len(b) == 20
+}
+
+// certificate creates a self-signed TLS certificate for the key
+func (k *NodeKey) certificate() (tls.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: k.ID()},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, k.PrivateKey.Public(), k.PrivateKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: k.PrivateKey}, nil
+}
+
+// peerIDFromCerts checks that the remote certificate is a self-signed
+// ed25519 identity certificate and returns the node ID it proves
+func peerIDFromCerts(rawCerts [][]byte) (string, error) {
+	if len(rawCerts) == 0 {
+		return "", errNoPeerCert
+	}
+
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errBadIdentity, err)
+	}
+	pub, ok := cert.PublicKey.(ed25519.PublicKey)
+	if !ok {
+		return "", errBadIdentity
+	}
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		return "", fmt.Errorf("%w: %v", errBadIdentity, err)
+	}
+	return NodeIDFromPublicKey(pub), nil
+}
+
+// tlsConfig returns the TLS configuration used for both directions.
+// Certificates are not checked against a CA; instead the remote node ID is
+// derived from the certificate key and passed to n.checkIdentity.
+func (n *Node) tlsConfig() *tls.Config {
+	return &tls.Config{
+		Certificates:       []tls.Certificate{n.cert},
+		MinVersion:         tls.VersionTLS13,
+		ClientAuth:         tls.RequireAnyClientCert,
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			id, err := peerIDFromCerts(rawCerts)
+			if err != nil {
+				return err
+			}
+			return n.checkIdentity(id)
+		},
+	}
+}
+
+// checkIdentity rejects our own ID and, in allowlist mode, any node that
+// is not listed
+func (n *Node) checkIdentity(id string) error {
+	if id == n.id {
+		return errSelfConnection
+	}
+	if len(n.cfg.Allowlist) == 0 {
+		return nil
+	}
+	for _, allowed := range n.cfg.Allowlist {
+		if allowed == id {
+			return nil
+		}
+	}
+	return errNotAllowed
+}
+
+// secure runs the TLS handshake on conn and returns the encrypted
+// connection and the authenticated remote node ID
+func (n *Node) secure(conn net.Conn, dir Direction) (net.Conn, string, error) {
+	var tconn *tls.Conn
+	if dir == Outbound {
+		tconn = tls.Client(conn, n.tlsConfig())
+	} else {
+		tconn = tls.Server(conn, n.tlsConfig())
+	}
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if err := tconn.Handshake(); err != nil {
+		return nil, "", err
+	}
+
+	state := tconn.ConnectionState()
+	certs := make([][]byte, len(state.PeerCertificates))
+	for i, cert := range state.PeerCertificates {
+		certs[i] = cert.Raw
+	}
+	id, err := peerIDFromCerts(certs)
+	if err != nil {
+		return nil, "", err
+	}
+	return tconn, id, nil
+}
@@ -0,0 +1,153 @@
+package p2p
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"usdtg-chain/blockchain"
+)
+
+func TestPeerIDFromCerts(t *testing.T) {
+	key, err := GenerateNodeKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateNodeKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := key.certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := peerIDFromCerts(cert.Certificate); err != nil || id != key.ID() {
+		t.Fatalf("own certificate: got %s, %v, want %s", id, err, key.ID())
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: key.ID()},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	// A certificate for key's public key that other signed
+	forged, err := x509.CreateCertificate(rand.Reader, template, template, key.PrivateKey.Public(), other.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecCert, err := x509.CreateCertificate(rand.Reader, template, template, ecKey.Public(), ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		certs [][]byte
+		want  error
+	}{
+		{"no certificate", nil, errNoPeerCert},
+		{"garbage", [][]byte{{0x30, 0x03, 0x01, 0x02, 0x03}}, errBadIdentity},
+		{"signed by another key", [][]byte{forged}, errBadIdentity},
+		{"not an ed25519 key", [][]byte{ecCert}, errBadIdentity},
+	}
+	for _, tt := range tests {
+		if _, err := peerIDFromCerts(tt.certs); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	chainA, chainB, chainC := blockchain.NewBlockchain(), blockchain.NewBlockchain(), blockchain.NewBlockchain()
+	defer chainA.Close()
+	defer chainB.Close()
+	defer chainC.Close()
+	b := startTestNode(t, chainB, nil)
+	defer b.Stop()
+	c := startTestNode(t, chainC, nil)
+	defer c.Stop()
+	a := startTestNode(t, chainA, func(cfg *Config) { cfg.Allowlist = []string{b.ID()} })
+	defer a.Stop()
+
+	if err := c.Connect(a.Addr()); err == nil {
+		t.Fatal("a node off the allowlist connected in")
+	}
+	if err := a.Connect(c.Addr()); err == nil {
+		t.Fatal("connected out to a node off the allowlist")
+	}
+	if err := b.Connect(a.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, "the allowed peer to register", func() bool { return hasPeer(a, b.ID()) })
+	if hasPeer(a, c.ID()) || hasPeer(c, a.ID()) {
+		t.Fatal("a and c are peers")
+	}
+}
+
+// TestHelloMustMatchCertificate checks that a peer cannot claim another
+// node ID in its hello than the one its certificate proves
+func TestHelloMustMatchCertificate(t *testing.T) {
+	chain := blockchain.NewBlockchain()
+	defer chain.Close()
+	n := startTestNode(t, chain, nil)
+	defer n.Stop()
+
+	key, err := GenerateNodeKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	impersonated, err := GenerateNodeKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := key.certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := tls.Dial("tcp", n.Addr(), &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		MinVersion:         tls.VersionTLS13,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	msg, err := newMessage(MsgHello, Hello{
+		Version:     ProtocolVersion,
+		ChainID:     DefaultConfig().ChainID,
+		GenesisHash: chain.GenesisHash(),
+		NodeID:      impersonated.ID(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeMessage(conn, msg); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := readMessage(conn); err != nil || reply.Type != MsgHello {
+		t.Fatalf("hello reply: %+v, %v", reply, err)
+	}
+
+	// The node drops the connection without registering either ID
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := readMessage(conn); err == nil {
+		t.Fatal("connection kept open after a mismatched hello")
+	}
+	if hasPeer(n, key.ID()) || hasPeer(n, impersonated.ID()) {
+		t.Fatal("peer registered after a mismatched hello")
+	}
+}
@@ -0,0 +1,697 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"usdtg-chain/evm"
+
+	"github.com/gorilla/mux"
+)
+
+// Ethereum JSON-RPC 2.0 endpoint, so wallets such as MetaMask and tools
+// such as ethers.js can talk to the node. Quantities are 0x-prefixed hex
+// without leading zeros and data is 0x-prefixed hex, as in geth.
+
+// JSON-RPC error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+	rpcServerError    = -32000 // execution errors, as geth reports them
+	rpcRevertError    = 3      // reverted calls, with the revert data
+)
+
+// maxRPCBodySize caps the size of a request or batch
+const maxRPCBodySize = 5 << 20
+
+// maxRPCBatchSize caps the number of calls in a batch
+const maxRPCBatchSize = 100
+
+// registerRPCRoutes adds the JSON-RPC endpoint to the router
+func registerRPCRoutes(r *mux.Router) {
+	r.HandleFunc("/rpc", rpcHandler).Methods("POST", "OPTIONS")
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+func invalidParams(format string, args ...interface{}) *rpcError {
+	return &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf(format, args...)}
+}
+
+// rpcMethod handles one method; a returned *rpcError is passed to the
+// client as is, any other error becomes a server error
+type rpcMethod func(params json.RawMessage) (interface{}, error)
+
+var rpcMethods map[string]rpcMethod
+
+func init() {
+	rpcMethods = map[string]rpcMethod{
+		"eth_chainId":               rpcChainID,
+		"net_version":               rpcNetVersion,
+		"eth_blockNumber":           rpcBlockNumber,
+		"eth_getBalance":            rpcGetBalance,
+		"eth_getTransactionCount":   rpcGetTransactionCount,
+		"eth_getCode":               rpcGetCode,
+		"eth_getStorageAt":          rpcGetStorageAt,
+		"eth_getTransactionReceipt": rpcGetTransactionReceipt,
+		"eth_getLogs":               rpcGetLogs,
+		"eth_sendRawTransaction":    rpcSendRawTransaction,
+		"eth_call":                  rpcCall,
+		"eth_estimateGas":           rpcEstimateGas,
+	}
+}
+
+// rpcHandler serves single calls and batches. Notifications, calls
+// without an id, get no response; a batch of only notifications gets an
+// empty body.
+func rpcHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRPCBodySize+1))
+	if err != nil || len(body) > maxRPCBodySize {
+		json.NewEncoder(w).Encode(rpcErrorResponse(nil, &rpcError{Code: rpcInvalidRequest, Message: "request too large or unreadable"}))
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			json.NewEncoder(w).Encode(rpcErrorResponse(nil, &rpcError{Code: rpcParseError, Message: err.Error()}))
+			return
+		}
+		if len(batch) == 0 {
+			json.NewEncoder(w).Encode(rpcErrorResponse(nil, &rpcError{Code: rpcInvalidRequest, Message: "empty batch"}))
+			return
+		}
+		if len(batch) > maxRPCBatchSize {
+			json.NewEncoder(w).Encode(rpcErrorResponse(nil, &rpcError{Code: rpcInvalidRequest, Message: fmt.Sprintf("batch of %d calls exceeds %d", len(batch), maxRPCBatchSize)}))
+			return
+		}
+		responses := []*rpcResponse{}
+		for _, raw := range batch {
+			if resp := handleRPCCall(raw); resp != nil {
+				responses = append(responses, resp)
+			}
+		}
+		if len(responses) > 0 {
+			json.NewEncoder(w).Encode(responses)
+		}
+		return
+	}
+
+	if resp := handleRPCCall(body); resp != nil {
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// handleRPCCall runs one call, returning nil for notifications
+func handleRPCCall(raw json.RawMessage) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		if _, ok := err.(*json.SyntaxError); ok {
+			return rpcErrorResponse(nil, &rpcError{Code: rpcParseError, Message: err.Error()})
+		}
+		return rpcErrorResponse(nil, &rpcError{Code: rpcInvalidRequest, Message: err.Error()})
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcErrorResponse(req.ID, &rpcError{Code: rpcInvalidRequest, Message: `invalid request: expected "jsonrpc": "2.0" and a method`})
+	}
+
+	method, ok := rpcMethods[req.Method]
+	var result interface{}
+	var err error
+	if !ok {
+		err = &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("the method %s does not exist/is not available", req.Method)}
+	} else {
+		result, err = method(req.Params)
+	}
+	if req.ID == nil {
+		return nil
+	}
+
+	if err != nil {
+		rerr, ok := err.(*rpcError)
+		if !ok {
+			rerr = &rpcError{Code: rpcServerError, Message: err.Error()}
+		}
+		return rpcErrorResponse(req.ID, rerr)
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return rpcErrorResponse(req.ID, &rpcError{Code: rpcInternalError, Message: err.Error()})
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: encoded}
+}
+
+func rpcErrorResponse(id json.RawMessage, err *rpcError) *rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: id, Error: err}
+}
+
+// parseParams decodes positional parameters into args. The first
+// required ones must be present; the rest may be omitted.
+func parseParams(params json.RawMessage, required int, args ...interface{}) error {
+	var raw []json.RawMessage
+	if len(params) > 0 && string(params) != "null" {
+		if err := json.Unmarshal(params, &raw); err != nil {
+			return invalidParams("non-array params")
+		}
+	}
+	if len(raw) < required {
+		return invalidParams("missing value for required argument %d", len(raw))
+	}
+	if len(raw) > len(args) {
+		return invalidParams("too many arguments, want at most %d", len(args))
+	}
+	for i, param := range raw {
+		if err := json.Unmarshal(param, args[i]); err != nil {
+			return invalidParams("invalid argument %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// hexUint64 is a quantity encoded as 0x-prefixed hex
+type hexUint64 uint64
+
+func (q hexUint64) MarshalText() ([]byte, error) {
+	return []byte("0x" + strconv.FormatUint(uint64(q), 16)), nil
+}
+
+func (q *hexUint64) UnmarshalText(text []byte) error {
+	n, err := parseQuantity(string(text))
+	if err != nil {
+		return err
+	}
+	if !n.IsUint64() {
+		return fmt.Errorf("quantity %s does not fit in 64 bits", text)
+	}
+	*q = hexUint64(n.Uint64())
+	return nil
+}
+
+// hexBig is a 256-bit quantity encoded as 0x-prefixed hex
+type hexBig big.Int
+
+func (q *hexBig) MarshalText() ([]byte, error) {
+	return []byte("0x" + (*big.Int)(q).Text(16)), nil
+}
+
+func (q *hexBig) UnmarshalText(text []byte) error {
+	n, err := parseQuantity(string(text))
+	if err != nil {
+		return err
+	}
+	if n.BitLen() > 256 {
+		return fmt.Errorf("quantity %s exceeds 256 bits", text)
+	}
+	*q = hexBig(*n)
+	return nil
+}
+
+func (q *hexBig) toBig() *big.Int {
+	if q == nil {
+		return nil
+	}
+	return new(big.Int).Set((*big.Int)(q))
+}
+
+// parseQuantity parses a 0x-prefixed hex quantity
+func parseQuantity(s string) (*big.Int, error) {
+	if !strings.HasPrefix(s, "0x") || len(s) == 2 {
+		return nil, fmt.Errorf("invalid quantity %q: expected 0x-prefixed hex", s)
+	}
+	n, ok := new(big.Int).SetString(s[2:], 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid quantity %q", s)
+	}
+	return n, nil
+}
+
+// rpcBlockTag is a block number or one of the tags latest, pending, safe,
+// finalized and earliest
+type rpcBlockTag string
+
+// number resolves the tag to a block number, or to nil for the pending
+// block, which runs on the latest state
+func (t rpcBlockTag) number() (*uint64, error) {
+	var number uint64
+	switch t {
+	case "pending":
+		return nil, nil
+	case "", "latest", "safe", "finalized":
+		number = evmInstance.BlockNumber()
+	case "earliest":
+	default:
+		n, err := parseQuantity(string(t))
+		if err != nil || !n.IsUint64() {
+			return nil, invalidParams("invalid block number or tag %q", string(t))
+		}
+		number = n.Uint64()
+	}
+	return &number, nil
+}
+
+func rpcChainID(params json.RawMessage) (interface{}, error) {
+	return (*hexBig)(evmInstance.ChainID), nil
+}
+
+func rpcNetVersion(params json.RawMessage) (interface{}, error) {
+	return evmInstance.ChainID.String(), nil
+}
+
+func rpcBlockNumber(params json.RawMessage) (interface{}, error) {
+	return hexUint64(evmInstance.BlockNumber()), nil
+}
+
+// rpcAccountAt returns an account at the block of tag, nil if it does
+// not exist. The block number is resolved once, so a block imported
+// meanwhile does not change which state is read.
+func rpcAccountAt(address evm.Address, tag rpcBlockTag) (*evm.Account, error) {
+	number, err := tag.number()
+	if err != nil {
+		return nil, err
+	}
+	return evmInstance.AccountAt(address, number)
+}
+
+func rpcGetBalance(params json.RawMessage) (interface{}, error) {
+	var address evm.Address
+	var tag rpcBlockTag
+	if err := parseParams(params, 1, &address, &tag); err != nil {
+		return nil, err
+	}
+	account, err := rpcAccountAt(address, tag)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return (*hexBig)(new(big.Int)), nil
+	}
+	return (*hexBig)(account.Balance), nil
+}
+
+func rpcGetTransactionCount(params json.RawMessage) (interface{}, error) {
+	var address evm.Address
+	var tag rpcBlockTag
+	if err := parseParams(params, 1, &address, &tag); err != nil {
+		return nil, err
+	}
+	// Wallets ask for the pending count to number their next transaction
+	if tag == "pending" {
+		return hexUint64(bc.PendingNonce(address)), nil
+	}
+	account, err := rpcAccountAt(address, tag)
+	if err != nil {
+		return nil, err
+	}
+	var nonce uint64
+	if account != nil {
+		nonce = account.Nonce
+	}
+	return hexUint64(nonce), nil
+}
+
+func rpcGetCode(params json.RawMessage) (interface{}, error) {
+	var address evm.Address
+	var tag rpcBlockTag
+	if err := parseParams(params, 1, &address, &tag); err != nil {
+		return nil, err
+	}
+	account, err := rpcAccountAt(address, tag)
+	if err != nil {
+		return nil, err
+	}
+	code := evm.Bytes{}
+	if account != nil {
+		code = account.Code
+	}
+	return code, nil
+}
+
+func rpcGetStorageAt(params json.RawMessage) (interface{}, error) {
+	var address evm.Address
+	var slot hexBig
+	var tag rpcBlockTag
+	if err := parseParams(params, 2, &address, &slot, &tag); err != nil {
+		return nil, err
+	}
+	number, err := tag.number()
+	if err != nil {
+		return nil, err
+	}
+	value, err := evmInstance.StorageAt(address, evm.BigToHash((*big.Int)(&slot)), number)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// rpcLog is a log in the JSON-RPC format
+type rpcLog struct {
+	Address     evm.Address `json:"address"`
+	Topics      []evm.Hash  `json:"topics"`
+	Data        evm.Bytes   `json:"data"`
+	BlockNumber hexUint64   `json:"blockNumber"`
+	BlockHash   evm.Hash    `json:"blockHash"`
+	TxHash      evm.Hash    `json:"transactionHash"`
+	TxIndex     hexUint64   `json:"transactionIndex"`
+	Index       hexUint64   `json:"logIndex"`
+	Removed     bool        `json:"removed"`
+}
+
+func newRPCLog(log *evm.Log) (*rpcLog, error) {
+	blockHash, err := rpcBlockHash(log.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	return &rpcLog{
+		Address:     log.Address,
+		Topics:      log.Topics,
+		Data:        log.Data,
+		BlockNumber: hexUint64(log.BlockNumber),
+		BlockHash:   blockHash,
+		TxHash:      log.TxHash,
+		TxIndex:     hexUint64(log.TxIndex),
+		Index:       hexUint64(log.Index),
+	}, nil
+}
+
+// rpcBlockHash returns the hash of the native block with the given
+// number. Only its header is read, which is kept after the block body is
+// pruned.
+func rpcBlockHash(number uint64) (evm.Hash, error) {
+	header, err := bc.GetBlockHeader(int(number))
+	if err != nil {
+		return evm.Hash{}, fmt.Errorf("block %d: %w", number, err)
+	}
+	var hash evm.Hash
+	if err := hash.UnmarshalText([]byte("0x" + header.Hash)); err != nil {
+		return evm.Hash{}, fmt.Errorf("block %d: invalid hash %q: %w", number, header.Hash, err)
+	}
+	return hash, nil
+}
+
+// rpcReceipt is a transaction receipt in the JSON-RPC format
+type rpcReceipt struct {
+	TxHash            evm.Hash     `json:"transactionHash"`
+	TxIndex           hexUint64    `json:"transactionIndex"`
+	BlockHash         evm.Hash     `json:"blockHash"`
+	BlockNumber       hexUint64    `json:"blockNumber"`
+	From              evm.Address  `json:"from"`
+	To                *evm.Address `json:"to"`
+	ContractAddress   *evm.Address `json:"contractAddress"`
+	CumulativeGasUsed hexUint64    `json:"cumulativeGasUsed"`
+	GasUsed           hexUint64    `json:"gasUsed"`
+	EffectiveGasPrice *hexBig      `json:"effectiveGasPrice"`
+	Logs              []*rpcLog    `json:"logs"`
+	Bloom             evm.Bloom    `json:"logsBloom"`
+	Status            hexUint64    `json:"status"`
+	Type              hexUint64    `json:"type"`
+}
+
+func rpcGetTransactionReceipt(params json.RawMessage) (interface{}, error) {
+	var hash evm.Hash
+	if err := parseParams(params, 1, &hash); err != nil {
+		return nil, err
+	}
+	receipt := evmInstance.GetReceipt(hash)
+	if receipt == nil {
+		return nil, nil
+	}
+
+	blockHash, err := rpcBlockHash(receipt.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	logs := make([]*rpcLog, len(receipt.Logs))
+	for i, log := range receipt.Logs {
+		if logs[i], err = newRPCLog(log); err != nil {
+			return nil, err
+		}
+	}
+	return &rpcReceipt{
+		TxHash:            receipt.TxHash,
+		TxIndex:           hexUint64(receipt.TxIndex),
+		BlockHash:         blockHash,
+		BlockNumber:       hexUint64(receipt.BlockNumber),
+		From:              receipt.From,
+		To:                receipt.To,
+		ContractAddress:   receipt.ContractAddress,
+		CumulativeGasUsed: hexUint64(receipt.CumulativeGasUsed),
+		GasUsed:           hexUint64(receipt.GasUsed),
+		EffectiveGasPrice: (*hexBig)(receipt.EffectiveGasPrice),
+		Logs:              logs,
+		Bloom:             receipt.Bloom,
+		Status:            hexUint64(receipt.Status),
+		Type:              hexUint64(receipt.Type),
+	}, nil
+}
+
+// rpcFilter is the eth_getLogs filter object. address is one address or a
+// list; each topic is null, one hash or a list of hashes.
+type rpcFilter struct {
+	FromBlock rpcBlockTag       `json:"fromBlock"`
+	ToBlock   rpcBlockTag       `json:"toBlock"`
+	Address   json.RawMessage   `json:"address"`
+	Topics    []json.RawMessage `json:"topics"`
+}
+
+// query converts the filter to an evm.FilterQuery
+func (f *rpcFilter) query() (evm.FilterQuery, error) {
+	var q evm.FilterQuery
+	from, err := f.FromBlock.number()
+	if err != nil {
+		return q, err
+	}
+	to, err := f.ToBlock.number()
+	if err != nil {
+		return q, err
+	}
+	// The pending block has no logs yet, so it ends at the latest one
+	q.FromBlock, q.ToBlock = from, to
+
+	if len(f.Address) > 0 && string(f.Address) != "null" {
+		var addr evm.Address
+		if err := json.Unmarshal(f.Address, &addr); err == nil {
+			q.Addresses = []evm.Address{addr}
+		} else if err := json.Unmarshal(f.Address, &q.Addresses); err != nil {
+			return q, invalidParams("invalid address filter: %v", err)
+		}
+	}
+
+	for i, raw := range f.Topics {
+		var options []evm.Hash
+		if len(raw) > 0 && string(raw) != "null" {
+			var topic evm.Hash
+			if err := json.Unmarshal(raw, &topic); err == nil {
+				options = []evm.Hash{topic}
+			} else if err := json.Unmarshal(raw, &options); err != nil {
+				return q, invalidParams("invalid topic filter %d: %v", i, err)
+			}
+		}
+		q.Topics = append(q.Topics, options)
+	}
+	return q, nil
+}
+
+func rpcGetLogs(params json.RawMessage) (interface{}, error) {
+	var filter rpcFilter
+	if err := parseParams(params, 1, &filter); err != nil {
+		return nil, err
+	}
+	q, err := filter.query()
+	if err != nil {
+		return nil, err
+	}
+	logs, err := evmInstance.FilterLogs(q)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*rpcLog, len(logs))
+	for i, log := range logs {
+		if result[i], err = newRPCLog(log); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// rpcSendRawTransaction adds a signed transaction to the mempool and
+// returns its hash. It has a receipt once a block includes it; one that
+// runs but fails is still included, with status 0.
+func rpcSendRawTransaction(params json.RawMessage) (interface{}, error) {
+	var raw evm.Bytes
+	if err := parseParams(params, 1, &raw); err != nil {
+		return nil, err
+	}
+	tx, err := evm.DecodeTransaction(raw)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := submitEVMTransaction(tx); err != nil {
+		return nil, err
+	}
+	return tx.Hash, nil
+}
+
+// rpcCallArgs is the transaction object of eth_call and eth_estimateGas.
+// input is the newer name of data; when both are given they must match.
+type rpcCallArgs struct {
+	From                 *evm.Address  `json:"from"`
+	To                   *evm.Address  `json:"to"`
+	Gas                  *hexUint64    `json:"gas"`
+	GasPrice             *hexBig       `json:"gasPrice"`
+	MaxFeePerGas         *hexBig       `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexBig       `json:"maxPriorityFeePerGas"`
+	Value                *hexBig       `json:"value"`
+	Data                 *evm.Bytes    `json:"data"`
+	Input                *evm.Bytes    `json:"input"`
+	AccessList           rpcAccessList `json:"accessList"`
+}
+
+// rpcAccessList is an EIP-2930 access list in the JSON-RPC format
+type rpcAccessList []struct {
+	Address     evm.Address `json:"address"`
+	StorageKeys []evm.Hash  `json:"storageKeys"`
+}
+
+func (al rpcAccessList) toAccessList() evm.AccessList {
+	if al == nil {
+		return nil
+	}
+	list := make(evm.AccessList, len(al))
+	for i, tuple := range al {
+		list[i] = evm.AccessTuple{Address: tuple.Address, StorageKeys: tuple.StorageKeys}
+	}
+	return list
+}
+
+// msg converts the arguments to a call message. Calls pay no fee unless a
+// price is given; a fee cap stands in for the gas price.
+func (args *rpcCallArgs) msg() (evm.CallMsg, error) {
+	var msg evm.CallMsg
+	if args.From != nil {
+		msg.From = *args.From
+	}
+	msg.To = args.To
+	if args.Gas != nil {
+		msg.Gas = uint64(*args.Gas)
+	}
+	msg.GasPrice = args.GasPrice.toBig()
+	if msg.GasPrice == nil {
+		msg.GasPrice = args.MaxFeePerGas.toBig()
+	}
+	msg.Value = args.Value.toBig()
+	if args.Data != nil && args.Input != nil && !bytes.Equal(*args.Data, *args.Input) {
+		return msg, invalidParams(`both "data" and "input" are set and not equal`)
+	}
+	if args.Input != nil {
+		msg.Data = *args.Input
+	} else if args.Data != nil {
+		msg.Data = *args.Data
+	}
+	msg.AccessList = args.AccessList.toAccessList()
+	return msg, nil
+}
+
+// rpcExecutionError reports a failed call: reverts as code 3 with the
+// revert data, as geth does, other failures as server errors
+func rpcExecutionError(result *evm.TransactionResult) error {
+	if result.Revert != nil {
+		return revertRPCError(result.Revert)
+	}
+	return &rpcError{Code: rpcServerError, Message: result.Error}
+}
+
+// revertRPCError reports a revert with its decoded reason and data
+func revertRPCError(revert *evm.RevertError) *rpcError {
+	return &rpcError{Code: rpcRevertError, Message: revert.Error(), Data: revert.Data}
+}
+
+func rpcCall(params json.RawMessage) (interface{}, error) {
+	var args rpcCallArgs
+	var tag rpcBlockTag
+	if err := parseParams(params, 1, &args, &tag); err != nil {
+		return nil, err
+	}
+	msg, err := args.msg()
+	if err != nil {
+		return nil, err
+	}
+	number, err := tag.number()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := evmInstance.Call(msg, number)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Success {
+		return nil, rpcExecutionError(result)
+	}
+	return evm.Bytes(result.Return), nil
+}
+
+func rpcEstimateGas(params json.RawMessage) (interface{}, error) {
+	var args rpcCallArgs
+	var tag rpcBlockTag
+	if err := parseParams(params, 1, &args, &tag); err != nil {
+		return nil, err
+	}
+	msg, err := args.msg()
+	if err != nil {
+		return nil, err
+	}
+	number, err := tag.number()
+	if err != nil {
+		return nil, err
+	}
+
+	gas, err := evmInstance.EstimateGas(msg, number)
+	var revert *evm.RevertError
+	if errors.As(err, &revert) {
+		return nil, revertRPCError(revert)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hexUint64(gas), nil
+}
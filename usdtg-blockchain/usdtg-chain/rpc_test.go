@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"usdtg-chain/blockchain"
+	"usdtg-chain/evm"
+)
+
+const testMiner = "0x00000000000000000000000000000000000000aa"
+
+// startTestChain sets up bc and evmInstance as the server does in dev
+// mode, with the given pruning
+func startTestChain(t *testing.T, pruning blockchain.PruningConfig) {
+	t.Helper()
+	evmInstance = evm.NewEVM()
+	evmInstance.AllowUnsigned = true
+	cfg := blockchain.DefaultConfig()
+	cfg.EVM = evmInstance
+	cfg.Pruning = pruning
+	chain, err := blockchain.NewBlockchainWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc = chain
+	t.Cleanup(func() {
+		chain.Close()
+		bc, evmInstance = nil, nil
+	})
+}
+
+// submitAndMine submits an unsigned transaction and mines it in a block
+func submitAndMine(t *testing.T, tx *evm.EVMTransaction) {
+	t.Helper()
+	if _, err := bc.SubmitEVMTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.MinePendingTransactions(testMiner); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rpcPost posts body to the JSON-RPC endpoint and returns the response body
+func rpcPost(body string) string {
+	req := httptest.NewRequest("POST", "/rpc", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	rpcHandler(w, req)
+	return w.Body.String()
+}
+
+// rpcCallMethod calls method with params and decodes the response
+func rpcCallMethod(t *testing.T, method string, params ...interface{}) rpcResponse {
+	t.Helper()
+	encoded, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp rpcResponse
+	if err := json.Unmarshal([]byte(rpcPost(string(encoded))), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// rpcResult calls method and decodes its result into v, failing on errors
+func rpcResult(t *testing.T, v interface{}, method string, params ...interface{}) {
+	t.Helper()
+	resp := rpcCallMethod(t, method, params...)
+	if resp.Error != nil {
+		t.Fatalf("%s: %s", method, resp.Error.Message)
+	}
+	if err := json.Unmarshal(resp.Result, v); err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+}
+
+func TestReceiptOfPrunedBlock(t *testing.T) {
+	startTestChain(t, blockchain.PruningConfig{Mode: blockchain.PruningRecent, KeepRecent: 1})
+
+	// Init code logging one word with topic 1
+	code := []byte{byte(evm.PUSH1), 1, byte(evm.PUSH1), 0, byte(evm.PUSH1), 0, byte(evm.LOG0 + 1), byte(evm.STOP)}
+	tx := &evm.EVMTransaction{Value: new(big.Int), Data: code, Gas: 100_000, GasPrice: new(big.Int)}
+	submitAndMine(t, tx)
+	for i := 0; i < 2; i++ {
+		if _, err := bc.MinePendingTransactions(testMiner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bc.IsPruned(1) {
+		t.Fatal("block 1 was not pruned")
+	}
+	header, err := bc.GetBlockHeader(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "0x" + header.Hash
+
+	var receipt struct {
+		BlockHash string `json:"blockHash"`
+		Logs      []struct {
+			BlockHash string `json:"blockHash"`
+		} `json:"logs"`
+	}
+	rpcResult(t, &receipt, "eth_getTransactionReceipt", tx.Hash)
+	if receipt.BlockHash != want {
+		t.Fatalf("receipt block hash %s, want %s", receipt.BlockHash, want)
+	}
+	if len(receipt.Logs) != 1 || receipt.Logs[0].BlockHash != want {
+		t.Fatalf("receipt logs %+v, want one in block %s", receipt.Logs, want)
+	}
+}
+
+func TestStateMethodsAtEarlierBlocks(t *testing.T) {
+	startTestChain(t, blockchain.PruningConfig{})
+
+	// Init code storing 42 in slot 7 and deploying one STOP
+	sender := evm.BytesToAddress([]byte{0x5e, 0x4d})
+	code := []byte{
+		byte(evm.PUSH1), 42, byte(evm.PUSH1), 7, byte(evm.SSTORE),
+		byte(evm.PUSH1), 1, byte(evm.PUSH1), 0, byte(evm.RETURN),
+	}
+	tx := &evm.EVMTransaction{From: sender, Value: new(big.Int), Data: code, Gas: 100_000, GasPrice: new(big.Int)}
+	submitAndMine(t, tx)
+	contract := evm.CreateAddress(sender, 0).String()
+	if _, err := bc.MinePendingTransactions(testMiner); err != nil {
+		t.Fatal(err)
+	}
+	reward, err := blockchain.ToWei(bc.MiningReward)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method string
+		params []interface{}
+		want   string
+	}{
+		{"eth_getStorageAt", []interface{}{contract, "0x7", "0x0"}, "0x" + strings.Repeat("0", 64)},
+		{"eth_getStorageAt", []interface{}{contract, "0x7", "0x1"}, "0x" + strings.Repeat("0", 62) + "2a"},
+		{"eth_getStorageAt", []interface{}{contract, "0x7"}, "0x" + strings.Repeat("0", 62) + "2a"},
+		{"eth_getCode", []interface{}{contract, "earliest"}, "0x"},
+		{"eth_getCode", []interface{}{contract, "0x1"}, "0x00"},
+		{"eth_getTransactionCount", []interface{}{sender.String(), "0x0"}, "0x0"},
+		{"eth_getTransactionCount", []interface{}{sender.String(), "latest"}, "0x1"},
+		{"eth_getBalance", []interface{}{testMiner, "0x0"}, "0x0"},
+		{"eth_getBalance", []interface{}{testMiner, "0x1"}, "0x" + reward.Text(16)},
+	}
+	for _, tt := range tests {
+		var got string
+		rpcResult(t, &got, tt.method, tt.params...)
+		if got != tt.want {
+			t.Fatalf("%s%v = %s, want %s", tt.method, tt.params, got, tt.want)
+		}
+	}
+
+	// The state of the last StateHistory blocks is kept
+	for i := 0; i < evm.StateHistory; i++ {
+		if _, err := bc.MinePendingTransactions(testMiner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got string
+	if rpcResult(t, &got, "eth_getStorageAt", contract, "0x7", "0x2"); got != tests[1].want {
+		t.Fatalf("slot 7 at block 2 = %s", got)
+	}
+	if resp := rpcCallMethod(t, "eth_getStorageAt", contract, "0x7", "0x1"); resp.Error == nil || !strings.Contains(resp.Error.Message, "not available") {
+		t.Fatalf("state past the history: %+v", resp)
+	}
+	if resp := rpcCallMethod(t, "eth_getBalance", testMiner, "0xffff"); resp.Error == nil || !strings.Contains(resp.Error.Message, "future") {
+		t.Fatalf("state of a future block: %+v", resp)
+	}
+}
+
+func TestRPCBatch(t *testing.T) {
+	startTestChain(t, blockchain.PruningConfig{})
+
+	var responses []rpcResponse
+	body := rpcPost(`[
+		{"jsonrpc": "2.0", "id": 1, "method": "eth_chainId"},
+		{"jsonrpc": "2.0", "method": "eth_blockNumber"},
+		{"jsonrpc": "2.0", "id": "two", "method": "eth_nothing"},
+		{"id": 3, "method": "eth_chainId"},
+		{"jsonrpc": "2.0", "id": 4, "method": "eth_getBalance", "params": ["0xzz"]},
+		42
+	]`)
+	if err := json.Unmarshal([]byte(body), &responses); err != nil {
+		t.Fatalf("batch response %s: %v", body, err)
+	}
+	want := []struct {
+		id   string
+		code int
+	}{{"1", 0}, {`"two"`, rpcMethodNotFound}, {"3", rpcInvalidRequest}, {"4", rpcInvalidParams}, {"null", rpcInvalidRequest}}
+	if len(responses) != len(want) {
+		t.Fatalf("got %d responses, want %d: %s", len(responses), len(want), body)
+	}
+	for i, w := range want {
+		resp := responses[i]
+		code := 0
+		if resp.Error != nil {
+			code = resp.Error.Code
+		}
+		if string(resp.ID) != w.id || code != w.code {
+			t.Errorf("response %d: id %s, code %d, want id %s, code %d", i, resp.ID, code, w.id, w.code)
+		}
+	}
+	var chainID string
+	if err := json.Unmarshal(responses[0].Result, &chainID); err != nil || chainID != "0x"+evmInstance.ChainID.Text(16) {
+		t.Fatalf("chain id %s, %v", responses[0].Result, err)
+	}
+
+	// Notifications get no response at all
+	for _, body := range []string{
+		`{"jsonrpc": "2.0", "method": "eth_blockNumber"}`,
+		`[{"jsonrpc": "2.0", "method": "eth_blockNumber"}, {"jsonrpc": "2.0", "method": "eth_chainId"}]`,
+	} {
+		if got := rpcPost(body); got != "" {
+			t.Errorf("%s: response %s", body, got)
+		}
+	}
+
+	calls := make([]string, maxRPCBatchSize)
+	for i := range calls {
+		calls[i] = fmt.Sprintf(`{"jsonrpc": "2.0", "id": %d, "method": "eth_blockNumber"}`, i)
+	}
+	full := "[" + strings.Join(calls, ",") + "]"
+	if err := json.Unmarshal([]byte(rpcPost(full)), &responses); err != nil || len(responses) != maxRPCBatchSize {
+		t.Fatalf("full batch: %d responses, %v", len(responses), err)
+	}
+}
+
+func TestRPCRequestErrors(t *testing.T) {
+	startTestChain(t, blockchain.PruningConfig{})
+
+	calls := make([]string, maxRPCBatchSize+1)
+	for i := range calls {
+		calls[i] = `{"jsonrpc": "2.0", "id": 1, "method": "eth_blockNumber"}`
+	}
+	tests := []struct {
+		name string
+		body string
+		code int
+		msg  string
+	}{
+		{"malformed call", `{"jsonrpc": "2.0", "id": 1, "method"`, rpcParseError, ""},
+		{"malformed batch", `[{"jsonrpc": "2.0"`, rpcParseError, ""},
+		{"empty batch", `[]`, rpcInvalidRequest, "empty batch"},
+		{"oversized batch", "[" + strings.Join(calls, ",") + "]", rpcInvalidRequest, "exceeds 100"},
+		{"oversized body", `{"jsonrpc": "2.0", "id": 1, "method": "eth_chainId", "params": ["` + strings.Repeat("a", maxRPCBodySize) + `"]}`, rpcInvalidRequest, "too large"},
+		{"wrong version", `{"jsonrpc": "1.0", "id": 1, "method": "eth_chainId"}`, rpcInvalidRequest, ""},
+		{"unknown method", `{"jsonrpc": "2.0", "id": 1, "method": "eth_mining"}`, rpcMethodNotFound, "eth_mining"},
+		{"missing parameter", `{"jsonrpc": "2.0", "id": 1, "method": "eth_getBalance", "params": []}`, rpcInvalidParams, ""},
+	}
+	for _, tt := range tests {
+		var resp rpcResponse
+		if err := json.Unmarshal([]byte(rpcPost(tt.body)), &resp); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if resp.Error == nil || resp.Error.Code != tt.code || !strings.Contains(resp.Error.Message, tt.msg) {
+			t.Errorf("%s: error %+v, want code %d containing %q", tt.name, resp.Error, tt.code, tt.msg)
+		}
+	}
+}
+
+func TestRPCCall(t *testing.T) {
+	startTestChain(t, blockchain.PruningConfig{})
+
+	// Runtime code that reverts with its calldata, or returns slot 0 when
+	// there is none; the init code stores 42 there first
+	runtime := []byte{
+		byte(evm.CALLDATASIZE), byte(evm.ISZERO), byte(evm.PUSH1), 15, byte(evm.JUMPI),
+		byte(evm.CALLDATASIZE), byte(evm.PUSH1), 0, byte(evm.PUSH1), 0, byte(evm.CALLDATACOPY),
+		byte(evm.CALLDATASIZE), byte(evm.PUSH1), 0, byte(evm.REVERT),
+		byte(evm.JUMPDEST), byte(evm.PUSH1), 0, byte(evm.SLOAD), byte(evm.PUSH1), 0, byte(evm.MSTORE),
+		byte(evm.PUSH1), 32, byte(evm.PUSH1), 0, byte(evm.RETURN),
+	}
+	code := append([]byte{
+		byte(evm.PUSH1), 42, byte(evm.PUSH1), 0, byte(evm.SSTORE),
+		byte(evm.PUSH1), byte(len(runtime)), byte(evm.DUP1), byte(evm.PUSH1), 16, byte(evm.PUSH1), 0, byte(evm.CODECOPY),
+		byte(evm.PUSH1), 0, byte(evm.RETURN),
+	}, runtime...)
+	sender := evm.BytesToAddress([]byte{0x5e, 0x4d})
+	submitAndMine(t, &evm.EVMTransaction{From: sender, Value: new(big.Int), Data: code, Gas: 100_000, GasPrice: new(big.Int)})
+	contract := evm.CreateAddress(sender, 0).String()
+
+	slot := "0x" + strings.Repeat("0", 62) + "2a"
+	for _, tt := range []struct {
+		tag  string
+		want string
+	}{{"latest", slot}, {"0x1", slot}, {"earliest", "0x"}} {
+		var got string
+		if rpcResult(t, &got, "eth_call", map[string]string{"to": contract}, tt.tag); got != tt.want {
+			t.Errorf("eth_call at %s returned %s, want %s", tt.tag, got, tt.want)
+		}
+	}
+
+	// require(false, "not enough")
+	revert := "0x08c379a0" + strings.Repeat("0", 62) + "20" + strings.Repeat("0", 62) + "0a" + "6e6f7420656e6f756768" + strings.Repeat("0", 44)
+	resp := rpcCallMethod(t, "eth_call", map[string]string{"to": contract, "data": revert})
+	if resp.Error == nil || resp.Error.Code != rpcRevertError || resp.Error.Message != "execution reverted: not enough" || resp.Error.Data != revert {
+		t.Fatalf("reverted call: %+v", resp.Error)
+	}
+	if resp := rpcCallMethod(t, "eth_call", map[string]string{"to": contract}, "0x5"); resp.Error == nil || !strings.Contains(resp.Error.Message, "future") {
+		t.Fatalf("call at a future block: %+v", resp.Error)
+	}
+	if bc.Height() != 1 || evmInstance.GetNonce(sender) != 1 {
+		t.Fatal("eth_call changed the chain")
+	}
+}
@@ -4,10 +4,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"time"
 )
 
 func main() {
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
 	fmt.Println("🚀 Simple USDTg Blockchain Server")
 
 	// CORS handler